@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go-playground/pkg/database"
+	"go-playground/pkg/kafka"
 	"go-playground/server/bootstrap"
 	"go-playground/server/config"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	_ "go-playground/server/docs" // This is required for swagger
@@ -56,14 +64,21 @@ func main() {
 	// Initialize repositories
 	repos := bootstrap.InitializeRepositories(dbConn.RW, dbConn, rdb, cfg)
 
+	// Initialize Kafka
+	kafkaService := kafka.NewKafkaService(kafka.KafkaConfig{BrokerURLs: cfg.KafkaBrokerURLs})
+	defer kafkaService.Close()
+
 	// Initialize services
-	services := bootstrap.InitializeServices(repos)
+	services := bootstrap.InitializeServices(repos, kafkaService, kafkaService)
+
+	// Event listeners run until exit, requests drained on shutdown still reach them
+	services.StartEventListeners(context.Background())
 
 	// Initialize handlers
 	handlers := bootstrap.InitializeHandlers(services, dbConn.RW, dbConn.RR, rdb)
 
 	// Setup router
-	r := bootstrap.SetupRouter(handlers, repos.AuthRepo, repos.SessionRepo)
+	r := bootstrap.SetupRouter(handlers, repos.AuthRepo, repos.SessionRepo, repos.IdempotencyRepo, repos.MerchantCustomersRepo)
 
 	// Run migrations
 	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
@@ -75,18 +90,87 @@ func main() {
 	// Start Cleanup User Session
 	repos.SessionRepo.DeleteAllSession(rdb.Context())
 
+	// Stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers stop with ctx, main waits for their current run
+	var workers sync.WaitGroup
+
 	// Start cleanup goroutine
+	runEvery(ctx, &workers, 1*time.Hour, func(ctx context.Context) {
+		if err := repos.AuthRepo.CleanupExpiredAttempts(ctx); err != nil {
+			log.Printf("Failed to cleanup expired attempts: %v", err)
+		}
+	})
+
+	// Start points expiration worker
+	runEvery(ctx, &workers, 1*time.Hour, func(ctx context.Context) {
+		if _, err := services.PointsExpirationService.ExpirePoints(ctx, time.Now()); err != nil {
+			log.Printf("Failed to expire points: %v", err)
+		}
+	})
+
+	// Start outbox relay
+	runEvery(ctx, &workers, 1*time.Second, func(ctx context.Context) {
+		if _, err := services.OutboxRelayService.PublishPending(ctx); err != nil {
+			log.Printf("Failed to relay outbox events: %v", err)
+		}
+	})
+
+	// Start webhook dispatcher
+	runEvery(ctx, &workers, 5*time.Second, func(ctx context.Context) {
+		if _, err := services.WebhookService.DeliverDue(ctx); err != nil {
+			log.Printf("Failed to deliver webhooks: %v", err)
+		}
+	})
+
+	// Start transaction ingestion
+	ingestionDone := make(chan struct{})
 	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
+		defer close(ingestionDone)
+		if err := services.TransactionIngestionService.Run(ctx); err != nil {
+			log.Printf("Failed to run transaction ingestion: %v", err)
+		}
+	}()
+
+	// Start server
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down server: %v", err)
+	}
+	// Let the message being ingested and the workers' runs finish before
+	// closing Kafka and the database
+	<-ingestionDone
+	workers.Wait()
+}
+
+// runEvery runs fn every interval until ctx is done
+func runEvery(ctx context.Context, workers *sync.WaitGroup, interval time.Duration, fn func(ctx context.Context)) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			if err := repos.AuthRepo.CleanupExpiredAttempts(rdb.Context()); err != nil {
-				log.Printf("Failed to cleanup expired attempts: %v", err)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
 			}
 		}
 	}()
-
-	// Start server
-	r.Run(":8080")
 }
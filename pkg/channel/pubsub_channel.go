@@ -1,76 +1,275 @@
 package channel
 
 import (
+	"context"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// PubSub is the main structure for our simple pub-sub system.
-type PubSub struct {
-	// mu is a RWMutex that allows multiple goroutines to read from the subscribers map,
-	// but only one goroutine to write to it at any given time.
-	mu sync.RWMutex
+// Policy decides what happens to a message published to a subscriber whose
+// buffer is full.
+type Policy int
 
-	// subscribers is a map where the key is a topic (as a string) and the value is
-	// a slice of channels. Each channel corresponds to a subscriber listening to that topic.
-	subscribers map[string][]chan int
+const (
+	// DropOldest discards the oldest buffered message to make room.
+	DropOldest Policy = iota
+	// BlockWithTimeout makes Publish wait for room, up to the subscription's
+	// Timeout, then drops the message.
+	BlockWithTimeout
+	// Unbounded grows the buffer, nothing is ever dropped.
+	Unbounded
+)
+
+// DefaultBuffer is the buffer size of a subscription that does not set one
+const DefaultBuffer = 64
+
+// SubscribeOptions configures a subscription
+type SubscribeOptions struct {
+	Policy  Policy
+	Buffer  int           // messages buffered before the policy applies, DefaultBuffer when 0
+	Timeout time.Duration // how long BlockWithTimeout waits for room
+}
+
+// Message is a value published to a topic
+type Message[T any] struct {
+	Topic string
+	Value T
+}
+
+// Metrics counts the messages that went through a PubSub
+type Metrics struct {
+	Published uint64 // calls to Publish
+	Dropped   uint64 // messages a subscriber did not receive
 }
 
-// NewPubSub creates a new PubSub instance and initializes its subscribers map.
-func NewPubSub() *PubSub {
-	return &PubSub{
-		subscribers: make(map[string][]chan int),
+// PubSub is an in-process publish/subscribe bus carrying values of type T.
+//
+// Topics are dot separated, like "points.earned". A subscription pattern
+// matches topics segment by segment: "*" matches any one segment and a
+// trailing ">" matches one or more remaining segments, so "points.*" and
+// ">" both receive "points.earned".
+//
+// Every subscriber has its own buffer, a slow subscriber never holds up the
+// others beyond what its policy allows.
+type PubSub[T any] struct {
+	// mu guards subscribers, it is never held while delivering.
+	mu          sync.RWMutex
+	subscribers map[*Subscription[T]]struct{}
+
+	published atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// NewPubSub creates a new PubSub instance.
+func NewPubSub[T any]() *PubSub[T] {
+	return &PubSub[T]{
+		subscribers: make(map[*Subscription[T]]struct{}),
 	}
 }
 
-// Subscribe allows a subscriber to get updates for a specific topic.
-// It returns a channel on which the subscriber will receive these updates.
-func (ps *PubSub) Subscribe(topic string) <-chan int {
-	// Lock the map for writing.
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+// Subscription receives the messages published to the topics matching its
+// pattern. Its channel is closed once ctx is cancelled or Close is called.
+type Subscription[T any] struct {
+	ps      *PubSub[T]
+	pattern []string
+	opts    SubscribeOptions
+
+	mu     sync.Mutex
+	queue  []Message[T]
+	closed bool
+
+	ready   chan struct{} // a message was queued
+	space   chan struct{} // a message was taken off the queue
+	done    chan struct{} // the subscription was closed
+	once    sync.Once
+	out     chan Message[T]
+	dropped atomic.Uint64
+}
 
-	// Create a new channel for this subscriber.
-	ch := make(chan int, 1)
+// Subscribe starts a subscription to the topics matching pattern.
+func (ps *PubSub[T]) Subscribe(ctx context.Context, pattern string, opts SubscribeOptions) *Subscription[T] {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultBuffer
+	}
 
-	// Append this subscriber's channel to the slice of channels for the given topic.
-	ps.subscribers[topic] = append(ps.subscribers[topic], ch)
+	sub := &Subscription[T]{
+		ps:      ps,
+		pattern: splitTopic(pattern),
+		opts:    opts,
+		ready:   make(chan struct{}, 1),
+		space:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		out:     make(chan Message[T]),
+	}
 
-	// Return the channel to the subscriber.
-	return ch
+	ps.mu.Lock()
+	ps.subscribers[sub] = struct{}{}
+	ps.mu.Unlock()
+
+	go sub.deliver(ctx)
+	return sub
 }
 
-// Publish sends the given value to all subscribers of a specific topic.
-func (ps *PubSub) Publish(topic string, value int) {
-	// Lock the map for reading.
+// Publish sends the value to every subscription matching the topic. It only
+// waits for subscribers with the BlockWithTimeout policy, and not past ctx.
+func (ps *PubSub[T]) Publish(ctx context.Context, topic string, value T) {
+	ps.published.Add(1)
+
+	segments := splitTopic(topic)
 	ps.mu.RLock()
-	defer ps.mu.RUnlock()
+	matching := make([]*Subscription[T], 0, len(ps.subscribers))
+	for sub := range ps.subscribers {
+		if match(sub.pattern, segments) {
+			matching = append(matching, sub)
+		}
+	}
+	ps.mu.RUnlock()
 
-	// Iterate over all channels (subscribers) for this topic and send the value.
-	for _, subscriber := range ps.subscribers[topic] {
-		subscriber <- value
+	message := Message[T]{Topic: topic, Value: value}
+	for _, sub := range matching {
+		if !sub.offer(ctx, message) {
+			sub.dropped.Add(1)
+			ps.dropped.Add(1)
+		}
 	}
 }
 
-// Close removes a specific subscriber from a topic and closes its channel.
-func (ps *PubSub) Close(topic string, subCh <-chan int) {
-	// Lock the map for writing.
-	ps.mu.Lock()
-	defer ps.mu.Unlock()
+// Metrics returns the counts so far
+func (ps *PubSub[T]) Metrics() Metrics {
+	return Metrics{
+		Published: ps.published.Load(),
+		Dropped:   ps.dropped.Load(),
+	}
+}
 
-	// Find the subscriber's channel in the slice for the given topic.
-	subscribers, found := ps.subscribers[topic]
-	if !found {
-		return
+// C returns the channel messages are received on
+func (s *Subscription[T]) C() <-chan Message[T] {
+	return s.out
+}
+
+// Dropped returns how many messages this subscriber did not receive
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close ends the subscription. Messages still buffered are discarded.
+func (s *Subscription[T]) Close() {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.queue = nil
+		s.mu.Unlock()
+		close(s.done)
+
+		s.ps.mu.Lock()
+		delete(s.ps.subscribers, s)
+		s.ps.mu.Unlock()
+	})
+}
+
+// offer queues a message according to the subscription's policy. It reports
+// false when a message was dropped, the new one or the oldest buffered one.
+func (s *Subscription[T]) offer(ctx context.Context, message Message[T]) bool {
+	var timeout <-chan time.Time
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return false
+		}
+		if s.opts.Policy == Unbounded || len(s.queue) < s.opts.Buffer {
+			s.queue = append(s.queue, message)
+			s.mu.Unlock()
+			signal(s.ready)
+			return true
+		}
+		if s.opts.Policy == DropOldest {
+			var zero Message[T]
+			s.queue[0] = zero
+			s.queue = append(s.queue[1:], message)
+			s.mu.Unlock()
+			signal(s.ready)
+			return false
+		}
+		s.mu.Unlock()
+
+		// BlockWithTimeout, wait for the subscriber to take a message
+		if timeout == nil {
+			timer := time.NewTimer(s.opts.Timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-s.space:
+		case <-timeout:
+			return false
+		case <-ctx.Done():
+			return false
+		case <-s.done:
+			return false
+		}
 	}
+}
 
-	for i, subscriber := range subscribers {
-		if subscriber == subCh {
-			// Close the channel.
-			close(subscriber)
+// deliver moves queued messages to the subscriber's channel until the
+// subscription ends.
+func (s *Subscription[T]) deliver(ctx context.Context) {
+	defer close(s.out)
+	defer s.Close()
 
-			// Remove this channel from the slice.
-			ps.subscribers[topic] = append(subscribers[:i], subscribers[i+1:]...)
-			break
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.ready:
+				continue
+			case <-s.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+		var zero Message[T]
+		message := s.queue[0]
+		s.queue[0] = zero
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		signal(s.space)
+
+		select {
+		case s.out <- message:
+		case <-s.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// signal wakes up whoever waits on ch, without blocking when nobody does.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func splitTopic(topic string) []string {
+	return strings.Split(topic, ".")
+}
+
+// match reports whether the topic segments match the pattern segments.
+func match(pattern, topic []string) bool {
+	for i, segment := range pattern {
+		if segment == ">" && i == len(pattern)-1 {
+			return len(topic) > i
+		}
+		if i >= len(topic) || (segment != "*" && segment != topic[i]) {
+			return false
 		}
 	}
+	return len(pattern) == len(topic)
 }
@@ -0,0 +1,129 @@
+package channel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receive[T any](t *testing.T, sub *Subscription[T]) Message[T] {
+	t.Helper()
+	select {
+	case m := <-sub.C():
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return Message[T]{}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"points.earned", "points.earned", true},
+		{"points.earned", "points.redeemed", false},
+		{"points.*", "points.earned", true},
+		{"*.earned", "points.earned", true},
+		{"points.*", "points", false},
+		{"points.*", "points.earned.late", false},
+		{">", "points.earned", true},
+		{"points.>", "points.earned.late", true},
+		{"points.>", "points", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.pattern+" "+tc.topic, func(t *testing.T) {
+			assert.Equal(t, tc.want, match(splitTopic(tc.pattern), splitTopic(tc.topic)))
+		})
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("delivers to matching subscribers in order", func(t *testing.T) {
+		ps := NewPubSub[string]()
+		points := ps.Subscribe(ctx, "points.*", SubscribeOptions{})
+		all := ps.Subscribe(ctx, ">", SubscribeOptions{})
+		defer points.Close()
+		defer all.Close()
+
+		ps.Publish(ctx, "transaction.created", "t1")
+		ps.Publish(ctx, "points.earned", "p1")
+
+		assert.Equal(t, Message[string]{Topic: "points.earned", Value: "p1"}, receive(t, points))
+		assert.Equal(t, "t1", receive(t, all).Value)
+		assert.Equal(t, "p1", receive(t, all).Value)
+	})
+
+	t.Run("drop oldest keeps the latest messages", func(t *testing.T) {
+		ps := NewPubSub[int]()
+		sub := ps.Subscribe(ctx, "n", SubscribeOptions{Policy: DropOldest, Buffer: 2})
+		defer sub.Close()
+
+		// The first message may already be waiting on the channel, the rest
+		// overflow the buffer
+		for i := 1; i <= 10; i++ {
+			ps.Publish(ctx, "n", i)
+		}
+
+		var received []int
+		for len(received) < 3 {
+			m := receive(t, sub)
+			received = append(received, m.Value)
+			if m.Value == 10 {
+				break
+			}
+		}
+		assert.Equal(t, 10, received[len(received)-1])
+		assert.Equal(t, uint64(10-len(received)), sub.Dropped())
+		assert.Equal(t, Metrics{Published: 10, Dropped: sub.Dropped()}, ps.Metrics())
+	})
+
+	t.Run("block with timeout drops after waiting", func(t *testing.T) {
+		ps := NewPubSub[int]()
+		sub := ps.Subscribe(ctx, "n", SubscribeOptions{Policy: BlockWithTimeout, Buffer: 1, Timeout: 10 * time.Millisecond})
+		defer sub.Close()
+
+		for i := 1; i <= 3; i++ {
+			ps.Publish(ctx, "n", i)
+		}
+
+		assert.Equal(t, uint64(1), sub.Dropped())
+		assert.Equal(t, 1, receive(t, sub).Value)
+		assert.Equal(t, 2, receive(t, sub).Value)
+	})
+
+	t.Run("unbounded never drops", func(t *testing.T) {
+		ps := NewPubSub[int]()
+		sub := ps.Subscribe(ctx, "n", SubscribeOptions{Policy: Unbounded, Buffer: 1})
+		defer sub.Close()
+
+		for i := 0; i < 1000; i++ {
+			ps.Publish(ctx, "n", i)
+		}
+
+		for i := 0; i < 1000; i++ {
+			assert.Equal(t, i, receive(t, sub).Value)
+		}
+		assert.Equal(t, uint64(0), ps.Metrics().Dropped)
+	})
+
+	t.Run("cancelling the context ends the subscription", func(t *testing.T) {
+		ps := NewPubSub[int]()
+		subCtx, cancel := context.WithCancel(ctx)
+		sub := ps.Subscribe(subCtx, "n", SubscribeOptions{})
+
+		cancel()
+
+		_, open := <-sub.C()
+		assert.False(t, open)
+		ps.Publish(ctx, "n", 1)
+		assert.Equal(t, uint64(0), ps.Metrics().Dropped)
+	})
+}
@@ -3,14 +3,30 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
+	"go-playground/pkg/logging"
+
+	"github.com/rs/zerolog"
 	"github.com/segmentio/kafka-go"
 )
 
+// Backoff between retries of a failing read
+const (
+	minReadBackoff = 100 * time.Millisecond
+	maxReadBackoff = 30 * time.Second
+)
+
 type KafkaService struct {
-	writer *kafka.Writer
-	reader *kafka.Reader
+	brokers []string
+	writer  *kafka.Writer
+	mu      sync.Mutex
+	readers []*kafka.Reader
+	logger  zerolog.Logger
 }
 
 type KafkaConfig struct {
@@ -19,7 +35,19 @@ type KafkaConfig struct {
 
 // NewKafkaService creates a new instance of KafkaService
 func NewKafkaService(config KafkaConfig) *KafkaService {
-	return &KafkaService{}
+	return &KafkaService{
+		brokers: config.BrokerURLs,
+		// The topic is set per message. Messages with the same key go to the
+		// same partition, and a write only succeeds once every in-sync
+		// replica has it.
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(config.BrokerURLs...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+		},
+		logger: logging.GetLogger(),
+	}
 }
 
 // PublishMessage publishes a message to a specified topic
@@ -30,57 +58,90 @@ func (s *KafkaService) PublishMessage(ctx context.Context, topic string, payload
 		return fmt.Errorf("error marshaling payload: %w", err)
 	}
 
-	// Create writer if not exists
-	if s.writer == nil {
-		s.writer = &kafka.Writer{
-			Addr:     kafka.TCP("localhost:9092"),
-			Topic:    topic,
-			Balancer: &kafka.LeastBytes{},
-		}
+	return s.Publish(ctx, topic, "", jsonData)
+}
+
+// Publish writes a message to a topic and waits for the brokers to acknowledge
+// it. Messages with the same key land on the same partition, in order.
+func (s *KafkaService) Publish(ctx context.Context, topic, key string, value []byte) error {
+	message := kafka.Message{
+		Topic: topic,
+		Value: value,
+	}
+	if key != "" {
+		message.Key = []byte(key)
 	}
 
-	// Write message
-	err = s.writer.WriteMessages(ctx, kafka.Message{
-		Value: jsonData,
-	})
-	if err != nil {
+	if err := s.writer.WriteMessages(ctx, message); err != nil {
 		return fmt.Errorf("error writing message: %w", err)
 	}
 
 	return nil
 }
 
-// SubscribeToTopic subscribes to a topic and processes messages
-func (s *KafkaService) SubscribeToTopic(ctx context.Context, topic string, groupID string) (<-chan []byte, error) {
-	// Create reader if not exists
-	if s.reader == nil {
-		s.reader = kafka.NewReader(kafka.ReaderConfig{
-			Brokers:  []string{"localhost:9092"},
-			Topic:    topic,
-			GroupID:  groupID,
-			MinBytes: 10e3, // 10KB
-			MaxBytes: 10e6, // 10MB
-		})
-	}
+// SubscribeToTopic reads a topic as a member of a consumer group. Offsets are
+// not committed on read: commit each message once it is processed, messages
+// left uncommitted are delivered again after a restart or rebalance.
+//
+// Read errors are retried with a backoff. The channel is closed once ctx is
+// cancelled or the service is closed.
+func (s *KafkaService) SubscribeToTopic(ctx context.Context, topic string, groupID string) (<-chan *Message, error) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  s.brokers,
+		Topic:    topic,
+		GroupID:  groupID,
+		MinBytes: 10e3, // 10KB
+		MaxBytes: 10e6, // 10MB
+	})
+
+	s.mu.Lock()
+	s.readers = append(s.readers, reader)
+	s.mu.Unlock()
 
-	messageChan := make(chan []byte)
+	messageChan := make(chan *Message)
 
 	// Start reading messages in a goroutine
 	go func() {
 		defer close(messageChan)
-		defer s.reader.Close()
+		defer reader.Close()
 
+		backoff := minReadBackoff
 		for {
+			message, err := reader.FetchMessage(ctx)
+			if err != nil {
+				// The reader returns io.EOF once closed
+				if ctx.Err() != nil || errors.Is(err, io.EOF) {
+					return
+				}
+				s.logger.Error().
+					Err(err).
+					Str("topic", topic).
+					Dur("backoff", backoff).
+					Msg("Failed to read message")
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2, maxReadBackoff)
+				continue
+			}
+			backoff = minReadBackoff
+
+			delivery := &Message{
+				Topic:     message.Topic,
+				Key:       string(message.Key),
+				Value:     message.Value,
+				Partition: message.Partition,
+				Offset:    message.Offset,
+				commit: func(ctx context.Context) error {
+					return reader.CommitMessages(ctx, message)
+				},
+			}
 			select {
+			case messageChan <- delivery:
 			case <-ctx.Done():
 				return
-			default:
-				message, err := s.reader.ReadMessage(ctx)
-				if err != nil {
-					fmt.Printf("error reading message: %v\n", err)
-					continue
-				}
-				messageChan <- message.Value
 			}
 		}
 	}()
@@ -90,13 +151,14 @@ func (s *KafkaService) SubscribeToTopic(ctx context.Context, topic string, group
 
 // Close closes the kafka connections
 func (s *KafkaService) Close() error {
-	if s.writer != nil {
-		if err := s.writer.Close(); err != nil {
-			return fmt.Errorf("error closing writer: %w", err)
-		}
+	if err := s.writer.Close(); err != nil {
+		return fmt.Errorf("error closing writer: %w", err)
 	}
-	if s.reader != nil {
-		if err := s.reader.Close(); err != nil {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, reader := range s.readers {
+		if err := reader.Close(); err != nil {
 			return fmt.Errorf("error closing reader: %w", err)
 		}
 	}
@@ -0,0 +1,136 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+)
+
+// Message is a message published to or read from a topic
+type Message struct {
+	Topic     string
+	Key       string
+	Value     []byte
+	Partition int
+	Offset    int64
+
+	commit func(ctx context.Context) error
+}
+
+// Commit marks the message, and every message before it on its partition, as
+// processed by the consumer group that read it.
+func (m *Message) Commit(ctx context.Context) error {
+	if m.commit == nil {
+		return nil
+	}
+	return m.commit(ctx)
+}
+
+// MemoryBroker stands in for Kafka in tests. Every topic has one partition
+// holding the messages published to it, in order, and consumer groups resume
+// from their last committed offset.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	messages  map[string][]Message
+	committed map[string]int64 // by topic and group
+	published chan struct{}    // closed and replaced on every publish
+	err       error
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		messages:  map[string][]Message{},
+		committed: map[string]int64{},
+		published: make(chan struct{}),
+	}
+}
+
+// Publish keeps the message, or fails with the error set by FailWith.
+func (b *MemoryBroker) Publish(ctx context.Context, topic, key string, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err != nil {
+		return b.err
+	}
+	b.messages[topic] = append(b.messages[topic], Message{
+		Topic:  topic,
+		Key:    key,
+		Value:  value,
+		Offset: int64(len(b.messages[topic])),
+	})
+	close(b.published)
+	b.published = make(chan struct{})
+	return nil
+}
+
+// FailWith makes every following Publish fail with err, nil makes it succeed again.
+func (b *MemoryBroker) FailWith(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+// Messages returns the messages published to topic
+func (b *MemoryBroker) Messages(topic string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message{}, b.messages[topic]...)
+}
+
+// Committed returns the offset the group resumes topic from
+func (b *MemoryBroker) Committed(topic, groupID string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.committed[topic+"/"+groupID]
+}
+
+// SubscribeToTopic delivers the messages of topic from the group's committed
+// offset on, then waits for new ones. The channel is closed once ctx is
+// cancelled.
+func (b *MemoryBroker) SubscribeToTopic(ctx context.Context, topic string, groupID string) (<-chan *Message, error) {
+	b.mu.Lock()
+	next := b.committed[topic+"/"+groupID]
+	b.mu.Unlock()
+
+	messageChan := make(chan *Message)
+	go func() {
+		defer close(messageChan)
+
+		for {
+			b.mu.Lock()
+			published := b.published
+			if next >= int64(len(b.messages[topic])) {
+				b.mu.Unlock()
+				select {
+				case <-ctx.Done():
+					return
+				case <-published:
+					continue
+				}
+			}
+			message := b.messages[topic][next]
+			b.mu.Unlock()
+
+			message.commit = func(ctx context.Context) error {
+				b.commit(topic, groupID, message.Offset+1)
+				return nil
+			}
+			select {
+			case messageChan <- &message:
+				next++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messageChan, nil
+}
+
+func (b *MemoryBroker) commit(topic, groupID string, offset int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if offset > b.committed[topic+"/"+groupID] {
+		b.committed[topic+"/"+groupID] = offset
+	}
+}
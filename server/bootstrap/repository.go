@@ -24,6 +24,17 @@ type Repositories struct {
 	ProgramRepo           *postgres.ProgramsRepository
 	SessionRepo           redis.SessionRepository
 	ProgramRuleRepo       *postgres.ProgramRuleRepository
+	ProgramRuleSetRepo    *postgres.ProgramRuleSetRepository
+	CustomerContextCache  *redis.CustomerContextCache
+	RuleBacktestRepo      *postgres.RuleBacktestRepository
+	PointsExpirationRepo  *postgres.PointsExpirationRepository
+	PointsHoldRepo        *postgres.PointsHoldRepository
+	IdempotencyRepo       *redis.IdempotencyRepository
+	OutboxRepo            *postgres.OutboxRepository
+	WebhookRepo           *postgres.WebhookRepository
+	TransactionImportRepo *postgres.TransactionImportRepository
+	VoucherRepo           *postgres.VoucherRepository
+	TxManager             *postgres.TxManager
 }
 
 // InitializeRepositories initializes all repositories
@@ -42,5 +53,16 @@ func InitializeRepositories(db *sql.DB, dbConn *config.DbConnection, rdb *redisl
 		ProgramRepo:           postgres.NewProgramsRepository(db),
 		SessionRepo:           redis.NewSessionRepository(rdb),
 		ProgramRuleRepo:       postgres.NewProgramRuleRepository(*dbConn),
+		ProgramRuleSetRepo:    postgres.NewProgramRuleSetRepository(*dbConn),
+		CustomerContextCache:  redis.NewCustomerContextCache(rdb),
+		RuleBacktestRepo:      postgres.NewRuleBacktestRepository(*dbConn),
+		PointsExpirationRepo:  postgres.NewPointsExpirationRepository(*dbConn),
+		PointsHoldRepo:        postgres.NewPointsHoldRepository(*dbConn),
+		IdempotencyRepo:       redis.NewIdempotencyRepository(rdb),
+		OutboxRepo:            postgres.NewOutboxRepository(db),
+		WebhookRepo:           postgres.NewWebhookRepository(*dbConn),
+		TransactionImportRepo: postgres.NewTransactionImportRepository(*dbConn),
+		VoucherRepo:           postgres.NewVoucherRepository(*dbConn),
+		TxManager:             postgres.NewTxManager(db),
 	}
 }
@@ -1,6 +1,7 @@
 package bootstrap
 
 import (
+	"go-playground/server/domain"
 	"go-playground/server/handler"
 	"go-playground/server/middleware"
 	"go-playground/server/repository/postgres"
@@ -25,12 +26,18 @@ type Handlers struct {
 	TransactionHandler       *handler.TransactionHandler
 	RewardsHandler           *handler.RewardsHandler
 	RedemptionHandler        *handler.RedemptionHandler
+	VoucherHandler           *handler.VoucherHandler
 	PingHandler              *handler.PingHandler
 	InternalLoadTestHandler  *handler.InternalLoadTestHandler
 	MerchantHandler          *handler.MerchantHandler
 	MerchantCustomersHandler *handler.MerchantCustomersHandler
 	ProgramHandler           *handler.ProgramHandler
 	ProgramRulesHandler      *handler.ProgramRulesHandler
+	RuleBacktestHandler      *handler.RuleBacktestHandler
+	TransactionImportHandler *handler.TransactionImportHandler
+	RuleSetHandler           *handler.RuleSetHandler
+	PointsExpirationHandler  *handler.PointsExpirationHandler
+	WebhookHandler           *handler.WebhookHandler
 }
 
 // InitializeHandlers initializes all handlers
@@ -42,17 +49,29 @@ func InitializeHandlers(services *Services, db *sql.DB, dbReplication *sql.DB, r
 		TransactionHandler:       handler.NewTransactionHandler(services.TransactionService),
 		RewardsHandler:           handler.NewRewardsHandler(services.RewardsService),
 		RedemptionHandler:        handler.NewRedemptionHandler(services.RedemptionService),
+		VoucherHandler:           handler.NewVoucherHandler(services.VoucherService),
 		PingHandler:              handler.NewPingHandler(db, dbReplication, rdb),
 		InternalLoadTestHandler:  handler.NewInternalLoadTestHandler(services.AuthService),
 		MerchantHandler:          handler.NewMerchantHandler(services.MerchantService),
 		MerchantCustomersHandler: handler.NewMerchantCustomersHandler(services.MerchantCustomersService),
 		ProgramHandler:           handler.NewProgramHandler(services.ProgramService),
 		ProgramRulesHandler:      handler.NewProgramRulesHandler(services.ProgramRuleService),
+		RuleBacktestHandler:      handler.NewRuleBacktestHandler(services.RuleBacktestService),
+		TransactionImportHandler: handler.NewTransactionImportHandler(services.TransactionImportService),
+		RuleSetHandler:           handler.NewRuleSetHandler(services.ProgramRuleService),
+		PointsExpirationHandler:  handler.NewPointsExpirationHandler(services.PointsExpirationService),
+		WebhookHandler:           handler.NewWebhookHandler(services.WebhookService),
 	}
 }
 
 // SetupRouter sets up the Gin router with all routes and middleware
-func SetupRouter(h *Handlers, authRepo *postgres.AuthRepository, sessionRepo redis.SessionRepository) *gin.Engine {
+func SetupRouter(
+	h *Handlers,
+	authRepo *postgres.AuthRepository,
+	sessionRepo redis.SessionRepository,
+	idempotencyRepo domain.IdempotencyRepository,
+	customersRepo domain.MerchantCustomersRepository,
+) *gin.Engine {
 	r := gin.Default()
 
 	// Debug mode
@@ -86,7 +105,7 @@ func SetupRouter(h *Handlers, authRepo *postgres.AuthRepository, sessionRepo red
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:8080"}
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-User-Id"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-User-Id", domain.IdempotencyKeyHeader}
 	r.Use(cors.New(config))
 
 	// Swagger documentation
@@ -136,17 +155,24 @@ func SetupRouter(h *Handlers, authRepo *postgres.AuthRepository, sessionRepo red
 		{
 			points.GET("/:customer_id/:program_id/ledger", h.PointsHandler.GetLedger)
 			points.GET("/:customer_id/:program_id/balance", h.PointsHandler.GetBalance)
-			points.POST("/:customer_id/:program_id/earn", h.PointsHandler.EarnPoints)
+			points.GET("/:customer_id/:program_id/lots", h.PointsHandler.GetLots)
+			points.POST("/:customer_id/:program_id/earn", middleware.IdempotencyMiddleware(idempotencyRepo, middleware.MerchantFromCustomer(customersRepo)), h.PointsHandler.EarnPoints)
 			points.POST("/:customer_id/:program_id/redeem", h.PointsHandler.RedeemPoints)
+			points.GET("/:customer_id/:program_id/expirations", h.PointsExpirationHandler.GetUpcoming)
 		}
 
 		// Transactions routes
 		transactions := api.Group("/transactions")
 		{
-			transactions.POST("", h.TransactionHandler.Create)
+			transactions.POST("", middleware.IdempotencyMiddleware(idempotencyRepo, middleware.MerchantFromBodyCustomer(customersRepo)), h.TransactionHandler.Create)
 			transactions.GET("/:id", h.TransactionHandler.GetByID)
 			transactions.GET("/user/:user_id", h.TransactionHandler.GetByCustomerID)
 			transactions.GET("/merchant/:merchant_id", h.TransactionHandler.GetByMerchantID)
+			transactions.PUT("/:id/status", h.TransactionHandler.UpdateStatus)
+			transactions.POST("/batch", h.TransactionImportHandler.CreateBatch)
+			transactions.POST("/import", h.TransactionImportHandler.ImportCSV)
+			transactions.GET("/imports/:id", h.TransactionImportHandler.GetByID)
+			transactions.GET("/imports/:id/rows", h.TransactionImportHandler.GetRows)
 		}
 
 		// Rewards routes
@@ -158,15 +184,20 @@ func SetupRouter(h *Handlers, authRepo *postgres.AuthRepository, sessionRepo red
 			rewards.PUT("/:id", h.RewardsHandler.Update)
 			rewards.DELETE("/:id", h.RewardsHandler.Delete)
 			rewards.GET("/program/:program_id", h.RewardsHandler.GetByProgramID)
+			rewards.POST("/:id/codes", h.VoucherHandler.AddCodes)
 		}
 
 		// Redemptions routes
 		redemptions := api.Group("/redemptions")
 		{
 			redemptions.POST("", h.RedemptionHandler.Create)
+			redemptions.POST("/cart", h.RedemptionHandler.CreateCart)
+			redemptions.GET("/groups/:group_id", h.RedemptionHandler.GetGroup)
 			redemptions.GET("/:id", h.RedemptionHandler.GetByID)
 			redemptions.GET("/user/:user_id", h.RedemptionHandler.GetByUserID)
 			redemptions.PUT("/:id/status", h.RedemptionHandler.UpdateStatus)
+			redemptions.GET("/:id/history", h.RedemptionHandler.GetStatusHistory)
+			redemptions.POST("/verify", h.VoucherHandler.Verify)
 		}
 
 		// Merchants routes
@@ -198,16 +229,39 @@ func SetupRouter(h *Handlers, authRepo *postgres.AuthRepository, sessionRepo red
 			programs.GET("/merchant/:merchant_id", h.ProgramHandler.GetByMerchantID)
 			programs.PUT("/:id", h.ProgramHandler.Update)
 			programs.DELETE("/:id", h.ProgramHandler.Delete)
+			programs.PUT("/:id/expiry-policy", h.PointsExpirationHandler.SetPolicy)
+			programs.GET("/:id/expiry-policy", h.PointsExpirationHandler.GetPolicy)
+			programs.DELETE("/:id/expiry-policy", h.PointsExpirationHandler.DeletePolicy)
 		}
 
 		programRules := api.Group("/program-rules")
 		{
 			programRules.POST("", h.ProgramRulesHandler.Create)
+			programRules.POST("/simulate", h.ProgramRulesHandler.Simulate)
+			programRules.POST("/backtests", h.RuleBacktestHandler.Create)
+			programRules.GET("/backtests/:id", h.RuleBacktestHandler.GetByID)
+			programRules.GET("/backtests/:id/customers", h.RuleBacktestHandler.GetCustomers)
+			programRules.POST("/versions", h.RuleSetHandler.Create)
+			programRules.GET("/versions/program/:program_id", h.RuleSetHandler.GetByProgramID)
+			programRules.GET("/versions/:id", h.RuleSetHandler.GetByID)
+			programRules.POST("/versions/:id/publish", h.RuleSetHandler.Publish)
+			programRules.POST("/versions/:id/rollback", h.RuleSetHandler.Rollback)
+			programRules.DELETE("/versions/:id", h.RuleSetHandler.Delete)
 			programRules.GET("/:id", h.ProgramRulesHandler.GetByID)
 			programRules.GET("/program/:program_id", h.ProgramRulesHandler.GetByProgramID)
 			programRules.PUT("/:id", h.ProgramRulesHandler.Update)
 			programRules.GET("/by-merchant/:merchant_id", h.ProgramRulesHandler.GetProgramRulesByMerchantId)
 		}
+
+		// Webhooks routes
+		webhooks := api.Group("/webhooks")
+		{
+			webhooks.POST("", h.WebhookHandler.Create)
+			webhooks.GET("/merchant/:merchant_id", h.WebhookHandler.GetByMerchantID)
+			webhooks.DELETE("/:id", h.WebhookHandler.Delete)
+			webhooks.GET("/:id/deliveries", h.WebhookHandler.GetDeliveries)
+			webhooks.POST("/deliveries/:id/replay", h.WebhookHandler.Replay)
+		}
 	}
 
 	// Protected HTML routes
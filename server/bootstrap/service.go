@@ -1,40 +1,102 @@
 package bootstrap
 
 import (
+	"context"
+
+	"go-playground/pkg/channel"
+	"go-playground/server/domain"
 	"go-playground/server/service"
 )
 
 // Services holds all service instances
 type Services struct {
-	UserService              *service.UserService
-	AuthService              *service.AuthService
-	PointsService            *service.PointsService
-	TransactionService       *service.TransactionService
-	RewardsService           *service.RewardsService
-	RedemptionService        *service.RedemptionService
-	MerchantService          *service.MerchantService
-	MerchantCustomersService *service.MerchantCustomersService
-	ProgramService           *service.ProgramService
-	ProgramRuleService       *service.ProgramRulesService
+	UserService                 *service.UserService
+	AuthService                 *service.AuthService
+	PointsService               *service.PointsService
+	TransactionService          *service.TransactionService
+	RewardsService              *service.RewardsService
+	RedemptionService           *service.RedemptionService
+	VoucherService              *service.VoucherService
+	MerchantService             *service.MerchantService
+	MerchantCustomersService    *service.MerchantCustomersService
+	ProgramService              *service.ProgramService
+	ProgramRuleService          *service.ProgramRulesService
+	RuleBacktestService         *service.RuleBacktestService
+	TransactionImportService    *service.TransactionImportService
+	PointsExpirationService     *service.PointsExpirationService
+	OutboxRelayService          *service.OutboxRelayService
+	TransactionIngestionService *service.TransactionIngestionService
+	CustomerContextService      *service.CustomerContextService
+	WebhookService              *service.WebhookService
+
+	// EventBus carries committed domain events to in-process listeners
+	EventBus *channel.PubSub[domain.DomainEvent]
 }
 
 // InitializeServices initializes all services
-func InitializeServices(repos *Repositories) *Services {
-	pointsService := service.NewPointsService(repos.PointsRepo, repos.EventRepo)
+func InitializeServices(repos *Repositories, publisher domain.EventPublisher, subscriber domain.MessageSubscriber) *Services {
+	pointsExpirationService := service.NewPointsExpirationService(
+		repos.PointsExpirationRepo,
+		repos.PointsRepo,
+		repos.ProgramRepo,
+		repos.MerchantRepo,
+	)
+	eventBus := channel.NewPubSub[domain.DomainEvent]()
+	webhookService := service.NewWebhookService(
+		repos.WebhookRepo,
+		repos.MerchantRepo,
+		repos.MerchantCustomersRepo,
+		service.NewWebhookClient(),
+	)
+	eventLoggerService := service.NewEventLoggerService(repos.EventRepo, repos.OutboxRepo, webhookService, eventBus, repos.TxManager)
+	pointsService := service.NewPointsService(
+		repos.PointsRepo,
+		repos.PointsHoldRepo,
+		repos.EventRepo,
+		pointsExpirationService,
+		eventLoggerService,
+		repos.TxManager,
+	)
 	merchantService := service.NewMerchantService(repos.MerchantRepo)
-	eventLoggerService := service.NewEventLoggerService(repos.EventRepo)
+	customerContextService := service.NewCustomerContextService(
+		repos.MerchantCustomersRepo,
+		repos.MerchantRepo,
+		repos.TransactionRepo,
+		repos.CustomerContextCache,
+	)
 	transactionService := service.NewTransactionService(
 		repos.TransactionRepo,
 		pointsService,
 		eventLoggerService,
 		repos.MerchantCustomersRepo,
+		repos.ProgramRuleRepo,
+		repos.ProgramRepo,
+		customerContextService,
+		repos.TxManager,
+	)
+	programRuleService := service.NewProgramRulesService(
+		repos.ProgramRuleRepo,
+		repos.ProgramRuleSetRepo,
+		repos.ProgramRepo,
+		repos.MerchantRepo,
+		customerContextService,
+		repos.TxManager,
+	)
+	voucherService := service.NewVoucherService(
+		repos.VoucherRepo,
+		repos.RedemptionRepo,
+		repos.RewardsRepo,
+		eventLoggerService,
+		repos.TxManager,
 	)
 	redemptionService := service.NewRedemptionService(
 		repos.RedemptionRepo,
 		repos.RewardsRepo,
 		pointsService,
 		transactionService,
+		voucherService,
 		eventLoggerService,
+		repos.TxManager,
 	)
 
 	return &Services{
@@ -51,9 +113,34 @@ func InitializeServices(repos *Repositories) *Services {
 		TransactionService:       transactionService,
 		RewardsService:           service.NewRewardsService(repos.RewardsRepo),
 		RedemptionService:        redemptionService,
+		VoucherService:           voucherService,
 		MerchantService:          merchantService,
 		MerchantCustomersService: service.NewMerchantCustomersService(repos.MerchantCustomersRepo),
 		ProgramService:           service.NewProgramService(repos.ProgramRepo),
-		ProgramRuleService:       service.NewProgramRulesService(repos.ProgramRuleRepo, repos.ProgramRepo),
+		ProgramRuleService:       programRuleService,
+		RuleBacktestService: service.NewRuleBacktestService(
+			repos.RuleBacktestRepo,
+			repos.ProgramRepo,
+			repos.MerchantRepo,
+			programRuleService,
+		),
+		TransactionImportService: service.NewTransactionImportService(
+			repos.TransactionImportRepo,
+			transactionService,
+			repos.MerchantCustomersRepo,
+			repos.TxManager,
+		),
+		PointsExpirationService:     pointsExpirationService,
+		OutboxRelayService:          service.NewOutboxRelayService(repos.OutboxRepo, publisher, repos.TxManager),
+		TransactionIngestionService: service.NewTransactionIngestionService(subscriber, publisher, transactionService),
+		CustomerContextService:      customerContextService,
+		WebhookService:              webhookService,
+		EventBus:                    eventBus,
 	}
 }
+
+// StartEventListeners subscribes the in-process listeners to the event bus.
+// They stop when ctx is cancelled.
+func (s *Services) StartEventListeners(ctx context.Context) {
+	s.CustomerContextService.InvalidateOnTransactionEvents(ctx, s.EventBus)
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -47,6 +48,9 @@ type Config struct {
 	RedisPort     string
 	RedisPassword string
 
+	// Kafka settings
+	KafkaBrokerURLs []string
+
 	Auth AuthConfig
 }
 
@@ -82,6 +86,9 @@ func LoadConfig() *Config {
 		RedisPort:     getEnv("REDIS_PORT", "6379"),
 		RedisPassword: getEnv("REDIS_PASSWORD", "redis123"),
 
+		// Kafka settings, a comma separated list of host:port
+		KafkaBrokerURLs: strings.Split(getEnv("KAFKA_BROKER_URLS", "localhost:9092"), ","),
+
 		Auth: AuthConfig{
 			LoginAttemptResetPeriod: 24 * time.Hour,   // Reset attempts after 24 hours
 			MaxLoginAttempts:        5,                // Lock after 5 failed attempts
@@ -39,6 +39,14 @@ const (
 	ProgramRuleUpdated   EventLogType = "program_rule_updated"
 )
 
+// Events published to the outbox and the event bus only, they are not in the
+// event_log enum.
+const (
+	TransactionStatusUpdated EventLogType = "transaction_status_updated"
+	RedemptionStatusUpdated  EventLogType = "redemption_status_updated"
+	RewardLowStock           EventLogType = "reward_low_stock"
+)
+
 // Reference : ~/server/migrations/000007_create_event_log_table.up.sql
 // EventLogActorType represents the possible types of actors
 type EventLogActorType string
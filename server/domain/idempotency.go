@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// IdempotencyKeyHeader is the header clients send to make a retried request
+// safe: the first response is stored and replayed on every retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyRecord is what is kept for an idempotency key. StatusCode is 0
+// while the first request is still being processed.
+type IdempotencyRecord struct {
+	RequestHash string    `json:"request_hash"` // method, path and body of the first request
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// InFlight reports whether the first request has not finished yet
+func (r *IdempotencyRecord) InFlight() bool {
+	return r.StatusCode == 0
+}
+
+// IdempotencyRepository stores idempotency keys. Keys are scoped, the same key
+// sent by two merchants belongs to two different requests.
+type IdempotencyRepository interface {
+	// Reserve claims the key for a request. When the key is already taken it
+	// returns the record holding it and stores nothing
+	Reserve(ctx context.Context, scope, key string, record *IdempotencyRecord) (*IdempotencyRecord, error)
+	// Complete stores the response of the request holding the key
+	Complete(ctx context.Context, scope, key string, record *IdempotencyRecord) error
+	// Release frees the key, so that a retry runs the request again
+	Release(ctx context.Context, scope, key string) error
+}
@@ -37,9 +37,17 @@ type AuthRepository interface {
 	TxManager
 }
 
+// TxManager runs database writes atomically
 type TxManager interface {
 	BeginTx(ctx context.Context) (*sql.Tx, error)
 	Commit(ctx context.Context, tx *sql.Tx) error
+	// WithinTx runs fn as a unit of work: the repositories called with the
+	// context fn receives join one transaction, committed when fn returns nil
+	// and rolled back otherwise
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+	// AfterCommit runs fn once the unit of work in ctx commits, right away
+	// outside of one
+	AfterCommit(ctx context.Context, fn func(ctx context.Context))
 }
 
 type AuthService interface {
@@ -54,13 +62,58 @@ type AuthService interface {
 
 // PointsRepository handles points balance operations
 type PointsRepository interface {
+	// Create writes a ledger entry. Writes to one customer and program are
+	// serialized. An earn opens a lot, a redemption consumes the oldest unspent
+	// lots and fails with INSUFFICIENT_POINTS when the balance does not cover
+	// it, unless the entry's RefundPolicy says otherwise. An earn pays off the
+	// account's points debt before adding to its balance
 	Create(ctx context.Context, ledger *PointsLedger) (*PointsLedger, error)
+	// GetLots returns the unspent lots, oldest first
+	GetLots(ctx context.Context, customerID, programID uuid.UUID) ([]*PointsLot, error)
 	GetByCustomerAndProgram(ctx context.Context, customerID, programID uuid.UUID) ([]*PointsLedger, error)
+	// GetCurrentBalance returns the balance less the points debt, it is
+	// negative while the debt is not paid off
 	GetCurrentBalance(ctx context.Context, customerID, programID uuid.UUID) (int, error)
 	GetByTransactionID(ctx context.Context, transactionID uuid.UUID) (*PointsLedger, error)
+	// SumByTransactionID adds up the points every ledger entry of a transaction earned and redeemed
+	SumByTransactionID(ctx context.Context, transactionID uuid.UUID) (earned, redeemed int, err error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
+// PointsHoldRepository stores the points held for pending transactions
+type PointsHoldRepository interface {
+	Create(ctx context.Context, hold *PointsHold) error
+	// LockByTransactionID returns a transaction's hold locked until the unit
+	// of work in ctx commits, nil when it has none
+	LockByTransactionID(ctx context.Context, transactionID uuid.UUID) (*PointsHold, error)
+	// Resolve moves a held hold to released or voided
+	Resolve(ctx context.Context, holdID uuid.UUID, status string) error
+	// SumHeld adds up the points still held for a customer in a program
+	SumHeld(ctx context.Context, customerID, programID uuid.UUID) (int, error)
+}
+
+// PointsExpirationRepository handles expiry policies and expiration entries
+type PointsExpirationRepository interface {
+	UpsertPolicy(ctx context.Context, policy *PointsExpiryPolicy) error
+	GetPolicy(ctx context.Context, programID uuid.UUID) (*PointsExpiryPolicy, error)
+	GetPolicies(ctx context.Context) ([]*PointsExpiryPolicy, error)
+	DeletePolicy(ctx context.Context, programID uuid.UUID) error
+	// GetExpiredAccounts pages through the accounts holding lots that expired at or before dueBy
+	GetExpiredAccounts(ctx context.Context, dueBy time.Time, after PointsAccount, limit int) ([]PointsAccount, error)
+	// GetInactiveCustomers pages through the customers of a program holding
+	// unspent lots whose last earn or redemption was before inactiveSince
+	GetInactiveCustomers(ctx context.Context, programID uuid.UUID, inactiveSince time.Time, afterID uuid.UUID, limit int) ([]uuid.UUID, error)
+	// ExpireLots writes one expiration entry consuming the unspent lots that
+	// expired at or before dueBy, or every unspent lot when dueBy is nil. It
+	// returns nil when there is nothing to expire
+	ExpireLots(ctx context.Context, customerID, programID uuid.UUID, dueBy *time.Time) (*PointsLedger, error)
+}
+
+// PointsExpiryProvider tells when points earned in a program expire
+type PointsExpiryProvider interface {
+	ExpiresAt(ctx context.Context, programID uuid.UUID, earnedAt time.Time) (*time.Time, error)
+}
+
 type TransactionRepository interface {
 	Create(ctx context.Context, transaction *Transaction) (*Transaction, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*Transaction, error)
@@ -69,6 +122,28 @@ type TransactionRepository interface {
 	GetByMerchantIDWithPagination(ctx context.Context, merchantID uuid.UUID, offset, limit int) ([]*Transaction, int64, error)
 	GetByUserIDWithPagination(ctx context.Context, userID uuid.UUID, offset, limit int) ([]*Transaction, int64, error)
 	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
+	CountByCustomerAndProgram(ctx context.Context, customerID, programID uuid.UUID, status string) (int, error)
+	// LockByID reads a transaction and locks it until the unit of work in ctx
+	// commits, so refunds and status changes of one transaction are serialized
+	LockByID(ctx context.Context, id uuid.UUID) (*Transaction, error)
+	// SumRefunds adds up the amounts of the refunds of a transaction that are not failed or cancelled
+	SumRefunds(ctx context.Context, originalID uuid.UUID) (float64, error)
+}
+
+// RuleBacktestRepository stores backtest jobs and reads the history they replay.
+type RuleBacktestRepository interface {
+	Create(ctx context.Context, backtest *RuleBacktest) error
+	GetByID(ctx context.Context, id uuid.UUID) (*RuleBacktest, error)
+	MarkRunning(ctx context.Context, id uuid.UUID) error
+	UpdateProgress(ctx context.Context, id uuid.UUID, transactionsProcessed int64) error
+	Complete(ctx context.Context, backtest *RuleBacktest, customers []*RuleBacktestCustomer) error
+	Fail(ctx context.Context, id uuid.UUID, reason string) error
+	GetCustomers(ctx context.Context, id uuid.UUID, offset, limit int) ([]*RuleBacktestCustomer, int64, error)
+	// GetTransactions returns up to limit transactions of a program in
+	// [from, to) ordered by date, starting after the (afterDate, afterID) cursor.
+	GetTransactions(ctx context.Context, programID uuid.UUID, from, to, afterDate time.Time, afterID uuid.UUID, limit int) ([]*BacktestTransaction, error)
+	// CountCompletedBefore counts each customer's completed transactions in a program before a date.
+	CountCompletedBefore(ctx context.Context, programID uuid.UUID, customerIDs []uuid.UUID, before time.Time) (map[uuid.UUID]int, error)
 }
 
 // RewardsRepository handles rewards operations
@@ -79,6 +154,13 @@ type RewardsRepository interface {
 	Delete(ctx context.Context, id uuid.UUID) error
 	GetAll(ctx context.Context, activeOnly bool) ([]Reward, error)
 	GetByProgramID(ctx context.Context, programID uuid.UUID) ([]*Reward, error)
+	// ReserveStock takes quantity of a reward's stock in the unit of work in
+	// ctx, holding the reward until it ends. It returns false when there is
+	// not enough stock left, and the stock left otherwise, nil when the reward
+	// is not limited.
+	ReserveStock(ctx context.Context, id uuid.UUID, quantity int) (bool, *int, error)
+	// ReleaseStock puts quantity back into a reward's stock
+	ReleaseStock(ctx context.Context, id uuid.UUID, quantity int) error
 }
 
 // RedemptionRepository handles redemption operations
@@ -86,7 +168,16 @@ type RedemptionRepository interface {
 	Create(ctx context.Context, redemption *Redemption) ([]*Redemption, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*Redemption, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*Redemption, error)
+	GetByGroupID(ctx context.Context, groupID uuid.UUID) ([]*Redemption, error)
 	Update(ctx context.Context, redemption *Redemption) error
+	// LockByID returns the redemption locked for the unit of work in ctx, nil
+	// when there is none
+	LockByID(ctx context.Context, id uuid.UUID) (*Redemption, error)
+	// CountActive counts a customer's pending, approved and fulfilled redemptions of a reward
+	CountActive(ctx context.Context, customerID, rewardID uuid.UUID) (int, error)
+	RecordStatusChange(ctx context.Context, change *RedemptionStatusChange) error
+	// GetStatusHistory returns a redemption's status changes, oldest first
+	GetStatusHistory(ctx context.Context, redemptionID uuid.UUID) ([]*RedemptionStatusChange, error)
 }
 
 type ProgramRepository interface {
@@ -101,10 +192,33 @@ type ProgramRepository interface {
 type ProgramRuleRepository interface {
 	Create(ctx context.Context, rule *ProgramRule) error
 	GetByID(ctx context.Context, id uuid.UUID) (*ProgramRule, error)
+	// GetByProgramID returns the rules of the program's published rule set
 	GetByProgramID(ctx context.Context, programID uuid.UUID) ([]*ProgramRule, error)
+	GetByRuleSetID(ctx context.Context, ruleSetID uuid.UUID) ([]*ProgramRule, error)
 	Update(ctx context.Context, rule *ProgramRule) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	// GetActiveRules returns the rules of the program's published rule set in force at timestamp
 	GetActiveRules(ctx context.Context, programID uuid.UUID, timestamp time.Time) ([]*ProgramRule, error)
+	CreateAwards(ctx context.Context, awards []*ProgramRuleAward) error
+	// SumAwardedPoints sums the awards of every version of the rule. They stay
+	// locked to the customer until the unit of work in ctx ends
+	SumAwardedPoints(ctx context.Context, ruleID, customerID uuid.UUID, from, to time.Time) (int, error)
+}
+
+// ProgramRuleSetRepository handles rule set versions
+type ProgramRuleSetRepository interface {
+	// GetOrCreateDraft returns the program's draft, creating it from a copy of
+	// the published rules when there is none
+	GetOrCreateDraft(ctx context.Context, programID uuid.UUID, description string) (*ProgramRuleSet, error)
+	// LockProgram holds off publishing the program's rule sets until the
+	// unit of work running in ctx ends
+	LockProgram(ctx context.Context, programID uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*ProgramRuleSet, error)
+	GetByProgramID(ctx context.Context, programID uuid.UUID) ([]*ProgramRuleSet, error)
+	// Publish makes the rule set, which must have the given status, the
+	// program's published version and archives the one it replaces
+	Publish(ctx context.Context, id uuid.UUID, fromStatus string) (*ProgramRuleSet, error)
+	DeleteDraft(ctx context.Context, id uuid.UUID) error
 }
 
 type UserService interface {
@@ -117,9 +231,22 @@ type UserService interface {
 
 type PointsService interface {
 	GetLedger(ctx context.Context, customerID uuid.UUID, programID uuid.UUID) ([]*PointsLedger, error)
+	GetLots(ctx context.Context, customerID uuid.UUID, programID uuid.UUID) ([]*PointsLot, error)
 	GetBalance(ctx context.Context, customerID uuid.UUID, programID uuid.UUID) (*PointsBalance, error)
 	EarnPoints(ctx context.Context, req *PointsTransaction) (*PointsTransaction, error)
 	RedeemPoints(ctx context.Context, req *PointsTransaction) (*PointsTransaction, error)
+	// ReversePoints takes back points of a refunded or cancelled transaction,
+	// handling a balance that does not cover them as the refund policy says.
+	// It returns the points actually taken back.
+	ReversePoints(ctx context.Context, req *PointsTransaction, refundPolicy string) (*PointsTransaction, error)
+	// GetTransactionPoints returns the points a transaction earned and redeemed
+	GetTransactionPoints(ctx context.Context, transactionID uuid.UUID) (earned, redeemed int, err error)
+	// HoldPoints sets aside the points a pending transaction will earn
+	HoldPoints(ctx context.Context, req *PointsTransaction) (*PointsHold, error)
+	// ReleaseHold earns the points held for a transaction, VoidHold drops
+	// them. Both return nil when the transaction has nothing held.
+	ReleaseHold(ctx context.Context, transactionID uuid.UUID) (*PointsHold, error)
+	VoidHold(ctx context.Context, transactionID uuid.UUID) (*PointsHold, error)
 }
 
 type ProgramService interface {
@@ -156,6 +283,13 @@ type ProgramRulesService interface {
 	Update(id string, req *UpdateProgramRuleRequest) (*ProgramRule, error)
 	Delete(id string) error
 	GetActiveRules(programID string) ([]*ProgramRule, error)
+	Simulate(req *SimulateRulesRequest) (*SimulateRulesResponse, error)
+	CreateRuleSet(req *CreateRuleSetRequest) (*ProgramRuleSet, error)
+	GetRuleSet(id string) (*ProgramRuleSet, error)
+	GetRuleSetsByProgramID(programID string) ([]*ProgramRuleSet, error)
+	PublishRuleSet(id string) (*ProgramRuleSet, error)
+	RollbackRuleSet(id string) (*ProgramRuleSet, error)
+	DiscardRuleSet(id string) error
 }
 
 type RewardsService interface {
@@ -173,6 +307,14 @@ type RedemptionService interface {
 	Update(id string, req *UpdateRedemptionRequest) (*Redemption, error)
 }
 
+// VoucherService issues the vouchers of redemptions. Issue and Void join the
+// unit of work in ctx.
+type VoucherService interface {
+	Issue(ctx context.Context, redemption *Redemption, reward *Reward) (*Voucher, error)
+	Void(ctx context.Context, redemptionID uuid.UUID) error
+	GetByRedemptionID(ctx context.Context, redemptionID uuid.UUID) (*Voucher, error)
+}
+
 type EventLogRepository interface {
 	Create(ctx context.Context, eventLog *EventLog) error
 	GetByID(id string) (*EventLog, error)
@@ -182,7 +324,10 @@ type EventLogRepository interface {
 
 type EventLoggerService interface {
 	SaveTransactionEvents(ctx context.Context, eventType EventLogType, transaction *Transaction, pointsEarned int) error
+	SaveTransactionStatusEvents(ctx context.Context, transaction *Transaction, oldStatus string) error
 	SaveRedemptionEvents(ctx context.Context, eventType EventLogType, redemption *Redemption, reward *Reward) error
+	SaveRedemptionStatusEvents(ctx context.Context, redemption *Redemption, reward *Reward, oldStatus RedemptionStatus) error
+	SaveRewardLowStockEvents(ctx context.Context, reward *Reward, customerID uuid.UUID) error
 	SaveUserUpdateEvents(ctx context.Context, eventType EventLogType, user *User) error
 	SaveMerchantUpdateEvents(ctx context.Context, eventType EventLogType, merchant *Merchant) error
 	SaveProgramUpdateEvents(ctx context.Context, eventType EventLogType, program *Program) error
@@ -19,25 +19,37 @@ type Merchant struct {
 	UserID    uuid.UUID    `json:"user_id"`
 	Name      string       `json:"merchant_name"`
 	Type      MerchantType `json:"merchant_type"`
+	Timezone  string       `json:"timezone"` // IANA name, local time for date based program rules
 	CreatedAt time.Time    `json:"created_at"`
 	UpdatedAt time.Time    `json:"updated_at"`
 	Status    string       `json:"status"`
 }
 
+// Location returns the merchant's timezone, falling back to UTC when it is unknown
+func (m *Merchant) Location() *time.Location {
+	loc, err := time.LoadLocation(m.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 type MerchantList struct {
 	ID   uuid.UUID `json:"id"`
 	Name string    `json:"merchant_name"`
 }
 
 type CreateMerchantRequest struct {
-	UserID uuid.UUID    `json:"user_id" binding:"required"`
-	Name   string       `json:"merchant_name" binding:"required"`
-	Type   MerchantType `json:"merchant_type" binding:"required"`
+	UserID   uuid.UUID    `json:"user_id" binding:"required"`
+	Name     string       `json:"merchant_name" binding:"required"`
+	Type     MerchantType `json:"merchant_type" binding:"required"`
+	Timezone string       `json:"timezone,omitempty"` // defaults to UTC
 }
 
 type UpdateMerchantRequest struct {
-	Name string       `json:"merchant_name" binding:"required"`
-	Type MerchantType `json:"merchant_type" binding:"required"`
+	Name     string       `json:"merchant_name" binding:"required"`
+	Type     MerchantType `json:"merchant_type" binding:"required"`
+	Timezone string       `json:"timezone,omitempty"`
 }
 
 // Pagination represents pagination metadata
@@ -9,14 +9,59 @@ import (
 
 // MerchantCustomer represents a customer of a merchant
 type MerchantCustomer struct {
-	ID         uuid.UUID `json:"id"`
-	MerchantID uuid.UUID `json:"merchant_id"`
-	Email      string    `json:"email"`
-	Password   string    `json:"password"`
-	Name       string    `json:"name"`
-	Phone      string    `json:"phone"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID          uuid.UUID  `json:"id"`
+	MerchantID  uuid.UUID  `json:"merchant_id"`
+	Email       string     `json:"email"`
+	Password    string     `json:"password"`
+	Name        string     `json:"name"`
+	Phone       string     `json:"phone"`
+	DateOfBirth *time.Time `json:"date_of_birth,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// CustomerContext holds the customer facts that tenure, transaction count and
+// transaction date rules are evaluated against
+type CustomerContext struct {
+	MerchantCustomersID uuid.UUID  `json:"merchant_customers_id"`
+	ProgramID           uuid.UUID  `json:"program_id"`
+	TransactionCount    int        `json:"transaction_count"` // completed transactions in the program
+	MemberSince         time.Time  `json:"member_since"`
+	DateOfBirth         *time.Time `json:"date_of_birth,omitempty"`
+	Timezone            string     `json:"timezone"` // the merchant's, see Merchant.Timezone
+}
+
+// MembershipTenure returns the number of whole days the customer has been a member at the given time
+func (c *CustomerContext) MembershipTenure(at time.Time) int {
+	if c.MemberSince.IsZero() || at.Before(c.MemberSince) {
+		return 0
+	}
+	return int(at.Sub(c.MemberSince).Hours() / 24)
+}
+
+// Location returns the merchant's timezone, falling back to UTC when it is unknown
+func (c *CustomerContext) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// CustomerContextCache caches customer contexts per customer and program.
+// Every invalidation starts a new generation; Get returns the current one and
+// Set only stores a context derived in it, so a read that started before an
+// invalidation can not cache what it read.
+type CustomerContextCache interface {
+	Get(ctx context.Context, customerID, programID uuid.UUID) (*CustomerContext, int64, error)
+	Set(ctx context.Context, customerContext *CustomerContext, generation int64) error
+	Invalidate(ctx context.Context, customerID, programID uuid.UUID) error
+}
+
+// CustomerContextProvider derives the customer context used for rule evaluation
+type CustomerContextProvider interface {
+	GetCustomerContext(ctx context.Context, customerID, programID uuid.UUID) (*CustomerContext, error)
+	InvalidateCustomerContext(ctx context.Context, customerID, programID uuid.UUID) error
 }
 
 // MerchantCustomersRepository defines the interface for merchant customer data operations
@@ -47,6 +92,8 @@ type CreateMerchantCustomerRequest struct {
 	Password   string    `json:"password" validate:"required,min=6"`
 	Name       string    `json:"name" validate:"required"`
 	Phone      string    `json:"phone" validate:"required"`
+	// DateOfBirth is a calendar date, ie 1990-04-21
+	DateOfBirth string `json:"date_of_birth,omitempty"`
 }
 
 // UpdateMerchantCustomerRequest represents the request to update an existing merchant customer
@@ -55,6 +102,8 @@ type UpdateMerchantCustomerRequest struct {
 	Password string `json:"password" validate:"omitempty,min=6"`
 	Name     string `json:"name"`
 	Phone    string `json:"phone"`
+	// DateOfBirth is a calendar date, ie 1990-04-21
+	DateOfBirth string `json:"date_of_birth,omitempty"`
 }
 
 // CustomerLoginRequest represents the login request for merchant customers
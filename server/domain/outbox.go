@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DomainEventsTopic is the Kafka topic the outbox relay publishes domain
+// events to, keyed by customer so one customer's events stay in order.
+const DomainEventsTopic = "loyalty.domain-events"
+
+// DomainEvent is the message published for a domain event. The same event can
+// be delivered more than once, consumers dedupe on EventID.
+type DomainEvent struct {
+	EventID    uuid.UUID              `json:"event_id"`
+	EventType  EventLogType           `json:"event_type"`
+	CustomerID uuid.UUID              `json:"customer_id"`
+	ProgramID  uuid.UUID              `json:"program_id"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// eventTopics are the in-process topics domain events are published on
+var eventTopics = map[EventLogType]string{
+	TransactionCreated:       "transaction.created",
+	TransactionStatusUpdated: "transaction.status_updated",
+	PointsEarned:             "points.earned",
+	PointsRedeemed:           "points.redeemed",
+	RewardRedeemed:           "reward.redeemed",
+	RedemptionStatusUpdated:  "redemption.status_updated",
+	RewardLowStock:           "reward.low_stock",
+}
+
+// EventTopic returns the in-process topic of an event type, like
+// "points.earned". Listeners can subscribe to "points.*" or ">" for all.
+func EventTopic(eventType EventLogType) string {
+	if topic, ok := eventTopics[eventType]; ok {
+		return topic
+	}
+	return string(eventType)
+}
+
+// EventBus carries committed domain events to in-process listeners, such as
+// cache invalidation. Delivery is best effort, the outbox is the
+// durable record.
+type EventBus interface {
+	Publish(ctx context.Context, topic string, event DomainEvent)
+}
+
+// OutboxEvent is a domain event waiting in the outbox to be published.
+type OutboxEvent struct {
+	ID           uuid.UUID       `json:"id"`
+	Topic        string          `json:"topic"`
+	PartitionKey string          `json:"partition_key"`
+	EventType    EventLogType    `json:"event_type"`
+	Payload      json.RawMessage `json:"payload"`
+	Attempts     int             `json:"attempts"`
+	LastError    *string         `json:"last_error,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	PublishedAt  *time.Time      `json:"published_at,omitempty"`
+}
+
+// OutboxRepository stores domain events until they are published. Create
+// joins the unit of work in ctx, so an event is only kept if the change it
+// describes commits.
+type OutboxRepository interface {
+	Create(ctx context.Context, event *OutboxEvent) error
+	// ClaimUnpublished locks the oldest unpublished events that are not dead
+	// for the unit of work in ctx. It returns nothing while another relay
+	// holds the outbox.
+	ClaimUnpublished(ctx context.Context, limit int) ([]*OutboxEvent, error)
+	MarkPublished(ctx context.Context, ids []uuid.UUID) error
+	MarkFailed(ctx context.Context, id uuid.UUID, reason string) error
+	// MarkDead gives up on an event, it is never claimed again
+	MarkDead(ctx context.Context, id uuid.UUID, reason string) error
+}
+
+// EventPublisher delivers messages to a broker. Messages with the same key
+// land on the same partition.
+type EventPublisher interface {
+	Publish(ctx context.Context, topic, key string, value []byte) error
+}
+
+// OutboxRelayRun summarizes one pass of the outbox relay
+type OutboxRelayRun struct {
+	Published int `json:"published"`
+	Failed    int `json:"failed"`
+	Dead      int `json:"dead"`
+}
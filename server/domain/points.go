@@ -1,43 +1,119 @@
 package domain
 
 import (
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type PointsLedger struct {
-	LedgerID            uuid.UUID `json:"ledger_id"`
-	MerchantCustomersID uuid.UUID `json:"merchant_customers_id"`
-	ProgramID           uuid.UUID `json:"program_id"`
-	PointsEarned        int       `json:"points_earned"`
-	PointsRedeemed      int       `json:"points_redeemed"`
-	PointsBalance       int       `json:"points_balance"`
-	TransactionID       uuid.UUID `json:"transaction_id,omitempty"`
-	CreatedAt           time.Time `json:"created_at"`
+	LedgerID            uuid.UUID  `json:"ledger_id"`
+	MerchantCustomersID uuid.UUID  `json:"merchant_customers_id"`
+	ProgramID           uuid.UUID  `json:"program_id"`
+	PointsEarned        int        `json:"points_earned"`
+	PointsRedeemed      int        `json:"points_redeemed"`
+	PointsBalance       int        `json:"points_balance"`
+	PointsDebt          int        `json:"points_debt,omitempty"` // points taken by allow_negative reversals that earns have not paid off yet
+	TransactionID       uuid.UUID  `json:"transaction_id,omitempty"`
+	RuleSetID           *uuid.UUID `json:"rule_set_id,omitempty"` // the rule set version that produced earned points
+	TxType              string     `json:"tx_type,omitempty"`     // set on point_expiration and point_reversal entries
+	CreatedAt           time.Time  `json:"created_at"`
+
+	// ExpiresAt is when the lot opened by an earn expires, nil when it does
+	// not expire on a date
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Allocations are the lots a redemption or expiration consumed
+	Allocations []*PointsLotAllocation `json:"allocations,omitempty"`
+	// RefundPolicy is how a debit the balance does not cover is handled, one
+	// of the RefundPolicy values. Only reversals set it, everything else blocks
+	RefundPolicy string `json:"-"`
+}
+
+// PointsLot is the points of one earn. Remaining goes down as redemptions and
+// expirations consume it, oldest lot first.
+type PointsLot struct {
+	LotID               uuid.UUID  `json:"lot_id"`
+	LedgerID            uuid.UUID  `json:"ledger_id"`
+	MerchantCustomersID uuid.UUID  `json:"merchant_customers_id"`
+	ProgramID           uuid.UUID  `json:"program_id"`
+	TransactionID       *uuid.UUID `json:"transaction_id,omitempty"`
+	Points              int        `json:"points"`
+	Remaining           int        `json:"remaining"`
+	EarnedAt            time.Time  `json:"earned_at"`
+	ExpiresAt           *time.Time `json:"expires_at,omitempty"`
+}
+
+// PointsLotAllocation is how many points of a lot a debit entry consumed.
+type PointsLotAllocation struct {
+	AllocationID uuid.UUID `json:"allocation_id"`
+	LotID        uuid.UUID `json:"lot_id"`
+	LedgerID     uuid.UUID `json:"ledger_id"`
+	Points       int       `json:"points"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
+// Reward is something customers redeem their points for. AvailableQuantity
+// is the stock left, a reward without it is not limited. Quantity is how many
+// the merchant stocked.
 type Reward struct {
-	ID                uuid.UUID `json:"id"`
-	ProgramID         uuid.UUID `json:"program_id"`
-	Name              string    `json:"name"`
-	Description       string    `json:"description"`
-	PointsRequired    int       `json:"points_required"`
-	AvailableQuantity *int      `json:"available_quantity,omitempty"`
-	Quantity          int       `json:"quantity"`
-	IsActive          bool      `json:"is_active"`
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
+	ID                  uuid.UUID `json:"id"`
+	ProgramID           uuid.UUID `json:"program_id"`
+	Name                string    `json:"name"`
+	Description         string    `json:"description"`
+	PointsRequired      int       `json:"points_required"`
+	AvailableQuantity   *int      `json:"available_quantity,omitempty"`
+	Quantity            int       `json:"quantity"`
+	MaxPerCustomer      *int      `json:"max_per_customer,omitempty"`    // how often a customer can redeem it, only pending, approved and fulfilled redemptions count
+	LowStockThreshold   *int      `json:"low_stock_threshold,omitempty"` // reward_low_stock is published when the stock drops to it
+	VoucherSource       string    `json:"voucher_source"`
+	VoucherValidityDays *int      `json:"voucher_validity_days,omitempty"` // days its vouchers can be used, a pool code's own expiry comes first
+	MinPoints           *int      `json:"min_points,omitempty"`            // least points burned when paying partly in cash, nil for points only
+	CashPerPoint        *float64  `json:"cash_per_point,omitempty"`        // cash charged for each point short of points_required
+	IsActive            bool      `json:"is_active"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
 }
 
 type RedemptionStatus string
 
+// Redemption statuses. A redemption is pending until the merchant approves it
+// or its voucher is used, fulfilled, cancelled, expired and failed are final.
 const (
-	RedemptionStatusCompleted RedemptionStatus = "completed"
 	RedemptionStatusPending   RedemptionStatus = "pending"
+	RedemptionStatusApproved  RedemptionStatus = "approved"
+	RedemptionStatusFulfilled RedemptionStatus = "fulfilled" // the customer got the reward
+	RedemptionStatusCancelled RedemptionStatus = "cancelled"
+	RedemptionStatusExpired   RedemptionStatus = "expired" // the voucher was not used in time
 	RedemptionStatusFailed    RedemptionStatus = "failed"
 )
 
+// redemptionTransitions are the statuses each status can move to
+var redemptionTransitions = map[RedemptionStatus][]RedemptionStatus{
+	RedemptionStatusPending: {RedemptionStatusApproved, RedemptionStatusFulfilled, RedemptionStatusCancelled,
+		RedemptionStatusExpired, RedemptionStatusFailed},
+	RedemptionStatusApproved: {RedemptionStatusFulfilled, RedemptionStatusCancelled, RedemptionStatusExpired,
+		RedemptionStatusFailed},
+}
+
+// CanTransitionRedemption reports whether a redemption can move from one status to another
+func CanTransitionRedemption(from, to RedemptionStatus) bool {
+	return slices.Contains(redemptionTransitions[from], to)
+}
+
+// RefundsPoints reports whether a redemption ending in the status gives the
+// customer back the points it took. An expired redemption's points are
+// forfeited, the customer did not use the voucher in time.
+func (s RedemptionStatus) RefundsPoints() bool {
+	return s == RedemptionStatusCancelled || s == RedemptionStatusFailed
+}
+
+// ReleasesReward reports whether a redemption ending in the status puts its
+// reward back in stock and voids its voucher.
+func (s RedemptionStatus) ReleasesReward() bool {
+	return s == RedemptionStatusCancelled || s == RedemptionStatusExpired || s == RedemptionStatusFailed
+}
+
 type Redemption struct {
 	ID                  uuid.UUID        `json:"id"`
 	MerchantCustomersID uuid.UUID        `json:"merchant_customers_id"`
@@ -45,6 +121,10 @@ type Redemption struct {
 	PointsUsed          int              `json:"points_used"`
 	RedemptionDate      time.Time        `json:"redemption_date"`
 	Status              RedemptionStatus `json:"status"`
+	TransactionID       *uuid.UUID       `json:"transaction_id,omitempty"` // the transaction that took its points
+	GroupID             *uuid.UUID       `json:"group_id,omitempty"`       // the cart it was redeemed with
+	CashAmount          float64          `json:"cash_amount"`              // paid alongside points_used for points and cash rewards
+	Voucher             *Voucher         `json:"voucher,omitempty"`
 	CreatedAt           time.Time        `json:"created_at"`
 	UpdatedAt           time.Time        `json:"updated_at"`
 }
@@ -53,6 +133,28 @@ type PointsBalance struct {
 	CustomerID string `json:"customer_id"`
 	ProgramID  string `json:"program_id"`
 	Balance    int    `json:"balance"`
+	Pending    int    `json:"pending"` // held for pending transactions, not spendable yet
+}
+
+// A hold is released into the balance when its transaction completes and
+// voided when it fails or is cancelled.
+const (
+	PointsHoldHeld     = "held"
+	PointsHoldReleased = "released"
+	PointsHoldVoided   = "voided"
+)
+
+// PointsHold is the points a pending transaction will earn once it completes.
+type PointsHold struct {
+	HoldID              uuid.UUID  `json:"hold_id"`
+	TransactionID       uuid.UUID  `json:"transaction_id"`
+	MerchantCustomersID uuid.UUID  `json:"merchant_customers_id"`
+	ProgramID           uuid.UUID  `json:"program_id"`
+	Points              int        `json:"points"`
+	RuleSetID           *uuid.UUID `json:"rule_set_id,omitempty"`
+	Status              string     `json:"status"`
+	CreatedAt           time.Time  `json:"created_at"`
+	ResolvedAt          *time.Time `json:"resolved_at,omitempty"`
 }
 
 type PointsTransaction struct {
@@ -60,8 +162,14 @@ type PointsTransaction struct {
 	CustomerID    string    `json:"customer_id"`
 	ProgramID     string    `json:"program_id"`
 	Points        int       `json:"points"`
-	Type          string    `json:"type"` // "earn" or "redeem"
+	Type          string    `json:"type"` // "earn", "redeem" or "reverse"
+	RuleSetID     string    `json:"rule_set_id,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
+	// EarnedAt is when an earn's points count from for expiry, the date of
+	// the transaction that earned them. Zero is now
+	EarnedAt time.Time `json:"-"`
+	// Allocations are the lots a redemption consumed
+	Allocations []*PointsLotAllocation `json:"allocations,omitempty"`
 }
 
 type EarnPointsRequest struct {
@@ -79,31 +187,79 @@ type RedeemPointsRequest struct {
 type CreateRedemptionRequest struct {
 	MerchantCustomersID uuid.UUID `json:"merchant_customers_id" binding:"required"`
 	RewardID            uuid.UUID `json:"reward_id" binding:"required"`
-	PointsUsed          int       `json:"points_used" binding:"required,gt=0"`
+	PointsUsed          int       `json:"points_used" binding:"required,gt=0"` // points to burn, the rest is paid in cash on points and cash rewards
 	PointsRequired      int       `json:"points_required" binding:"required,gt=0"`
 	RedemptionDate      time.Time `json:"redemption_date" binding:"required"`
-	RedemptionStatus    string    `json:"status" binding:"required,oneof=pending completed failed"`
+	RedemptionStatus    string    `json:"status" binding:"omitempty,oneof=pending"` // new redemptions are always pending
+}
+
+type RedemptionCartItem struct {
+	RewardID uuid.UUID `json:"reward_id" binding:"required"`
+	Quantity int       `json:"quantity" binding:"required,gt=0,max=100"`
+}
+
+// CreateRedemptionCartRequest redeems several rewards of one program at once.
+// Either every item is redeemed or none is.
+type CreateRedemptionCartRequest struct {
+	MerchantCustomersID uuid.UUID            `json:"merchant_customers_id" binding:"required"`
+	Items               []RedemptionCartItem `json:"items" binding:"required,min=1,max=50,dive"`
+}
+
+// RedemptionGroup is the redemptions of a cart, one per unit of each reward,
+// paid for with a single transaction.
+type RedemptionGroup struct {
+	GroupID             uuid.UUID     `json:"group_id"`
+	MerchantCustomersID uuid.UUID     `json:"merchant_customers_id"`
+	TransactionID       *uuid.UUID    `json:"transaction_id,omitempty"`
+	PointsUsed          int           `json:"points_used"`
+	Redemptions         []*Redemption `json:"redemptions"`
 }
 
 type UpdateRedemptionRequest struct {
-	Status string `json:"status"`
+	Status    string `json:"status" binding:"required,oneof=approved fulfilled cancelled expired failed"`
+	Reason    string `json:"reason,omitempty" binding:"max=500"`
+	ChangedBy string `json:"-"` // the user making the change
+}
+
+// RedemptionStatusChange is an entry of a redemption's audit trail.
+type RedemptionStatusChange struct {
+	ID                  uuid.UUID         `json:"id"`
+	RedemptionID        uuid.UUID         `json:"redemption_id"`
+	FromStatus          *RedemptionStatus `json:"from_status,omitempty"` // nil when the redemption was created
+	ToStatus            RedemptionStatus  `json:"to_status"`
+	Reason              string            `json:"reason,omitempty"`
+	ChangedBy           string            `json:"changed_by,omitempty"`
+	RefundTransactionID *uuid.UUID        `json:"refund_transaction_id,omitempty"` // the refund that gave the points back
+	CreatedAt           time.Time         `json:"created_at"`
 }
 
 type CreateRewardRequest struct {
-	ProgramID         uuid.UUID `json:"program_id" binding:"required"`
-	Name              string    `json:"name" binding:"required"`
-	Description       string    `json:"description" binding:"required"`
-	PointsRequired    int       `json:"points_required" binding:"required,gt=0"`
-	AvailableQuantity *int      `json:"available_quantity,omitempty"`
-	Quantity          int       `json:"quantity"`
-	IsActive          bool      `json:"is_active"`
+	ProgramID           uuid.UUID `json:"program_id" binding:"required"`
+	Name                string    `json:"name" binding:"required"`
+	Description         string    `json:"description" binding:"required"`
+	PointsRequired      int       `json:"points_required" binding:"required,gt=0"`
+	AvailableQuantity   *int      `json:"available_quantity,omitempty"`
+	Quantity            int       `json:"quantity"`
+	MaxPerCustomer      *int      `json:"max_per_customer,omitempty"`
+	LowStockThreshold   *int      `json:"low_stock_threshold,omitempty"`
+	VoucherSource       string    `json:"voucher_source,omitempty" binding:"omitempty,oneof=generated pool"`
+	VoucherValidityDays *int      `json:"voucher_validity_days,omitempty"`
+	MinPoints           *int      `json:"min_points,omitempty"`
+	CashPerPoint        *float64  `json:"cash_per_point,omitempty"`
+	IsActive            bool      `json:"is_active"`
 }
 
 type UpdateRewardRequest struct {
-	Name              string `json:"name,omitempty"`
-	Description       string `json:"description,omitempty"`
-	PointsRequired    *int   `json:"points_required,omitempty"`
-	AvailableQuantity *int   `json:"available_quantity,omitempty"`
-	Quantity          *int   `json:"quantity,omitempty"`
-	IsActive          *bool  `json:"is_active,omitempty"`
+	Name                string   `json:"name,omitempty"`
+	Description         string   `json:"description,omitempty"`
+	PointsRequired      *int     `json:"points_required,omitempty"`
+	AvailableQuantity   *int     `json:"available_quantity,omitempty"`
+	Quantity            *int     `json:"quantity,omitempty"`
+	MaxPerCustomer      *int     `json:"max_per_customer,omitempty"`
+	LowStockThreshold   *int     `json:"low_stock_threshold,omitempty"`
+	VoucherSource       string   `json:"voucher_source,omitempty" binding:"omitempty,oneof=generated pool"`
+	VoucherValidityDays *int     `json:"voucher_validity_days,omitempty"`
+	MinPoints           *int     `json:"min_points,omitempty"` // 0 makes the reward points only
+	CashPerPoint        *float64 `json:"cash_per_point,omitempty"`
+	IsActive            *bool    `json:"is_active,omitempty"`
 }
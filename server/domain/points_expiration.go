@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Points expiry policies. A program without a policy never expires points.
+// Dated policies stamp each lot with its expiry when it is earned, so changing
+// the policy only affects points earned afterwards.
+const (
+	ExpiryFixedDays    = "fixed_days"    // each earn expires Days days after it was earned
+	ExpiryCalendarYear = "calendar_year" // each earn expires when the year it was earned in ends
+	ExpiryInactivity   = "inactivity"    // every point expires Days days after the last earn or redemption
+)
+
+// PointTxExpiration is the ledger type of the entries that take expired
+// points off a balance.
+const PointTxExpiration = "point_expiration"
+
+// PointTxReversal is the ledger type of the entries that take back the points
+// of a refunded or cancelled transaction.
+const PointTxReversal = "point_reversal"
+
+type PointsExpiryPolicy struct {
+	ProgramID uuid.UUID `json:"program_id"`
+	Policy    string    `json:"policy"`
+	Days      *int      `json:"days,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SetPointsExpiryPolicyRequest struct {
+	Policy string `json:"policy" binding:"required,oneof=fixed_days calendar_year inactivity"`
+	Days   *int   `json:"days,omitempty" binding:"omitempty,gt=0"`
+}
+
+// PointsAccount is a customer's points in one program.
+type PointsAccount struct {
+	MerchantCustomersID uuid.UUID `json:"merchant_customers_id"`
+	ProgramID           uuid.UUID `json:"program_id"`
+}
+
+// PointsExpiration is a number of unspent points that expire together.
+type PointsExpiration struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Points    int       `json:"points"`
+}
+
+type UpcomingExpirations struct {
+	CustomerID  uuid.UUID          `json:"customer_id"`
+	ProgramID   uuid.UUID          `json:"program_id"`
+	Policy      string             `json:"policy,omitempty"`
+	Balance     int                `json:"balance"`
+	Expirations []PointsExpiration `json:"expirations"`
+}
+
+// PointsExpirationRun is what one pass of the expiration worker did.
+type PointsExpirationRun struct {
+	AccountsProcessed int `json:"accounts_processed"`
+	AccountsExpired   int `json:"accounts_expired"`
+	PointsExpired     int `json:"points_expired"`
+	Failures          int `json:"failures"`
+}
@@ -7,17 +7,139 @@ import (
 )
 
 type ProgramRule struct {
-	ID             uuid.UUID  `json:"id"`
-	ProgramID      uuid.UUID  `json:"program_id"`
-	RuleName       string     `json:"rule_name"`
-	ConditionType  string     `json:"condition_type"`
-	ConditionValue string     `json:"condition_value"`
-	Multiplier     float64    `json:"multiplier"`
-	PointsAwarded  int        `json:"points_awarded"`
-	EffectiveFrom  time.Time  `json:"effective_from"`
-	EffectiveTo    *time.Time `json:"effective_to,omitempty"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
+	ID                            uuid.UUID  `json:"id"`
+	ProgramID                     uuid.UUID  `json:"program_id"`
+	RuleSetID                     uuid.UUID  `json:"rule_set_id"`
+	RuleKey                       uuid.UUID  `json:"rule_key"` // shared by the copies of a rule across rule set versions
+	RuleName                      string     `json:"rule_name"`
+	ConditionType                 string     `json:"condition_type"`
+	ConditionValue                string     `json:"condition_value"`
+	Multiplier                    float64    `json:"multiplier"`
+	PointsAwarded                 int        `json:"points_awarded"`
+	Priority                      int        `json:"priority"` // higher priority rules are applied first
+	Stacking                      string     `json:"stacking"` // stackable, non_stackable, exclusive
+	MaxPointsPerTransaction       *int       `json:"max_points_per_transaction,omitempty"`
+	MaxPointsPerCustomerPerPeriod *int       `json:"max_points_per_customer_per_period,omitempty"`
+	CapPeriod                     string     `json:"cap_period,omitempty"` // day, week, month, year
+	EffectiveFrom                 time.Time  `json:"effective_from"`
+	EffectiveTo                   *time.Time `json:"effective_to,omitempty"`
+	CreatedAt                     time.Time  `json:"created_at"`
+	UpdatedAt                     time.Time  `json:"updated_at"`
+}
+
+// How a matching rule combines with the other matching rules of a transaction.
+// An empty Stacking is treated as RuleStackable.
+const (
+	RuleStackable    = "stackable"     // adds on top of every other matching rule
+	RuleNonStackable = "non_stackable" // only the highest priority non_stackable rule applies
+	RuleExclusive    = "exclusive"     // the highest priority exclusive rule is the only rule applied
+)
+
+// Rule set versions. A program has at most one draft and one published
+// version, publishing a version archives the one it replaces.
+const (
+	RuleSetDraft     = "draft"
+	RuleSetPublished = "published"
+	RuleSetArchived  = "archived"
+)
+
+// ProgramRuleSet is a numbered version of a program's rules. Only drafts can
+// be edited.
+type ProgramRuleSet struct {
+	ID          uuid.UUID      `json:"id"`
+	ProgramID   uuid.UUID      `json:"program_id"`
+	Version     int            `json:"version"`
+	Status      string         `json:"status"`
+	Description string         `json:"description,omitempty"`
+	PublishedAt *time.Time     `json:"published_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Rules       []*ProgramRule `json:"rules,omitempty"`
+}
+
+type CreateRuleSetRequest struct {
+	ProgramID   uuid.UUID `json:"program_id" binding:"required"`
+	Description string    `json:"description,omitempty"`
+}
+
+// Why a rule awarded nothing on a transaction.
+const (
+	RuleSkipExpired         = "expired"
+	RuleSkipNotYetEffective = "not_yet_effective"
+	RuleSkipConditionFalse  = "condition_false"
+	RuleSkipCapReached      = "cap_reached" // the customer cap for the period is used up
+	RuleSkipOverridden      = "overridden"  // an exclusive or higher priority non_stackable rule won
+)
+
+// Periods a per customer cap can be counted over.
+const (
+	CapPeriodDay   = "day"
+	CapPeriodWeek  = "week"
+	CapPeriodMonth = "month"
+	CapPeriodYear  = "year"
+)
+
+// ProgramRuleAward is what one rule paid out on one transaction.
+type ProgramRuleAward struct {
+	ID                  uuid.UUID `json:"id"`
+	RuleID              uuid.UUID `json:"rule_id"`
+	MerchantCustomersID uuid.UUID `json:"merchant_customers_id"`
+	TransactionID       uuid.UUID `json:"transaction_id"`
+	Points              int       `json:"points"`
+	AwardedAt           time.Time `json:"awarded_at"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// RuleContext is what a program rule is evaluated against: the transaction
+// itself plus customer facts that are not stored on the transaction row.
+type RuleContext struct {
+	Transaction      *Transaction
+	TransactionCount int
+	MembershipTenure int    // in days
+	MerchantGroupID  string // merchant groups are not modelled yet
+	// Date rules see the transaction date in the merchant's timezone and may
+	// match on the customer's birthday or membership anniversary
+	Location    *time.Location
+	DateOfBirth *time.Time
+	MemberSince time.Time
+	// PeriodAwards holds, per rule ID, the points the rule already awarded the
+	// customer in the current cap period. Only rules with a customer cap are listed.
+	PeriodAwards map[uuid.UUID]int
+}
+
+// SimulateRulesRequest is a hypothetical transaction to run through a
+// program's published rules, or the rules of RuleSetID. Without a customer,
+// customer based rules see a new member with no history. TransactionDate
+// defaults to now.
+type SimulateRulesRequest struct {
+	ProgramID           uuid.UUID  `json:"program_id" binding:"required"`
+	RuleSetID           *uuid.UUID `json:"rule_set_id,omitempty"`
+	MerchantCustomersID *uuid.UUID `json:"merchant_customers_id,omitempty"`
+	TransactionType     string     `json:"transaction_type" binding:"required"`
+	TransactionAmount   float64    `json:"transaction_amount" binding:"required,gt=0"`
+	Category            string     `json:"category,omitempty"`
+	TransactionDate     *time.Time `json:"transaction_date,omitempty"`
+}
+
+// RuleSimulation is how one rule fared in a simulation.
+type RuleSimulation struct {
+	RuleID         uuid.UUID `json:"rule_id"`
+	RuleName       string    `json:"rule_name"`
+	ConditionType  string    `json:"condition_type"`
+	ConditionValue string    `json:"condition_value"`
+	Priority       int       `json:"priority"`
+	Stacking       string    `json:"stacking"`
+	Matched        bool      `json:"matched"`
+	Points         int       `json:"points"`
+	SkipReason     string    `json:"skip_reason,omitempty"` // see RuleSkipExpired and friends
+}
+
+type SimulateRulesResponse struct {
+	ProgramID       uuid.UUID        `json:"program_id"`
+	RuleSetID       *uuid.UUID       `json:"rule_set_id,omitempty"`
+	TransactionDate time.Time        `json:"transaction_date"`
+	TotalPoints     int              `json:"total_points"`
+	Rules           []RuleSimulation `json:"rules"`
 }
 
 type CreateProgramRuleRequest struct {
@@ -29,6 +151,12 @@ type CreateProgramRuleRequest struct {
 	PointsAwarded  int        `json:"points_awarded" binding:"required,gte=0"`
 	EffectiveFrom  time.Time  `json:"effective_from" binding:"required"`
 	EffectiveTo    *time.Time `json:"effective_to,omitempty"`
+
+	Priority                      int    `json:"priority,omitempty"`
+	Stacking                      string `json:"stacking,omitempty" binding:"omitempty,oneof=stackable non_stackable exclusive"`
+	MaxPointsPerTransaction       *int   `json:"max_points_per_transaction,omitempty" binding:"omitempty,gte=0"`
+	MaxPointsPerCustomerPerPeriod *int   `json:"max_points_per_customer_per_period,omitempty" binding:"omitempty,gte=0"`
+	CapPeriod                     string `json:"cap_period,omitempty" binding:"omitempty,oneof=day week month year"`
 }
 
 type UpdateProgramRuleRequest struct {
@@ -39,6 +167,12 @@ type UpdateProgramRuleRequest struct {
 	PointsAwarded  *int       `json:"points_awarded,omitempty"`
 	EffectiveFrom  *time.Time `json:"effective_from,omitempty"`
 	EffectiveTo    *time.Time `json:"effective_to,omitempty"`
+
+	Priority                      *int   `json:"priority,omitempty"`
+	Stacking                      string `json:"stacking,omitempty" binding:"omitempty,oneof=stackable non_stackable exclusive"`
+	MaxPointsPerTransaction       *int   `json:"max_points_per_transaction,omitempty" binding:"omitempty,gte=0"`
+	MaxPointsPerCustomerPerPeriod *int   `json:"max_points_per_customer_per_period,omitempty" binding:"omitempty,gte=0"`
+	CapPeriod                     string `json:"cap_period,omitempty" binding:"omitempty,oneof=day week month year"`
 }
 
 type CreateProgramResponse struct {
@@ -50,12 +184,21 @@ type CreateProgramResponse struct {
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
+// Refund policies decide what a refund or cancellation does when the customer
+// has already spent the points it takes back. A program without one blocks.
+const (
+	RefundPolicyBlock         = "block"          // the refund fails with INSUFFICIENT_POINTS
+	RefundPolicyClawBack      = "claw_back"      // takes back what is left of the balance, the rest is written off
+	RefundPolicyAllowNegative = "allow_negative" // takes back everything, later earns pay off the negative balance
+)
+
 type Program struct {
 	ID                uuid.UUID `json:"program_id"`
 	MerchantID        uuid.UUID `json:"merchant_id"`
 	UserID            uuid.UUID `json:"user_id"`
 	ProgramName       string    `json:"program_name"`
 	PointCurrencyName string    `json:"point_currency_name"`
+	RefundPolicy      string    `json:"refund_policy"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
@@ -65,9 +208,11 @@ type CreateProgramRequest struct {
 	UserID            uuid.UUID `json:"user_id" binding:"required"`
 	ProgramName       string    `json:"program_name" binding:"required"`
 	PointCurrencyName string    `json:"point_currency_name" binding:"required"`
+	RefundPolicy      string    `json:"refund_policy,omitempty" binding:"omitempty,oneof=block claw_back allow_negative"`
 }
 
 type UpdateProgramRequest struct {
 	ProgramName       string `json:"program_name,omitempty"`
 	PointCurrencyName string `json:"point_currency_name,omitempty"`
+	RefundPolicy      string `json:"refund_policy,omitempty" binding:"omitempty,oneof=block claw_back allow_negative"`
 }
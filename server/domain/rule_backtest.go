@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A backtest moves from queued to running, then to completed or failed.
+const (
+	BacktestQueued    = "queued"
+	BacktestRunning   = "running"
+	BacktestCompleted = "completed"
+	BacktestFailed    = "failed"
+)
+
+// RuleBacktest replays a program's earning transactions in [From, To) against
+// a draft rule set and compares the points it would have issued with the
+// points that were actually issued.
+type RuleBacktest struct {
+	ID                    uuid.UUID      `json:"id"`
+	ProgramID             uuid.UUID      `json:"program_id"`
+	RuleSetID             *uuid.UUID     `json:"rule_set_id,omitempty"` // set when a saved rule set was replayed
+	Status                string         `json:"status"`
+	From                  time.Time      `json:"from"`
+	To                    time.Time      `json:"to"`
+	Rules                 []*ProgramRule `json:"rules"`
+	TransactionsProcessed int64          `json:"transactions_processed"`
+	CustomersCount        int64          `json:"customers_count"`
+	TotalPoints           int64          `json:"total_points"`  // what the draft rules would have issued
+	ActualPoints          int64          `json:"actual_points"` // what was issued on the ledger
+	PointsDelta           int64          `json:"points_delta"`  // TotalPoints - ActualPoints
+	Error                 string         `json:"error,omitempty"`
+	CreatedAt             time.Time      `json:"created_at"`
+	StartedAt             *time.Time     `json:"started_at,omitempty"`
+	CompletedAt           *time.Time     `json:"completed_at,omitempty"`
+}
+
+// RuleBacktestCustomer is one customer's share of a backtest.
+type RuleBacktestCustomer struct {
+	BacktestID          uuid.UUID `json:"backtest_id"`
+	MerchantCustomersID uuid.UUID `json:"merchant_customers_id"`
+	TransactionCount    int       `json:"transaction_count"`
+	Points              int64     `json:"points"`
+	ActualPoints        int64     `json:"actual_points"`
+	PointsDelta         int64     `json:"points_delta"`
+}
+
+// BacktestTransaction is a past transaction together with what the rules
+// need to know about its customer and the points it actually earned.
+type BacktestTransaction struct {
+	Transaction
+	MemberSince  time.Time
+	DateOfBirth  *time.Time
+	ActualPoints int
+}
+
+// DraftProgramRule is a rule that is evaluated without being saved.
+type DraftProgramRule struct {
+	RuleName       string     `json:"rule_name" binding:"required"`
+	ConditionType  string     `json:"condition_type" binding:"required"`
+	ConditionValue string     `json:"condition_value" binding:"required"`
+	Multiplier     float64    `json:"multiplier" binding:"required,gt=0"`
+	PointsAwarded  int        `json:"points_awarded" binding:"gte=0"`
+	EffectiveFrom  time.Time  `json:"effective_from" binding:"required"`
+	EffectiveTo    *time.Time `json:"effective_to,omitempty"`
+
+	Priority                      int    `json:"priority,omitempty"`
+	Stacking                      string `json:"stacking,omitempty" binding:"omitempty,oneof=stackable non_stackable exclusive"`
+	MaxPointsPerTransaction       *int   `json:"max_points_per_transaction,omitempty" binding:"omitempty,gte=0"`
+	MaxPointsPerCustomerPerPeriod *int   `json:"max_points_per_customer_per_period,omitempty" binding:"omitempty,gte=0"`
+	CapPeriod                     string `json:"cap_period,omitempty" binding:"omitempty,oneof=day week month year"`
+}
+
+// CreateRuleBacktestRequest replays either a saved rule set version or
+// unsaved rules.
+type CreateRuleBacktestRequest struct {
+	ProgramID uuid.UUID          `json:"program_id" binding:"required"`
+	RuleSetID *uuid.UUID         `json:"rule_set_id,omitempty"`
+	From      time.Time          `json:"from" binding:"required"`
+	To        time.Time          `json:"to" binding:"required"`
+	Rules     []DraftProgramRule `json:"rules,omitempty" binding:"required_without=RuleSetID,dive"`
+}
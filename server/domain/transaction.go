@@ -1,33 +1,62 @@
 package domain
 
 import (
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Transaction statuses. A pending transaction holds its points until it
+// completes, failed and cancelled are final.
+const (
+	TransactionPending   = "pending"
+	TransactionCompleted = "completed"
+	TransactionFailed    = "failed"
+	TransactionCancelled = "cancelled"
+)
+
+// transactionTransitions are the statuses each status can move to
+var transactionTransitions = map[string][]string{
+	TransactionPending:   {TransactionCompleted, TransactionFailed, TransactionCancelled},
+	TransactionCompleted: {TransactionCancelled},
+}
+
+// CanTransitionTransaction reports whether a transaction can move from one status to another
+func CanTransitionTransaction(from, to string) bool {
+	return slices.Contains(transactionTransitions[from], to)
+}
+
 type Transaction struct {
-	TransactionID       uuid.UUID  `json:"transaction_id"`
-	MerchantID          uuid.UUID  `json:"merchant_id"`
-	MerchantCustomersID uuid.UUID  `json:"merchant_customers_id"`
-	ProgramID           uuid.UUID  `json:"program_id"`
-	TransactionType     string     `json:"transaction_type"` // purchase, refund, bonus
-	TransactionAmount   float64    `json:"transaction_amount"`
-	TransactionDate     time.Time  `json:"transaction_date"`
-	BranchID            *uuid.UUID `json:"branch_id,omitempty"`
-	Status              string     `json:"status"`
-	CreatedAt           time.Time  `json:"created_at"`
+	TransactionID         uuid.UUID  `json:"transaction_id"`
+	MerchantID            uuid.UUID  `json:"merchant_id"`
+	MerchantCustomersID   uuid.UUID  `json:"merchant_customers_id"`
+	ProgramID             uuid.UUID  `json:"program_id"`
+	TransactionType       string     `json:"transaction_type"` // purchase, refund, bonus
+	TransactionAmount     float64    `json:"transaction_amount"`
+	TransactionDate       time.Time  `json:"transaction_date"`
+	Category              string     `json:"category,omitempty"` // food, travel, electronics, etc
+	BranchID              *uuid.UUID `json:"branch_id,omitempty"`
+	Status                string     `json:"status"`
+	SourceMessageID       *string    `json:"source_message_id,omitempty"`       // set when ingested from Kafka or imported
+	OriginalTransactionID *uuid.UUID `json:"original_transaction_id,omitempty"` // the purchase or redemption a refund is for
+	CashAmount            float64    `json:"cash_amount,omitempty"`             // cash paid with a redemption's points, or given back by its refund
+	CreatedAt             time.Time  `json:"created_at"`
 }
 
 type CreateTransactionRequest struct {
-	MerchantID          uuid.UUID  `json:"merchant_id" binding:"required"`
-	MerchantCustomersID uuid.UUID  `json:"merchant_customers_id" binding:"required"`
-	ProgramID           uuid.UUID  `json:"program_id" binding:"required"`
-	TransactionType     string     `json:"transaction_type" binding:"required,oneof=purchase refund bonus"`
-	TransactionAmount   float64    `json:"transaction_amount" binding:"required,gt=0"`
-	TransactionDate     time.Time  `json:"transaction_date" binding:"required"`
-	BranchID            *uuid.UUID `json:"branch_id,omitempty"`
-	Status              string     `json:"status" binding:"required,oneof=pending completed failed cancelled"`
+	MerchantID            uuid.UUID  `json:"merchant_id" binding:"required"`
+	MerchantCustomersID   uuid.UUID  `json:"merchant_customers_id" binding:"required"`
+	ProgramID             uuid.UUID  `json:"program_id" binding:"required"`
+	TransactionType       string     `json:"transaction_type" binding:"required,oneof=purchase refund bonus"`
+	TransactionAmount     float64    `json:"transaction_amount" binding:"required,gt=0"`
+	TransactionDate       time.Time  `json:"transaction_date" binding:"required"`
+	Category              string     `json:"category,omitempty"`
+	BranchID              *uuid.UUID `json:"branch_id,omitempty"`
+	Status                string     `json:"status" binding:"required,oneof=pending completed failed cancelled"`
+	SourceMessageID       *string    `json:"-"`
+	OriginalTransactionID *uuid.UUID `json:"original_transaction_id,omitempty"` // required on refunds
+	CashAmount            float64    `json:"-"`
 }
 
 type UpdateTransactionStatusRequest struct {
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// An import moves from queued to running, then to completed or failed. A
+// failed import carries on where it stopped when its file is uploaded again.
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+const (
+	ImportFormatJSON = "json"
+	ImportFormatCSV  = "csv"
+)
+
+// A row either created its transaction, was already imported or failed.
+const (
+	ImportRowCreated   = "created"
+	ImportRowDuplicate = "duplicate"
+	ImportRowFailed    = "failed"
+)
+
+// TransactionImport loads a batch of a merchant's historical transactions.
+type TransactionImport struct {
+	ID            uuid.UUID               `json:"id"`
+	MerchantID    uuid.UUID               `json:"merchant_id"`
+	Format        string                  `json:"format"`
+	FileHash      string                  `json:"file_hash"`
+	Status        string                  `json:"status"`
+	TotalRows     int                     `json:"total_rows"`
+	ProcessedRows int                     `json:"processed_rows"`
+	CreatedRows   int                     `json:"created_rows"`
+	DuplicateRows int                     `json:"duplicate_rows"`
+	FailedRows    int                     `json:"failed_rows"`
+	Error         string                  `json:"error,omitempty"`
+	Rows          []*TransactionImportRow `json:"rows,omitempty"` // the report, included when the import ran within the request
+	CreatedAt     time.Time               `json:"created_at"`
+	UpdatedAt     time.Time               `json:"updated_at"`
+	StartedAt     *time.Time              `json:"started_at,omitempty"`
+	CompletedAt   *time.Time              `json:"completed_at,omitempty"`
+}
+
+// TransactionImportRow is the outcome of one row of an import. Rows are
+// numbered from 1, not counting a CSV header.
+type TransactionImportRow struct {
+	ImportID      uuid.UUID  `json:"import_id"`
+	RowNumber     int        `json:"row_number"`
+	Status        string     `json:"status"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// BatchTransactionRequest imports transactions sent as JSON. Every row is
+// validated on its own and reported in the import's rows, a row without a
+// merchant_id belongs to the batch's merchant.
+type BatchTransactionRequest struct {
+	MerchantID   uuid.UUID                  `json:"merchant_id" binding:"required"`
+	Transactions []CreateTransactionRequest `json:"transactions" binding:"required,min=1"`
+}
+
+type TransactionImportRepository interface {
+	// Create stores a queued import. An import of the same file for the
+	// merchant is left alone and reported as false.
+	Create(ctx context.Context, transactionImport *TransactionImport) (bool, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*TransactionImport, error)
+	GetByFileHash(ctx context.Context, merchantID uuid.UUID, fileHash string) (*TransactionImport, error)
+	// Claim marks an import running for the caller and returns it. Queued and
+	// failed imports can be claimed, and running ones that have not made
+	// progress since staleBefore. It returns nil when the import is taken.
+	Claim(ctx context.Context, id uuid.UUID, staleBefore time.Time) (*TransactionImport, error)
+	// SaveRows stores the outcome of the next rows and counts them in the
+	// import's progress. It joins the unit of work in ctx, so the rows commit
+	// with the transactions they created.
+	SaveRows(ctx context.Context, importID uuid.UUID, rows []*TransactionImportRow) error
+	Complete(ctx context.Context, id uuid.UUID) error
+	Fail(ctx context.Context, id uuid.UUID, reason string) error
+	// GetRows pages through an import's rows in order, optionally only those
+	// with the given status.
+	GetRows(ctx context.Context, importID uuid.UUID, status string, offset, limit int) ([]*TransactionImportRow, int64, error)
+}
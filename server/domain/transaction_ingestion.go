@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go-playground/pkg/kafka"
+
+	"github.com/google/uuid"
+)
+
+// Merchants push their POS transactions onto TransactionIngestTopic. Messages
+// that can not be ingested are moved to TransactionDeadLetterTopic.
+const (
+	TransactionIngestTopic     = "pos.transactions"
+	TransactionDeadLetterTopic = "pos.transactions.dlq"
+	TransactionIngestGroupID   = "loyalty-transaction-ingestion"
+)
+
+// TransactionMessageVersion is read first from every ingested message, it
+// decides how the rest of the message is read.
+type TransactionMessageVersion struct {
+	SchemaVersion int `json:"schema_version"`
+}
+
+// TransactionMessageV1 is version 1 of the ingested transaction message.
+// MessageID is unique per merchant, a message delivered twice is only
+// ingested once.
+type TransactionMessageV1 struct {
+	SchemaVersion       int        `json:"schema_version"`
+	MessageID           string     `json:"message_id"`
+	MerchantCustomersID uuid.UUID  `json:"merchant_customers_id"`
+	ProgramID           uuid.UUID  `json:"program_id"`
+	TransactionType     string     `json:"transaction_type"` // purchase, refund, bonus
+	TransactionAmount   float64    `json:"transaction_amount"`
+	TransactionDate     time.Time  `json:"transaction_date"`
+	Category            string     `json:"category,omitempty"`
+	BranchID            *uuid.UUID `json:"branch_id,omitempty"`
+	Status              string     `json:"status,omitempty"` // completed when not set
+	// OriginalTransactionID is the purchase a refund gives money back for,
+	// required on refunds
+	OriginalTransactionID *uuid.UUID `json:"original_transaction_id,omitempty"`
+}
+
+// DeadLetter is published to the dead letter topic for a message that could
+// not be ingested, with the message as it was read.
+type DeadLetter struct {
+	Topic     string    `json:"topic"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       string    `json:"key"`
+	Payload   string    `json:"payload"`
+	Reason    string    `json:"reason"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// MessageSubscriber reads a topic as a member of a consumer group. Each
+// message must be committed once processed.
+type MessageSubscriber interface {
+	SubscribeToTopic(ctx context.Context, topic string, groupID string) (<-chan *kafka.Message, error)
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A voucher is issued with its redemption, used once when a branch verifies
+// it and void when the redemption is cancelled, expires or fails.
+const (
+	VoucherIssued = "issued"
+	VoucherUsed   = "used"
+	VoucherVoid   = "void"
+)
+
+// Where a reward's voucher codes come from
+const (
+	VoucherSourceGenerated = "generated"
+	VoucherSourcePool      = "pool"
+)
+
+// Voucher is what a customer shows at a branch to get a redeemed reward.
+type Voucher struct {
+	ID           uuid.UUID  `json:"id"`
+	RedemptionID uuid.UUID  `json:"redemption_id"`
+	RewardID     uuid.UUID  `json:"reward_id"`
+	MerchantID   uuid.UUID  `json:"merchant_id"`
+	Code         string     `json:"code"`
+	Source       string     `json:"source"`
+	Status       string     `json:"status"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+	UsedBranchID *uuid.UUID `json:"used_branch_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RewardCode is a code a merchant uploaded for a pool reward.
+type RewardCode struct {
+	Code      string     `json:"code"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// AddRewardCodesRequest uploads codes to a pool reward. Codes the merchant
+// already has are skipped.
+type AddRewardCodesRequest struct {
+	Codes     []string   `json:"codes" binding:"required,min=1,max=10000,dive,required,max=64"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type AddRewardCodesResponse struct {
+	Added      int `json:"added"`
+	Duplicates int `json:"duplicates"`
+	Available  int `json:"available"` // codes of the reward not handed out yet
+}
+
+// VerifyVoucherRequest is sent by a branch scanning a customer's voucher.
+type VerifyVoucherRequest struct {
+	MerchantID uuid.UUID  `json:"merchant_id" binding:"required"`
+	Code       string     `json:"code" binding:"required,max=64"`
+	BranchID   *uuid.UUID `json:"branch_id,omitempty"`
+	ChangedBy  string     `json:"-"` // the user scanning it
+}
+
+type VoucherRepository interface {
+	// Create stores a voucher in the unit of work in ctx. A code the merchant
+	// already has is left alone and reported as false.
+	Create(ctx context.Context, voucher *Voucher) (bool, error)
+	GetByRedemptionID(ctx context.Context, redemptionID uuid.UUID) (*Voucher, error)
+	// LockByCode returns a merchant's voucher locked for the unit of work in
+	// ctx, nil when there is none.
+	LockByCode(ctx context.Context, merchantID uuid.UUID, code string) (*Voucher, error)
+	MarkUsed(ctx context.Context, voucher *Voucher) error
+	Void(ctx context.Context, redemptionID uuid.UUID) error
+	// ClaimCode hands the oldest unexpired code of a pool reward to a
+	// redemption, nil when none is left.
+	ClaimCode(ctx context.Context, rewardID, redemptionID uuid.UUID) (*RewardCode, error)
+	// AddCodes adds the codes the reward's merchant does not have yet and
+	// returns how many were added.
+	AddCodes(ctx context.Context, rewardID uuid.UUID, codes []string, expiresAt *time.Time) (int, error)
+	CountAvailableCodes(ctx context.Context, rewardID uuid.UUID) (int, error)
+}
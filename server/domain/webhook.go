@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A delivery is retried while pending, and becomes dead once it has used up
+// its attempts.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// Headers sent with every webhook delivery. The signature is the hex
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the subscription's secret,
+// prefixed with "sha256=".
+const (
+	WebhookSignatureHeader = "X-Loyalty-Signature"
+	WebhookTimestampHeader = "X-Loyalty-Timestamp"
+	WebhookEventHeader     = "X-Loyalty-Event"
+	WebhookDeliveryHeader  = "X-Loyalty-Delivery"
+)
+
+// WebhookEventTypes are the event topics merchants can subscribe to
+var WebhookEventTypes = []string{
+	EventTopic(PointsEarned),
+	EventTopic(PointsRedeemed),
+	EventTopic(RewardRedeemed),
+	EventTopic(RedemptionStatusUpdated),
+	EventTopic(RewardLowStock),
+}
+
+// WebhookSubscription sends a merchant's events of the given types to a URL.
+type WebhookSubscription struct {
+	ID         uuid.UUID `json:"id"`
+	MerchantID uuid.UUID `json:"merchant_id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"-"`
+	IsActive   bool      `json:"is_active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type CreateWebhookSubscriptionRequest struct {
+	MerchantID uuid.UUID `json:"merchant_id" binding:"required"`
+	URL        string    `json:"url" binding:"required,url"`
+	EventTypes []string  `json:"event_types" binding:"required,min=1"`
+	Secret     string    `json:"secret" binding:"required,min=16"`
+}
+
+// WebhookEvent is the body of a webhook delivery.
+type WebhookEvent struct {
+	EventID    uuid.UUID              `json:"event_id"`
+	EventType  string                 `json:"event_type"`
+	MerchantID uuid.UUID              `json:"merchant_id"`
+	CustomerID uuid.UUID              `json:"customer_id"`
+	ProgramID  uuid.UUID              `json:"program_id"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a subscription.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	ReplayOf       *uuid.UUID      `json:"replay_of,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// WebhookDispatch is a claimed delivery with where and how to send it.
+type WebhookDispatch struct {
+	Delivery *WebhookDelivery
+	URL      string
+	Secret   string
+}
+
+// WebhookDeliveryRun summarizes one pass of the webhook dispatcher
+type WebhookDeliveryRun struct {
+	Delivered int `json:"delivered"`
+	Retrying  int `json:"retrying"`
+	Dead      int `json:"dead"`
+}
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription *WebhookSubscription) error
+	GetSubscription(ctx context.Context, id uuid.UUID) (*WebhookSubscription, error)
+	GetSubscriptionsByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]*WebhookSubscription, error)
+	// GetActiveSubscriptions returns the merchant's active subscriptions to an event type
+	GetActiveSubscriptions(ctx context.Context, merchantID uuid.UUID, eventType string) ([]*WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+
+	// CreateDelivery queues a delivery. An event already queued for the
+	// subscription is left alone and reported as false.
+	CreateDelivery(ctx context.Context, delivery *WebhookDelivery) (bool, error)
+	GetDelivery(ctx context.Context, id uuid.UUID) (*WebhookDelivery, error)
+	// GetDeliveries lists a subscription's deliveries, newest first, optionally
+	// only those with the given status.
+	GetDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, offset, limit int) ([]*WebhookDelivery, int64, error)
+	// ClaimDueDeliveries takes up to limit pending deliveries that are due and
+	// pushes their next attempt back by lease, so no other dispatcher sends
+	// them in the meantime.
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDispatch, error)
+	// UpdateDelivery stores the outcome of an attempt
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"go-playground/server/service"
+	"go-playground/server/util"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type PointsExpirationHandler struct {
+	expirationService *service.PointsExpirationService
+	logger            zerolog.Logger
+}
+
+func NewPointsExpirationHandler(service *service.PointsExpirationService) *PointsExpirationHandler {
+	return &PointsExpirationHandler{
+		expirationService: service,
+		logger:            logging.GetLogger(),
+	}
+}
+
+// SetPointsExpiryPolicy godoc
+// @Summary Set points expiry policy
+// @Description Set how long the points earned in a program stay valid
+// @Tags programs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Program ID"
+// @Param policy body domain.SetPointsExpiryPolicyRequest true "Expiry policy"
+// @Success 200 {object} domain.PointsExpiryPolicy
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /programs/{id}/expiry-policy [put]
+func (h *PointsExpirationHandler) SetPolicy(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming set points expiry policy request")
+
+	var req domain.SetPointsExpiryPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind set points expiry policy request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	policy, err := h.expirationService.SetPolicy(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("program_id", c.Param("id")).
+			Msg("Failed to set points expiry policy")
+		util.HandleError(c, err)
+		return
+	}
+
+	h.logger.Info().
+		Str("program_id", policy.ProgramID.String()).
+		Str("policy", policy.Policy).
+		Msg("Points expiry policy set successfully")
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// GetPointsExpiryPolicy godoc
+// @Summary Get points expiry policy
+// @Description Get how long the points earned in a program stay valid
+// @Tags programs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Program ID"
+// @Success 200 {object} domain.PointsExpiryPolicy
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /programs/{id}/expiry-policy [get]
+func (h *PointsExpirationHandler) GetPolicy(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get points expiry policy request")
+
+	policy, err := h.expirationService.GetPolicy(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("program_id", c.Param("id")).
+			Msg("Failed to get points expiry policy")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeletePointsExpiryPolicy godoc
+// @Summary Delete points expiry policy
+// @Description Stop the points of a program from expiring
+// @Tags programs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Program ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /programs/{id}/expiry-policy [delete]
+func (h *PointsExpirationHandler) DeletePolicy(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming delete points expiry policy request")
+
+	if err := h.expirationService.DeletePolicy(c.Request.Context(), c.Param("id")); err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("program_id", c.Param("id")).
+			Msg("Failed to delete points expiry policy")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Points expiry policy deleted successfully"})
+}
+
+// GetUpcomingExpirations godoc
+// @Summary Get upcoming points expirations
+// @Description Get when a customer's unspent points in a program expire, soonest first
+// @Tags points
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param customer_id path string true "Customer ID"
+// @Param program_id path string true "Program ID"
+// @Success 200 {object} domain.UpcomingExpirations
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /points/{customer_id}/{program_id}/expirations [get]
+func (h *PointsExpirationHandler) GetUpcoming(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get upcoming points expirations request")
+
+	customerID, err := uuid.Parse(c.Param("customer_id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Invalid customer ID")
+		util.HandleError(c, domain.NewValidationError("customer_id", "invalid customer ID format"))
+		return
+	}
+	programID, err := uuid.Parse(c.Param("program_id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Invalid program ID")
+		util.HandleError(c, domain.NewValidationError("program_id", "invalid program ID format"))
+		return
+	}
+
+	upcoming, err := h.expirationService.GetUpcoming(c.Request.Context(), customerID, programID)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("customer_id", customerID.String()).
+			Str("program_id", programID.String()).
+			Msg("Failed to get upcoming points expirations")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, upcoming)
+}
@@ -80,9 +80,62 @@ func (h *PointsHandler) GetLedger(c *gin.Context) {
 	c.JSON(http.StatusOK, ledger)
 }
 
+// GetLots godoc
+// @Summary Get points lots
+// @Description Get the unspent earn lots of a customer in a program, in the order redemptions consume them
+// @Tags points
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param customer_id path string true "Customer ID"
+// @Param program_id path string true "Program ID"
+// @Success 200 {array} domain.PointsLot
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /points/{customer_id}/{program_id}/lots [get]
+func (h *PointsHandler) GetLots(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get points lots request")
+
+	customerID, err := uuid.Parse(c.Param("customer_id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Invalid customer ID")
+		util.HandleError(c, domain.NewValidationError("customer_id", "invalid customer ID format"))
+		return
+	}
+	programID, err := uuid.Parse(c.Param("program_id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Invalid program ID")
+		util.HandleError(c, domain.NewValidationError("program_id", "invalid program ID format"))
+		return
+	}
+
+	lots, err := h.pointsService.GetLots(c.Request.Context(), customerID, programID)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("customer_id", customerID.String()).
+			Str("program_id", programID.String()).
+			Msg("Failed to get points lots")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lots)
+}
+
 // GetBalance godoc
 // @Summary Get points balance
-// @Description Get current points balance for a customer in a program
+// @Description Get current points balance for a customer in a program, with the points held for pending transactions
 // @Tags points
 // @Accept json
 // @Produce json
@@ -147,6 +200,7 @@ func (h *PointsHandler) GetBalance(c *gin.Context) {
 // @Param customer_id path string true "Customer ID"
 // @Param program_id path string true "Program ID"
 // @Param points body domain.EarnPointsRequest true "Points to earn"
+// @Param Idempotency-Key header string false "Replays the first response on retries with the same key"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
@@ -71,6 +71,54 @@ func (h *ProgramRulesHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, rule)
 }
 
+// SimulateProgramRules godoc
+// @Summary Simulate program rules
+// @Description Evaluate a hypothetical transaction against every rule of a program without recording anything
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param simulation body domain.SimulateRulesRequest true "Hypothetical transaction"
+// @Success 200 {object} domain.SimulateRulesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /program-rules/simulate [post]
+func (h *ProgramRulesHandler) Simulate(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming simulate program rules request")
+
+	var req domain.SimulateRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind simulate program rules request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	result, err := h.programRulesService.Simulate(&req)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Interface("request", req).
+			Msg("Failed to simulate program rules")
+		util.HandleError(c, err)
+		return
+	}
+
+	h.logger.Info().
+		Str("program_id", result.ProgramID.String()).
+		Int("total_points", result.TotalPoints).
+		Msg("Program rules simulated successfully")
+
+	c.JSON(http.StatusOK, result)
+}
+
 // GetProgramRule godoc
 // @Summary Get program rule by ID
 // @Description Get program rule details by ID
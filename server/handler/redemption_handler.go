@@ -25,7 +25,7 @@ func NewRedemptionHandler(redemptionService *service.RedemptionService) *Redempt
 }
 
 // @Summary Create redemption
-// @Description Create a new redemption request
+// @Description Create a new redemption request. On a reward with min_points, points_used sets how many points to burn, at least min_points, and the rest is charged as cash_amount at cash_per_point
 // @Tags redemptions
 // @Accept json
 // @Produce json
@@ -71,6 +71,79 @@ func (h *RedemptionHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, redemption)
 }
 
+// @Summary Redeem a cart of rewards
+// @Description Redeem several rewards of one program at once, each with a quantity. The points of the whole cart are checked and taken with one transaction and the stock of every reward is reserved together, so either every item is redeemed or none is. Each unit becomes a redemption of the returned group
+// @Tags redemptions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param cart body domain.CreateRedemptionCartRequest true "Rewards to redeem"
+// @Success 201 {object} domain.RedemptionGroup
+// @Failure 400,404 {object} map[string]string
+// @Router /redemptions/cart [post]
+func (h *RedemptionHandler) CreateCart(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming request")
+
+	var req domain.CreateRedemptionCartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind redemption cart request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	group, err := h.redemptionService.CreateCart(c.Request.Context(), &req)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("customer_id", req.MerchantCustomersID.String()).
+			Msg("Failed to create redemption cart")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// @Summary Get redemption group
+// @Description Get the redemptions of a cart
+// @Tags redemptions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param group_id path string true "Redemption group ID"
+// @Success 200 {object} domain.RedemptionGroup
+// @Failure 400,404 {object} map[string]string
+// @Router /redemptions/groups/{group_id} [get]
+func (h *RedemptionHandler) GetGroup(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming request")
+
+	group, err := h.redemptionService.GetGroup(c.Request.Context(), c.Param("group_id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("group_id", c.Param("group_id")).
+			Msg("Failed to get redemption group")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
 // @Summary Get redemption by ID
 // @Description Get redemption details by ID
 // @Tags redemptions
@@ -149,14 +222,14 @@ func (h *RedemptionHandler) GetByUserID(c *gin.Context) {
 }
 
 // @Summary Update redemption status
-// @Description Update the status of a redemption
+// @Description Move a redemption along its lifecycle. A pending redemption can become approved, fulfilled, cancelled, expired or failed, an approved one fulfilled, cancelled, expired or failed. Other changes fail with INVALID_STATUS_TRANSITION. Cancelling or failing a redemption refunds its points, every change is recorded in its history
 // @Tags redemptions
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Security UserIdAuth
 // @Param id path string true "Redemption ID"
-// @Param status body string true "New status" Enums(completed, pending, failed, canceled)
+// @Param status body domain.UpdateRedemptionRequest true "New status and the reason for it"
 // @Success 200 {object} map[string]string
 // @Failure 400,404 {object} map[string]string
 // @Router /redemptions/{id}/status [put]
@@ -188,7 +261,9 @@ func (h *RedemptionHandler) UpdateStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.redemptionService.UpdateStatus(c.Request.Context(), id, string(req.Status)); err != nil {
+	req.ChangedBy = c.GetString("user_id")
+
+	if err := h.redemptionService.UpdateStatus(c.Request.Context(), id, &req); err != nil {
 		h.logger.Error().
 			Err(err).
 			Msg("Failed to update redemption status")
@@ -198,3 +273,35 @@ func (h *RedemptionHandler) UpdateStatus(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "status updated successfully"})
 }
+
+// @Summary Get redemption status history
+// @Description Get every status change of a redemption, oldest first, with who made it, why and the refund it caused
+// @Tags redemptions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Redemption ID"
+// @Success 200 {array} domain.RedemptionStatusChange
+// @Failure 400,404 {object} map[string]string
+// @Router /redemptions/{id}/history [get]
+func (h *RedemptionHandler) GetStatusHistory(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming request")
+
+	history, err := h.redemptionService.GetStatusHistory(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("redemption_id", c.Param("id")).
+			Msg("Failed to get redemption status history")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
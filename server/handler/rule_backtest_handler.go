@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"go-playground/server/service"
+	"go-playground/server/util"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+type RuleBacktestHandler struct {
+	backtestService *service.RuleBacktestService
+	logger          zerolog.Logger
+}
+
+func NewRuleBacktestHandler(service *service.RuleBacktestService) *RuleBacktestHandler {
+	return &RuleBacktestHandler{
+		backtestService: service,
+		logger:          logging.GetLogger(),
+	}
+}
+
+// CreateRuleBacktest godoc
+// @Summary Start a rule backtest
+// @Description Replay a date range of a program's transactions against a draft rule set in the background
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param backtest body domain.CreateRuleBacktestRequest true "Date range and draft rules"
+// @Success 202 {object} domain.RuleBacktest
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /program-rules/backtests [post]
+func (h *RuleBacktestHandler) Create(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming create rule backtest request")
+
+	var req domain.CreateRuleBacktestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind create rule backtest request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	backtest, err := h.backtestService.Create(c.Request.Context(), &req)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("program_id", req.ProgramID.String()).
+			Msg("Failed to create rule backtest")
+		util.HandleError(c, err)
+		return
+	}
+
+	h.logger.Info().
+		Str("backtest_id", backtest.ID.String()).
+		Str("program_id", backtest.ProgramID.String()).
+		Msg("Rule backtest queued")
+
+	c.JSON(http.StatusAccepted, backtest)
+}
+
+// GetRuleBacktest godoc
+// @Summary Get rule backtest status
+// @Description Get the status, progress and totals of a rule backtest
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Backtest ID"
+// @Success 200 {object} domain.RuleBacktest
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /program-rules/backtests/{id} [get]
+func (h *RuleBacktestHandler) GetByID(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get rule backtest request")
+
+	backtest, err := h.backtestService.GetByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("backtest_id", c.Param("id")).
+			Msg("Failed to get rule backtest")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, backtest)
+}
+
+// GetRuleBacktestCustomers godoc
+// @Summary Get rule backtest customers
+// @Description Get the per customer points of a completed rule backtest, largest change first
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Backtest ID"
+// @Param page query integer false "Page number (default: 1)"
+// @Param limit query integer false "Items per page (default: 10, max: 100)"
+// @Success 200 {object} domain.PaginatedResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /program-rules/backtests/{id}/customers [get]
+func (h *RuleBacktestHandler) GetCustomers(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get rule backtest customers request")
+
+	var pagination domain.PaginationRequest
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind pagination request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	customers, total, err := h.backtestService.GetCustomers(c.Request.Context(), c.Param("id"), pagination.Page, pagination.Limit)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("backtest_id", c.Param("id")).
+			Msg("Failed to get rule backtest customers")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, domain.NewPaginatedResponse(customers, total, pagination.Page, pagination.Limit))
+}
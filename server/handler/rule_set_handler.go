@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"go-playground/server/service"
+	"go-playground/server/util"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+type RuleSetHandler struct {
+	programRulesService *service.ProgramRulesService
+	logger              zerolog.Logger
+}
+
+func NewRuleSetHandler(service *service.ProgramRulesService) *RuleSetHandler {
+	return &RuleSetHandler{
+		programRulesService: service,
+		logger:              logging.GetLogger(),
+	}
+}
+
+// CreateRuleSet godoc
+// @Summary Create a draft rule set
+// @Description Start a draft version of a program's rules from a copy of the published rules, or return the existing draft
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param rule_set body domain.CreateRuleSetRequest true "Program and description"
+// @Success 201 {object} domain.ProgramRuleSet
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /program-rules/versions [post]
+func (h *RuleSetHandler) Create(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming create rule set request")
+
+	var req domain.CreateRuleSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind create rule set request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	ruleSet, err := h.programRulesService.CreateRuleSet(&req)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("program_id", req.ProgramID.String()).
+			Msg("Failed to create rule set")
+		util.HandleError(c, err)
+		return
+	}
+
+	h.logger.Info().
+		Str("rule_set_id", ruleSet.ID.String()).
+		Int("version", ruleSet.Version).
+		Msg("Draft rule set ready")
+
+	c.JSON(http.StatusCreated, ruleSet)
+}
+
+// GetRuleSet godoc
+// @Summary Get a rule set
+// @Description Get a rule set version together with its rules
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Rule set ID"
+// @Success 200 {object} domain.ProgramRuleSet
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /program-rules/versions/{id} [get]
+func (h *RuleSetHandler) GetByID(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get rule set request")
+
+	ruleSet, err := h.programRulesService.GetRuleSet(c.Param("id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("rule_set_id", c.Param("id")).
+			Msg("Failed to get rule set")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ruleSet)
+}
+
+// GetRuleSetsByProgramID godoc
+// @Summary List rule sets of a program
+// @Description List the rule set versions of a program, newest first
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param program_id path string true "Program ID"
+// @Success 200 {array} domain.ProgramRuleSet
+// @Failure 400 {object} map[string]string
+// @Router /program-rules/versions/program/{program_id} [get]
+func (h *RuleSetHandler) GetByProgramID(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get rule sets by program request")
+
+	ruleSets, err := h.programRulesService.GetRuleSetsByProgramID(c.Param("program_id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("program_id", c.Param("program_id")).
+			Msg("Failed to get rule sets")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ruleSets)
+}
+
+// PublishRuleSet godoc
+// @Summary Publish a draft rule set
+// @Description Make a draft the program's published rule set and archive the version it replaces
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Rule set ID"
+// @Success 200 {object} domain.ProgramRuleSet
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /program-rules/versions/{id}/publish [post]
+func (h *RuleSetHandler) Publish(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming publish rule set request")
+
+	ruleSet, err := h.programRulesService.PublishRuleSet(c.Param("id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("rule_set_id", c.Param("id")).
+			Msg("Failed to publish rule set")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ruleSet)
+}
+
+// RollbackRuleSet godoc
+// @Summary Roll back to a previous rule set
+// @Description Publish an archived rule set again and archive the current version
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Rule set ID"
+// @Success 200 {object} domain.ProgramRuleSet
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /program-rules/versions/{id}/rollback [post]
+func (h *RuleSetHandler) Rollback(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming rollback rule set request")
+
+	ruleSet, err := h.programRulesService.RollbackRuleSet(c.Param("id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("rule_set_id", c.Param("id")).
+			Msg("Failed to roll back rule set")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ruleSet)
+}
+
+// DiscardRuleSet godoc
+// @Summary Discard a draft rule set
+// @Description Delete a draft rule set and its rules
+// @Tags program-rules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Rule set ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /program-rules/versions/{id} [delete]
+func (h *RuleSetHandler) Delete(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming discard rule set request")
+
+	if err := h.programRulesService.DiscardRuleSet(c.Param("id")); err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("rule_set_id", c.Param("id")).
+			Msg("Failed to discard rule set")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Draft rule set discarded successfully"})
+}
@@ -27,13 +27,14 @@ func NewTransactionHandler(transactionService domain.TransactionService) *Transa
 
 // CreateTransaction godoc
 // @Summary Create transaction
-// @Description Create a new transaction
+// @Description Create a new transaction. A refund needs the original_transaction_id of the purchase it refunds, it takes back that purchase's points pro rata and the refunds of a purchase can not add up to more than the purchase
 // @Tags transactions
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Security UserIdAuth
 // @Param transaction body domain.CreateTransactionRequest true "Transaction details"
+// @Param Idempotency-Key header string false "Replays the first response on retries with the same key"
 // @Success 201 {object} domain.Transaction
 // @Failure 400 {object} map[string]string
 // @Router /transactions [post]
@@ -327,6 +328,19 @@ func (h *TransactionHandler) GetByMerchantID(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// UpdateTransactionStatus godoc
+// @Summary Update transaction status
+// @Description Move a transaction to another status. A pending transaction can become completed, failed or cancelled, a completed one cancelled. Completing releases the points held for the transaction into the balance. Failing or cancelling voids them, takes back the points the transaction earned that its refunds have not, or gives back the points a refund took
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Transaction ID"
+// @Param status body domain.UpdateTransactionStatusRequest true "New status"
+// @Success 200 {object} map[string]string
+// @Failure 400,404 {object} map[string]string
+// @Router /transactions/{id}/status [put]
 func (h *TransactionHandler) UpdateStatus(c *gin.Context) {
 	h.logger.Info().
 		Str("method", c.Request.Method).
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"errors"
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"go-playground/server/service"
+	"go-playground/server/util"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// maxImportFileSize bounds a CSV upload, the multipart envelope included
+const maxImportFileSize = 32 << 20
+
+type TransactionImportHandler struct {
+	importService *service.TransactionImportService
+	logger        zerolog.Logger
+}
+
+func NewTransactionImportHandler(service *service.TransactionImportService) *TransactionImportHandler {
+	return &TransactionImportHandler{
+		importService: service,
+		logger:        logging.GetLogger(),
+	}
+}
+
+// importStatusCode is 202 for an import still running in the background and
+// 200 for one that has finished
+func importStatusCode(transactionImport *domain.TransactionImport) int {
+	if transactionImport.Status == domain.ImportQueued || transactionImport.Status == domain.ImportRunning {
+		return http.StatusAccepted
+	}
+	return http.StatusOK
+}
+
+// CreateTransactionBatch godoc
+// @Summary Import a batch of transactions
+// @Description Create a merchant's historical transactions from a JSON array. Every row is validated like POST /transactions and reported in the import's rows. Batches of up to 100 rows run within the request and return their report, larger ones run in the background. Sending the same batch again returns its import
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param batch body domain.BatchTransactionRequest true "Transactions"
+// @Success 200 {object} domain.TransactionImport
+// @Success 202 {object} domain.TransactionImport
+// @Failure 400 {object} map[string]string
+// @Router /transactions/batch [post]
+func (h *TransactionImportHandler) CreateBatch(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming create transaction batch request")
+
+	var req domain.BatchTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind create transaction batch request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	transactionImport, err := h.importService.ImportBatch(c.Request.Context(), &req)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("merchant_id", req.MerchantID.String()).
+			Msg("Failed to import transaction batch")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(importStatusCode(transactionImport), transactionImport)
+}
+
+// ImportTransactionCSV godoc
+// @Summary Import transactions from a CSV file
+// @Description Create a merchant's historical transactions from a CSV file with a header row. Columns are named like the fields of POST /transactions, status defaults to completed and dates are RFC 3339 timestamps or YYYY-MM-DD. Files of up to 100 rows run within the request and return their report, larger ones run in the background. Uploading the same file again returns its import, or carries on with it if it failed
+// @Tags transactions
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param merchant_id formData string true "Merchant ID"
+// @Param file formData file true "CSV file"
+// @Success 200 {object} domain.TransactionImport
+// @Success 202 {object} domain.TransactionImport
+// @Failure 400 {object} map[string]string
+// @Router /transactions/import [post]
+func (h *TransactionImportHandler) ImportCSV(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming import transaction csv request")
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+	if err := c.Request.ParseMultipartForm(maxImportFileSize); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to parse multipart form")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			util.HandleError(c, domain.NewValidationError("file", "the file is too large"))
+			return
+		}
+		util.HandleError(c, domain.NewValidationError("file", "expected a multipart form with a CSV file"))
+		return
+	}
+
+	merchantID, err := uuid.Parse(c.PostForm("merchant_id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Invalid merchant ID")
+		util.HandleError(c, domain.NewValidationError("merchant_id", "invalid merchant ID"))
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to read uploaded file")
+		util.HandleError(c, domain.NewValidationError("file", "a CSV file is required"))
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to open uploaded file")
+		util.HandleError(c, domain.NewValidationError("file", "the file can not be read"))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to read uploaded file")
+		util.HandleError(c, domain.NewValidationError("file", "the file can not be read"))
+		return
+	}
+
+	transactionImport, err := h.importService.ImportCSV(c.Request.Context(), merchantID, data)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("merchant_id", merchantID.String()).
+			Msg("Failed to import transaction csv")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(importStatusCode(transactionImport), transactionImport)
+}
+
+// GetTransactionImport godoc
+// @Summary Get transaction import progress
+// @Description Get the status and row counts of a transaction import. The rows are included for imports of up to 100 rows
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Import ID"
+// @Success 200 {object} domain.TransactionImport
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /transactions/imports/{id} [get]
+func (h *TransactionImportHandler) GetByID(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get transaction import request")
+
+	transactionImport, err := h.importService.GetByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("import_id", c.Param("id")).
+			Msg("Failed to get transaction import")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, transactionImport)
+}
+
+// GetTransactionImportRows godoc
+// @Summary Get transaction import rows
+// @Description Get the per row report of a transaction import in row order. Filter on status failed for the rows to fix and upload again
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Import ID"
+// @Param status query string false "Row status: created, duplicate or failed"
+// @Param page query integer false "Page number (default: 1)"
+// @Param limit query integer false "Items per page (default: 10, max: 100)"
+// @Success 200 {object} domain.PaginatedResponse
+// @Failure 400 {object} map[string]string
+// @Router /transactions/imports/{id}/rows [get]
+func (h *TransactionImportHandler) GetRows(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get transaction import rows request")
+
+	var pagination domain.PaginationRequest
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind pagination request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	rows, total, err := h.importService.GetRows(c.Request.Context(), c.Param("id"), c.Query("status"), pagination.Page, pagination.Limit)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("import_id", c.Param("id")).
+			Msg("Failed to get transaction import rows")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, domain.NewPaginatedResponse(rows, total, pagination.Page, pagination.Limit))
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"go-playground/server/service"
+	"go-playground/server/util"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+type VoucherHandler struct {
+	voucherService *service.VoucherService
+	logger         zerolog.Logger
+}
+
+func NewVoucherHandler(service *service.VoucherService) *VoucherHandler {
+	return &VoucherHandler{
+		voucherService: service,
+		logger:         logging.GetLogger(),
+	}
+}
+
+// VerifyVoucher godoc
+// @Summary Verify a voucher
+// @Description Use the voucher a branch scanned, which fulfills its pending or approved redemption. A voucher can be used once, later scans fail with VOUCHER_ALREADY_USED. Expired vouchers fail with VOUCHER_EXPIRED and those of cancelled, expired or failed redemptions with VOUCHER_VOID
+// @Tags redemptions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param voucher body domain.VerifyVoucherRequest true "Scanned voucher"
+// @Success 200 {object} domain.Redemption
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /redemptions/verify [post]
+func (h *VoucherHandler) Verify(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming verify voucher request")
+
+	var req domain.VerifyVoucherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind verify voucher request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	req.ChangedBy = c.GetString("user_id")
+
+	redemption, err := h.voucherService.Verify(c.Request.Context(), &req)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("merchant_id", req.MerchantID.String()).
+			Msg("Failed to verify voucher")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, redemption)
+}
+
+// AddRewardCodes godoc
+// @Summary Upload voucher codes
+// @Description Add codes to the pool of a reward whose voucher_source is pool. Each redemption takes the oldest unexpired code, codes the merchant already has are skipped
+// @Tags rewards
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Reward ID"
+// @Param codes body domain.AddRewardCodesRequest true "Voucher codes"
+// @Success 200 {object} domain.AddRewardCodesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /rewards/{id}/codes [post]
+func (h *VoucherHandler) AddCodes(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming add reward codes request")
+
+	var req domain.AddRewardCodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind add reward codes request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	result, err := h.voucherService.AddCodes(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("reward_id", c.Param("id")).
+			Msg("Failed to add reward codes")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
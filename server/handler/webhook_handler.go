@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"go-playground/server/service"
+	"go-playground/server/util"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+	logger         zerolog.Logger
+}
+
+func NewWebhookHandler(service *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: service,
+		logger:         logging.GetLogger(),
+	}
+}
+
+// CreateWebhookSubscription godoc
+// @Summary Create a webhook subscription
+// @Description Send a merchant's events of the given types to a public https URL, signed with the secret. Event types are points.earned, points.redeemed, reward.redeemed and redemption.status_updated
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param subscription body domain.CreateWebhookSubscriptionRequest true "Webhook subscription"
+// @Success 201 {object} domain.WebhookSubscription
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks [post]
+func (h *WebhookHandler) Create(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming create webhook subscription request")
+
+	var req domain.CreateWebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind create webhook subscription request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	subscription, err := h.webhookService.CreateSubscription(c.Request.Context(), &req)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("merchant_id", req.MerchantID.String()).
+			Msg("Failed to create webhook subscription")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, subscription)
+}
+
+// GetWebhookSubscriptionsByMerchantID godoc
+// @Summary Get a merchant's webhook subscriptions
+// @Description Get all webhook subscriptions of a merchant
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param merchant_id path string true "Merchant ID"
+// @Success 200 {array} domain.WebhookSubscription
+// @Failure 400 {object} map[string]string
+// @Router /webhooks/merchant/{merchant_id} [get]
+func (h *WebhookHandler) GetByMerchantID(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get webhook subscriptions request")
+
+	subscriptions, err := h.webhookService.GetSubscriptionsByMerchantID(c.Request.Context(), c.Param("merchant_id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("merchant_id", c.Param("merchant_id")).
+			Msg("Failed to get webhook subscriptions")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// DeleteWebhookSubscription godoc
+// @Summary Delete a webhook subscription
+// @Description Stop sending events to a webhook, its delivery log is deleted with it
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Webhook subscription ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/{id} [delete]
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming delete webhook subscription request")
+
+	if err := h.webhookService.DeleteSubscription(c.Request.Context(), c.Param("id")); err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("subscription_id", c.Param("id")).
+			Msg("Failed to delete webhook subscription")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook subscription deleted successfully"})
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Get webhook deliveries
+// @Description Get the delivery log of a webhook subscription, newest first. Filter on status dead for the deliveries that ran out of attempts
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Webhook subscription ID"
+// @Param status query string false "Delivery status: pending, delivered or dead"
+// @Param page query integer false "Page number (default: 1)"
+// @Param limit query integer false "Items per page (default: 10, max: 100)"
+// @Success 200 {object} domain.PaginatedResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming get webhook deliveries request")
+
+	var pagination domain.PaginationRequest
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		h.logger.Error().
+			Err(err).
+			Msg("Failed to bind pagination request")
+		util.HandleError(c, domain.ValidationError{Message: err.Error()})
+		return
+	}
+
+	deliveries, total, err := h.webhookService.GetDeliveries(c.Request.Context(), c.Param("id"), c.Query("status"), pagination.Page, pagination.Limit)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("subscription_id", c.Param("id")).
+			Msg("Failed to get webhook deliveries")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, domain.NewPaginatedResponse(deliveries, total, pagination.Page, pagination.Limit))
+}
+
+// ReplayWebhookDelivery godoc
+// @Summary Replay a webhook delivery
+// @Description Send a past delivery again as a new delivery with fresh attempts
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security UserIdAuth
+// @Param id path string true "Webhook delivery ID"
+// @Success 202 {object} domain.WebhookDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/deliveries/{id}/replay [post]
+func (h *WebhookHandler) Replay(c *gin.Context) {
+	h.logger.Info().
+		Str("method", c.Request.Method).
+		Str("url", c.Request.URL.RequestURI()).
+		Str("user_agent", c.Request.UserAgent()).
+		Dur("elapsed_ms", time.Since(time.Now())).
+		Msg("incoming replay webhook delivery request")
+
+	delivery, err := h.webhookService.ReplayDelivery(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("delivery_id", c.Param("id")).
+			Msg("Failed to replay webhook delivery")
+		util.HandleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
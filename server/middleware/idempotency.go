@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"go-playground/server/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxIdempotencyKeyLength keeps client keys to a sane size, a UUID is 36
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyScope resolves the merchant a request acts for. Idempotency keys
+// are scoped per merchant, so two merchants' POS clients can pick the same key.
+type IdempotencyScope func(c *gin.Context, body []byte) (uuid.UUID, error)
+
+// MerchantFromBodyCustomer scopes requests by the merchant of the
+// merchant_customers_id of their JSON body. The merchant is looked up rather
+// than taken from the body, like the transaction service does.
+func MerchantFromBodyCustomer(customers domain.MerchantCustomersRepository) IdempotencyScope {
+	return func(c *gin.Context, body []byte) (uuid.UUID, error) {
+		var req struct {
+			MerchantCustomersID uuid.UUID `json:"merchant_customers_id"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil || req.MerchantCustomersID == uuid.Nil {
+			return uuid.Nil, domain.NewValidationError("merchant_customers_id", "merchant_customers_id is required")
+		}
+		return merchantOfCustomer(c, customers, req.MerchantCustomersID)
+	}
+}
+
+// MerchantFromCustomer scopes requests by the merchant of the customer_id path parameter.
+func MerchantFromCustomer(customers domain.MerchantCustomersRepository) IdempotencyScope {
+	return func(c *gin.Context, body []byte) (uuid.UUID, error) {
+		customerID, err := uuid.Parse(c.Param("customer_id"))
+		if err != nil {
+			return uuid.Nil, domain.NewValidationError("customer_id", "invalid customer ID format")
+		}
+		return merchantOfCustomer(c, customers, customerID)
+	}
+}
+
+func merchantOfCustomer(c *gin.Context, customers domain.MerchantCustomersRepository, customerID uuid.UUID) (uuid.UUID, error) {
+	customer, err := customers.GetByID(c.Request.Context(), customerID)
+	if err != nil {
+		return uuid.Nil, domain.NewSystemError("IdempotencyMiddleware", err, "failed to get merchant customer")
+	}
+	if customer == nil {
+		return uuid.Nil, domain.NewResourceNotFoundError("merchant customer", customerID.String(), "merchant customer not found")
+	}
+	return customer.MerchantID, nil
+}
+
+// IdempotencyMiddleware makes retries of a request carrying an Idempotency-Key
+// header safe.
+//
+// The first request with a key runs and its response is stored. A retry with
+// the same key and the same method, path and body gets the stored response
+// back, with an Idempotent-Replayed header, and does not run again. A retry
+// with the same key but a different request, or while the first one is still
+// running, is rejected with a conflict.
+//
+// Server errors are not stored, the key is released so that a retry runs the
+// request again. Requests without the header are passed through untouched.
+func IdempotencyMiddleware(repo domain.IdempotencyRepository, scope IdempotencyScope) gin.HandlerFunc {
+	logger := logging.GetLogger()
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(domain.IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			util.HandleError(c, domain.NewValidationError("Idempotency-Key", "idempotency key must be at most 255 characters"))
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Str("method", c.Request.Method).
+				Str("url", c.Request.URL.RequestURI()).
+				Msg("Failed to read request body")
+			util.HandleError(c, domain.NewValidationError("body", "failed to read request body"))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		merchantID, err := scope(c, body)
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Str("method", c.Request.Method).
+				Str("url", c.Request.URL.RequestURI()).
+				Msg("Failed to resolve idempotency scope")
+			util.HandleError(c, err)
+			c.Abort()
+			return
+		}
+
+		// The client may have given up on the request, storing its response
+		// must not be cancelled with it
+		ctx := context.WithoutCancel(c.Request.Context())
+		hash := requestHash(c.Request, body)
+		held, err := repo.Reserve(ctx, merchantID.String(), key, &domain.IdempotencyRecord{
+			RequestHash: hash,
+			CreatedAt:   time.Now(),
+		})
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Str("idempotency_key", key).
+				Msg("Failed to reserve idempotency key")
+			util.HandleError(c, domain.NewSystemError("IdempotencyMiddleware", err, "failed to reserve idempotency key"))
+			c.Abort()
+			return
+		}
+
+		if held != nil {
+			switch {
+			case held.RequestHash != hash:
+				logger.Error().
+					Str("idempotency_key", key).
+					Msg("Idempotency key reused with a different request")
+				util.HandleError(c, domain.NewResourceConflictError("idempotency key", "idempotency key was already used for a different request"))
+			case held.InFlight():
+				logger.Error().
+					Str("idempotency_key", key).
+					Msg("Idempotency key still in flight")
+				util.HandleError(c, domain.NewResourceConflictError("idempotency key", "a request with this idempotency key is still being processed"))
+			default:
+				logger.Info().
+					Str("idempotency_key", key).
+					Int("status", held.StatusCode).
+					Msg("Replaying idempotent response")
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(held.StatusCode, held.ContentType, held.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			if err := repo.Release(ctx, merchantID.String(), key); err != nil {
+				logger.Error().
+					Err(err).
+					Str("idempotency_key", key).
+					Msg("Failed to release idempotency key")
+			}
+			return
+		}
+
+		err = repo.Complete(ctx, merchantID.String(), key, &domain.IdempotencyRecord{
+			RequestHash: hash,
+			StatusCode:  recorder.Status(),
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+			CreatedAt:   time.Now(),
+		})
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Str("idempotency_key", key).
+				Msg("Failed to store idempotent response")
+		}
+	}
+}
+
+// requestHash identifies a request by method, path and body.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body written through it.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,174 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-playground/server/domain"
+	"go-playground/server/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryIdempotencyRepository keeps idempotency records in a map
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]*domain.IdempotencyRecord
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{records: map[string]*domain.IdempotencyRecord{}}
+}
+
+func (r *memoryIdempotencyRepository) Reserve(ctx context.Context, scope, key string, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if held, ok := r.records[scope+":"+key]; ok {
+		return held, nil
+	}
+	r.records[scope+":"+key] = record
+	return nil, nil
+}
+
+func (r *memoryIdempotencyRepository) Complete(ctx context.Context, scope, key string, record *domain.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[scope+":"+key] = record
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) Release(ctx context.Context, scope, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, scope+":"+key)
+	return nil
+}
+
+// memoryCustomersRepository knows the merchant of a few customers
+type memoryCustomersRepository struct {
+	domain.MerchantCustomersRepository
+	merchants map[uuid.UUID]uuid.UUID
+}
+
+func (r *memoryCustomersRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.MerchantCustomer, error) {
+	merchantID, ok := r.merchants[id]
+	if !ok {
+		return nil, nil
+	}
+	return &domain.MerchantCustomer{ID: id, MerchantID: merchantID}, nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	merchantA, merchantB := uuid.New(), uuid.New()
+	alice, amy, bob := uuid.New(), uuid.New(), uuid.New()
+	customers := &memoryCustomersRepository{merchants: map[uuid.UUID]uuid.UUID{
+		alice: merchantA,
+		amy:   merchantA,
+		bob:   merchantB,
+	}}
+
+	setup := func(status int) (*gin.Engine, *int) {
+		calls := 0
+		r := gin.New()
+		r.POST("/transactions", middleware.IdempotencyMiddleware(newMemoryIdempotencyRepository(), middleware.MerchantFromBodyCustomer(customers)), func(c *gin.Context) {
+			calls++
+			c.JSON(status, gin.H{"transaction_id": uuid.New().String()})
+		})
+		return r, &calls
+	}
+	send := func(r *gin.Engine, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(domain.IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	purchase := func(customerID uuid.UUID, merchantID uuid.UUID) string {
+		return `{"merchant_customers_id":"` + customerID.String() + `","merchant_id":"` + merchantID.String() + `","transaction_amount":10}`
+	}
+	aliceBuys := purchase(alice, merchantA)
+
+	t.Run("retry replays the first response", func(t *testing.T) {
+		r, calls := setup(http.StatusCreated)
+
+		first := send(r, "key-1", aliceBuys)
+		retry := send(r, "key-1", aliceBuys)
+
+		assert.Equal(t, 1, *calls)
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("same key with a different body conflicts", func(t *testing.T) {
+		r, calls := setup(http.StatusCreated)
+
+		send(r, "key-1", aliceBuys)
+		retry := send(r, "key-1", strings.Replace(aliceBuys, `"transaction_amount":10`, `"transaction_amount":20`, 1))
+
+		assert.Equal(t, 1, *calls)
+		assert.Equal(t, http.StatusConflict, retry.Code)
+	})
+
+	t.Run("keys are scoped per merchant", func(t *testing.T) {
+		r, calls := setup(http.StatusCreated)
+
+		send(r, "key-1", aliceBuys)
+		other := send(r, "key-1", purchase(bob, merchantB))
+
+		assert.Equal(t, 2, *calls)
+		assert.Empty(t, other.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("the merchant comes from the customer, not the body", func(t *testing.T) {
+		r, calls := setup(http.StatusCreated)
+
+		send(r, "key-1", aliceBuys)
+		// Naming merchant B does not reach into its scope
+		spoofed := send(r, "key-1", purchase(bob, merchantA))
+		// Nor does naming another merchant dodge merchant A's
+		dodged := send(r, "key-1", purchase(amy, merchantB))
+
+		assert.Equal(t, 2, *calls)
+		assert.Equal(t, http.StatusCreated, spoofed.Code)
+		assert.Equal(t, http.StatusConflict, dodged.Code)
+	})
+
+	t.Run("unknown customer", func(t *testing.T) {
+		r, calls := setup(http.StatusCreated)
+
+		w := send(r, "key-1", purchase(uuid.New(), merchantA))
+
+		assert.Equal(t, 0, *calls)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		r, calls := setup(http.StatusInternalServerError)
+
+		send(r, "key-1", aliceBuys)
+		send(r, "key-1", aliceBuys)
+
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("requests without a key pass through", func(t *testing.T) {
+		r, calls := setup(http.StatusCreated)
+
+		send(r, "", aliceBuys)
+		send(r, "", aliceBuys)
+
+		assert.Equal(t, 2, *calls)
+	})
+}
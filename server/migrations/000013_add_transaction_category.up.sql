@@ -0,0 +1,3 @@
+-- Transaction category is evaluated by `program_rule_transaction_category` rules,
+-- ie food, travel, electronics, etc
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS transaction_category VARCHAR(100) NOT NULL DEFAULT '';
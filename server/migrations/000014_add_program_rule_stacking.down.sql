@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS program_rule_awards;
+
+DROP INDEX IF EXISTS idx_program_rules_priority;
+
+ALTER TABLE program_rules
+    DROP CONSTRAINT IF EXISTS valid_stacking,
+    DROP CONSTRAINT IF EXISTS valid_max_points_per_transaction,
+    DROP CONSTRAINT IF EXISTS valid_customer_period_cap;
+
+ALTER TABLE program_rules
+    DROP COLUMN IF EXISTS priority,
+    DROP COLUMN IF EXISTS stacking,
+    DROP COLUMN IF EXISTS max_points_per_transaction,
+    DROP COLUMN IF EXISTS max_points_per_customer_per_period,
+    DROP COLUMN IF EXISTS cap_period;
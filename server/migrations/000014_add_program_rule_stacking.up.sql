@@ -0,0 +1,35 @@
+-- Rules are applied in priority order (highest first). `stacking` decides how a
+-- matching rule combines with the others:
+--   stackable      adds on top of every other matching rule
+--   non_stackable  only the highest priority matching non_stackable rule applies
+--   exclusive      the highest priority matching exclusive rule is the only rule applied
+ALTER TABLE program_rules
+    ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS stacking VARCHAR(20) NOT NULL DEFAULT 'stackable',
+    ADD COLUMN IF NOT EXISTS max_points_per_transaction INTEGER,
+    ADD COLUMN IF NOT EXISTS max_points_per_customer_per_period INTEGER,
+    ADD COLUMN IF NOT EXISTS cap_period VARCHAR(10);
+
+ALTER TABLE program_rules
+    ADD CONSTRAINT valid_stacking CHECK (stacking IN ('stackable', 'non_stackable', 'exclusive')),
+    ADD CONSTRAINT valid_max_points_per_transaction CHECK (max_points_per_transaction IS NULL OR max_points_per_transaction >= 0),
+    ADD CONSTRAINT valid_customer_period_cap CHECK (
+        (max_points_per_customer_per_period IS NULL AND cap_period IS NULL) OR
+        (max_points_per_customer_per_period >= 0 AND cap_period IN ('day', 'week', 'month', 'year'))
+    );
+
+CREATE INDEX IF NOT EXISTS idx_program_rules_priority ON program_rules(program_id, priority DESC);
+
+-- Points each rule awarded on each transaction, so per customer caps can be
+-- checked against what the rule already paid out in the current period
+CREATE TABLE IF NOT EXISTS program_rule_awards (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    rule_id UUID NOT NULL REFERENCES program_rules(id) ON DELETE CASCADE,
+    merchant_customers_id UUID NOT NULL REFERENCES merchant_customers(id),
+    transaction_id UUID NOT NULL REFERENCES transactions(transaction_id),
+    points INTEGER NOT NULL,
+    awarded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_program_rule_awards_rule_customer ON program_rule_awards(rule_id, merchant_customers_id, awarded_at);
@@ -0,0 +1,2 @@
+ALTER TABLE merchant_customers DROP COLUMN IF EXISTS date_of_birth;
+ALTER TABLE merchants DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,4 @@
+-- `program_rule_transaction_date` rules are evaluated in the merchant's local
+-- time (IANA name, ie Asia/Jakarta), and may match on the customer's birthday
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE merchant_customers ADD COLUMN IF NOT EXISTS date_of_birth DATE;
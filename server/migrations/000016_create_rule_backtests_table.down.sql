@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_points_ledger_transaction_id;
+DROP INDEX IF EXISTS idx_transactions_program_date;
+DROP TABLE IF EXISTS rule_backtest_customers;
+DROP TABLE IF EXISTS rule_backtests;
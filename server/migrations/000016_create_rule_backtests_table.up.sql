@@ -0,0 +1,38 @@
+-- A backtest replays a date range of a program's transactions against a draft
+-- rule set (stored as JSON in `rules`) and compares the points it would have
+-- issued with what the ledger actually issued
+CREATE TABLE IF NOT EXISTS rule_backtests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    program_id UUID NOT NULL REFERENCES programs(program_id),
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    from_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    to_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    rules JSONB NOT NULL,
+    transactions_processed BIGINT NOT NULL DEFAULT 0,
+    customers_count BIGINT NOT NULL DEFAULT 0,
+    total_points BIGINT NOT NULL DEFAULT 0,
+    actual_points BIGINT NOT NULL DEFAULT 0,
+    error_message TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT valid_backtest_status CHECK (status IN ('queued', 'running', 'completed', 'failed')),
+    CONSTRAINT valid_backtest_range CHECK (to_date > from_date)
+);
+
+CREATE INDEX idx_rule_backtests_program_id ON rule_backtests(program_id);
+
+-- Per customer results of a completed backtest
+CREATE TABLE IF NOT EXISTS rule_backtest_customers (
+    backtest_id UUID NOT NULL REFERENCES rule_backtests(id) ON DELETE CASCADE,
+    merchant_customers_id UUID NOT NULL REFERENCES merchant_customers(id),
+    transaction_count INTEGER NOT NULL,
+    points BIGINT NOT NULL,
+    actual_points BIGINT NOT NULL,
+    PRIMARY KEY (backtest_id, merchant_customers_id)
+);
+
+-- Backtests page through a program's transactions by date and look up the
+-- points each one earned
+CREATE INDEX IF NOT EXISTS idx_transactions_program_date ON transactions(program_id, transaction_date, transaction_id);
+CREATE INDEX IF NOT EXISTS idx_points_ledger_transaction_id ON points_ledger(transaction_id);
@@ -0,0 +1,16 @@
+ALTER TABLE rule_backtests DROP COLUMN IF EXISTS rule_set_id;
+DROP INDEX IF EXISTS idx_points_ledger_rule_set_id;
+ALTER TABLE points_ledger DROP COLUMN IF EXISTS rule_set_id;
+
+-- Only the published rules were in force before versioning
+DELETE FROM program_rules pr
+USING program_rule_sets rs
+WHERE rs.id = pr.rule_set_id AND rs.status <> 'published';
+
+DROP INDEX IF EXISTS idx_program_rules_rule_key;
+DROP INDEX IF EXISTS idx_program_rules_rule_set_id;
+ALTER TABLE program_rules
+    DROP COLUMN IF EXISTS rule_key,
+    DROP COLUMN IF EXISTS rule_set_id;
+
+DROP TABLE IF EXISTS program_rule_sets;
@@ -0,0 +1,51 @@
+-- Program rules are grouped in numbered rule set versions. Rules are edited in
+-- the program's draft; publishing the draft archives the version in force,
+-- and an archived version can be published again to roll back. Published and
+-- archived rules never change, so a ledger entry's rule set tells which rules
+-- produced it.
+CREATE TABLE IF NOT EXISTS program_rule_sets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    program_id UUID NOT NULL REFERENCES programs(program_id),
+    version INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    description TEXT NOT NULL DEFAULT '',
+    published_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_rule_set_status CHECK (status IN ('draft', 'published', 'archived')),
+    CONSTRAINT unique_rule_set_version UNIQUE (program_id, version)
+);
+
+-- At most one published version and one draft per program
+CREATE UNIQUE INDEX idx_program_rule_sets_published ON program_rule_sets(program_id) WHERE status = 'published';
+CREATE UNIQUE INDEX idx_program_rule_sets_draft ON program_rule_sets(program_id) WHERE status = 'draft';
+
+-- The rules in force before versioning become version 1 of their program
+INSERT INTO program_rule_sets (program_id, version, status, description, published_at)
+SELECT DISTINCT program_id, 1, 'published', 'Rules in force before versioning', CURRENT_TIMESTAMP
+FROM program_rules;
+
+-- rule_key is shared by the copies of a rule across versions, so per customer
+-- caps keep counting what earlier versions of the rule awarded
+ALTER TABLE program_rules
+    ADD COLUMN IF NOT EXISTS rule_set_id UUID REFERENCES program_rule_sets(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS rule_key UUID;
+
+UPDATE program_rules pr
+SET rule_set_id = rs.id, rule_key = pr.id
+FROM program_rule_sets rs
+WHERE rs.program_id = pr.program_id;
+
+ALTER TABLE program_rules
+    ALTER COLUMN rule_set_id SET NOT NULL,
+    ALTER COLUMN rule_key SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_program_rules_rule_set_id ON program_rules(rule_set_id);
+CREATE INDEX IF NOT EXISTS idx_program_rules_rule_key ON program_rules(rule_key);
+
+-- Entries written before versioning have no rule set
+ALTER TABLE points_ledger ADD COLUMN IF NOT EXISTS rule_set_id UUID REFERENCES program_rule_sets(id);
+CREATE INDEX IF NOT EXISTS idx_points_ledger_rule_set_id ON points_ledger(rule_set_id);
+
+-- Backtests keep their copy of the rules when a draft they replayed is discarded
+ALTER TABLE rule_backtests ADD COLUMN IF NOT EXISTS rule_set_id UUID REFERENCES program_rule_sets(id) ON DELETE SET NULL;
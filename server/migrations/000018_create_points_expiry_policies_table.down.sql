@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_points_ledger_program_customer;
+ALTER TABLE points_ledger DROP COLUMN IF EXISTS tx_type;
+DROP TABLE IF EXISTS points_expiry_policies;
@@ -0,0 +1,23 @@
+-- How long earned points stay valid in a program. Programs without a policy
+-- never expire points.
+--   fixed_days     each earn expires `days` days after it was earned
+--   calendar_year  each earn expires at the end of the calendar year it was
+--                  earned in, in the merchant's timezone
+--   inactivity     every point expires `days` days after the customer's last
+--                  earn or redemption
+CREATE TABLE IF NOT EXISTS points_expiry_policies (
+    program_id UUID PRIMARY KEY REFERENCES programs(program_id) ON DELETE CASCADE,
+    policy VARCHAR(20) NOT NULL,
+    days INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_expiry_policy CHECK (
+        (policy IN ('fixed_days', 'inactivity') AND days > 0) OR
+        (policy = 'calendar_year' AND days IS NULL)
+    )
+);
+
+-- Expired points are written as ledger entries of type point_expiration that
+-- redeem the oldest unspent earns first
+ALTER TABLE points_ledger ADD COLUMN IF NOT EXISTS tx_type point_tx_type;
+CREATE INDEX IF NOT EXISTS idx_points_ledger_program_customer ON points_ledger(program_id, merchant_customers_id);
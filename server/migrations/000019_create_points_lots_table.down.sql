@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS points_lot_allocations;
+DROP TABLE IF EXISTS points_lots;
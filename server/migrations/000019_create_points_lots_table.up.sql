@@ -0,0 +1,86 @@
+-- Every earn opens a lot. Redemptions and expirations consume the oldest lots
+-- first and record in points_lot_allocations how much they took from each, so
+-- it is known which earn every spent point came from.
+CREATE TABLE IF NOT EXISTS points_lots (
+    lot_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    ledger_id UUID NOT NULL UNIQUE REFERENCES points_ledger(ledger_id),
+    merchant_customers_id UUID NOT NULL REFERENCES merchant_customers(id),
+    program_id UUID NOT NULL REFERENCES programs(program_id),
+    transaction_id UUID REFERENCES transactions(transaction_id),
+    points INTEGER NOT NULL,
+    remaining INTEGER NOT NULL,
+    earned_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    -- NULL when the points do not expire or expire on inactivity
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_lot_points CHECK (points > 0),
+    CONSTRAINT valid_lot_remaining CHECK (remaining >= 0 AND remaining <= points)
+);
+
+CREATE INDEX idx_points_lots_unspent ON points_lots(merchant_customers_id, program_id, earned_at) WHERE remaining > 0;
+CREATE INDEX idx_points_lots_expires_at ON points_lots(expires_at) WHERE remaining > 0;
+
+CREATE TABLE IF NOT EXISTS points_lot_allocations (
+    allocation_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    lot_id UUID NOT NULL REFERENCES points_lots(lot_id),
+    ledger_id UUID NOT NULL REFERENCES points_ledger(ledger_id),
+    points INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_allocation_points CHECK (points > 0)
+);
+
+CREATE INDEX idx_points_lot_allocations_lot_id ON points_lot_allocations(lot_id);
+CREATE INDEX idx_points_lot_allocations_ledger_id ON points_lot_allocations(ledger_id);
+
+-- Existing earns become lots. Earns and debits are laid end to end per
+-- customer and program; a debit consumed the part of every earn its range
+-- overlaps, which is the oldest first.
+CREATE TEMPORARY TABLE backfill_earns AS
+SELECT pl.ledger_id, pl.merchant_customers_id, pl.program_id, pl.transaction_id,
+       pl.points_earned AS points, pl.created_at,
+       SUM(pl.points_earned) OVER w - pl.points_earned AS range_start,
+       SUM(pl.points_earned) OVER w AS range_end
+FROM points_ledger pl
+WHERE pl.points_earned > 0
+WINDOW w AS (PARTITION BY pl.merchant_customers_id, pl.program_id ORDER BY pl.created_at, pl.ledger_id);
+
+CREATE TEMPORARY TABLE backfill_debits AS
+SELECT pl.ledger_id, pl.merchant_customers_id, pl.program_id, pl.created_at,
+       SUM(pl.points_redeemed) OVER w - pl.points_redeemed AS range_start,
+       SUM(pl.points_redeemed) OVER w AS range_end
+FROM points_ledger pl
+WHERE pl.points_redeemed > 0
+WINDOW w AS (PARTITION BY pl.merchant_customers_id, pl.program_id ORDER BY pl.created_at, pl.ledger_id);
+
+INSERT INTO points_lots (ledger_id, merchant_customers_id, program_id, transaction_id, points, remaining, earned_at, expires_at)
+SELECT e.ledger_id, e.merchant_customers_id, e.program_id, e.transaction_id, e.points,
+       e.points - LEAST(e.points, GREATEST(0, COALESCE(spent.total, 0) - e.range_start)),
+       e.created_at,
+       CASE p.policy
+           WHEN 'fixed_days' THEN e.created_at + p.days * INTERVAL '1 day'
+           WHEN 'calendar_year' THEN (date_trunc('year', e.created_at AT TIME ZONE m.timezone) + INTERVAL '1 year') AT TIME ZONE m.timezone
+       END
+FROM backfill_earns e
+JOIN programs pr ON pr.program_id = e.program_id
+JOIN merchants m ON m.id = pr.merchant_id
+LEFT JOIN points_expiry_policies p ON p.program_id = e.program_id
+LEFT JOIN (
+    SELECT merchant_customers_id, program_id, MAX(range_end) AS total
+    FROM backfill_debits
+    GROUP BY merchant_customers_id, program_id
+) spent ON spent.merchant_customers_id = e.merchant_customers_id AND spent.program_id = e.program_id;
+
+INSERT INTO points_lot_allocations (lot_id, ledger_id, points, created_at)
+SELECT l.lot_id, d.ledger_id,
+       LEAST(e.range_end, d.range_end) - GREATEST(e.range_start, d.range_start),
+       d.created_at
+FROM backfill_debits d
+JOIN backfill_earns e
+  ON e.merchant_customers_id = d.merchant_customers_id
+ AND e.program_id = d.program_id
+ AND e.range_start < d.range_end
+ AND d.range_start < e.range_end
+JOIN points_lots l ON l.ledger_id = e.ledger_id;
+
+DROP TABLE backfill_debits;
+DROP TABLE backfill_earns;
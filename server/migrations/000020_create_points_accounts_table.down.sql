@@ -0,0 +1,2 @@
+ALTER TABLE points_ledger DROP CONSTRAINT IF EXISTS non_negative_points_balance;
+DROP TABLE IF EXISTS points_accounts;
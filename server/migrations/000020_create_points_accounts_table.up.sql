@@ -0,0 +1,20 @@
+-- One row per customer and program holding the current balance. Every ledger
+-- write locks the row first, so writes to one account are serialized and the
+-- balance can never go below zero.
+CREATE TABLE IF NOT EXISTS points_accounts (
+    merchant_customers_id UUID NOT NULL REFERENCES merchant_customers(id),
+    program_id UUID NOT NULL REFERENCES programs(program_id),
+    balance INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (merchant_customers_id, program_id),
+    CONSTRAINT non_negative_balance CHECK (balance >= 0)
+);
+
+INSERT INTO points_accounts (merchant_customers_id, program_id, balance)
+SELECT merchant_customers_id, program_id, SUM(remaining)
+FROM points_lots
+GROUP BY merchant_customers_id, program_id;
+
+-- Entries already overdrawn by concurrent redemptions are left as they are
+ALTER TABLE points_ledger
+    ADD CONSTRAINT non_negative_points_balance CHECK (points_balance >= 0) NOT VALID;
@@ -0,0 +1,18 @@
+-- Domain events are written here in the same transaction as the change they
+-- describe, then published to Kafka by the outbox relay. A row is published
+-- at least once, consumers dedupe on the event id in the payload.
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    -- Publishing order, created_at is the same for every event of a transaction
+    sequence BIGSERIAL NOT NULL,
+    topic VARCHAR(255) NOT NULL,
+    partition_key VARCHAR(255) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_outbox_events_unpublished ON outbox_events(sequence) WHERE published_at IS NULL;
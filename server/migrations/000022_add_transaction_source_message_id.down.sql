@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transactions_source_message_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS source_message_id;
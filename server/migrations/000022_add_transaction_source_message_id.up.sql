@@ -0,0 +1,8 @@
+-- Transactions ingested from Kafka keep the id of the message they came from.
+-- A message delivered twice then conflicts instead of creating the
+-- transaction again.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS source_message_id VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_source_message_id
+    ON transactions(merchant_id, source_message_id)
+    WHERE source_message_id IS NOT NULL;
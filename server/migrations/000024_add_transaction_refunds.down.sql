@@ -0,0 +1,13 @@
+-- point_reversal stays in point_tx_type, enum values can not be dropped
+ALTER TABLE points_ledger
+    DROP CONSTRAINT IF EXISTS non_negative_points_debt,
+    DROP COLUMN IF EXISTS points_debt;
+ALTER TABLE points_accounts
+    DROP CONSTRAINT IF EXISTS non_negative_debt,
+    DROP COLUMN IF EXISTS debt;
+
+ALTER TABLE programs DROP CONSTRAINT IF EXISTS valid_refund_policy;
+ALTER TABLE programs DROP COLUMN IF EXISTS refund_policy;
+
+DROP INDEX IF EXISTS idx_transactions_original_transaction_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS original_transaction_id;
@@ -0,0 +1,30 @@
+-- A refund points at the purchase it gives money back for. It takes back the
+-- purchase's points pro rata, and the refunds of a purchase that are not
+-- cancelled never add up to more than the purchase.
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS original_transaction_id UUID REFERENCES transactions(transaction_id);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_original_transaction_id
+    ON transactions(original_transaction_id)
+    WHERE original_transaction_id IS NOT NULL;
+
+-- What a refund or cancellation does when the customer has already spent the
+-- points it takes back: block rejects it, claw_back takes back what is left
+-- and writes off the rest, allow_negative takes everything and lets the
+-- balance go below zero until later earns pay it off.
+ALTER TABLE programs
+    ADD COLUMN IF NOT EXISTS refund_policy VARCHAR(20) NOT NULL DEFAULT 'block',
+    ADD CONSTRAINT valid_refund_policy CHECK (refund_policy IN ('block', 'claw_back', 'allow_negative'));
+
+-- The points an allow_negative reversal took beyond the balance are owed as
+-- debt, the balance itself stays at zero. Later earns pay off the debt before
+-- they add to the balance.
+ALTER TABLE points_accounts
+    ADD COLUMN IF NOT EXISTS debt INTEGER NOT NULL DEFAULT 0,
+    ADD CONSTRAINT non_negative_debt CHECK (debt >= 0);
+ALTER TABLE points_ledger
+    ADD COLUMN IF NOT EXISTS points_debt INTEGER NOT NULL DEFAULT 0,
+    ADD CONSTRAINT non_negative_points_debt CHECK (points_debt >= 0);
+
+-- Ledger entries that take back the points of a refunded or cancelled transaction
+ALTER TYPE point_tx_type ADD VALUE IF NOT EXISTS 'point_reversal';
@@ -0,0 +1,21 @@
+-- A pending transaction holds the points it will earn instead of earning them.
+-- Held points are not part of the balance and can not be spent. Completing
+-- the transaction releases the hold into the balance, failing or cancelling
+-- it voids the hold.
+CREATE TABLE IF NOT EXISTS points_holds (
+    hold_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    transaction_id UUID NOT NULL UNIQUE REFERENCES transactions(transaction_id),
+    merchant_customers_id UUID NOT NULL REFERENCES merchant_customers(id),
+    program_id UUID NOT NULL REFERENCES programs(program_id),
+    points INTEGER NOT NULL,
+    rule_set_id UUID REFERENCES program_rule_sets(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'held',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT valid_hold_points CHECK (points > 0),
+    CONSTRAINT valid_hold_status CHECK (status IN ('held', 'released', 'voided'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_points_holds_held
+    ON points_holds(merchant_customers_id, program_id)
+    WHERE status = 'held';
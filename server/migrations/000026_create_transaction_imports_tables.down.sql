@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS transaction_import_rows;
+DROP TABLE IF EXISTS transaction_imports;
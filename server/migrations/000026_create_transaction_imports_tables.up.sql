@@ -0,0 +1,35 @@
+-- A transaction import loads a merchant's historical transactions from a JSON
+-- batch or a CSV file. Uploading the same file again finds its import by the
+-- file hash instead of creating the transactions twice.
+CREATE TABLE IF NOT EXISTS transaction_imports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    merchant_id UUID NOT NULL REFERENCES merchants(id),
+    format VARCHAR(10) NOT NULL,
+    file_hash VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    total_rows INTEGER NOT NULL,
+    processed_rows INTEGER NOT NULL DEFAULT 0,
+    created_rows INTEGER NOT NULL DEFAULT 0,
+    duplicate_rows INTEGER NOT NULL DEFAULT 0,
+    failed_rows INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT valid_import_format CHECK (format IN ('json', 'csv')),
+    CONSTRAINT valid_import_status CHECK (status IN ('queued', 'running', 'completed', 'failed')),
+    CONSTRAINT unique_import_file UNIQUE (merchant_id, file_hash)
+);
+
+-- The outcome of every row of an import, written in the same database
+-- transaction as the transactions it created
+CREATE TABLE IF NOT EXISTS transaction_import_rows (
+    import_id UUID NOT NULL REFERENCES transaction_imports(id) ON DELETE CASCADE,
+    row_number INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    transaction_id UUID REFERENCES transactions(transaction_id),
+    error_message TEXT,
+    PRIMARY KEY (import_id, row_number),
+    CONSTRAINT valid_import_row_status CHECK (status IN ('created', 'duplicate', 'failed'))
+);
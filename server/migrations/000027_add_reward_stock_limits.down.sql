@@ -0,0 +1,9 @@
+-- cancelled stays in redemption_status, enum values can not be dropped
+DROP INDEX IF EXISTS idx_redemptions_customer_reward;
+
+ALTER TABLE rewards
+    DROP CONSTRAINT IF EXISTS valid_low_stock_threshold,
+    DROP CONSTRAINT IF EXISTS valid_max_per_customer,
+    DROP CONSTRAINT IF EXISTS non_negative_available_quantity,
+    DROP COLUMN IF EXISTS low_stock_threshold,
+    DROP COLUMN IF EXISTS max_per_customer;
@@ -0,0 +1,16 @@
+-- available_quantity is the stock left of a reward, NULL when it is not
+-- limited. Redemptions take from it and cancelled redemptions put it back.
+ALTER TABLE rewards
+    ADD COLUMN IF NOT EXISTS max_per_customer INTEGER,
+    ADD COLUMN IF NOT EXISTS low_stock_threshold INTEGER,
+    ADD CONSTRAINT non_negative_available_quantity CHECK (available_quantity >= 0) NOT VALID,
+    ADD CONSTRAINT valid_max_per_customer CHECK (max_per_customer > 0),
+    ADD CONSTRAINT valid_low_stock_threshold CHECK (low_stock_threshold >= 0);
+
+-- Counts a customer's redemptions of a reward against max_per_customer
+CREATE INDEX IF NOT EXISTS idx_redemptions_customer_reward
+    ON redemptions(merchant_customers_id, reward_id);
+
+-- A pending redemption can be cancelled, which refunds its points and stock.
+-- Cancelled follows the spelling transactions use.
+ALTER TYPE redemption_status ADD VALUE IF NOT EXISTS 'cancelled';
@@ -0,0 +1,9 @@
+-- fulfilled stays in redemption_status, enum values can not be dropped
+DROP TABLE IF EXISTS vouchers;
+DROP TABLE IF EXISTS reward_codes;
+
+ALTER TABLE rewards
+    DROP CONSTRAINT IF EXISTS valid_voucher_validity_days,
+    DROP CONSTRAINT IF EXISTS valid_voucher_source,
+    DROP COLUMN IF EXISTS voucher_validity_days,
+    DROP COLUMN IF EXISTS voucher_source;
@@ -0,0 +1,48 @@
+-- Where a reward's voucher codes come from: generated for each redemption or
+-- taken from codes the merchant uploaded. Generated codes expire after
+-- voucher_validity_days, or never when it is NULL.
+ALTER TABLE rewards
+    ADD COLUMN IF NOT EXISTS voucher_source VARCHAR(20) NOT NULL DEFAULT 'generated',
+    ADD COLUMN IF NOT EXISTS voucher_validity_days INTEGER,
+    ADD CONSTRAINT valid_voucher_source CHECK (voucher_source IN ('generated', 'pool')),
+    ADD CONSTRAINT valid_voucher_validity_days CHECK (voucher_validity_days > 0);
+
+-- Codes a merchant uploaded for a pool reward. A code belongs to the
+-- redemption it was handed out to, and is never handed out again.
+CREATE TABLE IF NOT EXISTS reward_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    reward_id UUID NOT NULL REFERENCES rewards(id) ON DELETE CASCADE,
+    merchant_id UUID NOT NULL REFERENCES merchants(id),
+    code VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    redemption_id UUID REFERENCES redemptions(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    assigned_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (merchant_id, code)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reward_codes_unassigned
+    ON reward_codes(reward_id, created_at)
+    WHERE redemption_id IS NULL;
+
+-- The voucher a customer gets for a redemption. A branch verifies it once,
+-- which fulfills the redemption.
+CREATE TABLE IF NOT EXISTS vouchers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    redemption_id UUID NOT NULL UNIQUE REFERENCES redemptions(id),
+    reward_id UUID NOT NULL REFERENCES rewards(id),
+    merchant_id UUID NOT NULL REFERENCES merchants(id),
+    code VARCHAR(64) NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'issued',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    used_at TIMESTAMP WITH TIME ZONE,
+    used_branch_id UUID,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (merchant_id, code),
+    CONSTRAINT valid_voucher_source CHECK (source IN ('generated', 'pool')),
+    CONSTRAINT valid_voucher_status CHECK (status IN ('issued', 'used', 'void'))
+);
+
+-- A redemption whose voucher was used at a branch
+ALTER TYPE redemption_status ADD VALUE IF NOT EXISTS 'fulfilled';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_redemption_status_history_redemption_id;
+DROP TABLE IF EXISTS redemption_status_history;
+
+ALTER TABLE redemptions DROP COLUMN IF EXISTS transaction_id;
+
+-- approved and expired stay in redemption_status, enum values can not be dropped
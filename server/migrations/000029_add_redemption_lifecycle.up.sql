@@ -0,0 +1,46 @@
+-- Redemptions are pending until approved or fulfilled, and end fulfilled,
+-- cancelled, expired or failed.
+ALTER TYPE redemption_status ADD VALUE IF NOT EXISTS 'approved';
+ALTER TYPE redemption_status ADD VALUE IF NOT EXISTS 'expired';
+
+-- A completed redemption handed out its reward
+UPDATE redemptions SET status = 'fulfilled' WHERE status = 'completed';
+
+-- Redemption transactions were written without a status, they took their
+-- points when they were created
+UPDATE transactions SET status = 'completed' WHERE transaction_type = 'redemption' AND status = '';
+
+-- The transaction that took the redemption's points, refunds point at it
+ALTER TABLE redemptions
+    ADD COLUMN IF NOT EXISTS transaction_id UUID REFERENCES transactions(transaction_id);
+
+-- Redemptions and their transactions were written with the same customer,
+-- points and date
+UPDATE redemptions r
+SET transaction_id = (
+    SELECT t.transaction_id
+    FROM transactions t
+    WHERE t.transaction_type = 'redemption'
+      AND t.merchant_customers_id = r.merchant_customers_id
+      AND t.transaction_amount = r.points_used
+      AND t.transaction_date = r.redemption_date
+    ORDER BY t.created_at
+    LIMIT 1
+)
+WHERE r.transaction_id IS NULL;
+
+-- Every status a redemption moves to, who moved it and why. from_status is
+-- NULL for the redemption being created.
+CREATE TABLE IF NOT EXISTS redemption_status_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    redemption_id UUID NOT NULL REFERENCES redemptions(id) ON DELETE CASCADE,
+    from_status redemption_status,
+    to_status redemption_status NOT NULL,
+    reason TEXT,
+    changed_by VARCHAR(255),
+    refund_transaction_id UUID REFERENCES transactions(transaction_id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_redemption_status_history_redemption_id
+    ON redemption_status_history(redemption_id, created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_redemptions_group_id;
+
+ALTER TABLE redemptions DROP COLUMN IF EXISTS group_id;
@@ -0,0 +1,7 @@
+-- The redemptions of a cart share a group and the one transaction that took
+-- their points. A redemption of a single reward has no group.
+ALTER TABLE redemptions ADD COLUMN IF NOT EXISTS group_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_redemptions_group_id
+    ON redemptions(group_id)
+    WHERE group_id IS NOT NULL;
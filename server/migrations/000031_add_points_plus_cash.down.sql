@@ -0,0 +1,9 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS cash_amount;
+ALTER TABLE redemptions DROP COLUMN IF EXISTS cash_amount;
+
+ALTER TABLE rewards
+    DROP CONSTRAINT IF EXISTS valid_points_plus_cash,
+    DROP CONSTRAINT IF EXISTS valid_cash_per_point,
+    DROP CONSTRAINT IF EXISTS valid_min_points,
+    DROP COLUMN IF EXISTS cash_per_point,
+    DROP COLUMN IF EXISTS min_points;
@@ -0,0 +1,14 @@
+-- A reward with min_points can be paid partly in cash: the customer burns at
+-- least min_points and pays cash_per_point for each point short of
+-- points_required. Both are NULL for rewards paid in points only.
+ALTER TABLE rewards
+    ADD COLUMN IF NOT EXISTS min_points INTEGER,
+    ADD COLUMN IF NOT EXISTS cash_per_point DECIMAL(10,4),
+    ADD CONSTRAINT valid_min_points CHECK (min_points > 0 AND min_points <= points_required),
+    ADD CONSTRAINT valid_cash_per_point CHECK (cash_per_point > 0),
+    ADD CONSTRAINT valid_points_plus_cash CHECK ((min_points IS NULL) = (cash_per_point IS NULL));
+
+-- The cash paid alongside the points of a redemption, and on its redemption
+-- transaction for finance to reconcile. Refunds carry the cash to give back.
+ALTER TABLE redemptions ADD COLUMN IF NOT EXISTS cash_amount DECIMAL(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS cash_amount DECIMAL(10,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- An event the relay gave up on, after too many failed attempts. It is no
+-- longer claimed, so it does not hold up the events after it.
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS dead_at TIMESTAMP WITH TIME ZONE;
+
+DROP INDEX IF EXISTS idx_outbox_events_unpublished;
+CREATE INDEX idx_outbox_events_unpublished ON outbox_events(sequence) WHERE published_at IS NULL AND dead_at IS NULL;
@@ -38,6 +38,18 @@ func (m *MockAuthRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
 	return args.Get(0).(*sql.Tx), args.Error(1)
 }
 
+func (m *MockAuthRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	args := m.Called(ctx, fn)
+	if args.Error(0) != nil {
+		return args.Error(0)
+	}
+	return fn(ctx)
+}
+
+func (m *MockAuthRepository) AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	fn(ctx)
+}
+
 func (m *MockAuthRepository) CreateToken(ctx context.Context, token *domain.AuthToken) error {
 	args := m.Called(ctx, token)
 	return args.Error(0)
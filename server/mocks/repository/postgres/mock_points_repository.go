@@ -29,6 +29,14 @@ func (m *MockPointsRepository) GetByCustomerAndProgram(ctx context.Context, cust
 	return args.Get(0).([]*domain.PointsLedger), args.Error(1)
 }
 
+func (m *MockPointsRepository) GetLots(ctx context.Context, customerID, programID uuid.UUID) ([]*domain.PointsLot, error) {
+	args := m.Called(ctx, customerID, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.PointsLot), args.Error(1)
+}
+
 func (m *MockPointsRepository) GetCurrentBalance(ctx context.Context, customerID, programID uuid.UUID) (int, error) {
 	args := m.Called(ctx, customerID, programID)
 	return args.Int(0), args.Error(1)
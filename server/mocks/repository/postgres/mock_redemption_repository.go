@@ -56,3 +56,37 @@ func (m *MockRedemptionRepository) GetByMerchantCustomerID(ctx context.Context,
 	}
 	return args.Get(0).([]*domain.Redemption), args.Error(1)
 }
+
+func (m *MockRedemptionRepository) CountActive(ctx context.Context, customerID, rewardID uuid.UUID) (int, error) {
+	args := m.Called(ctx, customerID, rewardID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRedemptionRepository) LockByID(ctx context.Context, id uuid.UUID) (*domain.Redemption, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Redemption), args.Error(1)
+}
+
+func (m *MockRedemptionRepository) RecordStatusChange(ctx context.Context, change *domain.RedemptionStatusChange) error {
+	args := m.Called(ctx, change)
+	return args.Error(0)
+}
+
+func (m *MockRedemptionRepository) GetStatusHistory(ctx context.Context, redemptionID uuid.UUID) ([]*domain.RedemptionStatusChange, error) {
+	args := m.Called(ctx, redemptionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RedemptionStatusChange), args.Error(1)
+}
+
+func (m *MockRedemptionRepository) GetByGroupID(ctx context.Context, groupID uuid.UUID) ([]*domain.Redemption, error) {
+	args := m.Called(ctx, groupID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Redemption), args.Error(1)
+}
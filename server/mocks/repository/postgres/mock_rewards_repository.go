@@ -56,3 +56,16 @@ func (m *MockRewardsRepository) GetByProgramID(ctx context.Context, programID uu
 	}
 	return args.Get(0).([]*domain.Reward), args.Error(1)
 }
+
+func (m *MockRewardsRepository) ReserveStock(ctx context.Context, id uuid.UUID, quantity int) (bool, *int, error) {
+	args := m.Called(ctx, id, quantity)
+	if args.Get(1) == nil {
+		return args.Bool(0), nil, args.Error(2)
+	}
+	return args.Bool(0), args.Get(1).(*int), args.Error(2)
+}
+
+func (m *MockRewardsRepository) ReleaseStock(ctx context.Context, id uuid.UUID, quantity int) error {
+	args := m.Called(ctx, id, quantity)
+	return args.Error(0)
+}
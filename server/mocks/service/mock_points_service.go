@@ -20,6 +20,14 @@ func (m *MockPointsService) GetLedger(ctx context.Context, customerID, programID
 	return args.Get(0).([]*domain.PointsLedger), args.Error(1)
 }
 
+func (m *MockPointsService) GetLots(ctx context.Context, customerID, programID uuid.UUID) ([]*domain.PointsLot, error) {
+	args := m.Called(ctx, customerID, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.PointsLot), args.Error(1)
+}
+
 func (m *MockPointsService) GetBalance(customerID, programID string) (*domain.PointsBalance, error) {
 	args := m.Called(customerID, programID)
 	if args.Get(0) == nil {
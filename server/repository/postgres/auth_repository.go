@@ -13,6 +13,7 @@ import (
 )
 
 type AuthRepository struct {
+	*TxManager
 	db     *sql.DB
 	config *config.AuthConfig
 	logger zerolog.Logger
@@ -20,9 +21,10 @@ type AuthRepository struct {
 
 func NewAuthRepository(db *sql.DB, config *config.AuthConfig) *AuthRepository {
 	return &AuthRepository{
-		db:     db,
-		config: config,
-		logger: logging.GetLogger(),
+		TxManager: NewTxManager(db),
+		db:        db,
+		config:    config,
+		logger:    logging.GetLogger(),
 	}
 }
 
@@ -353,21 +355,6 @@ func (r *AuthRepository) CleanupExpiredAttempts(ctx context.Context) error {
 	return nil
 }
 
-func (r *AuthRepository) BeginTx(ctx context.Context) (*sql.Tx, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		r.logger.Error().
-			Err(err).
-			Msg("Failed to begin transaction")
-		return nil, domain.NewSystemError("AuthRepository.BeginTx", err, "failed to begin transaction")
-	}
-	return tx, nil
-}
-
-func (r *AuthRepository) Commit(ctx context.Context, tx *sql.Tx) error {
-	return tx.Commit()
-}
-
 func (r *AuthRepository) MarkVerificationUsedTx(ctx context.Context, tx *sql.Tx, id string) error {
 	query := `
 		UPDATE registration_verifications
@@ -41,7 +41,8 @@ func (r *EventLogRepository) Create(ctx context.Context, eventLog *domain.EventL
 		RETURNING id, event_timestamp, created_at
 	`
 
-	err = r.db.QueryRow(
+	err = conn(ctx, r.db).QueryRowContext(
+		ctx,
 		query,
 		eventLog.EventType,
 		eventLog.ActorID,
@@ -27,8 +27,8 @@ func NewMerchantCustomersRepository(db *sql.DB) *MerchantCustomersRepository {
 // Create inserts a new merchant customer into the database
 func (r *MerchantCustomersRepository) Create(ctx context.Context, customer *domain.MerchantCustomer) error {
 	query := `
-		INSERT INTO merchant_customers (id, merchant_id, email, password, name, phone, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		INSERT INTO merchant_customers (id, merchant_id, email, password, name, phone, date_of_birth, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`
 
 	now := time.Now().UTC()
@@ -42,6 +42,7 @@ func (r *MerchantCustomersRepository) Create(ctx context.Context, customer *doma
 		customer.Password,
 		customer.Name,
 		customer.Phone,
+		customer.DateOfBirth,
 	)
 
 	if err != nil {
@@ -71,7 +72,7 @@ func (r *MerchantCustomersRepository) Create(ctx context.Context, customer *doma
 // GetByID retrieves a merchant customer by their ID
 func (r *MerchantCustomersRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.MerchantCustomer, error) {
 	query := `
-		SELECT id, merchant_id, email, password, name, phone, created_at, updated_at
+		SELECT id, merchant_id, email, password, name, phone, date_of_birth, created_at, updated_at
 		FROM merchant_customers
 		WHERE id = $1
 	`
@@ -84,6 +85,7 @@ func (r *MerchantCustomersRepository) GetByID(ctx context.Context, id uuid.UUID)
 		&customer.Password,
 		&customer.Name,
 		&customer.Phone,
+		&customer.DateOfBirth,
 		&customer.CreatedAt,
 		&customer.UpdatedAt,
 	)
@@ -107,7 +109,7 @@ func (r *MerchantCustomersRepository) GetByID(ctx context.Context, id uuid.UUID)
 // GetByEmail retrieves a merchant customer by their email
 func (r *MerchantCustomersRepository) GetByEmail(ctx context.Context, email string) (*domain.MerchantCustomer, error) {
 	query := `
-		SELECT id, merchant_id, email, password, name, phone, created_at, updated_at
+		SELECT id, merchant_id, email, password, name, phone, date_of_birth, created_at, updated_at
 		FROM merchant_customers
 		WHERE email = $1
 	`
@@ -120,6 +122,7 @@ func (r *MerchantCustomersRepository) GetByEmail(ctx context.Context, email stri
 		&customer.Password,
 		&customer.Name,
 		&customer.Phone,
+		&customer.DateOfBirth,
 		&customer.CreatedAt,
 		&customer.UpdatedAt,
 	)
@@ -143,7 +146,7 @@ func (r *MerchantCustomersRepository) GetByEmail(ctx context.Context, email stri
 // GetByPhone retrieves a merchant customer by their phone number
 func (r *MerchantCustomersRepository) GetByPhone(ctx context.Context, phone string) (*domain.MerchantCustomer, error) {
 	query := `
-		SELECT id, merchant_id, email, password, name, phone, created_at, updated_at
+		SELECT id, merchant_id, email, password, name, phone, date_of_birth, created_at, updated_at
 		FROM merchant_customers
 		WHERE phone = $1
 	`
@@ -156,6 +159,7 @@ func (r *MerchantCustomersRepository) GetByPhone(ctx context.Context, phone stri
 		&customer.Password,
 		&customer.Name,
 		&customer.Phone,
+		&customer.DateOfBirth,
 		&customer.CreatedAt,
 		&customer.UpdatedAt,
 	)
@@ -179,7 +183,7 @@ func (r *MerchantCustomersRepository) GetByPhone(ctx context.Context, phone stri
 // GetByMerchantID retrieves all customers for a given merchant
 func (r *MerchantCustomersRepository) GetByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]*domain.MerchantCustomer, error) {
 	query := `
-		SELECT id, merchant_id, email, password, name, phone, created_at, updated_at
+		SELECT id, merchant_id, email, password, name, phone, date_of_birth, created_at, updated_at
 		FROM merchant_customers
 		WHERE merchant_id = $1
 	`
@@ -200,6 +204,7 @@ func (r *MerchantCustomersRepository) GetByMerchantID(ctx context.Context, merch
 			&customer.Password,
 			&customer.Name,
 			&customer.Phone,
+			&customer.DateOfBirth,
 			&customer.CreatedAt,
 			&customer.UpdatedAt,
 		)
@@ -226,8 +231,8 @@ func (r *MerchantCustomersRepository) GetByMerchantID(ctx context.Context, merch
 func (r *MerchantCustomersRepository) Update(ctx context.Context, customer *domain.MerchantCustomer) error {
 	query := `
 		UPDATE merchant_customers
-		SET email = $1, password = $2, name = $3, phone = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $5
+		SET email = $1, password = $2, name = $3, phone = $4, date_of_birth = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
 	`
 
 	result, err := r.db.ExecContext(ctx, query,
@@ -235,6 +240,7 @@ func (r *MerchantCustomersRepository) Update(ctx context.Context, customer *doma
 		customer.Password,
 		customer.Name,
 		customer.Phone,
+		customer.DateOfBirth,
 		customer.ID,
 	)
 
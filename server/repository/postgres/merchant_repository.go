@@ -24,15 +24,16 @@ func NewMerchantRepository(db *sql.DB) *MerchantRepository {
 }
 
 func (r *MerchantRepository) Create(ctx context.Context, merchant *domain.Merchant) (*domain.Merchant, error) {
-	query := `INSERT INTO merchants (user_id, merchant_name, merchant_type, created_at, updated_at) 
-			  VALUES ($1, $2, $3, $4, $5)
-			  RETURNING id, user_id, merchant_name, merchant_type, created_at, updated_at`
+	query := `INSERT INTO merchants (user_id, merchant_name, merchant_type, timezone, created_at, updated_at) 
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING id, user_id, merchant_name, merchant_type, timezone, created_at, updated_at`
 
 	result := domain.Merchant{}
 	err := r.db.QueryRowContext(ctx, query,
 		merchant.UserID,
 		merchant.Name,
 		merchant.Type,
+		merchant.Timezone,
 		merchant.CreatedAt,
 		merchant.UpdatedAt,
 	).Scan(
@@ -40,6 +41,7 @@ func (r *MerchantRepository) Create(ctx context.Context, merchant *domain.Mercha
 		&result.UserID,
 		&result.Name,
 		&result.Type,
+		&result.Timezone,
 		&result.CreatedAt,
 		&result.UpdatedAt)
 
@@ -62,7 +64,7 @@ func (r *MerchantRepository) Create(ctx context.Context, merchant *domain.Mercha
 }
 
 func (r *MerchantRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Merchant, error) {
-	query := `SELECT id, user_id, merchant_name, merchant_type, created_at, updated_at 
+	query := `SELECT id, user_id, merchant_name, merchant_type, timezone, created_at, updated_at 
 			  FROM merchants WHERE id = $1 AND status = 'active'`
 
 	merchant := &domain.Merchant{}
@@ -71,6 +73,7 @@ func (r *MerchantRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain
 		&merchant.UserID,
 		&merchant.Name,
 		&merchant.Type,
+		&merchant.Timezone,
 		&merchant.CreatedAt,
 		&merchant.UpdatedAt,
 	)
@@ -104,7 +107,7 @@ func (r *MerchantRepository) GetMerchantsByUserID(ctx context.Context, userID uu
 	}
 
 	// Then get paginated results
-	query := `SELECT id, user_id, merchant_name, merchant_type, created_at, updated_at, status
+	query := `SELECT id, user_id, merchant_name, merchant_type, timezone, created_at, updated_at, status
 			  FROM merchants 
 			  WHERE user_id = $1 
 			  ORDER BY created_at DESC
@@ -127,6 +130,7 @@ func (r *MerchantRepository) GetMerchantsByUserID(ctx context.Context, userID uu
 			&merchant.UserID,
 			&merchant.Name,
 			&merchant.Type,
+			&merchant.Timezone,
 			&merchant.CreatedAt,
 			&merchant.UpdatedAt,
 			&merchant.Status,
@@ -187,8 +191,8 @@ func (r *MerchantRepository) GetAll(ctx context.Context, userID uuid.UUID) ([]*d
 func (r *MerchantRepository) Update(ctx context.Context, merchant *domain.Merchant) error {
 	query := `
 		UPDATE merchants
-		SET merchant_name = $1, merchant_type = $2, updated_at = $3
-		WHERE id = $4
+		SET merchant_name = $1, merchant_type = $2, timezone = $3, updated_at = $4
+		WHERE id = $5
 		RETURNING updated_at
 	`
 	merchant.UpdatedAt = time.Now().UTC()
@@ -198,6 +202,7 @@ func (r *MerchantRepository) Update(ctx context.Context, merchant *domain.Mercha
 		query,
 		merchant.Name,
 		merchant.Type,
+		merchant.Timezone,
 		merchant.UpdatedAt,
 		merchant.ID,
 	).Scan(&merchant.UpdatedAt)
@@ -231,3 +236,10 @@ func isPgUniqueViolation(err error) bool {
 	}
 	return false
 }
+
+func isPgCheckViolation(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code == "23514" // PostgreSQL error code for check_violation
+	}
+	return false
+}
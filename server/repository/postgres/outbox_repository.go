@@ -0,0 +1,181 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// outboxRelayLock is the advisory lock key held by the relay publishing the
+// outbox. One relay at a time keeps each customer's events in order.
+const outboxRelayLock = 7_001_014
+
+type OutboxRepository struct {
+	db     *sql.DB
+	logger zerolog.Logger
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{
+		db:     db,
+		logger: logging.GetLogger(),
+	}
+}
+
+// Create adds an event to the outbox, in the unit of work running in ctx.
+func (r *OutboxRepository) Create(ctx context.Context, event *domain.OutboxEvent) error {
+	query := `
+		INSERT INTO outbox_events (id, topic, partition_key, event_type, payload)
+		VALUES ($1, $2, $3, $4, $5::jsonb)
+		RETURNING created_at
+	`
+
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		event.ID,
+		event.Topic,
+		event.PartitionKey,
+		event.EventType,
+		[]byte(event.Payload),
+	).Scan(&event.CreatedAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("event_type", string(event.EventType)).
+			Msg("Failed to create outbox event")
+		return domain.NewSystemError("OutboxRepository.Create", err, "failed to create outbox event")
+	}
+	return nil
+}
+
+// ClaimUnpublished locks the oldest unpublished events that are not dead until
+// the unit of work running in ctx ends. While another relay holds the outbox it
+// returns nothing.
+func (r *OutboxRepository) ClaimUnpublished(ctx context.Context, limit int) ([]*domain.OutboxEvent, error) {
+	var locked bool
+	err := conn(ctx, r.db).QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxRelayLock).Scan(&locked)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to lock outbox")
+		return nil, domain.NewSystemError("OutboxRepository.ClaimUnpublished", err, "failed to lock outbox")
+	}
+	if !locked {
+		return []*domain.OutboxEvent{}, nil
+	}
+
+	query := `
+		SELECT id, topic, partition_key, event_type, payload, attempts, last_error, created_at, published_at
+		FROM outbox_events
+		WHERE published_at IS NULL AND dead_at IS NULL
+		ORDER BY sequence
+		LIMIT $1
+		FOR UPDATE
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, limit)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get unpublished outbox events")
+		return nil, domain.NewSystemError("OutboxRepository.ClaimUnpublished", err, "failed to get unpublished outbox events")
+	}
+	defer rows.Close()
+
+	events := []*domain.OutboxEvent{}
+	for rows.Next() {
+		event := &domain.OutboxEvent{}
+		var payload []byte
+		if err := rows.Scan(
+			&event.ID,
+			&event.Topic,
+			&event.PartitionKey,
+			&event.EventType,
+			&payload,
+			&event.Attempts,
+			&event.LastError,
+			&event.CreatedAt,
+			&event.PublishedAt,
+		); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan outbox event")
+			return nil, domain.NewSystemError("OutboxRepository.ClaimUnpublished", err, "failed to scan outbox event")
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, domain.NewSystemError("OutboxRepository.ClaimUnpublished", err, "failed to iterate outbox events")
+	}
+	return events, nil
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	published := make([]string, len(ids))
+	for i, id := range ids {
+		published[i] = id.String()
+	}
+
+	query := `
+		UPDATE outbox_events
+		SET published_at = CURRENT_TIMESTAMP, attempts = attempts + 1, last_error = NULL
+		WHERE id = ANY($1::uuid[])
+	`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, pq.Array(published)); err != nil {
+		r.logger.Error().
+			Err(err).
+			Int("events", len(ids)).
+			Msg("Failed to mark outbox events published")
+		return domain.NewSystemError("OutboxRepository.MarkPublished", err, "failed to mark outbox events published")
+	}
+	return nil
+}
+
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, reason string) error {
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $2
+		WHERE id = $1
+	`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, reason); err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("event_id", id.String()).
+			Msg("Failed to mark outbox event failed")
+		return domain.NewSystemError("OutboxRepository.MarkFailed", err, "failed to mark outbox event failed")
+	}
+	return nil
+}
+
+// MarkDead records the last failed attempt of an event and stops it from
+// being claimed again.
+func (r *OutboxRepository) MarkDead(ctx context.Context, id uuid.UUID, reason string) error {
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $2, dead_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, reason); err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("event_id", id.String()).
+			Msg("Failed to mark outbox event dead")
+		return domain.NewSystemError("OutboxRepository.MarkDead", err, "failed to mark outbox event dead")
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"go-playground/pkg/logging"
+	"go-playground/server/config"
+	"go-playground/server/domain"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type PointsExpirationRepository struct {
+	db     config.DbConnection
+	logger zerolog.Logger
+}
+
+func NewPointsExpirationRepository(db config.DbConnection) *PointsExpirationRepository {
+	return &PointsExpirationRepository{db: db,
+		logger: logging.GetLogger(),
+	}
+}
+
+func (r *PointsExpirationRepository) UpsertPolicy(ctx context.Context, policy *domain.PointsExpiryPolicy) error {
+	query := `
+		INSERT INTO points_expiry_policies (program_id, policy, days)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (program_id) DO UPDATE
+		SET policy = EXCLUDED.policy, days = EXCLUDED.days, updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at
+	`
+	err := r.db.RW.QueryRowContext(ctx, query, policy.ProgramID, policy.Policy, policy.Days).
+		Scan(&policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to save points expiry policy")
+		return domain.NewSystemError("PointsExpirationRepository.UpsertPolicy", err, "failed to save points expiry policy")
+	}
+	return nil
+}
+
+func (r *PointsExpirationRepository) GetPolicy(ctx context.Context, programID uuid.UUID) (*domain.PointsExpiryPolicy, error) {
+	query := `
+		SELECT program_id, policy, days, created_at, updated_at
+		FROM points_expiry_policies
+		WHERE program_id = $1
+	`
+	policy := &domain.PointsExpiryPolicy{}
+	err := r.db.RR.QueryRowContext(ctx, query, programID).Scan(
+		&policy.ProgramID,
+		&policy.Policy,
+		&policy.Days,
+		&policy.CreatedAt,
+		&policy.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get points expiry policy")
+		return nil, domain.NewSystemError("PointsExpirationRepository.GetPolicy", err, "failed to get points expiry policy")
+	}
+	return policy, nil
+}
+
+func (r *PointsExpirationRepository) GetPolicies(ctx context.Context) ([]*domain.PointsExpiryPolicy, error) {
+	query := `
+		SELECT program_id, policy, days, created_at, updated_at
+		FROM points_expiry_policies
+		ORDER BY program_id
+	`
+	rows, err := r.db.RR.QueryContext(ctx, query)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query points expiry policies")
+		return nil, domain.NewSystemError("PointsExpirationRepository.GetPolicies", err, "failed to query points expiry policies")
+	}
+	defer rows.Close()
+
+	var policies []*domain.PointsExpiryPolicy
+	for rows.Next() {
+		policy := &domain.PointsExpiryPolicy{}
+		err := rows.Scan(
+			&policy.ProgramID,
+			&policy.Policy,
+			&policy.Days,
+			&policy.CreatedAt,
+			&policy.UpdatedAt,
+		)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan points expiry policy")
+			return nil, domain.NewSystemError("PointsExpirationRepository.GetPolicies", err, "failed to scan points expiry policy")
+		}
+		policies = append(policies, policy)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate points expiry policies")
+		return nil, domain.NewSystemError("PointsExpirationRepository.GetPolicies", err, "error iterating points expiry policies")
+	}
+
+	return policies, nil
+}
+
+func (r *PointsExpirationRepository) DeletePolicy(ctx context.Context, programID uuid.UUID) error {
+	query := `DELETE FROM points_expiry_policies WHERE program_id = $1`
+	result, err := r.db.RW.ExecContext(ctx, query, programID)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to delete points expiry policy")
+		return domain.NewSystemError("PointsExpirationRepository.DeletePolicy", err, "failed to delete points expiry policy")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get affected rows")
+		return domain.NewSystemError("PointsExpirationRepository.DeletePolicy", err, "failed to get affected rows")
+	}
+
+	if affected == 0 {
+		r.logger.Error().
+			Msg("Failed to delete points expiry policy")
+		return domain.NewResourceNotFoundError("points expiry policy", programID.String(), "points expiry policy not found")
+	}
+
+	return nil
+}
+
+func (r *PointsExpirationRepository) GetExpiredAccounts(ctx context.Context, dueBy time.Time, after domain.PointsAccount, limit int) ([]domain.PointsAccount, error) {
+	query := `
+		SELECT DISTINCT merchant_customers_id, program_id
+		FROM points_lots
+		WHERE remaining > 0
+		AND expires_at <= $1
+		AND (merchant_customers_id, program_id) > ($2, $3)
+		ORDER BY merchant_customers_id, program_id
+		LIMIT $4
+	`
+	rows, err := r.db.RR.QueryContext(ctx, query, dueBy, after.MerchantCustomersID, after.ProgramID, limit)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query expired points accounts")
+		return nil, domain.NewSystemError("PointsExpirationRepository.GetExpiredAccounts", err, "failed to query expired points accounts")
+	}
+	defer rows.Close()
+
+	var accounts []domain.PointsAccount
+	for rows.Next() {
+		var account domain.PointsAccount
+		if err := rows.Scan(&account.MerchantCustomersID, &account.ProgramID); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan expired points account")
+			return nil, domain.NewSystemError("PointsExpirationRepository.GetExpiredAccounts", err, "failed to scan expired points account")
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate expired points accounts")
+		return nil, domain.NewSystemError("PointsExpirationRepository.GetExpiredAccounts", err, "error iterating expired points accounts")
+	}
+
+	return accounts, nil
+}
+
+// GetInactiveCustomers counts earns and redemptions as activity, an expiration
+// entry is not.
+func (r *PointsExpirationRepository) GetInactiveCustomers(ctx context.Context, programID uuid.UUID, inactiveSince time.Time, afterID uuid.UUID, limit int) ([]uuid.UUID, error) {
+	query := `
+		SELECT DISTINCT l.merchant_customers_id
+		FROM points_lots l
+		WHERE l.program_id = $1
+		AND l.remaining > 0
+		AND l.merchant_customers_id > $3
+		AND NOT EXISTS (
+			SELECT 1
+			FROM points_ledger pl
+			WHERE pl.merchant_customers_id = l.merchant_customers_id
+			AND pl.program_id = l.program_id
+			AND pl.created_at > $2
+			AND pl.tx_type IS DISTINCT FROM 'point_expiration'
+		)
+		ORDER BY l.merchant_customers_id
+		LIMIT $4
+	`
+	rows, err := r.db.RR.QueryContext(ctx, query, programID, inactiveSince, afterID, limit)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query inactive customers")
+		return nil, domain.NewSystemError("PointsExpirationRepository.GetInactiveCustomers", err, "failed to query inactive customers")
+	}
+	defer rows.Close()
+
+	var customerIDs []uuid.UUID
+	for rows.Next() {
+		var customerID uuid.UUID
+		if err := rows.Scan(&customerID); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan inactive customer")
+			return nil, domain.NewSystemError("PointsExpirationRepository.GetInactiveCustomers", err, "failed to scan inactive customer")
+		}
+		customerIDs = append(customerIDs, customerID)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate inactive customers")
+		return nil, domain.NewSystemError("PointsExpirationRepository.GetInactiveCustomers", err, "error iterating inactive customers")
+	}
+
+	return customerIDs, nil
+}
+
+// ExpireLots locks the account and the lots it expires, a redemption running
+// at the same time either spends them first or waits for the expiration to
+// commit.
+func (r *PointsExpirationRepository) ExpireLots(ctx context.Context, customerID, programID uuid.UUID, dueBy *time.Time) (*domain.PointsLedger, error) {
+	var result *domain.PointsLedger
+	err := inTx(ctx, r.db.RW, func(tx *sql.Tx) error {
+		balance, debt, err := lockAccount(ctx, tx, customerID, programID)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to lock points account")
+			return domain.NewSystemError("PointsExpirationRepository.ExpireLots", err, "failed to lock points account")
+		}
+
+		consumed, err := consumeLots(ctx, tx, customerID, programID, 0, dueBy)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to lock expired points lots")
+			return err
+		}
+
+		points := 0
+		for _, lot := range consumed {
+			points += lot.points
+		}
+		if points == 0 {
+			// Nothing left to expire
+			return nil
+		}
+
+		result, err = insertLedgerEntry(ctx, tx, &domain.PointsLedger{
+			MerchantCustomersID: customerID,
+			ProgramID:           programID,
+			PointsRedeemed:      points,
+			PointsBalance:       max(balance-points, 0),
+			PointsDebt:          debt,
+			TxType:              domain.PointTxExpiration,
+		})
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to create points expiration entry")
+			return domain.NewSystemError("PointsExpirationRepository.ExpireLots", err, "failed to create points expiration entry")
+		}
+
+		result.Allocations, err = allocateLots(ctx, tx, result.LedgerID, consumed)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to record points lot allocations")
+			return domain.NewSystemError("PointsExpirationRepository.ExpireLots", err, "failed to record points lot allocations")
+		}
+
+		if err := updateAccountBalance(ctx, tx, result); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to update points account balance")
+			return domain.NewSystemError("PointsExpirationRepository.ExpireLots", err, "failed to update points account balance")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
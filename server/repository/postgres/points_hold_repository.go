@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"go-playground/pkg/logging"
+	"go-playground/server/config"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type PointsHoldRepository struct {
+	db     config.DbConnection
+	logger zerolog.Logger
+}
+
+func NewPointsHoldRepository(db config.DbConnection) *PointsHoldRepository {
+	return &PointsHoldRepository{db: db,
+		logger: logging.GetLogger(),
+	}
+}
+
+func (r *PointsHoldRepository) Create(ctx context.Context, hold *domain.PointsHold) error {
+	query := `
+		INSERT INTO points_holds (transaction_id, merchant_customers_id, program_id, points, rule_set_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING hold_id, status, created_at
+	`
+	err := conn(ctx, r.db.RW).QueryRowContext(ctx, query,
+		hold.TransactionID,
+		hold.MerchantCustomersID,
+		hold.ProgramID,
+		hold.Points,
+		hold.RuleSetID,
+	).Scan(&hold.HoldID, &hold.Status, &hold.CreatedAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("transaction_id", hold.TransactionID.String()).
+			Msg("Failed to create points hold")
+		return domain.NewSystemError("PointsHoldRepository.Create", err, "failed to create points hold")
+	}
+	return nil
+}
+
+func (r *PointsHoldRepository) LockByTransactionID(ctx context.Context, transactionID uuid.UUID) (*domain.PointsHold, error) {
+	query := `
+		SELECT hold_id, transaction_id, merchant_customers_id, program_id, points,
+			rule_set_id, status, created_at, resolved_at
+		FROM points_holds
+		WHERE transaction_id = $1
+		FOR UPDATE
+	`
+	hold := &domain.PointsHold{}
+	err := conn(ctx, r.db.RW).QueryRowContext(ctx, query, transactionID).Scan(
+		&hold.HoldID,
+		&hold.TransactionID,
+		&hold.MerchantCustomersID,
+		&hold.ProgramID,
+		&hold.Points,
+		&hold.RuleSetID,
+		&hold.Status,
+		&hold.CreatedAt,
+		&hold.ResolvedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("transaction_id", transactionID.String()).
+			Msg("Failed to lock points hold")
+		return nil, domain.NewSystemError("PointsHoldRepository.LockByTransactionID", err, "failed to lock points hold")
+	}
+	return hold, nil
+}
+
+func (r *PointsHoldRepository) Resolve(ctx context.Context, holdID uuid.UUID, status string) error {
+	query := `
+		UPDATE points_holds
+		SET status = $1, resolved_at = CURRENT_TIMESTAMP
+		WHERE hold_id = $2 AND status = 'held'
+	`
+	result, err := conn(ctx, r.db.RW).ExecContext(ctx, query, status, holdID)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("hold_id", holdID.String()).
+			Msg("Failed to resolve points hold")
+		return domain.NewSystemError("PointsHoldRepository.Resolve", err, "failed to resolve points hold")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return domain.NewSystemError("PointsHoldRepository.Resolve", err, "failed to get affected rows")
+	}
+	if rows == 0 {
+		return domain.NewResourceNotFoundError("points hold", holdID.String(), "points hold not found or already resolved")
+	}
+	return nil
+}
+
+func (r *PointsHoldRepository) SumHeld(ctx context.Context, customerID, programID uuid.UUID) (int, error) {
+	query := `
+		SELECT COALESCE(SUM(points), 0)
+		FROM points_holds
+		WHERE merchant_customers_id = $1 AND program_id = $2 AND status = 'held'
+	`
+	var held int
+	if err := r.db.RR.QueryRowContext(ctx, query, customerID, programID).Scan(&held); err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("customer_id", customerID.String()).
+			Str("program_id", programID.String()).
+			Msg("Failed to sum held points")
+		return 0, domain.NewSystemError("PointsHoldRepository.SumHeld", err, "failed to sum held points")
+	}
+	return held, nil
+}
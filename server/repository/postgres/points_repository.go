@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"go-playground/pkg/logging"
 	"go-playground/server/domain"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
@@ -22,83 +23,418 @@ func NewPointsRepository(db *sql.DB) *PointsRepository {
 	}
 }
 
-// Create inserts a new points ledger entry into the database
+// Create inserts a new points ledger entry into the database together with
+// the lot it opens or the lot allocations it consumes, in one transaction. It
+// joins the unit of work running in ctx, if any
 func (r *PointsRepository) Create(ctx context.Context, ledger *domain.PointsLedger) (*domain.PointsLedger, error) {
-	/*
-		The CTE (last_balance) fetches the points_balance of the last transaction
-		for the same merchant_customers_id and program_id.
-
-		If no previous record exists, COALESCE(..., 0) ensures we start from 0.
-
-		The new points_balance is calculated as:
-		previous_balance + points_earned - points_redeemed.
-
-		The record is atomically inserted into the points_ledger table.
-	*/
-	query := `WITH last_balance AS (
-			SELECT points_balance
-			FROM points_ledger
-			WHERE merchant_customers_id = $1
-			AND program_id = $2
-			ORDER BY created_at DESC
-			LIMIT 1
-		)
+	var result *domain.PointsLedger
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		// The account row is locked until commit, a second write to the same
+		// account waits here and then sees this one's balance
+		balance, debt, err := lockAccount(ctx, tx, ledger.MerchantCustomersID, ledger.ProgramID)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to lock points account")
+			return domain.NewSystemError("PointsRepository.Create", err, "failed to lock points account")
+		}
+
+		// An earn pays off the debt first, only the rest can be spent
+		paidOff := min(ledger.PointsEarned, debt)
+		ledger.PointsDebt = debt - paidOff
+		ledger.PointsBalance = balance + ledger.PointsEarned - paidOff - ledger.PointsRedeemed
+		if ledger.PointsBalance < 0 && ledger.PointsRedeemed > 0 {
+			switch ledger.RefundPolicy {
+			case domain.RefundPolicyAllowNegative:
+				// The lots cover what they can, the rest is owed until later
+				// earns pay it off
+				ledger.PointsDebt -= ledger.PointsBalance
+				ledger.PointsBalance = 0
+			case domain.RefundPolicyClawBack:
+				// Take back what is left, the rest is written off
+				ledger.PointsRedeemed = balance
+				ledger.PointsBalance = 0
+			default:
+				r.logger.Error().
+					Int("balance", balance).
+					Int("points_redeemed", ledger.PointsRedeemed).
+					Msg("Insufficient points balance")
+				return domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points balance")
+			}
+		}
+
+		var consumed []lotConsumption
+		if covered := min(ledger.PointsRedeemed, balance); covered > 0 {
+			consumed, err = consumeLots(ctx, tx, ledger.MerchantCustomersID, ledger.ProgramID, covered, nil)
+			if err != nil {
+				r.logger.Error().
+					Err(err).
+					Msg("Failed to allocate points lots")
+				return err
+			}
+		}
+
+		result, err = insertLedgerEntry(ctx, tx, ledger)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to create points ledger entry")
+			return domain.NewSystemError("PointsRepository.Create", err, "failed to create points ledger entry")
+		}
+
+		if result.PointsEarned > 0 {
+			result.ExpiresAt = ledger.ExpiresAt
+			lotID, err := insertLot(ctx, tx, result)
+			if err != nil {
+				r.logger.Error().
+					Err(err).
+					Msg("Failed to create points lot")
+				return domain.NewSystemError("PointsRepository.Create", err, "failed to create points lot")
+			}
+
+			if paidOff > 0 {
+				if err := payOffDebt(ctx, tx, result, lotID, paidOff); err != nil {
+					r.logger.Error().
+						Err(err).
+						Msg("Failed to pay off points debt")
+					return domain.NewSystemError("PointsRepository.Create", err, "failed to pay off points debt")
+				}
+			}
+		}
+
+		result.Allocations, err = allocateLots(ctx, tx, result.LedgerID, consumed)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to record points lot allocations")
+			return domain.NewSystemError("PointsRepository.Create", err, "failed to record points lot allocations")
+		}
+
+		if err := updateAccountBalance(ctx, tx, result); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to update points account balance")
+			if isPgCheckViolation(err) {
+				return domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points balance")
+			}
+			return domain.NewSystemError("PointsRepository.Create", err, "failed to update points account balance")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// lockAccount locks the customer's account in the program, creating it on
+// the first write, and returns its balance and debt.
+func lockAccount(ctx context.Context, tx *sql.Tx, customerID, programID uuid.UUID) (int, int, error) {
+	// DO UPDATE rather than DO NOTHING, so that the row is locked and returned
+	// whether it was just created or already there
+	query := `
+		INSERT INTO points_accounts (merchant_customers_id, program_id)
+		VALUES ($1, $2)
+		ON CONFLICT (merchant_customers_id, program_id) DO UPDATE
+		SET balance = points_accounts.balance
+		RETURNING balance, debt
+	`
+	var balance, debt int
+	err := tx.QueryRowContext(ctx, query, customerID, programID).Scan(&balance, &debt)
+	return balance, debt, err
+}
+
+// updateAccountBalance stores the balance and debt of a ledger entry on its
+// account.
+func updateAccountBalance(ctx context.Context, tx *sql.Tx, ledger *domain.PointsLedger) error {
+	query := `
+		UPDATE points_accounts
+		SET balance = $3, debt = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE merchant_customers_id = $1 AND program_id = $2
+	`
+	_, err := tx.ExecContext(ctx, query, ledger.MerchantCustomersID, ledger.ProgramID, ledger.PointsBalance, ledger.PointsDebt)
+	return err
+}
+
+// insertLedgerEntry writes the entry with the balance the caller computed
+// from its locked account.
+func insertLedgerEntry(ctx context.Context, tx *sql.Tx, ledger *domain.PointsLedger) (*domain.PointsLedger, error) {
+	query := `
 		INSERT INTO points_ledger (
 			merchant_customers_id,
 			program_id,
 			points_earned,
 			points_redeemed,
 			points_balance,
+			points_debt,
 			transaction_id,
+			rule_set_id,
+			tx_type,
 			created_at
 		)
-		VALUES (
-			$1,
-			$2,
-			$3,
-			$4,
-			COALESCE((SELECT points_balance FROM last_balance), 0) + $3 - $4,
-			$5,
-			CURRENT_TIMESTAMP
-		)
-		RETURNING 
-			ledger_id, 
-			merchant_customers_id, 
-			program_id, 
-			points_earned, 
-			points_redeemed, 
-			points_balance, 
-			transaction_id, 
-			created_at`
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, '')::point_tx_type, CURRENT_TIMESTAMP)
+		RETURNING ` + ledgerColumns
 
-	result := &domain.PointsLedger{}
-	err := r.db.QueryRowContext(
+	var transactionID *uuid.UUID
+	if ledger.TransactionID != uuid.Nil {
+		transactionID = &ledger.TransactionID
+	}
+	return scanLedger(tx.QueryRowContext(
 		ctx,
 		query,
 		ledger.MerchantCustomersID,
 		ledger.ProgramID,
 		ledger.PointsEarned,
 		ledger.PointsRedeemed,
-		ledger.TransactionID,
-	).Scan(
-		&result.LedgerID,
-		&result.MerchantCustomersID,
-		&result.ProgramID,
-		&result.PointsEarned,
-		&result.PointsRedeemed,
-		&result.PointsBalance,
-		&result.TransactionID,
-		&result.CreatedAt,
+		ledger.PointsBalance,
+		ledger.PointsDebt,
+		transactionID,
+		ledger.RuleSetID,
+		ledger.TxType,
+	))
+}
+
+const ledgerColumns = `
+			ledger_id,
+			merchant_customers_id,
+			program_id,
+			points_earned,
+			points_redeemed,
+			points_balance,
+			points_debt,
+			transaction_id,
+			rule_set_id,
+			COALESCE(tx_type::text, ''),
+			created_at`
+
+func scanLedger(row rowScanner) (*domain.PointsLedger, error) {
+	ledger := &domain.PointsLedger{}
+	err := row.Scan(
+		&ledger.LedgerID,
+		&ledger.MerchantCustomersID,
+		&ledger.ProgramID,
+		&ledger.PointsEarned,
+		&ledger.PointsRedeemed,
+		&ledger.PointsBalance,
+		&ledger.PointsDebt,
+		&ledger.TransactionID,
+		&ledger.RuleSetID,
+		&ledger.TxType,
+		&ledger.CreatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return ledger, nil
+}
 
+// insertLot opens the lot of an earn entry.
+func insertLot(ctx context.Context, tx *sql.Tx, ledger *domain.PointsLedger) (uuid.UUID, error) {
+	query := `
+		INSERT INTO points_lots (
+			ledger_id, merchant_customers_id, program_id, transaction_id,
+			points, remaining, earned_at, expires_at
+		) VALUES ($1, $2, $3, $4, $5, $5, $6, $7)
+		RETURNING lot_id
+	`
+	var transactionID *uuid.UUID
+	if ledger.TransactionID != uuid.Nil {
+		transactionID = &ledger.TransactionID
+	}
+	var lotID uuid.UUID
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		ledger.LedgerID,
+		ledger.MerchantCustomersID,
+		ledger.ProgramID,
+		transactionID,
+		ledger.PointsEarned,
+		ledger.CreatedAt,
+		ledger.ExpiresAt,
+	).Scan(&lotID)
+	return lotID, err
+}
+
+// payOffDebt spends up to points of an earn's new lot on the reversals that
+// overdrew the account, oldest first. A reversal is paid off once lots cover
+// all of its points.
+func payOffDebt(ctx context.Context, tx *sql.Tx, ledger *domain.PointsLedger, lotID uuid.UUID, points int) error {
+	query := `
+		SELECT pl.ledger_id, pl.points_redeemed - COALESCE(SUM(a.points), 0)
+		FROM points_ledger pl
+		LEFT JOIN points_lot_allocations a ON a.ledger_id = pl.ledger_id
+		WHERE pl.merchant_customers_id = $1
+		AND pl.program_id = $2
+		AND pl.tx_type = 'point_reversal'
+		GROUP BY pl.ledger_id
+		HAVING pl.points_redeemed > COALESCE(SUM(a.points), 0)
+		ORDER BY pl.created_at, pl.ledger_id
+	`
+	rows, err := tx.QueryContext(ctx, query, ledger.MerchantCustomersID, ledger.ProgramID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type debt struct {
+		ledgerID uuid.UUID
+		owed     int
+	}
+	var debts []debt
+	for rows.Next() {
+		var d debt
+		if err := rows.Scan(&d.ledgerID, &d.owed); err != nil {
+			return err
+		}
+		debts = append(debts, d)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, d := range debts {
+		if points == 0 {
+			break
+		}
+		paid := min(d.owed, points)
+		if _, err := allocateLots(ctx, tx, d.ledgerID, []lotConsumption{{lotID: lotID, points: paid}}); err != nil {
+			return err
+		}
+		points -= paid
+	}
+	return nil
+}
+
+// lotConsumption is how many points a debit takes from one lot.
+type lotConsumption struct {
+	lotID  uuid.UUID
+	points int
+}
+
+// consumeLots locks the unspent lots of an account, oldest first, and picks
+// the points a debit takes from each. With points 0 it takes everything that
+// is left. dueBy limits it to the lots that expired by then.
+func consumeLots(ctx context.Context, tx *sql.Tx, customerID, programID uuid.UUID, points int, dueBy *time.Time) ([]lotConsumption, error) {
+	query := `
+		SELECT lot_id, remaining
+		FROM points_lots
+		WHERE merchant_customers_id = $1
+		AND program_id = $2
+		AND remaining > 0
+		AND ($3::timestamptz IS NULL OR expires_at <= $3)
+		ORDER BY earned_at, lot_id
+		FOR UPDATE
+	`
+	rows, err := tx.QueryContext(ctx, query, customerID, programID, dueBy)
+	if err != nil {
+		return nil, domain.NewSystemError("consumeLots", err, "failed to lock points lots")
+	}
+	defer rows.Close()
+
+	var consumed []lotConsumption
+	needed := points
+	for rows.Next() {
+		var lot lotConsumption
+		var remaining int
+		if err := rows.Scan(&lot.lotID, &remaining); err != nil {
+			return nil, domain.NewSystemError("consumeLots", err, "failed to scan points lot")
+		}
+		lot.points = remaining
+		if points > 0 {
+			if needed == 0 {
+				break
+			}
+			lot.points = min(remaining, needed)
+			needed -= lot.points
+		}
+		consumed = append(consumed, lot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, domain.NewSystemError("consumeLots", err, "error iterating points lots")
+	}
+
+	if needed > 0 {
+		return nil, domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points balance")
+	}
+	return consumed, nil
+}
+
+// allocateLots takes the consumed points off their lots and records which
+// lots the debit entry consumed.
+func allocateLots(ctx context.Context, tx *sql.Tx, ledgerID uuid.UUID, consumed []lotConsumption) ([]*domain.PointsLotAllocation, error) {
+	var allocations []*domain.PointsLotAllocation
+	for _, lot := range consumed {
+		if _, err := tx.ExecContext(ctx, `UPDATE points_lots SET remaining = remaining - $1 WHERE lot_id = $2`, lot.points, lot.lotID); err != nil {
+			return nil, err
+		}
+
+		allocation := &domain.PointsLotAllocation{LotID: lot.lotID, LedgerID: ledgerID, Points: lot.points}
+		query := `
+			INSERT INTO points_lot_allocations (lot_id, ledger_id, points)
+			VALUES ($1, $2, $3)
+			RETURNING allocation_id, created_at
+		`
+		if err := tx.QueryRowContext(ctx, query, lot.lotID, ledgerID, lot.points).Scan(&allocation.AllocationID, &allocation.CreatedAt); err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, allocation)
+	}
+	return allocations, nil
+}
+
+// GetLots retrieves the unspent lots of a customer in a program, in the order
+// they are consumed
+func (r *PointsRepository) GetLots(ctx context.Context, customerID, programID uuid.UUID) ([]*domain.PointsLot, error) {
+	query := `
+		SELECT lot_id, ledger_id, merchant_customers_id, program_id, transaction_id,
+			   points, remaining, earned_at, expires_at
+		FROM points_lots
+		WHERE merchant_customers_id = $1 AND program_id = $2 AND remaining > 0
+		ORDER BY earned_at, lot_id
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, customerID, programID)
 	if err != nil {
 		r.logger.Error().
 			Err(err).
-			Msg("Failed to create points ledger entry")
-		return nil, domain.NewSystemError("PointsRepository.Create", err, "failed to create points ledger entry")
+			Msg("Failed to query points lots")
+		return nil, domain.NewSystemError("PointsRepository.GetLots", err, "failed to query points lots")
 	}
+	defer rows.Close()
 
-	return result, nil
+	lots := []*domain.PointsLot{}
+	for rows.Next() {
+		lot := &domain.PointsLot{}
+		err := rows.Scan(
+			&lot.LotID,
+			&lot.LedgerID,
+			&lot.MerchantCustomersID,
+			&lot.ProgramID,
+			&lot.TransactionID,
+			&lot.Points,
+			&lot.Remaining,
+			&lot.EarnedAt,
+			&lot.ExpiresAt,
+		)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan points lot")
+			return nil, domain.NewSystemError("PointsRepository.GetLots", err, "failed to scan points lot")
+		}
+		lots = append(lots, lot)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate points lots")
+		return nil, domain.NewSystemError("PointsRepository.GetLots", err, "error iterating points lots")
+	}
+
+	return lots, nil
 }
 
 // GetByCustomerAndProgram retrieves all points ledger entries for a given customer and program
@@ -110,13 +446,16 @@ func (r *PointsRepository) GetByCustomerAndProgram(ctx context.Context, merchant
 			   points_earned,
 			   points_redeemed,
 			   points_balance,
+			   points_debt,
 			   transaction_id,
+			   rule_set_id,
+			   COALESCE(tx_type::text, ''),
 			   created_at
 		FROM points_ledger
 		WHERE merchant_customers_id = $1 AND program_id = $2
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.QueryContext(ctx, query, merchantCustomersID, programID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, merchantCustomersID, programID)
 	if err != nil {
 		r.logger.Error().
 			Err(err).
@@ -135,7 +474,10 @@ func (r *PointsRepository) GetByCustomerAndProgram(ctx context.Context, merchant
 			&ledger.PointsEarned,
 			&ledger.PointsRedeemed,
 			&ledger.PointsBalance,
+			&ledger.PointsDebt,
 			&ledger.TransactionID,
+			&ledger.RuleSetID,
+			&ledger.TxType,
 			&ledger.CreatedAt,
 		)
 		if err != nil {
@@ -157,17 +499,16 @@ func (r *PointsRepository) GetByCustomerAndProgram(ctx context.Context, merchant
 	return ledgers, nil
 }
 
-// GetCurrentBalance retrieves the current points balance for a given customer and program
+// GetCurrentBalance retrieves the current points balance for a given customer
+// and program, less any points debt
 func (r *PointsRepository) GetCurrentBalance(ctx context.Context, merchantCustomersID, programID uuid.UUID) (int, error) {
 	query := `
-		SELECT points_balance
-		FROM points_ledger
+		SELECT balance - debt
+		FROM points_accounts
 		WHERE merchant_customers_id = $1 AND program_id = $2
-		ORDER BY created_at DESC
-		LIMIT 1
 	`
 	var balance int
-	err := r.db.QueryRowContext(ctx, query, merchantCustomersID, programID).Scan(&balance)
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, merchantCustomersID, programID).Scan(&balance)
 	if err == sql.ErrNoRows {
 		// Return 0 balance for new customers/programs
 		return 0, nil
@@ -190,20 +531,26 @@ func (r *PointsRepository) GetByTransactionID(ctx context.Context, transactionID
 			   points_earned,
 			   points_redeemed,
 			   points_balance,
+			   points_debt,
 			   transaction_id,
+			   rule_set_id,
+			   COALESCE(tx_type::text, ''),
 			   created_at
 		FROM points_ledger
 		WHERE transaction_id = $1
 	`
 	ledger := &domain.PointsLedger{}
-	err := r.db.QueryRowContext(ctx, query, transactionID).Scan(
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, transactionID).Scan(
 		&ledger.LedgerID,
 		&ledger.MerchantCustomersID,
 		&ledger.ProgramID,
 		&ledger.PointsEarned,
 		&ledger.PointsRedeemed,
 		&ledger.PointsBalance,
+		&ledger.PointsDebt,
 		&ledger.TransactionID,
+		&ledger.RuleSetID,
+		&ledger.TxType,
 		&ledger.CreatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -221,6 +568,24 @@ func (r *PointsRepository) GetByTransactionID(ctx context.Context, transactionID
 	return ledger, nil
 }
 
+// SumByTransactionID adds up the points every ledger entry of a transaction
+// earned and redeemed, its earn and any reversal of it
+func (r *PointsRepository) SumByTransactionID(ctx context.Context, transactionID uuid.UUID) (int, int, error) {
+	query := `
+		SELECT COALESCE(SUM(points_earned), 0), COALESCE(SUM(points_redeemed), 0)
+		FROM points_ledger
+		WHERE transaction_id = $1
+	`
+	var earned, redeemed int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, transactionID).Scan(&earned, &redeemed); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to sum points ledger entries")
+		return 0, 0, domain.NewSystemError("PointsRepository.SumByTransactionID", err, "failed to sum points ledger entries")
+	}
+	return earned, redeemed, nil
+}
+
 func (r *PointsRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil // Delete operation are not allowed
 }
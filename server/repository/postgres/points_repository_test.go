@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDB connects to the migrated database in TEST_DATABASE_URL, the test is
+// skipped without one. CI always provides one, so there it fails instead.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("TEST_DATABASE_URL not set, the repository tests must run in CI")
+		}
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	require.NoError(t, db.Ping())
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createPointsAccount inserts a user, merchant, customer and program to hold points in.
+func createPointsAccount(t *testing.T, db *sql.DB) (customerID, programID uuid.UUID) {
+	ctx := context.Background()
+	suffix := fmt.Sprint(time.Now().UnixNano() % 1e12)
+
+	var userID, merchantID uuid.UUID
+	require.NoError(t, db.QueryRowContext(ctx,
+		`INSERT INTO users (email, password, name, phone) VALUES ($1, 'x', 'points test', $2) RETURNING id`,
+		"points-"+suffix+"@example.com", suffix,
+	).Scan(&userID))
+	require.NoError(t, db.QueryRowContext(ctx,
+		`INSERT INTO merchants (user_id, merchant_name, merchant_type) VALUES ($1, 'points test', 'retailer') RETURNING id`,
+		userID,
+	).Scan(&merchantID))
+	require.NoError(t, db.QueryRowContext(ctx,
+		`INSERT INTO merchant_customers (merchant_id, email, password, name, phone) VALUES ($1, $2, 'x', 'points test', $3) RETURNING id`,
+		merchantID, "customer-"+suffix+"@example.com", suffix,
+	).Scan(&customerID))
+	require.NoError(t, db.QueryRowContext(ctx,
+		`INSERT INTO programs (merchant_id, user_id, program_name, point_currency_name) VALUES ($1, $2, 'points test', 'pts') RETURNING program_id`,
+		merchantID, userID,
+	).Scan(&programID))
+	return customerID, programID
+}
+
+func TestPointsRepository_Create_ParallelRedemptions(t *testing.T) {
+	db := testDB(t)
+	repo := NewPointsRepository(db)
+	ctx := context.Background()
+	customerID, programID := createPointsAccount(t, db)
+
+	_, err := repo.Create(ctx, &domain.PointsLedger{
+		MerchantCustomersID: customerID,
+		ProgramID:           programID,
+		PointsEarned:        100,
+	})
+	require.NoError(t, err)
+
+	// 25 redemptions of 10 against a balance of 100: exactly 10 can succeed
+	const redemptions = 25
+	var wg sync.WaitGroup
+	errs := make(chan error, redemptions)
+	for i := 0; i < redemptions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.Create(ctx, &domain.PointsLedger{
+				MerchantCustomersID: customerID,
+				ProgramID:           programID,
+				PointsRedeemed:      10,
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.True(t, domain.IsBusinessLogicError(err), "unexpected error: %v", err)
+	}
+	assert.Equal(t, 10, succeeded)
+
+	balance, err := repo.GetCurrentBalance(ctx, customerID, programID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, balance)
+
+	ledger, err := repo.GetByCustomerAndProgram(ctx, customerID, programID)
+	require.NoError(t, err)
+	for _, entry := range ledger {
+		assert.GreaterOrEqual(t, entry.PointsBalance, 0)
+	}
+
+	lots, err := repo.GetLots(ctx, customerID, programID)
+	require.NoError(t, err)
+	assert.Empty(t, lots)
+}
+
+func TestPointsRepository_Create_ReversalPolicies(t *testing.T) {
+	db := testDB(t)
+	repo := NewPointsRepository(db)
+	ctx := context.Background()
+	customerID, programID := createPointsAccount(t, db)
+
+	_, err := repo.Create(ctx, &domain.PointsLedger{
+		MerchantCustomersID: customerID,
+		ProgramID:           programID,
+		PointsEarned:        30,
+	})
+	require.NoError(t, err)
+
+	reversal := func(policy string) (*domain.PointsLedger, error) {
+		return repo.Create(ctx, &domain.PointsLedger{
+			MerchantCustomersID: customerID,
+			ProgramID:           programID,
+			PointsRedeemed:      50,
+			TxType:              domain.PointTxReversal,
+			RefundPolicy:        policy,
+		})
+	}
+
+	_, err = reversal(domain.RefundPolicyBlock)
+	assert.True(t, domain.IsBusinessLogicError(err), "unexpected error: %v", err)
+
+	// Takes the 30 that are left and writes off the other 20
+	clawedBack, err := reversal(domain.RefundPolicyClawBack)
+	require.NoError(t, err)
+	assert.Equal(t, 30, clawedBack.PointsRedeemed)
+	assert.Equal(t, 0, clawedBack.PointsBalance)
+
+	overdrawn, err := reversal(domain.RefundPolicyAllowNegative)
+	require.NoError(t, err)
+	assert.Equal(t, 50, overdrawn.PointsRedeemed)
+	assert.Equal(t, 0, overdrawn.PointsBalance)
+	assert.Equal(t, 50, overdrawn.PointsDebt)
+
+	balance, err := repo.GetCurrentBalance(ctx, customerID, programID)
+	require.NoError(t, err)
+	assert.Equal(t, -50, balance)
+
+	// The balance itself can not go below zero
+	_, err = db.ExecContext(ctx,
+		`UPDATE points_accounts SET balance = -1 WHERE merchant_customers_id = $1 AND program_id = $2`,
+		customerID, programID)
+	assert.True(t, isPgCheckViolation(err), "unexpected error: %v", err)
+
+	// The next earn pays off the 50 owed before anything can be spent
+	_, err = repo.Create(ctx, &domain.PointsLedger{
+		MerchantCustomersID: customerID,
+		ProgramID:           programID,
+		PointsEarned:        80,
+	})
+	require.NoError(t, err)
+
+	balance, err = repo.GetCurrentBalance(ctx, customerID, programID)
+	require.NoError(t, err)
+	assert.Equal(t, 30, balance)
+
+	lots, err := repo.GetLots(ctx, customerID, programID)
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.Equal(t, 30, lots[0].Remaining)
+}
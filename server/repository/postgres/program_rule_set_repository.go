@@ -0,0 +1,310 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"go-playground/pkg/logging"
+	"go-playground/server/config"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+type ProgramRuleSetRepository struct {
+	db     config.DbConnection
+	logger zerolog.Logger
+}
+
+func NewProgramRuleSetRepository(db config.DbConnection) *ProgramRuleSetRepository {
+	return &ProgramRuleSetRepository{db: db,
+		logger: logging.GetLogger(),
+	}
+}
+
+const programRuleSetColumns = `
+	id, program_id, version, status, description, published_at, created_at, updated_at`
+
+func scanProgramRuleSet(row rowScanner) (*domain.ProgramRuleSet, error) {
+	ruleSet := &domain.ProgramRuleSet{}
+	err := row.Scan(
+		&ruleSet.ID,
+		&ruleSet.ProgramID,
+		&ruleSet.Version,
+		&ruleSet.Status,
+		&ruleSet.Description,
+		&ruleSet.PublishedAt,
+		&ruleSet.CreatedAt,
+		&ruleSet.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ruleSet, nil
+}
+
+// GetOrCreateDraft reads and writes on the primary, a draft that was just
+// created may not have reached the replica yet. Within a unit of work the
+// program stays locked until it ends, so the caller can add to the draft
+// before it can be published.
+func (r *ProgramRuleSetRepository) GetOrCreateDraft(ctx context.Context, programID uuid.UUID, description string) (*domain.ProgramRuleSet, error) {
+	var draft *domain.ProgramRuleSet
+	err := inTx(ctx, r.db.RW, func(tx *sql.Tx) error {
+		// Serializes draft creation and publishing per program
+		if err := lockProgram(ctx, tx, programID); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to lock program")
+			return err
+		}
+
+		query := `SELECT ` + programRuleSetColumns + `
+			FROM program_rule_sets
+			WHERE program_id = $1 AND status = 'draft'
+		`
+		var err error
+		draft, err = scanProgramRuleSet(tx.QueryRowContext(ctx, query, programID))
+		if err == nil {
+			return nil
+		}
+		if err != sql.ErrNoRows {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to get draft rule set")
+			return domain.NewSystemError("ProgramRuleSetRepository.GetOrCreateDraft", err, "failed to get draft rule set")
+		}
+
+		insertQuery := `
+			INSERT INTO program_rule_sets (program_id, version, status, description)
+			SELECT $1, COALESCE(MAX(version), 0) + 1, 'draft', $2
+			FROM program_rule_sets
+			WHERE program_id = $1
+			RETURNING ` + programRuleSetColumns
+		draft, err = scanProgramRuleSet(tx.QueryRowContext(ctx, insertQuery, programID, description))
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to create draft rule set")
+			return domain.NewSystemError("ProgramRuleSetRepository.GetOrCreateDraft", err, "failed to create draft rule set")
+		}
+
+		// The draft starts as a copy of the published rules
+		copyQuery := `
+			INSERT INTO program_rules (
+				program_id, rule_set_id, rule_key, rule_name, condition_type, condition_value,
+				multiplier, points_awarded, priority, stacking,
+				max_points_per_transaction, max_points_per_customer_per_period, cap_period,
+				effective_from, effective_to
+			)
+			SELECT pr.program_id, $1, pr.rule_key, pr.rule_name, pr.condition_type, pr.condition_value,
+				   pr.multiplier, pr.points_awarded, pr.priority, pr.stacking,
+				   pr.max_points_per_transaction, pr.max_points_per_customer_per_period, pr.cap_period,
+				   pr.effective_from, pr.effective_to
+			FROM program_rules pr
+			JOIN program_rule_sets rs ON rs.id = pr.rule_set_id
+			WHERE rs.program_id = $2 AND rs.status = 'published'
+		`
+		if _, err := tx.ExecContext(ctx, copyQuery, draft.ID, programID); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to copy published rules")
+			return domain.NewSystemError("ProgramRuleSetRepository.GetOrCreateDraft", err, "failed to copy published rules")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// LockProgram locks the program the way Publish does, until the unit of work
+// running in ctx ends.
+func (r *ProgramRuleSetRepository) LockProgram(ctx context.Context, programID uuid.UUID) error {
+	return inTx(ctx, r.db.RW, func(tx *sql.Tx) error {
+		if err := lockProgram(ctx, tx, programID); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to lock program")
+			return err
+		}
+		return nil
+	})
+}
+
+func (r *ProgramRuleSetRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.ProgramRuleSet, error) {
+	query := `SELECT ` + programRuleSetColumns + `
+		FROM program_rule_sets
+		WHERE id = $1
+	`
+	ruleSet, err := scanProgramRuleSet(conn(ctx, r.db.RR).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get rule set")
+		return nil, domain.NewSystemError("ProgramRuleSetRepository.GetByID", err, "failed to get rule set")
+	}
+	return ruleSet, nil
+}
+
+func (r *ProgramRuleSetRepository) GetByProgramID(ctx context.Context, programID uuid.UUID) ([]*domain.ProgramRuleSet, error) {
+	query := `SELECT ` + programRuleSetColumns + `
+		FROM program_rule_sets
+		WHERE program_id = $1
+		ORDER BY version DESC
+	`
+	rows, err := r.db.RR.QueryContext(ctx, query, programID)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query rule sets")
+		return nil, domain.NewSystemError("ProgramRuleSetRepository.GetByProgramID", err, "failed to query rule sets")
+	}
+	defer rows.Close()
+
+	ruleSets := []*domain.ProgramRuleSet{}
+	for rows.Next() {
+		ruleSet, err := scanProgramRuleSet(rows)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan rule set")
+			return nil, domain.NewSystemError("ProgramRuleSetRepository.GetByProgramID", err, "failed to scan rule set")
+		}
+		ruleSets = append(ruleSets, ruleSet)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate rule sets")
+		return nil, domain.NewSystemError("ProgramRuleSetRepository.GetByProgramID", err, "error iterating rule sets")
+	}
+
+	return ruleSets, nil
+}
+
+// Publish swaps the program's published version in one database transaction,
+// so transactions are always scored against exactly one version.
+func (r *ProgramRuleSetRepository) Publish(ctx context.Context, id uuid.UUID, fromStatus string) (*domain.ProgramRuleSet, error) {
+	tx, err := r.db.RW.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to begin transaction")
+		return nil, domain.NewSystemError("ProgramRuleSetRepository.Publish", err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	var programID uuid.UUID
+	err = tx.QueryRowContext(ctx, `SELECT program_id FROM program_rule_sets WHERE id = $1`, id).Scan(&programID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.NewResourceNotFoundError("rule set", id.String(), "rule set not found")
+		}
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get rule set")
+		return nil, domain.NewSystemError("ProgramRuleSetRepository.Publish", err, "failed to get rule set")
+	}
+
+	if err := lockProgram(ctx, tx, programID); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to lock program")
+		return nil, err
+	}
+
+	// Checked again under the lock, another request may have published it
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM program_rule_sets WHERE id = $1`, id).Scan(&status); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get rule set status")
+		return nil, domain.NewSystemError("ProgramRuleSetRepository.Publish", err, "failed to get rule set status")
+	}
+	if status != fromStatus {
+		r.logger.Error().
+			Str("status", status).
+			Str("expected_status", fromStatus).
+			Msg("Rule set cannot be published")
+		return nil, domain.NewResourceConflictError("rule set", "rule set is "+status+", expected "+fromStatus)
+	}
+
+	archiveQuery := `
+		UPDATE program_rule_sets
+		SET status = 'archived', updated_at = CURRENT_TIMESTAMP
+		WHERE program_id = $1 AND status = 'published'
+	`
+	if _, err := tx.ExecContext(ctx, archiveQuery, programID); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to archive published rule set")
+		return nil, domain.NewSystemError("ProgramRuleSetRepository.Publish", err, "failed to archive published rule set")
+	}
+
+	publishQuery := `
+		UPDATE program_rule_sets
+		SET status = 'published', published_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING ` + programRuleSetColumns
+	ruleSet, err := scanProgramRuleSet(tx.QueryRowContext(ctx, publishQuery, id))
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to publish rule set")
+		return nil, domain.NewSystemError("ProgramRuleSetRepository.Publish", err, "failed to publish rule set")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to commit rule set publication")
+		return nil, domain.NewSystemError("ProgramRuleSetRepository.Publish", err, "failed to commit rule set publication")
+	}
+
+	return ruleSet, nil
+}
+
+// DeleteDraft discards a draft together with its rules.
+func (r *ProgramRuleSetRepository) DeleteDraft(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM program_rule_sets WHERE id = $1 AND status = 'draft'`
+	result, err := r.db.RW.ExecContext(ctx, query, id)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to delete draft rule set")
+		return domain.NewSystemError("ProgramRuleSetRepository.DeleteDraft", err, "failed to delete draft rule set")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get affected rows")
+		return domain.NewSystemError("ProgramRuleSetRepository.DeleteDraft", err, "failed to get affected rows")
+	}
+
+	if affected == 0 {
+		r.logger.Error().
+			Msg("Failed to delete draft rule set")
+		return domain.NewResourceNotFoundError("draft rule set", id.String(), "draft rule set not found")
+	}
+
+	return nil
+}
+
+func lockProgram(ctx context.Context, tx *sql.Tx, programID uuid.UUID) error {
+	var locked uuid.UUID
+	err := tx.QueryRowContext(ctx, `SELECT program_id FROM programs WHERE program_id = $1 FOR UPDATE`, programID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return domain.NewResourceNotFoundError("program", programID.String(), "program not found")
+	}
+	if err != nil {
+		return domain.NewSystemError("lockProgram", err, "failed to lock program")
+	}
+	return nil
+}
@@ -23,15 +23,58 @@ func NewProgramRuleRepository(db config.DbConnection) *ProgramRuleRepository {
 	}
 }
 
+// programRuleColumns are the program_rules columns read by scanProgramRule,
+// for queries aliasing the table as pr
+const programRuleColumns = `
+	pr.id, pr.program_id, pr.rule_set_id, pr.rule_key, pr.rule_name,
+	pr.condition_type, pr.condition_value, pr.multiplier, pr.points_awarded,
+	pr.priority, pr.stacking, pr.max_points_per_transaction,
+	pr.max_points_per_customer_per_period, COALESCE(pr.cap_period, ''),
+	pr.effective_from, pr.effective_to, pr.created_at, pr.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProgramRule(row rowScanner) (*domain.ProgramRule, error) {
+	rule := &domain.ProgramRule{}
+	err := row.Scan(
+		&rule.ID,
+		&rule.ProgramID,
+		&rule.RuleSetID,
+		&rule.RuleKey,
+		&rule.RuleName,
+		&rule.ConditionType,
+		&rule.ConditionValue,
+		&rule.Multiplier,
+		&rule.PointsAwarded,
+		&rule.Priority,
+		&rule.Stacking,
+		&rule.MaxPointsPerTransaction,
+		&rule.MaxPointsPerCustomerPerPeriod,
+		&rule.CapPeriod,
+		&rule.EffectiveFrom,
+		&rule.EffectiveTo,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
 func (r *ProgramRuleRepository) Create(ctx context.Context, rule *domain.ProgramRule) error {
 	query := `
 		INSERT INTO program_rules (
 			program_id, rule_name, condition_type, condition_value,
-			multiplier, points_awarded, effective_from, effective_to
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			multiplier, points_awarded, priority, stacking,
+			max_points_per_transaction, max_points_per_customer_per_period, cap_period,
+			effective_from, effective_to, rule_set_id, rule_key
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, $13, $14, $15)
 		RETURNING id, created_at, updated_at
 	`
-	err := r.db.RW.QueryRowContext(
+	err := conn(ctx, r.db.RW).QueryRowContext(
 		ctx,
 		query,
 		rule.ProgramID,
@@ -40,8 +83,15 @@ func (r *ProgramRuleRepository) Create(ctx context.Context, rule *domain.Program
 		rule.ConditionValue,
 		rule.Multiplier,
 		rule.PointsAwarded,
+		rule.Priority,
+		rule.Stacking,
+		rule.MaxPointsPerTransaction,
+		rule.MaxPointsPerCustomerPerPeriod,
+		rule.CapPeriod,
 		rule.EffectiveFrom,
 		rule.EffectiveTo,
+		rule.RuleSetID,
+		rule.RuleKey,
 	).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
 
 	if err != nil {
@@ -61,27 +111,11 @@ func (r *ProgramRuleRepository) Create(ctx context.Context, rule *domain.Program
 }
 
 func (r *ProgramRuleRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.ProgramRule, error) {
-	query := `
-		SELECT id, program_id, rule_name, condition_type, condition_value,
-			   multiplier, points_awarded, effective_from, effective_to,
-			   created_at, updated_at
-		FROM program_rules
-		WHERE id = $1
+	query := `SELECT ` + programRuleColumns + `
+		FROM program_rules pr
+		WHERE pr.id = $1
 	`
-	rule := &domain.ProgramRule{}
-	err := r.db.RR.QueryRowContext(ctx, query, id).Scan(
-		&rule.ID,
-		&rule.ProgramID,
-		&rule.RuleName,
-		&rule.ConditionType,
-		&rule.ConditionValue,
-		&rule.Multiplier,
-		&rule.PointsAwarded,
-		&rule.EffectiveFrom,
-		&rule.EffectiveTo,
-		&rule.CreatedAt,
-		&rule.UpdatedAt,
-	)
+	rule, err := scanProgramRule(conn(ctx, r.db.RR).QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			r.logger.Error().
@@ -98,44 +132,44 @@ func (r *ProgramRuleRepository) GetByID(ctx context.Context, id uuid.UUID) (*dom
 }
 
 func (r *ProgramRuleRepository) GetByProgramID(ctx context.Context, programID uuid.UUID) ([]*domain.ProgramRule, error) {
-	query := `
-		SELECT id, program_id, rule_name, condition_type, condition_value,
-			   multiplier, points_awarded, effective_from, effective_to,
-			   created_at, updated_at
-		FROM program_rules
-		WHERE program_id = $1
-		ORDER BY created_at DESC
+	query := `SELECT ` + programRuleColumns + `
+		FROM program_rules pr
+		JOIN program_rule_sets rs ON rs.id = pr.rule_set_id
+		WHERE pr.program_id = $1
+		AND rs.status = 'published'
+		ORDER BY pr.created_at DESC
 	`
-	rows, err := r.db.RR.QueryContext(ctx, query, programID)
+	return r.queryRules(ctx, "ProgramRuleRepository.GetByProgramID", query, programID)
+}
+
+func (r *ProgramRuleRepository) GetByRuleSetID(ctx context.Context, ruleSetID uuid.UUID) ([]*domain.ProgramRule, error) {
+	query := `SELECT ` + programRuleColumns + `
+		FROM program_rules pr
+		WHERE pr.rule_set_id = $1
+		ORDER BY pr.priority DESC, pr.created_at ASC
+	`
+	return r.queryRules(ctx, "ProgramRuleRepository.GetByRuleSetID", query, ruleSetID)
+}
+
+// queryRules runs a query selecting programRuleColumns on the read replica.
+func (r *ProgramRuleRepository) queryRules(ctx context.Context, op, query string, args ...interface{}) ([]*domain.ProgramRule, error) {
+	rows, err := r.db.RR.QueryContext(ctx, query, args...)
 	if err != nil {
 		r.logger.Error().
 			Err(err).
 			Msg("Failed to query program rules")
-		return nil, domain.NewSystemError("ProgramRuleRepository.GetByProgramID", err, "failed to query program rules")
+		return nil, domain.NewSystemError(op, err, "failed to query program rules")
 	}
 	defer rows.Close()
 
 	var rules []*domain.ProgramRule
 	for rows.Next() {
-		rule := &domain.ProgramRule{}
-		err := rows.Scan(
-			&rule.ID,
-			&rule.ProgramID,
-			&rule.RuleName,
-			&rule.ConditionType,
-			&rule.ConditionValue,
-			&rule.Multiplier,
-			&rule.PointsAwarded,
-			&rule.EffectiveFrom,
-			&rule.EffectiveTo,
-			&rule.CreatedAt,
-			&rule.UpdatedAt,
-		)
+		rule, err := scanProgramRule(rows)
 		if err != nil {
 			r.logger.Error().
 				Err(err).
 				Msg("Failed to scan program rule")
-			return nil, domain.NewSystemError("ProgramRuleRepository.GetByProgramID", err, "failed to scan program rule")
+			return nil, domain.NewSystemError(op, err, "failed to scan program rule")
 		}
 		rules = append(rules, rule)
 	}
@@ -144,7 +178,7 @@ func (r *ProgramRuleRepository) GetByProgramID(ctx context.Context, programID uu
 		r.logger.Error().
 			Err(err).
 			Msg("Failed to iterate program rules")
-		return nil, domain.NewSystemError("ProgramRuleRepository.GetByProgramID", err, "error iterating program rules")
+		return nil, domain.NewSystemError(op, err, "error iterating program rules")
 	}
 
 	return rules, nil
@@ -158,13 +192,19 @@ func (r *ProgramRuleRepository) Update(ctx context.Context, rule *domain.Program
 			condition_value = $3,
 			multiplier = $4,
 			points_awarded = $5,
-			effective_from = $6,
-			effective_to = $7,
+			priority = $6,
+			stacking = $7,
+			max_points_per_transaction = $8,
+			max_points_per_customer_per_period = $9,
+			cap_period = NULLIF($10, ''),
+			effective_from = $11,
+			effective_to = $12,
 			updated_at = CURRENT_TIMESTAMP
-		WHERE id = $8
+		WHERE id = $13
+		AND rule_set_id IN (SELECT id FROM program_rule_sets WHERE status = 'draft')
 		RETURNING updated_at
 	`
-	result, err := r.db.RW.ExecContext(
+	result, err := conn(ctx, r.db.RW).ExecContext(
 		ctx,
 		query,
 		rule.RuleName,
@@ -172,6 +212,11 @@ func (r *ProgramRuleRepository) Update(ctx context.Context, rule *domain.Program
 		rule.ConditionValue,
 		rule.Multiplier,
 		rule.PointsAwarded,
+		rule.Priority,
+		rule.Stacking,
+		rule.MaxPointsPerTransaction,
+		rule.MaxPointsPerCustomerPerPeriod,
+		rule.CapPeriod,
 		rule.EffectiveFrom,
 		rule.EffectiveTo,
 		rule.ID,
@@ -208,8 +253,12 @@ func (r *ProgramRuleRepository) Update(ctx context.Context, rule *domain.Program
 }
 
 func (r *ProgramRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM program_rules WHERE id = $1`
-	result, err := r.db.RW.ExecContext(ctx, query, id)
+	query := `
+		DELETE FROM program_rules
+		WHERE id = $1
+		AND rule_set_id IN (SELECT id FROM program_rule_sets WHERE status = 'draft')
+	`
+	result, err := conn(ctx, r.db.RW).ExecContext(ctx, query, id)
 	if err != nil {
 		r.logger.Error().
 			Err(err).
@@ -235,56 +284,93 @@ func (r *ProgramRuleRepository) Delete(ctx context.Context, id uuid.UUID) error
 }
 
 func (r *ProgramRuleRepository) GetActiveRules(ctx context.Context, programID uuid.UUID, timestamp time.Time) ([]*domain.ProgramRule, error) {
-	query := `
-		SELECT id, program_id, rule_name, condition_type, condition_value,
-			   multiplier, points_awarded, effective_from, effective_to,
-			   created_at, updated_at
-		FROM program_rules
-		WHERE program_id = $1
-		AND effective_from <= $2
-		AND (effective_to IS NULL OR effective_to >= $2)
-		ORDER BY created_at DESC
+	query := `SELECT ` + programRuleColumns + `
+		FROM program_rules pr
+		JOIN program_rule_sets rs ON rs.id = pr.rule_set_id
+		WHERE pr.program_id = $1
+		AND rs.status = 'published'
+		AND pr.effective_from <= $2
+		AND (pr.effective_to IS NULL OR pr.effective_to >= $2)
+		ORDER BY pr.priority DESC, pr.created_at ASC
 	`
-	rows, err := r.db.RR.QueryContext(ctx, query, programID, timestamp)
-	if err != nil {
-		r.logger.Error().
-			Err(err).
-			Msg("Failed to query active program rules")
-		return nil, domain.NewSystemError("ProgramRuleRepository.GetActiveRules", err, "failed to query active program rules")
+	return r.queryRules(ctx, "ProgramRuleRepository.GetActiveRules", query, programID, timestamp)
+}
+
+// CreateAwards joins the unit of work running in ctx, if any, so the awards
+// commit together with the points they paid out.
+func (r *ProgramRuleRepository) CreateAwards(ctx context.Context, awards []*domain.ProgramRuleAward) error {
+	if len(awards) == 0 {
+		return nil
 	}
-	defer rows.Close()
 
-	var rules []*domain.ProgramRule
-	for rows.Next() {
-		rule := &domain.ProgramRule{}
-		err := rows.Scan(
-			&rule.ID,
-			&rule.ProgramID,
-			&rule.RuleName,
-			&rule.ConditionType,
-			&rule.ConditionValue,
-			&rule.Multiplier,
-			&rule.PointsAwarded,
-			&rule.EffectiveFrom,
-			&rule.EffectiveTo,
-			&rule.CreatedAt,
-			&rule.UpdatedAt,
-		)
-		if err != nil {
-			r.logger.Error().
-				Err(err).
-				Msg("Failed to scan program rule")
-			return nil, domain.NewSystemError("ProgramRuleRepository.GetActiveRules", err, "failed to scan program rule")
+	query := `
+		INSERT INTO program_rule_awards (
+			rule_id, merchant_customers_id, transaction_id, points, awarded_at
+		) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	return inTx(ctx, r.db.RW, func(tx *sql.Tx) error {
+		for _, award := range awards {
+			err := tx.QueryRowContext(
+				ctx,
+				query,
+				award.RuleID,
+				award.MerchantCustomersID,
+				award.TransactionID,
+				award.Points,
+				award.AwardedAt,
+			).Scan(&award.ID, &award.CreatedAt)
+			if err != nil {
+				r.logger.Error().
+					Err(err).
+					Msg("Failed to create program rule award")
+				return domain.NewSystemError("ProgramRuleRepository.CreateAwards", err, "failed to create program rule award")
+			}
 		}
-		rules = append(rules, rule)
-	}
+		return nil
+	})
+}
 
-	if err = rows.Err(); err != nil {
+// SumAwardedPoints returns the points a rule, in any of its versions, awarded
+// a customer in [from, to). Awards of failed or cancelled transactions do not
+// count. It reads from the primary so a cap is checked against the latest
+// awards.
+//
+// It first locks the rule's awards to the customer until the unit of work
+// running in ctx ends, so a concurrent transaction sums them only once this
+// one's awards are recorded.
+func (r *ProgramRuleRepository) SumAwardedPoints(ctx context.Context, ruleID, customerID uuid.UUID, from, to time.Time) (int, error) {
+	lock := `
+		SELECT pg_advisory_xact_lock(hashtextextended(
+			(SELECT rule_key FROM program_rules WHERE id = $1)::text || ':' || $2::text, 0
+		))
+	`
+	query := `
+		SELECT COALESCE(SUM(a.points), 0)
+		FROM program_rule_awards a
+		JOIN program_rules pr ON pr.id = a.rule_id
+		WHERE pr.rule_key = (SELECT rule_key FROM program_rules WHERE id = $1)
+		AND a.merchant_customers_id = $2
+		AND a.awarded_at >= $3
+		AND a.awarded_at < $4
+		AND NOT EXISTS (
+			SELECT 1 FROM transactions t
+			WHERE t.transaction_id = a.transaction_id
+			AND t.status IN ('failed', 'cancelled')
+		)
+	`
+	var total int
+	err := inTx(ctx, r.db.RW, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, lock, ruleID, customerID); err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, query, ruleID, customerID, from, to).Scan(&total)
+	})
+	if err != nil {
 		r.logger.Error().
 			Err(err).
-			Msg("Failed to iterate active program rules")
-		return nil, domain.NewSystemError("ProgramRuleRepository.GetActiveRules", err, "error iterating active program rules")
+			Msg("Failed to sum program rule awards")
+		return 0, domain.NewSystemError("ProgramRuleRepository.SumAwardedPoints", err, "failed to sum program rule awards")
 	}
-
-	return rules, nil
+	return total, nil
 }
@@ -26,9 +26,9 @@ func (r *ProgramsRepository) Create(ctx context.Context, program *domain.Program
 	merchantID := program.MerchantID.String()
 
 	query := `
-		INSERT INTO programs (merchant_id, user_id, program_name, point_currency_name)
-		VALUES ($1, $2, $3, $4)
-		RETURNING program_id, merchant_id, program_name, point_currency_name, created_at, updated_at`
+		INSERT INTO programs (merchant_id, user_id, program_name, point_currency_name, refund_policy)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'block'))
+		RETURNING program_id, merchant_id, program_name, point_currency_name, refund_policy, created_at, updated_at`
 
 	result := domain.Program{}
 	var mID uuid.UUID
@@ -39,11 +39,13 @@ func (r *ProgramsRepository) Create(ctx context.Context, program *domain.Program
 		program.UserID,
 		program.ProgramName,
 		program.PointCurrencyName,
+		program.RefundPolicy,
 	).Scan(
 		&result.ID,
 		&mID,
 		&result.ProgramName,
 		&result.PointCurrencyName,
+		&result.RefundPolicy,
 		&result.CreatedAt,
 		&result.UpdatedAt,
 	)
@@ -67,7 +69,7 @@ func (r *ProgramsRepository) Create(ctx context.Context, program *domain.Program
 
 func (r *ProgramsRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Program, error) {
 	query := `
-		SELECT program_id, merchant_id, program_name, point_currency_name, created_at, updated_at
+		SELECT program_id, merchant_id, program_name, point_currency_name, refund_policy, created_at, updated_at
 		FROM programs
 		WHERE program_id = $1`
 
@@ -78,6 +80,7 @@ func (r *ProgramsRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain
 		&mID,
 		&program.ProgramName,
 		&program.PointCurrencyName,
+		&program.RefundPolicy,
 		&program.CreatedAt,
 		&program.UpdatedAt,
 	)
@@ -100,7 +103,7 @@ func (r *ProgramsRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain
 
 func (r *ProgramsRepository) GetAll(ctx context.Context) ([]*domain.Program, error) {
 	query := `
-		SELECT program_id, merchant_id, program_name, point_currency_name, created_at, updated_at
+		SELECT program_id, merchant_id, program_name, point_currency_name, refund_policy, created_at, updated_at
 		FROM programs`
 
 	rows, err := r.db.QueryContext(ctx, query)
@@ -121,6 +124,7 @@ func (r *ProgramsRepository) GetAll(ctx context.Context) ([]*domain.Program, err
 			&mID,
 			&program.ProgramName,
 			&program.PointCurrencyName,
+			&program.RefundPolicy,
 			&program.CreatedAt,
 			&program.UpdatedAt,
 		)
@@ -153,8 +157,8 @@ func (r *ProgramsRepository) GetAll(ctx context.Context) ([]*domain.Program, err
 func (r *ProgramsRepository) Update(ctx context.Context, program *domain.Program) error {
 	query := `
 		UPDATE programs
-		SET program_name = $1, point_currency_name = $2
-		WHERE program_id = $3
+		SET program_name = $1, point_currency_name = $2, refund_policy = COALESCE(NULLIF($3, ''), refund_policy)
+		WHERE program_id = $4
 		RETURNING updated_at`
 
 	result, err := r.db.ExecContext(
@@ -162,6 +166,7 @@ func (r *ProgramsRepository) Update(ctx context.Context, program *domain.Program
 		query,
 		program.ProgramName,
 		program.PointCurrencyName,
+		program.RefundPolicy,
 		program.ID,
 	)
 
@@ -201,7 +206,7 @@ func (r *ProgramsRepository) Delete(ctx context.Context, id uuid.UUID) error {
 
 func (r *ProgramsRepository) GetByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]*domain.Program, error) {
 	query := `
-		SELECT program_id, merchant_id, program_name, point_currency_name, created_at, updated_at
+		SELECT program_id, merchant_id, program_name, point_currency_name, refund_policy, created_at, updated_at
 		FROM programs
 		WHERE merchant_id = $1`
 
@@ -223,6 +228,7 @@ func (r *ProgramsRepository) GetByMerchantID(ctx context.Context, merchantID uui
 			&mID,
 			&program.ProgramName,
 			&program.PointCurrencyName,
+			&program.RefundPolicy,
 			&program.CreatedAt,
 			&program.UpdatedAt,
 		)
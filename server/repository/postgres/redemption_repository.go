@@ -25,17 +25,20 @@ func (r *RedemptionRepository) Create(ctx context.Context, redemption *domain.Re
 	query := `
 		INSERT INTO redemptions (
 			merchant_customers_id, reward_id, points_used,
-			redemption_date, status, created_at, updated_at
-		) VALUES ($1, $2, $3, CURRENT_TIMESTAMP, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			redemption_date, status, transaction_id, group_id, cash_amount, created_at, updated_at
+		) VALUES ($1, $2, $3, CURRENT_TIMESTAMP, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 		RETURNING id, redemption_date, created_at, updated_at
 	`
-	err := r.db.QueryRowContext(
+	err := conn(ctx, r.db).QueryRowContext(
 		ctx,
 		query,
 		redemption.MerchantCustomersID,
 		redemption.RewardID,
 		redemption.PointsUsed,
 		redemption.Status,
+		redemption.TransactionID,
+		redemption.GroupID,
+		redemption.CashAmount,
 	).Scan(
 		&redemption.ID,
 		&redemption.RedemptionDate,
@@ -60,7 +63,7 @@ func (r *RedemptionRepository) Create(ctx context.Context, redemption *domain.Re
 func (r *RedemptionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.Redemption, error) {
 	query := `
 		SELECT id, merchant_customers_id, reward_id, points_used,
-			   redemption_date, status, created_at, updated_at
+			   redemption_date, status, transaction_id, group_id, cash_amount, created_at, updated_at
 		FROM redemptions
 		WHERE merchant_customers_id = $1	
 		ORDER BY redemption_date DESC
@@ -84,6 +87,9 @@ func (r *RedemptionRepository) GetByUserID(ctx context.Context, userID uuid.UUID
 			&redemption.PointsUsed,
 			&redemption.RedemptionDate,
 			&redemption.Status,
+			&redemption.TransactionID,
+			&redemption.GroupID,
+			&redemption.CashAmount,
 			&redemption.CreatedAt,
 			&redemption.UpdatedAt,
 		)
@@ -110,7 +116,7 @@ func (r *RedemptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*doma
 	redemption := &domain.Redemption{}
 	query := `
 		SELECT id, merchant_customers_id, reward_id, points_used,
-			   redemption_date, status, created_at, updated_at
+			   redemption_date, status, transaction_id, group_id, cash_amount, created_at, updated_at
 		FROM redemptions
 		WHERE id = $1
 	`
@@ -121,6 +127,9 @@ func (r *RedemptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*doma
 		&redemption.PointsUsed,
 		&redemption.RedemptionDate,
 		&redemption.Status,
+		&redemption.TransactionID,
+		&redemption.GroupID,
+		&redemption.CashAmount,
 		&redemption.CreatedAt,
 		&redemption.UpdatedAt,
 	)
@@ -142,7 +151,7 @@ func (r *RedemptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*doma
 func (r *RedemptionRepository) GetByMerchantCustomerID(ctx context.Context, merchantCustomersID uuid.UUID) ([]*domain.Redemption, error) {
 	query := `
 		SELECT id, merchant_customers_id, reward_id, points_used,
-			   redemption_date, status, created_at, updated_at
+			   redemption_date, status, transaction_id, group_id, cash_amount, created_at, updated_at
 		FROM redemptions
 		WHERE merchant_customers_id = $1
 		ORDER BY redemption_date DESC
@@ -166,6 +175,9 @@ func (r *RedemptionRepository) GetByMerchantCustomerID(ctx context.Context, merc
 			&redemption.PointsUsed,
 			&redemption.RedemptionDate,
 			&redemption.Status,
+			&redemption.TransactionID,
+			&redemption.GroupID,
+			&redemption.CashAmount,
 			&redemption.CreatedAt,
 			&redemption.UpdatedAt,
 		)
@@ -188,6 +200,58 @@ func (r *RedemptionRepository) GetByMerchantCustomerID(ctx context.Context, merc
 	return redemptions, nil
 }
 
+func (r *RedemptionRepository) GetByGroupID(ctx context.Context, groupID uuid.UUID) ([]*domain.Redemption, error) {
+	query := `
+		SELECT id, merchant_customers_id, reward_id, points_used,
+			   redemption_date, status, transaction_id, group_id, cash_amount, created_at, updated_at
+		FROM redemptions
+		WHERE group_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, query, groupID)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query redemptions")
+		return nil, domain.NewSystemError("RedemptionRepository.GetByGroupID", err, "failed to query redemptions")
+	}
+	defer rows.Close()
+
+	redemptions := []*domain.Redemption{}
+	for rows.Next() {
+		redemption := &domain.Redemption{}
+		err := rows.Scan(
+			&redemption.ID,
+			&redemption.MerchantCustomersID,
+			&redemption.RewardID,
+			&redemption.PointsUsed,
+			&redemption.RedemptionDate,
+			&redemption.Status,
+			&redemption.TransactionID,
+			&redemption.GroupID,
+			&redemption.CashAmount,
+			&redemption.CreatedAt,
+			&redemption.UpdatedAt,
+		)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan redemption")
+			return nil, domain.NewSystemError("RedemptionRepository.GetByGroupID", err, "failed to scan redemption")
+		}
+		redemptions = append(redemptions, redemption)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate redemptions")
+		return nil, domain.NewSystemError("RedemptionRepository.GetByGroupID", err, "error iterating redemptions")
+	}
+
+	return redemptions, nil
+}
+
 func (r *RedemptionRepository) Update(ctx context.Context, redemption *domain.Redemption) error {
 	query := `
 		UPDATE redemptions
@@ -195,7 +259,7 @@ func (r *RedemptionRepository) Update(ctx context.Context, redemption *domain.Re
 		WHERE id = $2
 		RETURNING updated_at
 	`
-	result, err := r.db.ExecContext(ctx, query, redemption.Status, redemption.ID)
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, redemption.Status, redemption.ID)
 	if err != nil {
 		r.logger.Error().
 			Err(err).
@@ -221,10 +285,138 @@ func (r *RedemptionRepository) Update(ctx context.Context, redemption *domain.Re
 	return nil
 }
 
+func (r *RedemptionRepository) CountActive(ctx context.Context, customerID, rewardID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM redemptions
+		WHERE merchant_customers_id = $1 AND reward_id = $2
+		  AND status IN ('pending', 'approved', 'fulfilled')
+	`
+	var count int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, customerID, rewardID).Scan(&count); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to count redemptions")
+		return 0, domain.NewSystemError("RedemptionRepository.CountActive", err, "failed to count redemptions")
+	}
+	return count, nil
+}
+
+func (r *RedemptionRepository) LockByID(ctx context.Context, id uuid.UUID) (*domain.Redemption, error) {
+	redemption := &domain.Redemption{}
+	query := `
+		SELECT id, merchant_customers_id, reward_id, points_used,
+			   redemption_date, status, transaction_id, group_id, cash_amount, created_at, updated_at
+		FROM redemptions
+		WHERE id = $1
+		FOR UPDATE
+	`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
+		&redemption.ID,
+		&redemption.MerchantCustomersID,
+		&redemption.RewardID,
+		&redemption.PointsUsed,
+		&redemption.RedemptionDate,
+		&redemption.Status,
+		&redemption.TransactionID,
+		&redemption.GroupID,
+		&redemption.CashAmount,
+		&redemption.CreatedAt,
+		&redemption.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("id", id.String()).
+			Msg("Failed to lock redemption")
+		return nil, domain.NewSystemError("RedemptionRepository.LockByID", err, "failed to lock redemption")
+	}
+	return redemption, nil
+}
+
+func (r *RedemptionRepository) RecordStatusChange(ctx context.Context, change *domain.RedemptionStatusChange) error {
+	query := `
+		INSERT INTO redemption_status_history (
+			redemption_id, from_status, to_status, reason, changed_by, refund_transaction_id
+		) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6)
+		RETURNING id, created_at
+	`
+	err := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		query,
+		change.RedemptionID,
+		change.FromStatus,
+		change.ToStatus,
+		change.Reason,
+		change.ChangedBy,
+		change.RefundTransactionID,
+	).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("redemption_id", change.RedemptionID.String()).
+			Msg("Failed to record redemption status change")
+		return domain.NewSystemError("RedemptionRepository.RecordStatusChange", err, "failed to record redemption status change")
+	}
+	return nil
+}
+
+func (r *RedemptionRepository) GetStatusHistory(ctx context.Context, redemptionID uuid.UUID) ([]*domain.RedemptionStatusChange, error) {
+	query := `
+		SELECT id, redemption_id, from_status, to_status, COALESCE(reason, ''),
+			   COALESCE(changed_by, ''), refund_transaction_id, created_at
+		FROM redemption_status_history
+		WHERE redemption_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, query, redemptionID)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query redemption status history")
+		return nil, domain.NewSystemError("RedemptionRepository.GetStatusHistory", err, "failed to query redemption status history")
+	}
+	defer rows.Close()
+
+	changes := []*domain.RedemptionStatusChange{}
+	for rows.Next() {
+		change := &domain.RedemptionStatusChange{}
+		err := rows.Scan(
+			&change.ID,
+			&change.RedemptionID,
+			&change.FromStatus,
+			&change.ToStatus,
+			&change.Reason,
+			&change.ChangedBy,
+			&change.RefundTransactionID,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan redemption status change")
+			return nil, domain.NewSystemError("RedemptionRepository.GetStatusHistory", err, "failed to scan redemption status change")
+		}
+		changes = append(changes, change)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate redemption status history")
+		return nil, domain.NewSystemError("RedemptionRepository.GetStatusHistory", err, "error iterating redemption status history")
+	}
+
+	return changes, nil
+}
+
 func (r *RedemptionRepository) GetByRewardID(ctx context.Context, rewardID uuid.UUID) ([]*domain.Redemption, error) {
 	query := `
 		SELECT id, merchant_customers_id, reward_id, points_used,
-			   redemption_date, status, created_at, updated_at
+			   redemption_date, status, transaction_id, group_id, cash_amount, created_at, updated_at
 		FROM redemptions
 		WHERE reward_id = $1
 		ORDER BY redemption_date DESC
@@ -248,6 +440,9 @@ func (r *RedemptionRepository) GetByRewardID(ctx context.Context, rewardID uuid.
 			&redemption.PointsUsed,
 			&redemption.RedemptionDate,
 			&redemption.Status,
+			&redemption.TransactionID,
+			&redemption.GroupID,
+			&redemption.CashAmount,
 			&redemption.CreatedAt,
 			&redemption.UpdatedAt,
 		)
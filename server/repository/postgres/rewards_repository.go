@@ -30,9 +30,10 @@ func (r *RewardsRepository) Create(ctx context.Context, reward *domain.Reward) (
 	query := `
 		INSERT INTO rewards (
 			program_id, name, description, points_required,
-			available_quantity, quantity, is_active,
-			created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+			available_quantity, quantity, max_per_customer, low_stock_threshold,
+			voucher_source, voucher_validity_days, min_points, cash_per_point,
+			is_active, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 		RETURNING id, points_required, created_at, updated_at
 	`
 	err := r.db.QueryRowContext(
@@ -44,6 +45,12 @@ func (r *RewardsRepository) Create(ctx context.Context, reward *domain.Reward) (
 		reward.PointsRequired,
 		reward.AvailableQuantity,
 		reward.Quantity,
+		reward.MaxPerCustomer,
+		reward.LowStockThreshold,
+		reward.VoucherSource,
+		reward.VoucherValidityDays,
+		reward.MinPoints,
+		reward.CashPerPoint,
 		reward.IsActive,
 	).Scan(
 		&reward.ID,
@@ -70,12 +77,14 @@ func (r *RewardsRepository) Create(ctx context.Context, reward *domain.Reward) (
 
 func (r *RewardsRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Reward, error) {
 	reward := &domain.Reward{}
-	var availableQuantity sql.NullInt32
+	var availableQuantity, maxPerCustomer, lowStockThreshold, voucherValidityDays, minPoints sql.NullInt32
+	var cashPerPoint sql.NullFloat64
 
 	query := `
 		SELECT id, program_id, name, description, points_required,
-			   available_quantity, quantity, is_active,
-			   created_at, updated_at
+			   available_quantity, quantity, max_per_customer, low_stock_threshold,
+			   voucher_source, voucher_validity_days, min_points, cash_per_point,
+			   is_active, created_at, updated_at
 		FROM rewards
 		WHERE id = $1
 	`
@@ -91,6 +100,12 @@ func (r *RewardsRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.
 		&reward.PointsRequired,
 		&availableQuantity,
 		&reward.Quantity,
+		&maxPerCustomer,
+		&lowStockThreshold,
+		&reward.VoucherSource,
+		&voucherValidityDays,
+		&minPoints,
+		&cashPerPoint,
 		&reward.IsActive,
 		&reward.CreatedAt,
 		&reward.UpdatedAt,
@@ -109,10 +124,12 @@ func (r *RewardsRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.
 		return nil, domain.NewSystemError("RewardsRepository.GetByID", err, "failed to get reward")
 	}
 
-	if availableQuantity.Valid {
-		q := int(availableQuantity.Int32)
-		reward.AvailableQuantity = &q
-	}
+	reward.AvailableQuantity = nullableInt(availableQuantity)
+	reward.MaxPerCustomer = nullableInt(maxPerCustomer)
+	reward.LowStockThreshold = nullableInt(lowStockThreshold)
+	reward.VoucherValidityDays = nullableInt(voucherValidityDays)
+	reward.MinPoints = nullableInt(minPoints)
+	reward.CashPerPoint = nullableFloat(cashPerPoint)
 
 	return reward, nil
 }
@@ -120,8 +137,9 @@ func (r *RewardsRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.
 func (r *RewardsRepository) GetAll(ctx context.Context, activeOnly bool) ([]domain.Reward, error) {
 	query := `
 		SELECT id, program_id, name, description, points_required,
-			   available_quantity, quantity, is_active,
-			   created_at, updated_at
+			   available_quantity, quantity, max_per_customer, low_stock_threshold,
+			   voucher_source, voucher_validity_days, min_points, cash_per_point,
+			   is_active, created_at, updated_at
 		FROM rewards
 	`
 	if activeOnly {
@@ -141,7 +159,8 @@ func (r *RewardsRepository) GetAll(ctx context.Context, activeOnly bool) ([]doma
 	var rewards []domain.Reward
 	for rows.Next() {
 		var reward domain.Reward
-		var availableQuantity sql.NullInt32
+		var availableQuantity, maxPerCustomer, lowStockThreshold, voucherValidityDays, minPoints sql.NullInt32
+		var cashPerPoint sql.NullFloat64
 
 		err := rows.Scan(
 			&reward.ID,
@@ -151,6 +170,12 @@ func (r *RewardsRepository) GetAll(ctx context.Context, activeOnly bool) ([]doma
 			&reward.PointsRequired,
 			&availableQuantity,
 			&reward.Quantity,
+			&maxPerCustomer,
+			&lowStockThreshold,
+			&reward.VoucherSource,
+			&voucherValidityDays,
+			&minPoints,
+			&cashPerPoint,
 			&reward.IsActive,
 			&reward.CreatedAt,
 			&reward.UpdatedAt,
@@ -162,10 +187,12 @@ func (r *RewardsRepository) GetAll(ctx context.Context, activeOnly bool) ([]doma
 			return nil, domain.NewSystemError("RewardsRepository.GetAll", err, "failed to scan reward")
 		}
 
-		if availableQuantity.Valid {
-			q := int(availableQuantity.Int32)
-			reward.AvailableQuantity = &q
-		}
+		reward.AvailableQuantity = nullableInt(availableQuantity)
+		reward.MaxPerCustomer = nullableInt(maxPerCustomer)
+		reward.LowStockThreshold = nullableInt(lowStockThreshold)
+		reward.VoucherValidityDays = nullableInt(voucherValidityDays)
+		reward.MinPoints = nullableInt(minPoints)
+		reward.CashPerPoint = nullableFloat(cashPerPoint)
 
 		rewards = append(rewards, reward)
 	}
@@ -184,9 +211,10 @@ func (r *RewardsRepository) Update(ctx context.Context, reward *domain.Reward) (
 	query := `
 		UPDATE rewards
 		SET name = $1, description = $2, points_required = $3,
-			available_quantity = $4, quantity = $5, is_active = $6,
-			updated_at = CURRENT_TIMESTAMP
-		WHERE id = $7
+			available_quantity = $4, quantity = $5, max_per_customer = $6,
+			low_stock_threshold = $7, voucher_source = $8, voucher_validity_days = $9,
+			min_points = $10, cash_per_point = $11, is_active = $12, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $13
 		RETURNING updated_at
 	`
 	result, err := r.db.ExecContext(
@@ -197,6 +225,12 @@ func (r *RewardsRepository) Update(ctx context.Context, reward *domain.Reward) (
 		reward.PointsRequired,
 		reward.AvailableQuantity,
 		reward.Quantity,
+		reward.MaxPerCustomer,
+		reward.LowStockThreshold,
+		reward.VoucherSource,
+		reward.VoucherValidityDays,
+		reward.MinPoints,
+		reward.CashPerPoint,
 		reward.IsActive,
 		reward.ID,
 	)
@@ -265,8 +299,9 @@ func (r *RewardsRepository) Delete(ctx context.Context, id uuid.UUID) error {
 func (r *RewardsRepository) GetByProgramID(ctx context.Context, programID uuid.UUID) ([]*domain.Reward, error) {
 	query := `
 		SELECT id, program_id, name, description, points_required,
-			   available_quantity, quantity, is_active,
-			   created_at, updated_at
+			   available_quantity, quantity, max_per_customer, low_stock_threshold,
+			   voucher_source, voucher_validity_days, min_points, cash_per_point,
+			   is_active, created_at, updated_at
 		FROM rewards
 		WHERE program_id = $1
 		ORDER BY points_required ASC
@@ -288,7 +323,8 @@ func (r *RewardsRepository) GetByProgramID(ctx context.Context, programID uuid.U
 	var rewards []*domain.Reward
 	for rows.Next() {
 		reward := &domain.Reward{}
-		var availableQuantity sql.NullInt32
+		var availableQuantity, maxPerCustomer, lowStockThreshold, voucherValidityDays, minPoints sql.NullInt32
+		var cashPerPoint sql.NullFloat64
 
 		err := rows.Scan(
 			&reward.ID,
@@ -298,6 +334,12 @@ func (r *RewardsRepository) GetByProgramID(ctx context.Context, programID uuid.U
 			&reward.PointsRequired,
 			&availableQuantity,
 			&reward.Quantity,
+			&maxPerCustomer,
+			&lowStockThreshold,
+			&reward.VoucherSource,
+			&voucherValidityDays,
+			&minPoints,
+			&cashPerPoint,
 			&reward.IsActive,
 			&reward.CreatedAt,
 			&reward.UpdatedAt,
@@ -309,10 +351,12 @@ func (r *RewardsRepository) GetByProgramID(ctx context.Context, programID uuid.U
 			return nil, domain.NewSystemError("RewardsRepository.GetByProgramID", err, "failed to scan reward")
 		}
 
-		if availableQuantity.Valid {
-			q := int(availableQuantity.Int32)
-			reward.AvailableQuantity = &q
-		}
+		reward.AvailableQuantity = nullableInt(availableQuantity)
+		reward.MaxPerCustomer = nullableInt(maxPerCustomer)
+		reward.LowStockThreshold = nullableInt(lowStockThreshold)
+		reward.VoucherValidityDays = nullableInt(voucherValidityDays)
+		reward.MinPoints = nullableInt(minPoints)
+		reward.CashPerPoint = nullableFloat(cashPerPoint)
 
 		rewards = append(rewards, reward)
 	}
@@ -326,3 +370,60 @@ func (r *RewardsRepository) GetByProgramID(ctx context.Context, programID uuid.U
 
 	return rewards, nil
 }
+
+// ReserveStock always updates the reward, even one that is not limited, so
+// redemptions of the same reward queue up behind each other until their unit
+// of work ends.
+func (r *RewardsRepository) ReserveStock(ctx context.Context, id uuid.UUID, quantity int) (bool, *int, error) {
+	query := `
+		UPDATE rewards
+		SET available_quantity = available_quantity - $2
+		WHERE id = $1
+		  AND (available_quantity IS NULL OR available_quantity >= $2)
+		RETURNING available_quantity
+	`
+	var available sql.NullInt32
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id, quantity).Scan(&available)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("reward_id", id.String()).
+			Msg("Failed to reserve reward stock")
+		return false, nil, domain.NewSystemError("RewardsRepository.ReserveStock", err, "failed to reserve reward stock")
+	}
+	return true, nullableInt(available), nil
+}
+
+func (r *RewardsRepository) ReleaseStock(ctx context.Context, id uuid.UUID, quantity int) error {
+	query := `
+		UPDATE rewards
+		SET available_quantity = available_quantity + $2
+		WHERE id = $1 AND available_quantity IS NOT NULL
+	`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, quantity); err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("reward_id", id.String()).
+			Msg("Failed to release reward stock")
+		return domain.NewSystemError("RewardsRepository.ReleaseStock", err, "failed to release reward stock")
+	}
+	return nil
+}
+
+func nullableInt(n sql.NullInt32) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int32)
+	return &v
+}
+
+func nullableFloat(n sql.NullFloat64) *float64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Float64
+}
@@ -0,0 +1,407 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"go-playground/pkg/logging"
+	"go-playground/server/config"
+	"go-playground/server/domain"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// RuleBacktestRepository keeps backtest jobs on the primary and reads the
+// transaction history they replay from the read replica.
+type RuleBacktestRepository struct {
+	db     config.DbConnection
+	logger zerolog.Logger
+}
+
+func NewRuleBacktestRepository(db config.DbConnection) *RuleBacktestRepository {
+	return &RuleBacktestRepository{db: db,
+		logger: logging.GetLogger(),
+	}
+}
+
+func (r *RuleBacktestRepository) Create(ctx context.Context, backtest *domain.RuleBacktest) error {
+	rules, err := json.Marshal(backtest.Rules)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to marshal backtest rules")
+		return domain.NewSystemError("RuleBacktestRepository.Create", err, "failed to marshal backtest rules")
+	}
+
+	query := `
+		INSERT INTO rule_backtests (
+			program_id, rule_set_id, status, from_date, to_date, rules, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		RETURNING id, created_at
+	`
+	err = r.db.RW.QueryRowContext(
+		ctx,
+		query,
+		backtest.ProgramID,
+		backtest.RuleSetID,
+		backtest.Status,
+		backtest.From,
+		backtest.To,
+		rules,
+	).Scan(&backtest.ID, &backtest.CreatedAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to create backtest")
+		return domain.NewSystemError("RuleBacktestRepository.Create", err, "failed to create backtest")
+	}
+	return nil
+}
+
+// GetByID reads from the primary, the job updates its row as it goes.
+func (r *RuleBacktestRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.RuleBacktest, error) {
+	query := `
+		SELECT id, program_id, rule_set_id, status, from_date, to_date, rules,
+			   transactions_processed, customers_count, total_points, actual_points,
+			   COALESCE(error_message, ''), created_at, started_at, completed_at
+		FROM rule_backtests
+		WHERE id = $1
+	`
+	backtest := &domain.RuleBacktest{}
+	var rules []byte
+	err := r.db.RW.QueryRowContext(ctx, query, id).Scan(
+		&backtest.ID,
+		&backtest.ProgramID,
+		&backtest.RuleSetID,
+		&backtest.Status,
+		&backtest.From,
+		&backtest.To,
+		&rules,
+		&backtest.TransactionsProcessed,
+		&backtest.CustomersCount,
+		&backtest.TotalPoints,
+		&backtest.ActualPoints,
+		&backtest.Error,
+		&backtest.CreatedAt,
+		&backtest.StartedAt,
+		&backtest.CompletedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get backtest")
+		return nil, domain.NewSystemError("RuleBacktestRepository.GetByID", err, "failed to get backtest")
+	}
+
+	if err := json.Unmarshal(rules, &backtest.Rules); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to unmarshal backtest rules")
+		return nil, domain.NewSystemError("RuleBacktestRepository.GetByID", err, "failed to unmarshal backtest rules")
+	}
+	backtest.PointsDelta = backtest.TotalPoints - backtest.ActualPoints
+
+	return backtest, nil
+}
+
+func (r *RuleBacktestRepository) MarkRunning(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE rule_backtests SET status = $1, started_at = CURRENT_TIMESTAMP WHERE id = $2`
+	if _, err := r.db.RW.ExecContext(ctx, query, domain.BacktestRunning, id); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to mark backtest running")
+		return domain.NewSystemError("RuleBacktestRepository.MarkRunning", err, "failed to mark backtest running")
+	}
+	return nil
+}
+
+func (r *RuleBacktestRepository) UpdateProgress(ctx context.Context, id uuid.UUID, transactionsProcessed int64) error {
+	query := `UPDATE rule_backtests SET transactions_processed = $1 WHERE id = $2`
+	if _, err := r.db.RW.ExecContext(ctx, query, transactionsProcessed, id); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to update backtest progress")
+		return domain.NewSystemError("RuleBacktestRepository.UpdateProgress", err, "failed to update backtest progress")
+	}
+	return nil
+}
+
+// Complete stores the per customer results and the totals of a backtest in
+// one database transaction.
+func (r *RuleBacktestRepository) Complete(ctx context.Context, backtest *domain.RuleBacktest, customers []*domain.RuleBacktestCustomer) error {
+	tx, err := r.db.RW.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to begin transaction")
+		return domain.NewSystemError("RuleBacktestRepository.Complete", err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("rule_backtest_customers",
+		"backtest_id", "merchant_customers_id", "transaction_count", "points", "actual_points"))
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to prepare backtest customers copy")
+		return domain.NewSystemError("RuleBacktestRepository.Complete", err, "failed to prepare backtest customers copy")
+	}
+	for _, customer := range customers {
+		if _, err := stmt.ExecContext(
+			ctx,
+			backtest.ID,
+			customer.MerchantCustomersID,
+			customer.TransactionCount,
+			customer.Points,
+			customer.ActualPoints,
+		); err != nil {
+			stmt.Close()
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to copy backtest customer")
+			return domain.NewSystemError("RuleBacktestRepository.Complete", err, "failed to copy backtest customer")
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to flush backtest customers")
+		return domain.NewSystemError("RuleBacktestRepository.Complete", err, "failed to flush backtest customers")
+	}
+	if err := stmt.Close(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to close backtest customers copy")
+		return domain.NewSystemError("RuleBacktestRepository.Complete", err, "failed to close backtest customers copy")
+	}
+
+	query := `
+		UPDATE rule_backtests
+		SET status = $1, transactions_processed = $2, customers_count = $3,
+			total_points = $4, actual_points = $5, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+		RETURNING completed_at
+	`
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		domain.BacktestCompleted,
+		backtest.TransactionsProcessed,
+		backtest.CustomersCount,
+		backtest.TotalPoints,
+		backtest.ActualPoints,
+		backtest.ID,
+	).Scan(&backtest.CompletedAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to complete backtest")
+		return domain.NewSystemError("RuleBacktestRepository.Complete", err, "failed to complete backtest")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to commit backtest results")
+		return domain.NewSystemError("RuleBacktestRepository.Complete", err, "failed to commit backtest results")
+	}
+
+	backtest.Status = domain.BacktestCompleted
+	return nil
+}
+
+func (r *RuleBacktestRepository) Fail(ctx context.Context, id uuid.UUID, reason string) error {
+	query := `
+		UPDATE rule_backtests
+		SET status = $1, error_message = $2, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`
+	if _, err := r.db.RW.ExecContext(ctx, query, domain.BacktestFailed, reason, id); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to mark backtest failed")
+		return domain.NewSystemError("RuleBacktestRepository.Fail", err, "failed to mark backtest failed")
+	}
+	return nil
+}
+
+// GetCustomers pages through a backtest's customers, the ones whose points
+// change the most first.
+func (r *RuleBacktestRepository) GetCustomers(ctx context.Context, id uuid.UUID, offset, limit int) ([]*domain.RuleBacktestCustomer, int64, error) {
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM rule_backtest_customers WHERE backtest_id = $1`
+	if err := r.db.RR.QueryRowContext(ctx, countQuery, id).Scan(&total); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to count backtest customers")
+		return nil, 0, domain.NewSystemError("RuleBacktestRepository.GetCustomers", err, "failed to get total count")
+	}
+
+	query := `
+		SELECT backtest_id, merchant_customers_id, transaction_count, points, actual_points
+		FROM rule_backtest_customers
+		WHERE backtest_id = $1
+		ORDER BY ABS(points - actual_points) DESC, merchant_customers_id
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.RR.QueryContext(ctx, query, id, limit, offset)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query backtest customers")
+		return nil, 0, domain.NewSystemError("RuleBacktestRepository.GetCustomers", err, "failed to query backtest customers")
+	}
+	defer rows.Close()
+
+	customers := []*domain.RuleBacktestCustomer{}
+	for rows.Next() {
+		customer := &domain.RuleBacktestCustomer{}
+		if err := rows.Scan(
+			&customer.BacktestID,
+			&customer.MerchantCustomersID,
+			&customer.TransactionCount,
+			&customer.Points,
+			&customer.ActualPoints,
+		); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan backtest customer")
+			return nil, 0, domain.NewSystemError("RuleBacktestRepository.GetCustomers", err, "failed to scan backtest customer")
+		}
+		customer.PointsDelta = customer.Points - customer.ActualPoints
+		customers = append(customers, customer)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate backtest customers")
+		return nil, 0, domain.NewSystemError("RuleBacktestRepository.GetCustomers", err, "error iterating backtest customers")
+	}
+
+	return customers, total, nil
+}
+
+func (r *RuleBacktestRepository) GetTransactions(ctx context.Context, programID uuid.UUID, from, to, afterDate time.Time, afterID uuid.UUID, limit int) ([]*domain.BacktestTransaction, error) {
+	query := `
+		SELECT t.transaction_id, t.merchant_id, t.merchant_customers_id, t.program_id,
+			   t.transaction_type, t.transaction_amount, t.transaction_date,
+			   t.transaction_category, t.branch_id, t.status, t.created_at,
+			   mc.created_at, mc.date_of_birth,
+			   COALESCE((SELECT SUM(pl.points_earned) FROM points_ledger pl WHERE pl.transaction_id = t.transaction_id), 0)
+		FROM transactions t
+		JOIN merchant_customers mc ON mc.id = t.merchant_customers_id
+		WHERE t.program_id = $1
+		AND t.transaction_date >= $2
+		AND t.transaction_date < $3
+		AND (t.transaction_date, t.transaction_id) > ($4, $5)
+		ORDER BY t.transaction_date, t.transaction_id
+		LIMIT $6
+	`
+	rows, err := r.db.RR.QueryContext(ctx, query, programID, from, to, afterDate, afterID, limit)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query backtest transactions")
+		return nil, domain.NewSystemError("RuleBacktestRepository.GetTransactions", err, "failed to query transactions")
+	}
+	defer rows.Close()
+
+	var transactions []*domain.BacktestTransaction
+	for rows.Next() {
+		tx := &domain.BacktestTransaction{}
+		var dateOfBirth sql.NullTime
+		if err := rows.Scan(
+			&tx.TransactionID,
+			&tx.MerchantID,
+			&tx.MerchantCustomersID,
+			&tx.ProgramID,
+			&tx.TransactionType,
+			&tx.TransactionAmount,
+			&tx.TransactionDate,
+			&tx.Category,
+			&tx.BranchID,
+			&tx.Status,
+			&tx.CreatedAt,
+			&tx.MemberSince,
+			&dateOfBirth,
+			&tx.ActualPoints,
+		); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan backtest transaction")
+			return nil, domain.NewSystemError("RuleBacktestRepository.GetTransactions", err, "failed to scan transaction")
+		}
+		if dateOfBirth.Valid {
+			tx.DateOfBirth = &dateOfBirth.Time
+		}
+		transactions = append(transactions, tx)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate backtest transactions")
+		return nil, domain.NewSystemError("RuleBacktestRepository.GetTransactions", err, "error iterating transactions")
+	}
+
+	return transactions, nil
+}
+
+func (r *RuleBacktestRepository) CountCompletedBefore(ctx context.Context, programID uuid.UUID, customerIDs []uuid.UUID, before time.Time) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int, len(customerIDs))
+	if len(customerIDs) == 0 {
+		return counts, nil
+	}
+
+	ids := make([]string, len(customerIDs))
+	for i, id := range customerIDs {
+		ids[i] = id.String()
+	}
+
+	query := `
+		SELECT merchant_customers_id, COUNT(*)
+		FROM transactions
+		WHERE program_id = $1
+		AND merchant_customers_id = ANY($2::uuid[])
+		AND status = 'completed'
+		AND transaction_date < $3
+		GROUP BY merchant_customers_id
+	`
+	rows, err := r.db.RR.QueryContext(ctx, query, programID, pq.Array(ids), before)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to count completed transactions")
+		return nil, domain.NewSystemError("RuleBacktestRepository.CountCompletedBefore", err, "failed to count completed transactions")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var customerID uuid.UUID
+		var count int
+		if err := rows.Scan(&customerID, &count); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan completed transaction count")
+			return nil, domain.NewSystemError("RuleBacktestRepository.CountCompletedBefore", err, "failed to scan completed transaction count")
+		}
+		counts[customerID] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate completed transaction counts")
+		return nil, domain.NewSystemError("RuleBacktestRepository.CountCompletedBefore", err, "error iterating completed transaction counts")
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,286 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"go-playground/pkg/logging"
+	"go-playground/server/config"
+	"go-playground/server/domain"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// TransactionImportRepository keeps import jobs and their row reports on the
+// primary, the job updates them as it goes.
+type TransactionImportRepository struct {
+	db     config.DbConnection
+	logger zerolog.Logger
+}
+
+func NewTransactionImportRepository(db config.DbConnection) *TransactionImportRepository {
+	return &TransactionImportRepository{db: db,
+		logger: logging.GetLogger(),
+	}
+}
+
+func (r *TransactionImportRepository) Create(ctx context.Context, transactionImport *domain.TransactionImport) (bool, error) {
+	query := `
+		INSERT INTO transaction_imports (merchant_id, format, file_hash, status, total_rows)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (merchant_id, file_hash) DO NOTHING
+		RETURNING id, created_at, updated_at
+	`
+	err := r.db.RW.QueryRowContext(ctx, query,
+		transactionImport.MerchantID,
+		transactionImport.Format,
+		transactionImport.FileHash,
+		transactionImport.Status,
+		transactionImport.TotalRows,
+	).Scan(&transactionImport.ID, &transactionImport.CreatedAt, &transactionImport.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("merchant_id", transactionImport.MerchantID.String()).
+			Msg("Failed to create transaction import")
+		return false, domain.NewSystemError("TransactionImportRepository.Create", err, "failed to create transaction import")
+	}
+	return true, nil
+}
+
+const transactionImportColumns = `
+	id, merchant_id, format, file_hash, status, total_rows, processed_rows,
+	created_rows, duplicate_rows, failed_rows, COALESCE(error_message, ''),
+	created_at, updated_at, started_at, completed_at`
+
+func scanTransactionImport(row interface{ Scan(...interface{}) error }) (*domain.TransactionImport, error) {
+	transactionImport := &domain.TransactionImport{}
+	err := row.Scan(
+		&transactionImport.ID,
+		&transactionImport.MerchantID,
+		&transactionImport.Format,
+		&transactionImport.FileHash,
+		&transactionImport.Status,
+		&transactionImport.TotalRows,
+		&transactionImport.ProcessedRows,
+		&transactionImport.CreatedRows,
+		&transactionImport.DuplicateRows,
+		&transactionImport.FailedRows,
+		&transactionImport.Error,
+		&transactionImport.CreatedAt,
+		&transactionImport.UpdatedAt,
+		&transactionImport.StartedAt,
+		&transactionImport.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return transactionImport, nil
+}
+
+func (r *TransactionImportRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.TransactionImport, error) {
+	query := `SELECT ` + transactionImportColumns + ` FROM transaction_imports WHERE id = $1`
+	transactionImport, err := scanTransactionImport(r.db.RW.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("import_id", id.String()).
+			Msg("Failed to get transaction import")
+		return nil, domain.NewSystemError("TransactionImportRepository.GetByID", err, "failed to get transaction import")
+	}
+	return transactionImport, nil
+}
+
+func (r *TransactionImportRepository) GetByFileHash(ctx context.Context, merchantID uuid.UUID, fileHash string) (*domain.TransactionImport, error) {
+	query := `SELECT ` + transactionImportColumns + ` FROM transaction_imports WHERE merchant_id = $1 AND file_hash = $2`
+	transactionImport, err := scanTransactionImport(r.db.RW.QueryRowContext(ctx, query, merchantID, fileHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("merchant_id", merchantID.String()).
+			Msg("Failed to get transaction import by file hash")
+		return nil, domain.NewSystemError("TransactionImportRepository.GetByFileHash", err, "failed to get transaction import")
+	}
+	return transactionImport, nil
+}
+
+func (r *TransactionImportRepository) Claim(ctx context.Context, id uuid.UUID, staleBefore time.Time) (*domain.TransactionImport, error) {
+	query := `
+		UPDATE transaction_imports
+		SET status = 'running', error_message = NULL, updated_at = CURRENT_TIMESTAMP,
+			started_at = COALESCE(started_at, CURRENT_TIMESTAMP)
+		WHERE id = $1
+		  AND (status IN ('queued', 'failed') OR (status = 'running' AND updated_at < $2))
+		RETURNING ` + transactionImportColumns
+	transactionImport, err := scanTransactionImport(r.db.RW.QueryRowContext(ctx, query, id, staleBefore))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("import_id", id.String()).
+			Msg("Failed to claim transaction import")
+		return nil, domain.NewSystemError("TransactionImportRepository.Claim", err, "failed to claim transaction import")
+	}
+	return transactionImport, nil
+}
+
+func (r *TransactionImportRepository) SaveRows(ctx context.Context, importID uuid.UUID, rows []*domain.TransactionImportRow) error {
+	var created, duplicate, failed int
+	for _, row := range rows {
+		switch row.Status {
+		case domain.ImportRowCreated:
+			created++
+		case domain.ImportRowDuplicate:
+			duplicate++
+		default:
+			failed++
+		}
+	}
+
+	return inTx(ctx, r.db.RW, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("transaction_import_rows",
+			"import_id", "row_number", "status", "transaction_id", "error_message"))
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to prepare import rows copy")
+			return domain.NewSystemError("TransactionImportRepository.SaveRows", err, "failed to prepare import rows copy")
+		}
+		for _, row := range rows {
+			var reason *string
+			if row.Error != "" {
+				reason = &row.Error
+			}
+			if _, err := stmt.ExecContext(ctx, importID, row.RowNumber, row.Status, row.TransactionID, reason); err != nil {
+				stmt.Close()
+				r.logger.Error().
+					Err(err).
+					Int("row_number", row.RowNumber).
+					Msg("Failed to copy import row")
+				return domain.NewSystemError("TransactionImportRepository.SaveRows", err, "failed to copy import row")
+			}
+		}
+		if _, err := stmt.ExecContext(ctx); err != nil {
+			stmt.Close()
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to flush import rows")
+			return domain.NewSystemError("TransactionImportRepository.SaveRows", err, "failed to flush import rows")
+		}
+		if err := stmt.Close(); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to close import rows copy")
+			return domain.NewSystemError("TransactionImportRepository.SaveRows", err, "failed to close import rows copy")
+		}
+
+		query := `
+			UPDATE transaction_imports
+			SET processed_rows = processed_rows + $1, created_rows = created_rows + $2,
+				duplicate_rows = duplicate_rows + $3, failed_rows = failed_rows + $4,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $5
+		`
+		if _, err := tx.ExecContext(ctx, query, len(rows), created, duplicate, failed, importID); err != nil {
+			r.logger.Error().
+				Err(err).
+				Str("import_id", importID.String()).
+				Msg("Failed to update import progress")
+			return domain.NewSystemError("TransactionImportRepository.SaveRows", err, "failed to update import progress")
+		}
+		return nil
+	})
+}
+
+func (r *TransactionImportRepository) Complete(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE transaction_imports
+		SET status = 'completed', updated_at = CURRENT_TIMESTAMP, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	if _, err := r.db.RW.ExecContext(ctx, query, id); err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("import_id", id.String()).
+			Msg("Failed to complete transaction import")
+		return domain.NewSystemError("TransactionImportRepository.Complete", err, "failed to complete transaction import")
+	}
+	return nil
+}
+
+func (r *TransactionImportRepository) Fail(ctx context.Context, id uuid.UUID, reason string) error {
+	query := `
+		UPDATE transaction_imports
+		SET status = 'failed', error_message = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`
+	if _, err := r.db.RW.ExecContext(ctx, query, reason, id); err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("import_id", id.String()).
+			Msg("Failed to fail transaction import")
+		return domain.NewSystemError("TransactionImportRepository.Fail", err, "failed to mark transaction import failed")
+	}
+	return nil
+}
+
+func (r *TransactionImportRepository) GetRows(ctx context.Context, importID uuid.UUID, status string, offset, limit int) ([]*domain.TransactionImportRow, int64, error) {
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM transaction_import_rows WHERE import_id = $1 AND ($2 = '' OR status = $2)`
+	if err := r.db.RW.QueryRowContext(ctx, countQuery, importID, status).Scan(&total); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to count import rows")
+		return nil, 0, domain.NewSystemError("TransactionImportRepository.GetRows", err, "failed to get total count")
+	}
+
+	query := `
+		SELECT import_id, row_number, status, transaction_id, COALESCE(error_message, '')
+		FROM transaction_import_rows
+		WHERE import_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY row_number
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := r.db.RW.QueryContext(ctx, query, importID, status, limit, offset)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query import rows")
+		return nil, 0, domain.NewSystemError("TransactionImportRepository.GetRows", err, "failed to query import rows")
+	}
+	defer rows.Close()
+
+	importRows := []*domain.TransactionImportRow{}
+	for rows.Next() {
+		row := &domain.TransactionImportRow{}
+		if err := rows.Scan(&row.ImportID, &row.RowNumber, &row.Status, &row.TransactionID, &row.Error); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan import row")
+			return nil, 0, domain.NewSystemError("TransactionImportRepository.GetRows", err, "failed to scan import row")
+		}
+		importRows = append(importRows, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate import rows")
+		return nil, 0, domain.NewSystemError("TransactionImportRepository.GetRows", err, "error iterating import rows")
+	}
+
+	return importRows, total, nil
+}
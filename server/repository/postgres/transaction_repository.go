@@ -27,12 +27,12 @@ func (r *TransactionRepository) Create(ctx context.Context, tx *domain.Transacti
 		INSERT INTO transactions (
 			merchant_id, merchant_customers_id, program_id,
 			transaction_type, transaction_amount, transaction_date,
-			branch_id, status, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP)
+			transaction_category, branch_id, status, source_message_id,
+			original_transaction_id, cash_amount, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, CURRENT_TIMESTAMP)
 		RETURNING transaction_id, transaction_date, created_at
 	`
-	createdTx := &domain.Transaction{}
-	err := r.db.RW.QueryRowContext(
+	err := conn(ctx, r.db.RW).QueryRowContext(
 		ctx,
 		query,
 		tx.MerchantID,
@@ -41,12 +41,16 @@ func (r *TransactionRepository) Create(ctx context.Context, tx *domain.Transacti
 		tx.TransactionType,
 		tx.TransactionAmount,
 		tx.TransactionDate,
+		tx.Category,
 		tx.BranchID,
 		tx.Status,
+		tx.SourceMessageID,
+		tx.OriginalTransactionID,
+		tx.CashAmount,
 	).Scan(
-		&createdTx.TransactionID,
-		&createdTx.TransactionDate,
-		&createdTx.CreatedAt,
+		&tx.TransactionID,
+		&tx.TransactionDate,
+		&tx.CreatedAt,
 	)
 	if err != nil {
 		if isPgUniqueViolation(err) {
@@ -61,14 +65,14 @@ func (r *TransactionRepository) Create(ctx context.Context, tx *domain.Transacti
 		return nil, domain.NewSystemError("TransactionRepository.Create", err, "failed to create transaction")
 	}
 
-	return createdTx, nil
+	return tx, nil
 }
 
 func (r *TransactionRepository) GetByID(ctx context.Context, transactionID uuid.UUID) (*domain.Transaction, error) {
 	query := `
 		SELECT transaction_id, merchant_id, merchant_customers_id, program_id,
 			   transaction_type, transaction_amount, transaction_date,
-			   branch_id, status, created_at
+			   transaction_category, branch_id, status, original_transaction_id, cash_amount, created_at
 		FROM transactions
 		WHERE transaction_id = $1
 	`
@@ -81,8 +85,11 @@ func (r *TransactionRepository) GetByID(ctx context.Context, transactionID uuid.
 		&tx.TransactionType,
 		&tx.TransactionAmount,
 		&tx.TransactionDate,
+		&tx.Category,
 		&tx.BranchID,
 		&tx.Status,
+		&tx.OriginalTransactionID,
+		&tx.CashAmount,
 		&tx.CreatedAt,
 	)
 	if err != nil {
@@ -133,7 +140,7 @@ func (r *TransactionRepository) GetByCustomerIDWithPagination(ctx context.Contex
 	query := `
 		SELECT transaction_id, merchant_id, merchant_customers_id, program_id,
 			   transaction_type, transaction_amount, transaction_date,
-			   branch_id, status, created_at
+			   transaction_category, branch_id, status, original_transaction_id, cash_amount, created_at
 		FROM transactions
 		WHERE merchant_customers_id = $1
 		ORDER BY transaction_date DESC
@@ -172,8 +179,11 @@ func (r *TransactionRepository) GetByCustomerIDWithPagination(ctx context.Contex
 			&tx.TransactionType,
 			&tx.TransactionAmount,
 			&tx.TransactionDate,
+			&tx.Category,
 			&tx.BranchID,
 			&tx.Status,
+			&tx.OriginalTransactionID,
+			&tx.CashAmount,
 			&tx.CreatedAt,
 		)
 		if err != nil {
@@ -217,7 +227,7 @@ func (r *TransactionRepository) GetByMerchantIDWithPagination(ctx context.Contex
 	query := `
 		SELECT transaction_id, merchant_id, merchant_customers_id, program_id,
 			   transaction_type, transaction_amount, transaction_date,
-			   branch_id, status, created_at
+			   transaction_category, branch_id, status, original_transaction_id, cash_amount, created_at
 		FROM transactions
 		WHERE merchant_id = $1
 		ORDER BY transaction_date DESC
@@ -256,8 +266,11 @@ func (r *TransactionRepository) GetByMerchantIDWithPagination(ctx context.Contex
 			&tx.TransactionType,
 			&tx.TransactionAmount,
 			&tx.TransactionDate,
+			&tx.Category,
 			&tx.BranchID,
 			&tx.Status,
+			&tx.OriginalTransactionID,
+			&tx.CashAmount,
 			&tx.CreatedAt,
 		)
 		if err != nil {
@@ -305,7 +318,7 @@ func (r *TransactionRepository) GetByUserIDWithPagination(ctx context.Context, u
 	query := `
 		SELECT t.transaction_id, t.merchant_id, t.merchant_customers_id, t.program_id,
 			   t.transaction_type, t.transaction_amount, t.transaction_date,
-			   t.branch_id, t.status, t.created_at
+			   t.transaction_category, t.branch_id, t.status, t.original_transaction_id, t.cash_amount, t.created_at
 		FROM transactions t
 		INNER JOIN merchants m ON t.merchant_id = m.id
 		WHERE m.user_id = $1
@@ -345,8 +358,11 @@ func (r *TransactionRepository) GetByUserIDWithPagination(ctx context.Context, u
 			&tx.TransactionType,
 			&tx.TransactionAmount,
 			&tx.TransactionDate,
+			&tx.Category,
 			&tx.BranchID,
 			&tx.Status,
+			&tx.OriginalTransactionID,
+			&tx.CashAmount,
 			&tx.CreatedAt,
 		)
 		if err != nil {
@@ -368,10 +384,96 @@ func (r *TransactionRepository) GetByUserIDWithPagination(ctx context.Context, u
 	return transactions, total, nil
 }
 
+// CountByCustomerAndProgram counts a customer's transactions in a program with
+// the given status. It reads from the primary, the count is cached until the
+// customer's next transaction and a lagging replica would leave it behind. In a
+// unit of work it counts the transactions it created too.
+func (r *TransactionRepository) CountByCustomerAndProgram(ctx context.Context, merchantCustomersID, programID uuid.UUID, status string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM transactions
+		WHERE merchant_customers_id = $1
+		AND program_id = $2
+		AND status = $3
+	`
+	var count int
+	err := conn(ctx, r.db.RW).QueryRowContext(ctx, query, merchantCustomersID, programID, status).Scan(&count)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to count transactions")
+		return 0, domain.NewSystemError("TransactionRepository.CountByCustomerAndProgram", err, "failed to count transactions")
+	}
+	return count, nil
+}
+
+// LockByID reads a transaction from the primary and locks its row until the
+// unit of work running in ctx commits. Outside of one the lock is released
+// straight away.
+func (r *TransactionRepository) LockByID(ctx context.Context, transactionID uuid.UUID) (*domain.Transaction, error) {
+	query := `
+		SELECT transaction_id, merchant_id, merchant_customers_id, program_id,
+			   transaction_type, transaction_amount, transaction_date,
+			   transaction_category, branch_id, status, original_transaction_id, cash_amount, created_at
+		FROM transactions
+		WHERE transaction_id = $1
+		FOR UPDATE
+	`
+	tx := &domain.Transaction{}
+	err := conn(ctx, r.db.RW).QueryRowContext(ctx, query, transactionID).Scan(
+		&tx.TransactionID,
+		&tx.MerchantID,
+		&tx.MerchantCustomersID,
+		&tx.ProgramID,
+		&tx.TransactionType,
+		&tx.TransactionAmount,
+		&tx.TransactionDate,
+		&tx.Category,
+		&tx.BranchID,
+		&tx.Status,
+		&tx.OriginalTransactionID,
+		&tx.CashAmount,
+		&tx.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to lock transaction")
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to lock transaction")
+		return nil, domain.NewSystemError("TransactionRepository.LockByID", err, "failed to lock transaction")
+	}
+	return tx, nil
+}
+
+// SumRefunds adds up the amounts of a transaction's refunds that are not failed or cancelled
+func (r *TransactionRepository) SumRefunds(ctx context.Context, originalID uuid.UUID) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(transaction_amount), 0)
+		FROM transactions
+		WHERE original_transaction_id = $1
+		AND transaction_type = 'refund'
+		AND status NOT IN ('failed', 'cancelled')
+	`
+	var total float64
+	err := conn(ctx, r.db.RW).QueryRowContext(ctx, query, originalID).Scan(&total)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to sum refunds")
+		return 0, domain.NewSystemError("TransactionRepository.SumRefunds", err, "failed to sum refunds")
+	}
+	return total, nil
+}
+
 // Notes: Table Transactions should be can not be updated/deleted.
 func (r *TransactionRepository) UpdateStatus(ctx context.Context, transactionID uuid.UUID, status string) error {
 	query := `UPDATE transactions SET status = $1 WHERE transaction_id = $2`
-	result, err := r.db.RW.ExecContext(ctx, query, status, transactionID)
+	result, err := conn(ctx, r.db.RW).ExecContext(ctx, query, status, transactionID)
 	if err != nil {
 		r.logger.Error().
 			Err(err).
@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+
+	"github.com/rs/zerolog"
+)
+
+// txKey is the context key of the unit of work running in a context
+type txKey struct{}
+
+// unitOfWork is a transaction and what to run once it commits
+type unitOfWork struct {
+	tx          *sql.Tx
+	afterCommit []func(ctx context.Context)
+}
+
+// dbtx is what *sql.DB and *sql.Tx have in common
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns the transaction of the unit of work running in ctx, or db
+// outside of one.
+func conn(ctx context.Context, db *sql.DB) dbtx {
+	if uow, ok := ctx.Value(txKey{}).(*unitOfWork); ok {
+		return uow.tx
+	}
+	return db
+}
+
+// inTx runs fn in the transaction of the unit of work running in ctx. Outside
+// of one it runs fn in a transaction of its own, committed when fn succeeds.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	if uow, ok := ctx.Value(txKey{}).(*unitOfWork); ok {
+		return fn(uow.tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.NewSystemError("inTx", err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.NewSystemError("inTx", err, "failed to commit transaction")
+	}
+	return nil
+}
+
+// TxManager hands out database transactions, either to pass explicitly to
+// the *Tx repository methods or as a unit of work the repositories join.
+type TxManager struct {
+	db     *sql.DB
+	logger zerolog.Logger
+}
+
+func NewTxManager(db *sql.DB) *TxManager {
+	return &TxManager{
+		db:     db,
+		logger: logging.GetLogger(),
+	}
+}
+
+func (m *TxManager) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		m.logger.Error().
+			Err(err).
+			Msg("Failed to begin transaction")
+		return nil, domain.NewSystemError("TxManager.BeginTx", err, "failed to begin transaction")
+	}
+	return tx, nil
+}
+
+func (m *TxManager) Commit(ctx context.Context, tx *sql.Tx) error {
+	return tx.Commit()
+}
+
+// WithinTx runs fn as one unit of work. A WithinTx nested in another joins
+// the outer unit of work, which alone commits.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*unitOfWork); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	uow := &unitOfWork{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, uow)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		m.logger.Error().
+			Err(err).
+			Msg("Failed to commit transaction")
+		return domain.NewSystemError("TxManager.WithinTx", err, "failed to commit transaction")
+	}
+
+	for _, fn := range uow.afterCommit {
+		fn(ctx)
+	}
+	return nil
+}
+
+// AfterCommit runs fn once the unit of work running in ctx commits, and never
+// if it rolls back. Outside of a unit of work fn runs right away.
+func (m *TxManager) AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	if uow, ok := ctx.Value(txKey{}).(*unitOfWork); ok {
+		uow.afterCommit = append(uow.afterCommit, fn)
+		return
+	}
+	fn(ctx)
+}
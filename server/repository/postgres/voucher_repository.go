@@ -0,0 +1,227 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"go-playground/pkg/logging"
+	"go-playground/server/config"
+	"go-playground/server/domain"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// VoucherRepository keeps redemptions' vouchers and the code pools of rewards.
+type VoucherRepository struct {
+	db     config.DbConnection
+	logger zerolog.Logger
+}
+
+func NewVoucherRepository(db config.DbConnection) *VoucherRepository {
+	return &VoucherRepository{db: db,
+		logger: logging.GetLogger(),
+	}
+}
+
+const voucherColumns = `
+	id, redemption_id, reward_id, merchant_id, code, source, status,
+	expires_at, used_at, used_branch_id, created_at`
+
+func scanVoucher(row rowScanner) (*domain.Voucher, error) {
+	voucher := &domain.Voucher{}
+	err := row.Scan(
+		&voucher.ID,
+		&voucher.RedemptionID,
+		&voucher.RewardID,
+		&voucher.MerchantID,
+		&voucher.Code,
+		&voucher.Source,
+		&voucher.Status,
+		&voucher.ExpiresAt,
+		&voucher.UsedAt,
+		&voucher.UsedBranchID,
+		&voucher.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return voucher, nil
+}
+
+// Create takes the merchant from the reward's program
+func (r *VoucherRepository) Create(ctx context.Context, voucher *domain.Voucher) (bool, error) {
+	query := `
+		INSERT INTO vouchers (redemption_id, reward_id, merchant_id, code, source, status, expires_at)
+		SELECT $1, rw.id, p.merchant_id, $3, $4, $5, $6
+		FROM rewards rw
+		JOIN programs p ON p.program_id = rw.program_id
+		WHERE rw.id = $2
+		ON CONFLICT (merchant_id, code) DO NOTHING
+		RETURNING ` + voucherColumns
+	created, err := scanVoucher(conn(ctx, r.db.RW).QueryRowContext(ctx, query,
+		voucher.RedemptionID,
+		voucher.RewardID,
+		voucher.Code,
+		voucher.Source,
+		voucher.Status,
+		voucher.ExpiresAt,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("redemption_id", voucher.RedemptionID.String()).
+			Msg("Failed to create voucher")
+		return false, domain.NewSystemError("VoucherRepository.Create", err, "failed to create voucher")
+	}
+	*voucher = *created
+	return true, nil
+}
+
+func (r *VoucherRepository) GetByRedemptionID(ctx context.Context, redemptionID uuid.UUID) (*domain.Voucher, error) {
+	query := `SELECT ` + voucherColumns + ` FROM vouchers WHERE redemption_id = $1`
+	voucher, err := scanVoucher(conn(ctx, r.db.RW).QueryRowContext(ctx, query, redemptionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("redemption_id", redemptionID.String()).
+			Msg("Failed to get voucher")
+		return nil, domain.NewSystemError("VoucherRepository.GetByRedemptionID", err, "failed to get voucher")
+	}
+	return voucher, nil
+}
+
+func (r *VoucherRepository) LockByCode(ctx context.Context, merchantID uuid.UUID, code string) (*domain.Voucher, error) {
+	query := `SELECT ` + voucherColumns + ` FROM vouchers WHERE merchant_id = $1 AND code = $2 FOR UPDATE`
+	voucher, err := scanVoucher(conn(ctx, r.db.RW).QueryRowContext(ctx, query, merchantID, code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("merchant_id", merchantID.String()).
+			Msg("Failed to lock voucher")
+		return nil, domain.NewSystemError("VoucherRepository.LockByCode", err, "failed to get voucher")
+	}
+	return voucher, nil
+}
+
+func (r *VoucherRepository) MarkUsed(ctx context.Context, voucher *domain.Voucher) error {
+	query := `
+		UPDATE vouchers
+		SET status = 'used', used_at = CURRENT_TIMESTAMP, used_branch_id = $1
+		WHERE id = $2
+		RETURNING status, used_at
+	`
+	err := conn(ctx, r.db.RW).QueryRowContext(ctx, query, voucher.UsedBranchID, voucher.ID).
+		Scan(&voucher.Status, &voucher.UsedAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("voucher_id", voucher.ID.String()).
+			Msg("Failed to mark voucher used")
+		return domain.NewSystemError("VoucherRepository.MarkUsed", err, "failed to mark voucher used")
+	}
+	return nil
+}
+
+// Void leaves used vouchers alone
+func (r *VoucherRepository) Void(ctx context.Context, redemptionID uuid.UUID) error {
+	query := `UPDATE vouchers SET status = 'void' WHERE redemption_id = $1 AND status = 'issued'`
+	if _, err := conn(ctx, r.db.RW).ExecContext(ctx, query, redemptionID); err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("redemption_id", redemptionID.String()).
+			Msg("Failed to void voucher")
+		return domain.NewSystemError("VoucherRepository.Void", err, "failed to void voucher")
+	}
+	return nil
+}
+
+// ClaimCode skips codes other redemptions are claiming, so redemptions of the
+// same reward do not wait on each other's code.
+func (r *VoucherRepository) ClaimCode(ctx context.Context, rewardID, redemptionID uuid.UUID) (*domain.RewardCode, error) {
+	query := `
+		UPDATE reward_codes
+		SET redemption_id = $2, assigned_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM reward_codes
+			WHERE reward_id = $1 AND redemption_id IS NULL
+			  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING code, expires_at
+	`
+	code := &domain.RewardCode{}
+	err := conn(ctx, r.db.RW).QueryRowContext(ctx, query, rewardID, redemptionID).Scan(&code.Code, &code.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("reward_id", rewardID.String()).
+			Msg("Failed to claim reward code")
+		return nil, domain.NewSystemError("VoucherRepository.ClaimCode", err, "failed to claim reward code")
+	}
+	return code, nil
+}
+
+// AddCodes also skips codes already issued as vouchers of the merchant
+func (r *VoucherRepository) AddCodes(ctx context.Context, rewardID uuid.UUID, codes []string, expiresAt *time.Time) (int, error) {
+	query := `
+		INSERT INTO reward_codes (reward_id, merchant_id, code, expires_at)
+		SELECT rw.id, p.merchant_id, c.code, $3
+		FROM rewards rw
+		JOIN programs p ON p.program_id = rw.program_id
+		CROSS JOIN unnest($2::text[]) AS c(code)
+		WHERE rw.id = $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM vouchers v WHERE v.merchant_id = p.merchant_id AND v.code = c.code
+		  )
+		ON CONFLICT (merchant_id, code) DO NOTHING
+	`
+	result, err := r.db.RW.ExecContext(ctx, query, rewardID, pq.Array(codes), expiresAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("reward_id", rewardID.String()).
+			Msg("Failed to add reward codes")
+		return 0, domain.NewSystemError("VoucherRepository.AddCodes", err, "failed to add reward codes")
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get affected rows")
+		return 0, domain.NewSystemError("VoucherRepository.AddCodes", err, "failed to get affected rows")
+	}
+	return int(added), nil
+}
+
+func (r *VoucherRepository) CountAvailableCodes(ctx context.Context, rewardID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM reward_codes
+		WHERE reward_id = $1 AND redemption_id IS NULL
+		  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+	`
+	var count int
+	if err := r.db.RW.QueryRowContext(ctx, query, rewardID).Scan(&count); err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("reward_id", rewardID.String()).
+			Msg("Failed to count reward codes")
+		return 0, domain.NewSystemError("VoucherRepository.CountAvailableCodes", err, "failed to count reward codes")
+	}
+	return count, nil
+}
@@ -0,0 +1,359 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"go-playground/pkg/logging"
+	"go-playground/server/config"
+	"go-playground/server/domain"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// WebhookRepository stores webhook subscriptions and their deliveries.
+// Deliveries are read from the primary, the dispatcher updates them as it goes.
+type WebhookRepository struct {
+	db     config.DbConnection
+	logger zerolog.Logger
+}
+
+func NewWebhookRepository(db config.DbConnection) *WebhookRepository {
+	return &WebhookRepository{db: db,
+		logger: logging.GetLogger(),
+	}
+}
+
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (merchant_id, url, event_types, secret, is_active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+	err := r.db.RW.QueryRowContext(ctx, query,
+		subscription.MerchantID,
+		subscription.URL,
+		pq.Array(subscription.EventTypes),
+		subscription.Secret,
+		subscription.IsActive,
+	).Scan(&subscription.ID, &subscription.CreatedAt, &subscription.UpdatedAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to create webhook subscription")
+		return domain.NewSystemError("WebhookRepository.CreateSubscription", err, "failed to create webhook subscription")
+	}
+	return nil
+}
+
+func (r *WebhookRepository) GetSubscription(ctx context.Context, id uuid.UUID) (*domain.WebhookSubscription, error) {
+	query := `
+		SELECT id, merchant_id, url, event_types, secret, is_active, created_at, updated_at
+		FROM webhook_subscriptions
+		WHERE id = $1
+	`
+	subscription, err := scanWebhookSubscription(r.db.RR.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get webhook subscription")
+		return nil, domain.NewSystemError("WebhookRepository.GetSubscription", err, "failed to get webhook subscription")
+	}
+	return subscription, nil
+}
+
+func (r *WebhookRepository) GetSubscriptionsByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]*domain.WebhookSubscription, error) {
+	query := `
+		SELECT id, merchant_id, url, event_types, secret, is_active, created_at, updated_at
+		FROM webhook_subscriptions
+		WHERE merchant_id = $1
+		ORDER BY created_at
+	`
+	return r.querySubscriptions(ctx, "WebhookRepository.GetSubscriptionsByMerchantID", query, merchantID)
+}
+
+func (r *WebhookRepository) GetActiveSubscriptions(ctx context.Context, merchantID uuid.UUID, eventType string) ([]*domain.WebhookSubscription, error) {
+	query := `
+		SELECT id, merchant_id, url, event_types, secret, is_active, created_at, updated_at
+		FROM webhook_subscriptions
+		WHERE merchant_id = $1 AND is_active AND $2 = ANY(event_types)
+		ORDER BY created_at
+	`
+	return r.querySubscriptions(ctx, "WebhookRepository.GetActiveSubscriptions", query, merchantID, eventType)
+}
+
+func (r *WebhookRepository) querySubscriptions(ctx context.Context, op, query string, args ...interface{}) ([]*domain.WebhookSubscription, error) {
+	rows, err := r.db.RR.QueryContext(ctx, query, args...)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query webhook subscriptions")
+		return nil, domain.NewSystemError(op, err, "failed to query webhook subscriptions")
+	}
+	defer rows.Close()
+
+	subscriptions := []*domain.WebhookSubscription{}
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan webhook subscription")
+			return nil, domain.NewSystemError(op, err, "failed to scan webhook subscription")
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate webhook subscriptions")
+		return nil, domain.NewSystemError(op, err, "error iterating webhook subscriptions")
+	}
+	return subscriptions, nil
+}
+
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.RW.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to delete webhook subscription")
+		return domain.NewSystemError("WebhookRepository.DeleteSubscription", err, "failed to delete webhook subscription")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get affected rows")
+		return domain.NewSystemError("WebhookRepository.DeleteSubscription", err, "failed to get affected rows")
+	}
+	if affected == 0 {
+		return domain.NewResourceNotFoundError("webhook subscription", id.String(), "webhook subscription not found")
+	}
+	return nil
+}
+
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (bool, error) {
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, replay_of)
+		VALUES ($1, $2, $3, $4::jsonb, $5, $6)
+		ON CONFLICT (subscription_id, event_id) WHERE replay_of IS NULL DO NOTHING
+		RETURNING id, next_attempt_at, created_at, updated_at
+	`
+	err := conn(ctx, r.db.RW).QueryRowContext(ctx, query,
+		delivery.SubscriptionID,
+		delivery.EventID,
+		delivery.EventType,
+		[]byte(delivery.Payload),
+		delivery.Status,
+		delivery.ReplayOf,
+	).Scan(&delivery.ID, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Str("event_id", delivery.EventID.String()).
+			Msg("Failed to create webhook delivery")
+		return false, domain.NewSystemError("WebhookRepository.CreateDelivery", err, "failed to create webhook delivery")
+	}
+	return true, nil
+}
+
+const webhookDeliveryColumns = `
+	d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+	d.next_attempt_at, d.last_status_code, d.last_error, d.replay_of, d.delivered_at,
+	d.created_at, d.updated_at`
+
+func (r *WebhookRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries d WHERE d.id = $1`
+	delivery, err := scanWebhookDelivery(r.db.RW.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to get webhook delivery")
+		return nil, domain.NewSystemError("WebhookRepository.GetDelivery", err, "failed to get webhook delivery")
+	}
+	return delivery, nil
+}
+
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, offset, limit int) ([]*domain.WebhookDelivery, int64, error) {
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM webhook_deliveries WHERE subscription_id = $1 AND ($2 = '' OR status = $2)`
+	if err := r.db.RW.QueryRowContext(ctx, countQuery, subscriptionID, status).Scan(&total); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to count webhook deliveries")
+		return nil, 0, domain.NewSystemError("WebhookRepository.GetDeliveries", err, "failed to get total count")
+	}
+
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries d
+		WHERE d.subscription_id = $1 AND ($2 = '' OR d.status = $2)
+		ORDER BY d.created_at DESC, d.id
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := r.db.RW.QueryContext(ctx, query, subscriptionID, status, limit, offset)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to query webhook deliveries")
+		return nil, 0, domain.NewSystemError("WebhookRepository.GetDeliveries", err, "failed to query webhook deliveries")
+	}
+	defer rows.Close()
+
+	deliveries := []*domain.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan webhook delivery")
+			return nil, 0, domain.NewSystemError("WebhookRepository.GetDeliveries", err, "failed to scan webhook delivery")
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate webhook deliveries")
+		return nil, 0, domain.NewSystemError("WebhookRepository.GetDeliveries", err, "error iterating webhook deliveries")
+	}
+
+	return deliveries, total, nil
+}
+
+// ClaimDueDeliveries leases due deliveries in one statement, SKIP LOCKED lets
+// several dispatchers claim side by side without waiting on each other.
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDispatch, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id
+		  AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		  )
+		RETURNING ` + webhookDeliveryColumns + `, s.url, s.secret
+	`
+	rows, err := r.db.RW.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to claim webhook deliveries")
+		return nil, domain.NewSystemError("WebhookRepository.ClaimDueDeliveries", err, "failed to claim webhook deliveries")
+	}
+	defer rows.Close()
+
+	dispatches := []*domain.WebhookDispatch{}
+	for rows.Next() {
+		dispatch := &domain.WebhookDispatch{}
+		delivery, err := scanWebhookDelivery(rows, &dispatch.URL, &dispatch.Secret)
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to scan webhook delivery")
+			return nil, domain.NewSystemError("WebhookRepository.ClaimDueDeliveries", err, "failed to scan webhook delivery")
+		}
+		dispatch.Delivery = delivery
+		dispatches = append(dispatches, dispatch)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to iterate webhook deliveries")
+		return nil, domain.NewSystemError("WebhookRepository.ClaimDueDeliveries", err, "error iterating webhook deliveries")
+	}
+	return dispatches, nil
+}
+
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5,
+			last_error = $6, delivered_at = $7, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at
+	`
+	err := r.db.RW.QueryRowContext(ctx, query,
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastStatusCode,
+		delivery.LastError,
+		delivery.DeliveredAt,
+	).Scan(&delivery.UpdatedAt)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("delivery_id", delivery.ID.String()).
+			Msg("Failed to update webhook delivery")
+		return domain.NewSystemError("WebhookRepository.UpdateDelivery", err, "failed to update webhook delivery")
+	}
+	return nil
+}
+
+func scanWebhookSubscription(row rowScanner) (*domain.WebhookSubscription, error) {
+	subscription := &domain.WebhookSubscription{}
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.MerchantID,
+		&subscription.URL,
+		pq.Array(&subscription.EventTypes),
+		&subscription.Secret,
+		&subscription.IsActive,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// scanWebhookDelivery scans webhookDeliveryColumns, followed by extra columns
+// into extra.
+func scanWebhookDelivery(row rowScanner, extra ...interface{}) (*domain.WebhookDelivery, error) {
+	delivery := &domain.WebhookDelivery{}
+	var payload []byte
+	dest := append([]interface{}{
+		&delivery.ID,
+		&delivery.SubscriptionID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.ReplayOf,
+		&delivery.DeliveredAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+	return delivery, nil
+}
@@ -0,0 +1,122 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// customerContextTTL bounds how stale a cached context can get if an invalidation is missed
+	customerContextTTL = 1 * time.Hour
+	// customerContextGenerationTTL outlives any read of the database that
+	// started in the generation before
+	customerContextGenerationTTL = 2 * customerContextTTL
+)
+
+// setInGeneration stores a context only if no invalidation bumped the
+// generation since it was read
+var setInGeneration = redis.NewScript(`
+	if (redis.call("GET", KEYS[2]) or "0") ~= ARGV[2] then
+		return 0
+	end
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+	return 1
+`)
+
+type CustomerContextCache struct {
+	client *redis.Client
+	logger zerolog.Logger
+}
+
+func NewCustomerContextCache(client *redis.Client) *CustomerContextCache {
+	return &CustomerContextCache{client: client,
+		logger: logging.GetLogger(),
+	}
+}
+
+func customerContextKey(customerID, programID uuid.UUID) string {
+	return fmt.Sprintf("customer_context:%s:%s", customerID, programID)
+}
+
+func customerContextGenerationKey(customerID, programID uuid.UUID) string {
+	return fmt.Sprintf("customer_context_generation:%s:%s", customerID, programID)
+}
+
+func (c *CustomerContextCache) Get(ctx context.Context, customerID, programID uuid.UUID) (*domain.CustomerContext, int64, error) {
+	values, err := c.client.MGet(ctx,
+		customerContextKey(customerID, programID),
+		customerContextGenerationKey(customerID, programID),
+	).Result()
+	if err != nil {
+		c.logger.Error().
+			Err(err).
+			Msg("Failed to get customer context")
+		return nil, 0, err
+	}
+
+	var generation int64
+	if value, ok := values[1].(string); ok {
+		if generation, err = strconv.ParseInt(value, 10, 64); err != nil {
+			c.logger.Error().
+				Err(err).
+				Msg("Failed to parse customer context generation")
+			return nil, 0, err
+		}
+	}
+
+	data, ok := values[0].(string)
+	if !ok {
+		return nil, generation, nil
+	}
+	var customerContext domain.CustomerContext
+	if err := json.Unmarshal([]byte(data), &customerContext); err != nil {
+		c.logger.Error().
+			Err(err).
+			Msg("Failed to unmarshal customer context")
+		return nil, 0, err
+	}
+	return &customerContext, generation, nil
+}
+
+func (c *CustomerContextCache) Set(ctx context.Context, customerContext *domain.CustomerContext, generation int64) error {
+	data, err := json.Marshal(customerContext)
+	if err != nil {
+		c.logger.Error().
+			Err(err).
+			Msg("Failed to marshal customer context")
+		return err
+	}
+
+	keys := []string{
+		customerContextKey(customerContext.MerchantCustomersID, customerContext.ProgramID),
+		customerContextGenerationKey(customerContext.MerchantCustomersID, customerContext.ProgramID),
+	}
+	return setInGeneration.Run(ctx, c.client, keys, data, generation, customerContextTTL.Milliseconds()).Err()
+}
+
+// Invalidate drops the cached context and starts a new generation, so reads
+// already in flight do not cache it again
+func (c *CustomerContextCache) Invalidate(ctx context.Context, customerID, programID uuid.UUID) error {
+	generationKey := customerContextGenerationKey(customerID, programID)
+	pipe := c.client.TxPipeline()
+	pipe.Incr(ctx, generationKey)
+	pipe.Expire(ctx, generationKey, customerContextGenerationTTL)
+	pipe.Del(ctx, customerContextKey(customerID, programID))
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		c.logger.Error().
+			Err(err).
+			Msg("Failed to invalidate customer context")
+		return err
+	}
+	return nil
+}
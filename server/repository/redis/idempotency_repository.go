@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// idempotencyTTL is how long retries of a finished request are replayed
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyReservationTTL frees the key of a request that never finished,
+	// e.g. because the server went down while handling it
+	idempotencyReservationTTL = 1 * time.Minute
+)
+
+type IdempotencyRepository struct {
+	client *redis.Client
+	logger zerolog.Logger
+}
+
+func NewIdempotencyRepository(client *redis.Client) *IdempotencyRepository {
+	return &IdempotencyRepository{client: client,
+		logger: logging.GetLogger(),
+	}
+}
+
+func idempotencyKey(scope, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", scope, key)
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, scope, key string, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to marshal idempotency record")
+		return nil, err
+	}
+
+	// The key can expire between SETNX and GET, try once more to claim it
+	for attempt := 0; attempt < 2; attempt++ {
+		reserved, err := r.client.SetNX(ctx, idempotencyKey(scope, key), data, idempotencyReservationTTL).Result()
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to reserve idempotency key")
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+
+		existing, err := r.client.Get(ctx, idempotencyKey(scope, key)).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to get idempotency record")
+			return nil, err
+		}
+
+		var held domain.IdempotencyRecord
+		if err := json.Unmarshal([]byte(existing), &held); err != nil {
+			r.logger.Error().
+				Err(err).
+				Msg("Failed to unmarshal idempotency record")
+			return nil, err
+		}
+		return &held, nil
+	}
+
+	return nil, fmt.Errorf("idempotency key %s could not be reserved", key)
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, scope, key string, record *domain.IdempotencyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to marshal idempotency record")
+		return err
+	}
+	return r.client.Set(ctx, idempotencyKey(scope, key), data, idempotencyTTL).Err()
+}
+
+func (r *IdempotencyRepository) Release(ctx context.Context, scope, key string) error {
+	err := r.client.Del(ctx, idempotencyKey(scope, key)).Err()
+	if err != nil {
+		r.logger.Error().
+			Err(err).
+			Msg("Failed to release idempotency key")
+	}
+	return err
+}
@@ -111,6 +111,14 @@ func (m *mockAuthRepository) Commit(ctx context.Context, tx *sql.Tx) error {
 	return args.Error(0)
 }
 
+func (m *mockAuthRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (m *mockAuthRepository) AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	fn(ctx)
+}
+
 func (m *mockAuthRepository) MarkVerificationUsedTx(ctx context.Context, tx *sql.Tx, verificationID string) error {
 	args := m.Called(ctx, tx, verificationID)
 	return args.Error(0)
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+
+	"go-playground/pkg/channel"
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// CustomerContextService derives the customer facts used by tenure, transaction
+// count and date rules, caching them until the customer's next transaction.
+// A merchant timezone change shows up once the cached entries expire.
+type CustomerContextService struct {
+	merchantCustomerRepo domain.MerchantCustomersRepository
+	merchantRepo         domain.MerchantRepository
+	transactionRepo      domain.TransactionRepository
+	cache                domain.CustomerContextCache
+	logger               zerolog.Logger
+}
+
+// uncachedKey marks a ctx whose customer contexts are derived from the database
+type uncachedKey struct{}
+
+// withoutCustomerContextCache makes customer contexts derived in ctx bypass the
+// cache. A unit of work that creates several transactions of a customer needs
+// it, the cached count is only invalidated once the unit of work commits.
+func withoutCustomerContextCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncachedKey{}, true)
+}
+
+func NewCustomerContextService(
+	merchantCustomerRepo domain.MerchantCustomersRepository,
+	merchantRepo domain.MerchantRepository,
+	transactionRepo domain.TransactionRepository,
+	cache domain.CustomerContextCache,
+) *CustomerContextService {
+	return &CustomerContextService{
+		merchantCustomerRepo: merchantCustomerRepo,
+		merchantRepo:         merchantRepo,
+		transactionRepo:      transactionRepo,
+		cache:                cache,
+		logger:               logging.GetLogger(),
+	}
+}
+
+func (s *CustomerContextService) GetCustomerContext(ctx context.Context, customerID, programID uuid.UUID) (*domain.CustomerContext, error) {
+	// A cache failure only costs us the database round trips below
+	uncached, _ := ctx.Value(uncachedKey{}).(bool)
+	var generation int64
+	var cacheErr error
+	if !uncached {
+		var cached *domain.CustomerContext
+		cached, generation, cacheErr = s.cache.Get(ctx, customerID, programID)
+		if cacheErr == nil && cached != nil {
+			return cached, nil
+		}
+	}
+
+	customer, err := s.merchantCustomerRepo.GetByID(ctx, customerID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting merchant customer")
+		return nil, domain.NewSystemError("CustomerContextService.GetCustomerContext", err, "failed to get merchant customer")
+	}
+	if customer == nil {
+		s.logger.Error().
+			Msg("Customer not found")
+		return nil, domain.NewResourceNotFoundError("merchant customer", customerID.String(), "customer not found")
+	}
+
+	merchant, err := s.merchantRepo.GetByID(ctx, customer.MerchantID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting merchant")
+		return nil, err // Repository layer will return appropriate error types
+	}
+
+	count, err := s.transactionRepo.CountByCustomerAndProgram(ctx, customerID, programID, "completed")
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error counting customer transactions")
+		return nil, domain.NewSystemError("CustomerContextService.GetCustomerContext", err, "failed to count customer transactions")
+	}
+
+	customerContext := &domain.CustomerContext{
+		MerchantCustomersID: customerID,
+		ProgramID:           programID,
+		TransactionCount:    count,
+		MemberSince:         customer.CreatedAt,
+		DateOfBirth:         customer.DateOfBirth,
+		Timezone:            merchant.Timezone,
+	}
+
+	// Without the generation it was read in, the context is not cached
+	if !uncached && cacheErr == nil {
+		if err := s.cache.Set(ctx, customerContext, generation); err != nil {
+			s.logger.Warn().
+				Err(err).
+				Msg("Failed to cache customer context")
+		}
+	}
+
+	return customerContext, nil
+}
+
+func (s *CustomerContextService) InvalidateCustomerContext(ctx context.Context, customerID, programID uuid.UUID) error {
+	if err := s.cache.Invalidate(ctx, customerID, programID); err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error invalidating customer context")
+		return domain.NewSystemError("CustomerContextService.InvalidateCustomerContext", err, "failed to invalidate customer context")
+	}
+	return nil
+}
+
+// InvalidateOnTransactionEvents drops a customer's cached context whenever one
+// of their transactions is created or changes status, until ctx is cancelled.
+func (s *CustomerContextService) InvalidateOnTransactionEvents(ctx context.Context, bus *channel.PubSub[domain.DomainEvent]) {
+	// A missed invalidation serves a stale transaction count, so nothing is dropped
+	sub := bus.Subscribe(ctx, "transaction.*", channel.SubscribeOptions{Policy: channel.Unbounded})
+	go func() {
+		for message := range sub.C() {
+			event := message.Value
+			// Errors are logged, the entry still expires on its own
+			_ = s.InvalidateCustomerContext(ctx, event.CustomerID, event.ProgramID)
+		}
+	}()
+}
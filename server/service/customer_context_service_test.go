@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-playground/pkg/channel"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockCustomerContextCache struct {
+	mock.Mock
+}
+
+func (m *mockCustomerContextCache) Get(ctx context.Context, customerID, programID uuid.UUID) (*domain.CustomerContext, int64, error) {
+	args := m.Called(ctx, customerID, programID)
+	if args.Get(0) == nil {
+		return nil, args.Get(1).(int64), args.Error(2)
+	}
+	return args.Get(0).(*domain.CustomerContext), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockCustomerContextCache) Set(ctx context.Context, customerContext *domain.CustomerContext, generation int64) error {
+	args := m.Called(ctx, customerContext, generation)
+	return args.Error(0)
+}
+
+func (m *mockCustomerContextCache) Invalidate(ctx context.Context, customerID, programID uuid.UUID) error {
+	args := m.Called(ctx, customerID, programID)
+	return args.Error(0)
+}
+
+type mockMerchantRepository struct {
+	mock.Mock
+}
+
+func (m *mockMerchantRepository) Create(ctx context.Context, merchant *domain.Merchant) (*domain.Merchant, error) {
+	args := m.Called(ctx, merchant)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Merchant), args.Error(1)
+}
+
+func (m *mockMerchantRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Merchant, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Merchant), args.Error(1)
+}
+
+func (m *mockMerchantRepository) GetAll(ctx context.Context, userID uuid.UUID) ([]*domain.MerchantList, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.MerchantList), args.Error(1)
+}
+
+func (m *mockMerchantRepository) Update(ctx context.Context, merchant *domain.Merchant) error {
+	args := m.Called(ctx, merchant)
+	return args.Error(0)
+}
+
+func (m *mockMerchantRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockMerchantRepository) GetMerchantsByUserID(ctx context.Context, userID uuid.UUID, offset, limit int) ([]*domain.Merchant, int, error) {
+	args := m.Called(ctx, userID, offset, limit)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.Merchant), args.Int(1), args.Error(2)
+}
+
+func TestCustomerContextService_GetCustomerContext(t *testing.T) {
+	ctx := context.Background()
+	customerID := uuid.New()
+	programID := uuid.New()
+	merchantID := uuid.New()
+	memberSince := time.Now().AddDate(0, 0, -30)
+	dateOfBirth := time.Date(1990, time.April, 21, 0, 0, 0, 0, time.UTC)
+
+	t.Run("cache hit", func(t *testing.T) {
+		customerRepo := new(mockMerchantCustomersRepository)
+		merchantRepo := new(mockMerchantRepository)
+		transactionRepo := new(mockTransactionRepository)
+		cache := new(mockCustomerContextCache)
+		svc := NewCustomerContextService(customerRepo, merchantRepo, transactionRepo, cache)
+		merchantRepo.On("GetByID", ctx, merchantID).Return(&domain.Merchant{ID: merchantID, Timezone: "Asia/Jakarta"}, nil).Maybe()
+
+		cached := &domain.CustomerContext{MerchantCustomersID: customerID, ProgramID: programID, TransactionCount: 7, MemberSince: memberSince}
+		cache.On("Get", ctx, customerID, programID).Return(cached, int64(0), nil)
+
+		result, err := svc.GetCustomerContext(ctx, customerID, programID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, cached, result)
+		customerRepo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+		transactionRepo.AssertNotCalled(t, "CountByCustomerAndProgram", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("cache miss computes and caches in the generation it read", func(t *testing.T) {
+		customerRepo := new(mockMerchantCustomersRepository)
+		merchantRepo := new(mockMerchantRepository)
+		transactionRepo := new(mockTransactionRepository)
+		cache := new(mockCustomerContextCache)
+		svc := NewCustomerContextService(customerRepo, merchantRepo, transactionRepo, cache)
+		merchantRepo.On("GetByID", ctx, merchantID).Return(&domain.Merchant{ID: merchantID, Timezone: "Asia/Jakarta"}, nil).Maybe()
+
+		cache.On("Get", ctx, customerID, programID).Return(nil, int64(4), nil)
+		customerRepo.On("GetByID", ctx, customerID).Return(&domain.MerchantCustomer{ID: customerID, MerchantID: merchantID, CreatedAt: memberSince, DateOfBirth: &dateOfBirth}, nil)
+		transactionRepo.On("CountByCustomerAndProgram", ctx, customerID, programID, "completed").Return(3, nil)
+		cache.On("Set", ctx, mock.AnythingOfType("*domain.CustomerContext"), int64(4)).Return(nil)
+
+		result, err := svc.GetCustomerContext(ctx, customerID, programID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, result.TransactionCount)
+		assert.Equal(t, memberSince, result.MemberSince)
+		assert.Equal(t, 30, result.MembershipTenure(memberSince.AddDate(0, 0, 30)))
+		assert.Equal(t, &dateOfBirth, result.DateOfBirth)
+		assert.Equal(t, "Asia/Jakarta", result.Location().String())
+		cache.AssertExpectations(t)
+	})
+
+	t.Run("cache errors fall back to the database without caching", func(t *testing.T) {
+		customerRepo := new(mockMerchantCustomersRepository)
+		merchantRepo := new(mockMerchantRepository)
+		transactionRepo := new(mockTransactionRepository)
+		cache := new(mockCustomerContextCache)
+		svc := NewCustomerContextService(customerRepo, merchantRepo, transactionRepo, cache)
+		merchantRepo.On("GetByID", ctx, merchantID).Return(&domain.Merchant{ID: merchantID, Timezone: "Asia/Jakarta"}, nil).Maybe()
+
+		cache.On("Get", ctx, customerID, programID).Return(nil, int64(0), errors.New("redis down"))
+		customerRepo.On("GetByID", ctx, customerID).Return(&domain.MerchantCustomer{ID: customerID, MerchantID: merchantID, CreatedAt: memberSince, DateOfBirth: &dateOfBirth}, nil)
+		transactionRepo.On("CountByCustomerAndProgram", ctx, customerID, programID, "completed").Return(1, nil)
+
+		result, err := svc.GetCustomerContext(ctx, customerID, programID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result.TransactionCount)
+		cache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("uncached reads the database and caches nothing", func(t *testing.T) {
+		customerRepo := new(mockMerchantCustomersRepository)
+		merchantRepo := new(mockMerchantRepository)
+		transactionRepo := new(mockTransactionRepository)
+		cache := new(mockCustomerContextCache)
+		svc := NewCustomerContextService(customerRepo, merchantRepo, transactionRepo, cache)
+		uncachedCtx := withoutCustomerContextCache(ctx)
+		merchantRepo.On("GetByID", uncachedCtx, merchantID).Return(&domain.Merchant{ID: merchantID, Timezone: "Asia/Jakarta"}, nil)
+		customerRepo.On("GetByID", uncachedCtx, customerID).Return(&domain.MerchantCustomer{ID: customerID, MerchantID: merchantID, CreatedAt: memberSince}, nil)
+		transactionRepo.On("CountByCustomerAndProgram", uncachedCtx, customerID, programID, "completed").Return(2, nil)
+
+		result, err := svc.GetCustomerContext(uncachedCtx, customerID, programID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result.TransactionCount)
+		cache.AssertNotCalled(t, "Get", mock.Anything, mock.Anything, mock.Anything)
+		cache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("customer not found", func(t *testing.T) {
+		customerRepo := new(mockMerchantCustomersRepository)
+		merchantRepo := new(mockMerchantRepository)
+		transactionRepo := new(mockTransactionRepository)
+		cache := new(mockCustomerContextCache)
+		svc := NewCustomerContextService(customerRepo, merchantRepo, transactionRepo, cache)
+		merchantRepo.On("GetByID", ctx, merchantID).Return(&domain.Merchant{ID: merchantID, Timezone: "Asia/Jakarta"}, nil).Maybe()
+
+		cache.On("Get", ctx, customerID, programID).Return(nil, int64(0), nil)
+		customerRepo.On("GetByID", ctx, customerID).Return(nil, nil)
+
+		result, err := svc.GetCustomerContext(ctx, customerID, programID)
+
+		assert.Nil(t, result)
+		assert.True(t, domain.IsResourceNotFoundError(err))
+	})
+}
+
+func TestCustomerContextService_InvalidateOnTransactionEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	customerID := uuid.New()
+	programID := uuid.New()
+	cache := new(mockCustomerContextCache)
+	svc := NewCustomerContextService(new(mockMerchantCustomersRepository), new(mockMerchantRepository), new(mockTransactionRepository), cache)
+	bus := channel.NewPubSub[domain.DomainEvent]()
+	invalidated := make(chan struct{})
+	cache.On("Invalidate", ctx, customerID, programID).Return(nil).Run(func(mock.Arguments) { close(invalidated) })
+
+	svc.InvalidateOnTransactionEvents(ctx, bus)
+	// Points events leave the transaction count alone
+	bus.Publish(ctx, domain.EventTopic(domain.PointsEarned), domain.DomainEvent{CustomerID: uuid.New(), ProgramID: programID})
+	bus.Publish(ctx, domain.EventTopic(domain.TransactionStatusUpdated), domain.DomainEvent{CustomerID: customerID, ProgramID: programID})
+
+	select {
+	case <-invalidated:
+	case <-time.After(time.Second):
+		t.Fatal("customer context was not invalidated")
+	}
+	cache.AssertNumberOfCalls(t, "Invalidate", 1)
+}
@@ -2,15 +2,74 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"go-playground/server/domain"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type EventLoggerService struct {
-	eventLogRepo domain.EventLogRepository
+	eventLogRepo   domain.EventLogRepository
+	outboxRepo     domain.OutboxRepository
+	webhookService *WebhookService
+	bus            domain.EventBus
+	txManager      domain.TxManager
+}
+
+func NewEventLoggerService(
+	eventLogRepo domain.EventLogRepository,
+	outboxRepo domain.OutboxRepository,
+	webhookService *WebhookService,
+	bus domain.EventBus,
+	txManager domain.TxManager,
+) *EventLoggerService {
+	return &EventLoggerService{
+		eventLogRepo:   eventLogRepo,
+		outboxRepo:     outboxRepo,
+		webhookService: webhookService,
+		bus:            bus,
+		txManager:      txManager,
+	}
 }
 
-func NewEventLoggerService(eventLogRepo domain.EventLogRepository) *EventLoggerService {
-	return &EventLoggerService{eventLogRepo: eventLogRepo}
+// publish adds a domain event to the outbox and queues its webhook
+// deliveries, in the unit of work running in ctx. The outbox relay publishes
+// it to Kafka and the event bus hands it to in-process listeners, both once
+// the unit of work commits.
+func (s *EventLoggerService) publish(ctx context.Context, eventType domain.EventLogType, customerID, programID uuid.UUID, data map[string]interface{}) error {
+	event := &domain.DomainEvent{
+		EventID:    uuid.New(),
+		EventType:  eventType,
+		CustomerID: customerID,
+		ProgramID:  programID,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return domain.NewSystemError("EventLoggerService.publish", err, "failed to marshal domain event")
+	}
+
+	err = s.outboxRepo.Create(ctx, &domain.OutboxEvent{
+		ID:           event.EventID,
+		Topic:        domain.DomainEventsTopic,
+		PartitionKey: customerID.String(),
+		EventType:    eventType,
+		Payload:      payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.webhookService.Enqueue(ctx, domain.EventTopic(eventType), *event); err != nil {
+		return err
+	}
+
+	s.txManager.AfterCommit(ctx, func(ctx context.Context) {
+		s.bus.Publish(ctx, domain.EventTopic(eventType), *event)
+	})
+	return nil
 }
 
 func (s *EventLoggerService) SaveTransactionEvents(ctx context.Context, eventType domain.EventLogType, createdTx *domain.Transaction, pointsEarned int) error {
@@ -26,12 +85,30 @@ func (s *EventLoggerService) SaveTransactionEvents(ctx context.Context, eventTyp
 			"program_id":         createdTx.ProgramID,
 			"transaction_type":   createdTx.TransactionType,
 			"transaction_amount": createdTx.TransactionAmount,
+			"cash_amount":        createdTx.CashAmount,
 			"points_earned":      pointsEarned,
 		},
 	}
 
-	return s.eventLogRepo.Create(ctx, event)
+	if err := s.eventLogRepo.Create(ctx, event); err != nil {
+		return err
+	}
+	return s.publish(ctx, domain.TransactionCreated, createdTx.MerchantCustomersID, createdTx.ProgramID, event.Details)
 }
+
+// SaveTransactionStatusEvents publishes a transaction's status change. The
+// event_log enum has no such event, so it only goes to the outbox and the
+// event bus.
+func (s *EventLoggerService) SaveTransactionStatusEvents(ctx context.Context, transaction *domain.Transaction, oldStatus string) error {
+	return s.publish(ctx, domain.TransactionStatusUpdated, transaction.MerchantCustomersID, transaction.ProgramID, map[string]interface{}{
+		"transaction_id": transaction.TransactionID,
+		"merchant_id":    transaction.MerchantID,
+		"program_id":     transaction.ProgramID,
+		"old_status":     oldStatus,
+		"status":         transaction.Status,
+	})
+}
+
 func (s *EventLoggerService) SaveRedemptionEvents(ctx context.Context, eventType domain.EventLogType, redemption *domain.Redemption, reward *domain.Reward) error {
 	// Log the redemption event
 	event := &domain.EventLog{
@@ -42,13 +119,45 @@ func (s *EventLoggerService) SaveRedemptionEvents(ctx context.Context, eventType
 		Details: map[string]interface{}{
 			"reward_id":     redemption.RewardID,
 			"points_used":   redemption.PointsUsed,
+			"cash_amount":   redemption.CashAmount,
 			"redemption_id": redemption.ID,
 			"program_id":    reward.ProgramID,
 		},
 	}
 
-	return s.eventLogRepo.Create(ctx, event)
+	if err := s.eventLogRepo.Create(ctx, event); err != nil {
+		return err
+	}
+	return s.publish(ctx, domain.RewardRedeemed, redemption.MerchantCustomersID, reward.ProgramID, event.Details)
 }
+
+// SaveRedemptionStatusEvents publishes a redemption's status change, to the
+// outbox and the event bus only like transaction status changes.
+func (s *EventLoggerService) SaveRedemptionStatusEvents(ctx context.Context, redemption *domain.Redemption, reward *domain.Reward, oldStatus domain.RedemptionStatus) error {
+	return s.publish(ctx, domain.RedemptionStatusUpdated, redemption.MerchantCustomersID, reward.ProgramID, map[string]interface{}{
+		"redemption_id": redemption.ID,
+		"reward_id":     redemption.RewardID,
+		"program_id":    reward.ProgramID,
+		"points_used":   redemption.PointsUsed,
+		"cash_amount":   redemption.CashAmount,
+		"old_status":    oldStatus,
+		"status":        redemption.Status,
+	})
+}
+
+// SaveRewardLowStockEvents tells the merchant a reward's stock dropped to its
+// low stock threshold. It is published for the redemption that took the
+// stock there, so it carries that customer.
+func (s *EventLoggerService) SaveRewardLowStockEvents(ctx context.Context, reward *domain.Reward, customerID uuid.UUID) error {
+	return s.publish(ctx, domain.RewardLowStock, customerID, reward.ProgramID, map[string]interface{}{
+		"reward_id":           reward.ID,
+		"program_id":          reward.ProgramID,
+		"name":                reward.Name,
+		"available_quantity":  reward.AvailableQuantity,
+		"low_stock_threshold": reward.LowStockThreshold,
+	})
+}
+
 func (s *EventLoggerService) SaveUserUpdateEvents(ctx context.Context, eventType domain.EventLogType, user *domain.User) error {
 	event := &domain.EventLog{
 		EventType:   string(eventType),
@@ -133,5 +242,15 @@ func (s *EventLoggerService) SavePointUpdateEvents(ctx context.Context, eventTyp
 			"created_at":      ledger.CreatedAt,
 		},
 	}
-	return s.eventLogRepo.Create(ctx, event)
+	if ledger.TxType != "" {
+		// Tells a refund's reversal apart from a redemption
+		event.Details["tx_type"] = ledger.TxType
+	}
+	if err := s.eventLogRepo.Create(ctx, event); err != nil {
+		return err
+	}
+	if eventType != domain.PointsEarned && eventType != domain.PointsRedeemed {
+		return nil
+	}
+	return s.publish(ctx, eventType, ledger.MerchantCustomersID, ledger.ProgramID, event.Details)
 }
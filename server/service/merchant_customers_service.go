@@ -5,6 +5,7 @@ import (
 	"go-playground/pkg/logging"
 	"go-playground/server/domain"
 	"go-playground/server/util"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
@@ -44,6 +45,15 @@ func (s *MerchantCustomersService) Create(ctx context.Context, req *domain.Creat
 			return nil
 		}
 
+		dateOfBirth, err := parseDateOfBirth(req.DateOfBirth)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Invalid date of birth")
+			createErr = domain.NewValidationError("date_of_birth", "date of birth must be a date, ie 1990-04-21")
+			return nil
+		}
+
 		// Hash password
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
@@ -55,12 +65,13 @@ func (s *MerchantCustomersService) Create(ctx context.Context, req *domain.Creat
 		}
 
 		customer := &domain.MerchantCustomer{
-			ID:         uuid.New(),
-			MerchantID: req.MerchantID,
-			Email:      req.Email,
-			Password:   string(hashedPassword),
-			Name:       req.Name,
-			Phone:      req.Phone,
+			ID:          uuid.New(),
+			MerchantID:  req.MerchantID,
+			Email:       req.Email,
+			Password:    string(hashedPassword),
+			Name:        req.Name,
+			Phone:       req.Phone,
+			DateOfBirth: dateOfBirth,
 		}
 
 		if err := s.customerRepo.Create(ctx, customer); err != nil {
@@ -257,6 +268,17 @@ func (s *MerchantCustomersService) Update(ctx context.Context, id uuid.UUID, req
 		if req.Name != "" {
 			customer.Name = req.Name
 		}
+		if req.DateOfBirth != "" {
+			dateOfBirth, err := parseDateOfBirth(req.DateOfBirth)
+			if err != nil {
+				s.logger.Error().
+					Err(err).
+					Msg("Invalid date of birth")
+				updateErr = domain.NewValidationError("date_of_birth", "date of birth must be a date, ie 1990-04-21")
+				return nil
+			}
+			customer.DateOfBirth = dateOfBirth
+		}
 
 		// Update password if provided
 		if req.Password != "" {
@@ -337,3 +359,15 @@ func (s *MerchantCustomersService) ValidateCredentials(ctx context.Context, emai
 	}
 	return result, nil
 }
+
+// parseDateOfBirth parses an optional calendar date, ie 1990-04-21
+func parseDateOfBirth(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	dateOfBirth, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &dateOfBirth, nil
+}
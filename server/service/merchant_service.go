@@ -4,6 +4,7 @@ import (
 	"context"
 	"go-playground/pkg/logging"
 	"go-playground/server/domain"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
@@ -29,12 +30,24 @@ func (s *MerchantService) Create(ctx context.Context, req *domain.CreateMerchant
 		return nil, domain.NewValidationError("type", "invalid merchant type")
 	}
 
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if !isValidTimezone(timezone) {
+		s.logger.Error().
+			Str("timezone", timezone).
+			Msg("Invalid timezone")
+		return nil, domain.NewValidationError("timezone", "invalid timezone")
+	}
+
 	// Create merchant entity
 	merchant := &domain.Merchant{
-		ID:     uuid.New(),
-		UserID: req.UserID,
-		Name:   req.Name,
-		Type:   req.Type,
+		ID:       uuid.New(),
+		UserID:   req.UserID,
+		Name:     req.Name,
+		Type:     req.Type,
+		Timezone: timezone,
 	}
 
 	// Business logic validation
@@ -102,9 +115,19 @@ func (s *MerchantService) Update(ctx context.Context, id uuid.UUID, req *domain.
 		return nil, domain.NewValidationError("type", "invalid merchant type")
 	}
 
+	if req.Timezone != "" && !isValidTimezone(req.Timezone) {
+		s.logger.Error().
+			Str("timezone", req.Timezone).
+			Msg("Invalid timezone")
+		return nil, domain.NewValidationError("timezone", "invalid timezone")
+	}
+
 	// Update fields
 	merchant.Name = req.Name
 	merchant.Type = req.Type
+	if req.Timezone != "" {
+		merchant.Timezone = req.Timezone
+	}
 
 	// Business logic validation
 	if err := s.validateMerchantUpdate(merchant); err != nil {
@@ -204,3 +227,9 @@ func isValidMerchantType(t domain.MerchantType) bool {
 		return false
 	}
 }
+
+// isValidTimezone reports whether tz is an IANA timezone name the server knows
+func isValidTimezone(tz string) bool {
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
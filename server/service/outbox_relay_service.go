@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// outboxBatchSize is how many outbox events are claimed per unit of work
+	outboxBatchSize = 100
+	// maxOutboxAttempts is how many times an event is tried before it is dead
+	maxOutboxAttempts = 10
+)
+
+// OutboxRelayService publishes the events in the outbox to the broker.
+type OutboxRelayService struct {
+	outboxRepo domain.OutboxRepository
+	publisher  domain.EventPublisher
+	txManager  domain.TxManager
+	logger     zerolog.Logger
+}
+
+func NewOutboxRelayService(outboxRepo domain.OutboxRepository, publisher domain.EventPublisher, txManager domain.TxManager) *OutboxRelayService {
+	return &OutboxRelayService{
+		outboxRepo: outboxRepo,
+		publisher:  publisher,
+		txManager:  txManager,
+		logger:     logging.GetLogger(),
+	}
+}
+
+// PublishPending publishes the outbox in order, in batches, until it is empty
+// or publishing fails.
+//
+// Delivery is at least once: an event is marked published only after the
+// broker acknowledged it, so a crash in between publishes it again on the next
+// run. When an event fails the run stops there, the events after it wait for
+// the next run so that each customer's events keep their order. An event that
+// failed maxOutboxAttempts times is moved to the dead letters instead, so that
+// it can not hold up the outbox for good.
+func (s *OutboxRelayService) PublishPending(ctx context.Context) (*domain.OutboxRelayRun, error) {
+	run := &domain.OutboxRelayRun{}
+	for {
+		claimed, err := s.publishBatch(ctx, run)
+		if err != nil {
+			return run, err
+		}
+		if run.Failed > 0 || claimed < outboxBatchSize {
+			return run, nil
+		}
+	}
+}
+
+// publishBatch publishes one batch of the outbox and adds its outcome to run.
+// It returns how many events it claimed. Failures are recorded on the events.
+func (s *OutboxRelayService) publishBatch(ctx context.Context, run *domain.OutboxRelayRun) (int, error) {
+	var published []uuid.UUID
+	claimed, failed, dead := 0, 0, 0
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		events, err := s.outboxRepo.ClaimUnpublished(ctx, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		claimed = len(events)
+
+		for _, event := range events {
+			err := s.publisher.Publish(ctx, event.Topic, event.PartitionKey, event.Payload)
+			if err == nil {
+				published = append(published, event.ID)
+				continue
+			}
+
+			if event.Attempts+1 >= maxOutboxAttempts {
+				s.logger.Error().
+					Err(err).
+					Str("event_id", event.ID.String()).
+					Str("event_type", string(event.EventType)).
+					Int("attempts", event.Attempts+1).
+					Msg("Outbox event moved to the dead letters, it will not be published")
+				if err := s.outboxRepo.MarkDead(ctx, event.ID, err.Error()); err != nil {
+					return err
+				}
+				dead++
+				continue
+			}
+
+			s.logger.Error().
+				Err(err).
+				Str("event_id", event.ID.String()).
+				Str("event_type", string(event.EventType)).
+				Int("attempts", event.Attempts+1).
+				Msg("Failed to publish outbox event")
+			if err := s.outboxRepo.MarkFailed(ctx, event.ID, err.Error()); err != nil {
+				return err
+			}
+			failed++
+			break
+		}
+
+		return s.outboxRepo.MarkPublished(ctx, published)
+	})
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Failed to relay outbox events")
+		return 0, domain.NewSystemError("OutboxRelayService.PublishPending", err, "failed to relay outbox events")
+	}
+
+	if len(published) > 0 {
+		s.logger.Info().
+			Int("published", len(published)).
+			Msg("Published outbox events")
+	}
+	run.Published += len(published)
+	run.Failed += failed
+	run.Dead += dead
+	return claimed, nil
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"go-playground/pkg/channel"
+	"go-playground/pkg/kafka"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockOutboxRepository struct {
+	mock.Mock
+}
+
+func (m *mockOutboxRepository) Create(ctx context.Context, event *domain.OutboxEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *mockOutboxRepository) ClaimUnpublished(ctx context.Context, limit int) ([]*domain.OutboxEvent, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.OutboxEvent), args.Error(1)
+}
+
+func (m *mockOutboxRepository) MarkPublished(ctx context.Context, ids []uuid.UUID) error {
+	args := m.Called(ctx, ids)
+	return args.Error(0)
+}
+
+func (m *mockOutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, reason string) error {
+	args := m.Called(ctx, id, reason)
+	return args.Error(0)
+}
+
+func (m *mockOutboxRepository) MarkDead(ctx context.Context, id uuid.UUID, reason string) error {
+	args := m.Called(ctx, id, reason)
+	return args.Error(0)
+}
+
+func outboxEvent(eventType domain.EventLogType, customerID uuid.UUID) *domain.OutboxEvent {
+	id := uuid.New()
+	payload, _ := json.Marshal(&domain.DomainEvent{EventID: id, EventType: eventType, CustomerID: customerID})
+	return &domain.OutboxEvent{
+		ID:           id,
+		Topic:        domain.DomainEventsTopic,
+		PartitionKey: customerID.String(),
+		EventType:    eventType,
+		Payload:      payload,
+	}
+}
+
+func TestOutboxRelayService_PublishPending(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+	events := []*domain.OutboxEvent{
+		outboxEvent(domain.TransactionCreated, alice),
+		outboxEvent(domain.PointsEarned, alice),
+		outboxEvent(domain.RewardRedeemed, bob),
+	}
+
+	t.Run("publishes in order keyed by customer", func(t *testing.T) {
+		outboxRepo := new(mockOutboxRepository)
+		broker := kafka.NewMemoryBroker()
+		svc := NewOutboxRelayService(outboxRepo, broker, passThroughTxManager{})
+		outboxRepo.On("ClaimUnpublished", ctx, outboxBatchSize).Return(events, nil)
+		outboxRepo.On("MarkPublished", ctx, []uuid.UUID{events[0].ID, events[1].ID, events[2].ID}).Return(nil)
+
+		run, err := svc.PublishPending(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &domain.OutboxRelayRun{Published: 3}, run)
+		messages := broker.Messages(domain.DomainEventsTopic)
+		assert.Len(t, messages, 3)
+		for i, message := range messages {
+			assert.Equal(t, events[i].PartitionKey, message.Key)
+			assert.JSONEq(t, string(events[i].Payload), string(message.Value))
+		}
+		outboxRepo.AssertExpectations(t)
+	})
+
+	t.Run("stops at the first failure and keeps the rest for the next run", func(t *testing.T) {
+		outboxRepo := new(mockOutboxRepository)
+		broker := kafka.NewMemoryBroker()
+		broker.FailWith(errors.New("broker unavailable"))
+		svc := NewOutboxRelayService(outboxRepo, broker, passThroughTxManager{})
+		outboxRepo.On("ClaimUnpublished", ctx, outboxBatchSize).Return(events, nil)
+		outboxRepo.On("MarkFailed", ctx, events[0].ID, mock.Anything).Return(nil)
+		outboxRepo.On("MarkPublished", ctx, []uuid.UUID(nil)).Return(nil)
+
+		run, err := svc.PublishPending(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &domain.OutboxRelayRun{Failed: 1}, run)
+		assert.Empty(t, broker.Messages(domain.DomainEventsTopic))
+		outboxRepo.AssertExpectations(t)
+		outboxRepo.AssertNumberOfCalls(t, "MarkFailed", 1)
+	})
+
+	t.Run("an event out of attempts goes to the dead letters", func(t *testing.T) {
+		outboxRepo := new(mockOutboxRepository)
+		broker := kafka.NewMemoryBroker()
+		broker.FailWith(errors.New("message too large"))
+		svc := NewOutboxRelayService(outboxRepo, broker, passThroughTxManager{})
+		poison := outboxEvent(domain.PointsEarned, alice)
+		poison.Attempts = maxOutboxAttempts - 1
+		outboxRepo.On("ClaimUnpublished", ctx, outboxBatchSize).Return([]*domain.OutboxEvent{poison, events[2]}, nil)
+		outboxRepo.On("MarkDead", ctx, poison.ID, "message too large").Return(nil)
+		outboxRepo.On("MarkFailed", ctx, events[2].ID, mock.Anything).Return(nil)
+		outboxRepo.On("MarkPublished", ctx, []uuid.UUID(nil)).Return(nil)
+
+		run, err := svc.PublishPending(ctx)
+
+		assert.NoError(t, err)
+		// The dead event is out of the way, the next one is tried
+		assert.Equal(t, &domain.OutboxRelayRun{Failed: 1, Dead: 1}, run)
+		outboxRepo.AssertExpectations(t)
+	})
+
+	t.Run("claim failure", func(t *testing.T) {
+		outboxRepo := new(mockOutboxRepository)
+		svc := NewOutboxRelayService(outboxRepo, kafka.NewMemoryBroker(), passThroughTxManager{})
+		outboxRepo.On("ClaimUnpublished", ctx, outboxBatchSize).Return(nil, errors.New("db down"))
+
+		run, err := svc.PublishPending(ctx)
+
+		assert.True(t, domain.IsSystemError(err))
+		assert.Equal(t, &domain.OutboxRelayRun{}, run)
+	})
+}
+
+func TestEventLoggerService_SaveTransactionEvents(t *testing.T) {
+	ctx := context.Background()
+	eventRepo := new(mockEventLogRepository)
+	outboxRepo := new(mockOutboxRepository)
+	bus := channel.NewPubSub[domain.DomainEvent]()
+	created := bus.Subscribe(ctx, "transaction.*", channel.SubscribeOptions{})
+	defer created.Close()
+	// transaction.created is not a webhook event, no deliveries are looked up
+	webhooks := NewWebhookService(nil, nil, nil, nil)
+	svc := NewEventLoggerService(eventRepo, outboxRepo, webhooks, bus, passThroughTxManager{})
+	transaction := &domain.Transaction{
+		TransactionID:       uuid.New(),
+		MerchantCustomersID: uuid.New(),
+		ProgramID:           uuid.New(),
+		TransactionType:     "purchase",
+		TransactionAmount:   100,
+	}
+	eventRepo.On("Create", ctx, mock.Anything).Return(nil)
+	outboxRepo.On("Create", ctx, mock.Anything).Return(nil)
+
+	err := svc.SaveTransactionEvents(ctx, domain.TransactionCreated, transaction, 150)
+
+	assert.NoError(t, err)
+	event := outboxRepo.Calls[0].Arguments.Get(1).(*domain.OutboxEvent)
+	assert.Equal(t, domain.DomainEventsTopic, event.Topic)
+	assert.Equal(t, transaction.MerchantCustomersID.String(), event.PartitionKey)
+	assert.Equal(t, domain.TransactionCreated, event.EventType)
+
+	var published domain.DomainEvent
+	assert.NoError(t, json.Unmarshal(event.Payload, &published))
+	assert.Equal(t, event.ID, published.EventID)
+	assert.Equal(t, transaction.MerchantCustomersID, published.CustomerID)
+	assert.EqualValues(t, 150, published.Data["points_earned"])
+
+	// Listeners get the same event once the unit of work commits
+	message := <-created.C()
+	assert.Equal(t, "transaction.created", message.Topic)
+	assert.Equal(t, published.EventID, message.Value.EventID)
+	assert.Equal(t, transaction.ProgramID, message.Value.ProgramID)
+}
+
+func TestEventLoggerService_SavePointUpdateEvents_QueuesWebhooks(t *testing.T) {
+	ctx := context.Background()
+	eventRepo := new(mockEventLogRepository)
+	outboxRepo := new(mockOutboxRepository)
+	webhookRepo := new(mockWebhookRepository)
+	customerRepo := new(mockMerchantCustomersRepository)
+	merchantID := uuid.New()
+	subscription := &domain.WebhookSubscription{ID: uuid.New()}
+	svc := NewEventLoggerService(eventRepo, outboxRepo,
+		NewWebhookService(webhookRepo, nil, customerRepo, nil),
+		channel.NewPubSub[domain.DomainEvent](), passThroughTxManager{})
+	ledger := &domain.PointsLedger{
+		LedgerID:            uuid.New(),
+		MerchantCustomersID: uuid.New(),
+		ProgramID:           uuid.New(),
+		PointsEarned:        150,
+	}
+	eventRepo.On("Create", ctx, mock.Anything).Return(nil)
+	outboxRepo.On("Create", ctx, mock.Anything).Return(nil)
+	customerRepo.On("GetByID", ctx, ledger.MerchantCustomersID).
+		Return(&domain.MerchantCustomer{ID: ledger.MerchantCustomersID, MerchantID: merchantID}, nil)
+	webhookRepo.On("GetActiveSubscriptions", ctx, merchantID, "points.earned").
+		Return([]*domain.WebhookSubscription{subscription}, nil)
+	webhookRepo.On("CreateDelivery", ctx, mock.Anything).Return(true, nil)
+
+	err := svc.SavePointUpdateEvents(ctx, domain.PointsEarned, ledger)
+
+	assert.NoError(t, err)
+	// The delivery is of the event written to the outbox
+	event := outboxRepo.Calls[0].Arguments.Get(1).(*domain.OutboxEvent)
+	delivery := webhookRepo.Calls[1].Arguments.Get(1).(*domain.WebhookDelivery)
+	assert.Equal(t, subscription.ID, delivery.SubscriptionID)
+	assert.Equal(t, event.ID, delivery.EventID)
+	assert.Equal(t, "points.earned", delivery.EventType)
+}
+
+func TestEventLoggerService_WebhookFailureFailsThePublish(t *testing.T) {
+	ctx := context.Background()
+	eventRepo := new(mockEventLogRepository)
+	outboxRepo := new(mockOutboxRepository)
+	customerRepo := new(mockMerchantCustomersRepository)
+	svc := NewEventLoggerService(eventRepo, outboxRepo,
+		NewWebhookService(new(mockWebhookRepository), nil, customerRepo, nil),
+		channel.NewPubSub[domain.DomainEvent](), passThroughTxManager{})
+	ledger := &domain.PointsLedger{MerchantCustomersID: uuid.New(), ProgramID: uuid.New(), PointsRedeemed: 50}
+	eventRepo.On("Create", ctx, mock.Anything).Return(nil)
+	outboxRepo.On("Create", ctx, mock.Anything).Return(nil)
+	customerRepo.On("GetByID", ctx, ledger.MerchantCustomersID).Return(nil, errors.New("db down"))
+
+	err := svc.SavePointUpdateEvents(ctx, domain.PointsRedeemed, ledger)
+
+	// The unit of work rolls back, taking the outbox row with it
+	assert.True(t, domain.IsSystemError(err))
+}
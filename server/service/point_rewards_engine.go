@@ -1,170 +1,242 @@
 package service
 
 import (
-	"fmt"
+	"math"
+	"sort"
 	"time"
+
+	"go-playground/server/domain"
 )
 
-type Transaction struct {
-	Amount           float64
-	Type             string
-	Category         string
-	MerchantID       string
-	MerchantGroupID  string
-	TransactionCount int
-	MembershipTenure int // in days
+// compiledRule is a program rule with its condition parsed. Rules are
+// compiled once when they are loaded for evaluation, so a condition is not
+// parsed again for every transaction it is evaluated against.
+type compiledRule struct {
+	*domain.ProgramRule
+	condition condition // nil when the condition does not parse
 }
 
-type ProgramRule struct {
-	RuleName       string
-	ConditionType  string
-	ConditionValue string
-	Multiplier     float64
-	PointsAwarded  int
-	EffectiveFrom  time.Time
-	EffectiveTo    *time.Time
+// compileRules parses the conditions of the rules to evaluate.
+func compileRules(rules []*domain.ProgramRule) []*compiledRule {
+	compiled := make([]*compiledRule, len(rules))
+	for i, rule := range rules {
+		compiled[i] = compileRule(rule)
+	}
+	return compiled
 }
 
-type Program struct {
-	ProgramID         string
-	MerchantID        string
-	UserID            string
-	ProgramName       string
-	PointCurrencyName string
-	Rules             []ProgramRule
+// compileRule parses the condition of a rule. Rules are validated when they
+// are saved, so one that does not parse is kept and simply never matches.
+func compileRule(rule *domain.ProgramRule) *compiledRule {
+	compiled := &compiledRule{ProgramRule: rule}
+	if cond, err := parseCondition(rule.ConditionType, rule.ConditionValue); err == nil {
+		compiled.condition = cond
+	}
+	return compiled
 }
 
-func evaluateRule(rule ProgramRule, tx Transaction) (bool, float64) {
+func evaluateRule(rule *compiledRule, rc *domain.RuleContext) (bool, float64) {
+	tx := rc.Transaction
+
 	switch rule.ConditionType {
 	case "program_rule_tenure":
 		// Check if membership tenure meets the condition
-		tenure := tx.MembershipTenure
-		return float64(tenure) > parseConditionValue(rule.ConditionValue), rule.Multiplier * float64(rule.PointsAwarded)
+		tenure := rc.MembershipTenure
+		return matchesCondition(rule, conditionOperand{num: float64(tenure)}), rule.Multiplier * float64(rule.PointsAwarded)
 
 	case "program_rule_transaction_amount":
 		// Check if transaction amount meets the condition
-		if tx.Amount > parseConditionValue(rule.ConditionValue) {
+		if matchesCondition(rule, conditionOperand{num: tx.TransactionAmount}) {
 			if rule.PointsAwarded == 0 {
-				return true, rule.Multiplier * tx.Amount
+				return true, rule.Multiplier * tx.TransactionAmount
 			}
 			return true, rule.Multiplier * float64(rule.PointsAwarded)
 		}
 	case "program_rule_transaction_count":
 		// Check if transaction count meets the condition
-		count := tx.TransactionCount
-		return float64(count) > parseConditionValue(rule.ConditionValue), rule.Multiplier * float64(rule.PointsAwarded)
+		count := rc.TransactionCount
+		return matchesCondition(rule, conditionOperand{num: float64(count)}), rule.Multiplier * float64(rule.PointsAwarded)
 
 	case "program_rule_transaction_type":
 		// Check if transaction type matches the condition
-		return tx.Type == rule.ConditionValue, rule.Multiplier * float64(rule.PointsAwarded)
+		return matchesCondition(rule, conditionOperand{str: tx.TransactionType}), rule.Multiplier * float64(rule.PointsAwarded)
+
+	case "program_rule_transaction_date":
+		// Check if the transaction date, in the merchant's timezone, meets the condition
+		loc := rc.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		subject := conditionOperand{
+			at:          tx.TransactionDate.In(loc),
+			dateOfBirth: rc.DateOfBirth,
+			memberSince: rc.MemberSince,
+		}
+		if matchesCondition(rule, subject) {
+			if rule.PointsAwarded == 0 {
+				return true, rule.Multiplier * tx.TransactionAmount
+			}
+			return true, rule.Multiplier * float64(rule.PointsAwarded)
+		}
 
 	case "program_rule_transaction_category":
 		// Check if transaction category matches the condition
-		return tx.Category == rule.ConditionValue, rule.Multiplier * float64(rule.PointsAwarded)
+		return matchesCondition(rule, conditionOperand{str: tx.Category}), rule.Multiplier * float64(rule.PointsAwarded)
 
 	case "program_rule_transaction_merchant":
 		// Check if transaction merchant matches the condition
-		return tx.MerchantID == rule.ConditionValue, rule.Multiplier * float64(rule.PointsAwarded)
+		return matchesCondition(rule, conditionOperand{str: tx.MerchantID.String()}), rule.Multiplier * float64(rule.PointsAwarded)
 
 	case "program_rule_transaction_merchant_group":
 		// Check if transaction merchant group matches the condition
-		return tx.MerchantGroupID == rule.ConditionValue, rule.Multiplier * float64(rule.PointsAwarded)
+		return matchesCondition(rule, conditionOperand{str: rc.MerchantGroupID}), rule.Multiplier * float64(rule.PointsAwarded)
 	}
 	return false, 0
 }
 
-// Helper function to parse condition value (e.g., "> 100")
-func parseConditionValue(condition string) float64 {
-	// Implement logic to parse condition strings like "> 100"
-	// For simplicity, assume the condition is a numeric value
-	var value float64
-	fmt.Sscanf(condition, "%f", &value)
-	return value
+// matchesCondition tests the subject against the rule's parsed condition.
+func matchesCondition(rule *compiledRule, subject conditionOperand) bool {
+	return rule.condition != nil && rule.condition.matches(subject)
 }
 
-func calculatePoints(program Program, tx Transaction) float64 {
-	totalPoints := 0.0
-	basePoints := 0.0
-	bonusPoints := 0.0
-	now := time.Now()
-
-	// First pass: Calculate base points from transaction amount rules
-	for _, rule := range program.Rules {
-		if rule.ConditionType == "program_rule_transaction_amount" {
-			// Skip expired or future rules
-			if now.Before(rule.EffectiveFrom) || (rule.EffectiveTo != nil && now.After(*rule.EffectiveTo)) {
-				continue
-			}
+// ruleAward is what a single rule contributes to a transaction.
+type ruleAward struct {
+	rule   *domain.ProgramRule
+	points float64
+}
+
+// ruleOutcome is how a single rule fared against a transaction. skipReason is
+// empty for the rules that pay out.
+type ruleOutcome struct {
+	rule       *domain.ProgramRule
+	matched    bool
+	points     float64
+	skipReason string
+}
 
-			matches, points := evaluateRule(rule, tx)
-			if matches {
-				basePoints += points
+// evaluateRules evaluates every rule against the transaction, highest priority
+// first, resolves stacking conflicts and applies caps:
+//   - the highest priority matching exclusive rule, if any, is the only award
+//   - otherwise every stackable rule is awarded together with the highest
+//     priority non_stackable rule
+//
+// A rule whose customer cap is already used up for the period drops out, so
+// it does not block the rules behind it.
+func evaluateRules(rules []*compiledRule, rc *domain.RuleContext) []ruleOutcome {
+	at := rc.Transaction.TransactionDate
+
+	ordered := make([]*compiledRule, len(rules))
+	copy(ordered, rules)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority > ordered[j].Priority
+	})
+
+	outcomes := make([]ruleOutcome, len(ordered))
+	exclusive := -1
+	for i, rule := range ordered {
+		outcome := ruleOutcome{rule: rule.ProgramRule}
+		switch {
+		case at.Before(rule.EffectiveFrom):
+			outcome.skipReason = domain.RuleSkipNotYetEffective
+		case rule.EffectiveTo != nil && at.After(*rule.EffectiveTo):
+			outcome.skipReason = domain.RuleSkipExpired
+		default:
+			matched, points := evaluateRule(rule, rc)
+			if !matched {
+				outcome.skipReason = domain.RuleSkipConditionFalse
+				break
+			}
+			outcome.matched = true
+			points, exhausted := capRulePoints(rule.ProgramRule, points, rc)
+			if exhausted {
+				outcome.skipReason = domain.RuleSkipCapReached
+				break
+			}
+			outcome.points = points
+			if exclusive < 0 && rule.Stacking == domain.RuleExclusive {
+				exclusive = i
 			}
 		}
+		outcomes[i] = outcome
 	}
 
-	// Second pass: Calculate bonus points from other rules
-	for _, rule := range program.Rules {
-		// Skip expired or future rules
-		if now.Before(rule.EffectiveFrom) || (rule.EffectiveTo != nil && now.After(*rule.EffectiveTo)) {
+	nonStackableApplied := false
+	for i := range outcomes {
+		outcome := &outcomes[i]
+		if outcome.skipReason != "" {
 			continue
 		}
+		overridden := exclusive >= 0 && i != exclusive
+		if !overridden && outcome.rule.Stacking == domain.RuleNonStackable {
+			overridden = nonStackableApplied
+			nonStackableApplied = true
+		}
+		if overridden {
+			outcome.points = 0
+			outcome.skipReason = domain.RuleSkipOverridden
+		}
+	}
+	return outcomes
+}
 
-		// Skip transaction amount rules as they were handled in first pass
-		if rule.ConditionType != "program_rule_transaction_amount" {
-			matches, points := evaluateRule(rule, tx)
-			if matches {
-				bonusPoints += points
-			}
+// applyRules returns the rules that pay out on the transaction, see evaluateRules.
+func applyRules(rules []*compiledRule, rc *domain.RuleContext) []ruleAward {
+	var awards []ruleAward
+	for _, outcome := range evaluateRules(rules, rc) {
+		if outcome.skipReason == "" {
+			awards = append(awards, ruleAward{rule: outcome.rule, points: outcome.points})
 		}
 	}
+	return awards
+}
 
-	totalPoints = basePoints + bonusPoints
-	return totalPoints
+// capRulePoints limits the points of a matching rule to its per transaction
+// cap and to what is left of its per customer cap for the period. exhausted
+// reports that the customer cap left nothing to award.
+func capRulePoints(rule *domain.ProgramRule, points float64, rc *domain.RuleContext) (capped float64, exhausted bool) {
+	if rule.MaxPointsPerTransaction != nil {
+		points = math.Min(points, float64(*rule.MaxPointsPerTransaction))
+	}
+	if rule.MaxPointsPerCustomerPerPeriod != nil {
+		remaining := float64(*rule.MaxPointsPerCustomerPerPeriod - rc.PeriodAwards[rule.ID])
+		if remaining <= 0 {
+			return 0, true
+		}
+		points = math.Min(points, remaining)
+	}
+	return points, false
 }
 
-/*
-
-func main() {
-    // Example transaction
-    tx := Transaction{
-        Amount:           150.0,
-        Type:             "credit_card",
-        Category:         "food",
-        MerchantID:       "merchant_123",
-        MerchantGroupID:  "group_456",
-        TransactionCount: 12,
-        MembershipTenure: 365,
-    }
-
-    // Example program with rules
-    program := Program{
-        ProgramID: "program_123",
-        Rules: []ProgramRule{
-            {
-                RuleName:       "10th Transaction",
-                ConditionType:  "program_rule_transaction_count",
-                ConditionValue: "10",
-                Multiplier:     1.0,
-                PointsAwarded:  100,
-                EffectiveFrom:  time.Now().AddDate(0, -1, 0), // Active since 1 month ago
-                EffectiveTo:    nil,
-            },
-            {
-                RuleName:       "Transaction above $100",
-                ConditionType:  "program_rule_transaction_amount",
-                ConditionValue: "100",
-                Multiplier:     0.05, // 5% of transaction amount
-                PointsAwarded:  0,
-                EffectiveFrom:  time.Now().AddDate(0, -1, 0),
-                EffectiveTo:    nil,
-            },
-        },
-    }
-
-    // Calculate points
-    points := calculatePoints(program, tx)
-    fmt.Printf("Total points awarded: %.2f\n", points)
+// capPeriodBounds returns the [from, to) window of the cap period containing
+// at, in the merchant's timezone like the date conditions. Weeks start on
+// Monday.
+func capPeriodBounds(period string, at time.Time, loc *time.Location) (time.Time, time.Time) {
+	if loc != nil {
+		at = at.In(loc)
+	}
+	year, month, day := at.Date()
+	switch period {
+	case domain.CapPeriodDay:
+		from := time.Date(year, month, day, 0, 0, 0, 0, at.Location())
+		return from, from.AddDate(0, 0, 1)
+	case domain.CapPeriodWeek:
+		offset := (int(at.Weekday()) + 6) % 7
+		from := time.Date(year, month, day-offset, 0, 0, 0, 0, at.Location())
+		return from, from.AddDate(0, 0, 7)
+	case domain.CapPeriodYear:
+		from := time.Date(year, time.January, 1, 0, 0, 0, 0, at.Location())
+		return from, from.AddDate(1, 0, 0)
+	}
+	from := time.Date(year, month, 1, 0, 0, 0, 0, at.Location())
+	return from, from.AddDate(0, 1, 0)
 }
 
-*/
+// calculatePoints evaluates every rule in force at the transaction date and
+// returns the total points the transaction earns.
+func calculatePoints(rules []*compiledRule, rc *domain.RuleContext) float64 {
+	totalPoints := 0.0
+	for _, award := range applyRules(rules, rc) {
+		totalPoints += award.points
+	}
+	return totalPoints
+}
@@ -3,6 +3,10 @@ package service
 import (
 	"testing"
 	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
 )
 
 func TestCalculatePoints(t *testing.T) {
@@ -18,255 +22,255 @@ func TestCalculatePoints(t *testing.T) {
 
 	tests := []struct {
 		name     string
-		program  Program
-		tx       Transaction
+		rules    []*domain.ProgramRule
+		rc       *domain.RuleContext
 		expected float64
 	}{
 		{
 			name: "Transaction-Based Points - Minimum Spend",
-			program: Program{
-				ProgramID: "prog1",
-				Rules: []ProgramRule{
-					{
-						RuleName:       "Spend $100 get 10 points",
-						ConditionType:  "program_rule_transaction_amount",
-						ConditionValue: "100",
-						Multiplier:     1.0,
-						PointsAwarded:  10,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
+			rules: []*domain.ProgramRule{
+				{
+					RuleName:       "Spend $100 get 10 points",
+					ConditionType:  "program_rule_transaction_amount",
+					ConditionValue: "100",
+					Multiplier:     1.0,
+					PointsAwarded:  10,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
 				},
 			},
-			tx: Transaction{
-				Amount: 150.0,
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 150.0,
+					TransactionDate:   now,
+				},
 			},
 			expected: 10.0,
 		},
 		{
 			name: "Transaction-Based Points - Category Multiplier",
-			program: Program{
-				ProgramID: "prog2",
-				Rules: []ProgramRule{
-					{
-						RuleName:       "2x points on dining",
-						ConditionType:  "program_rule_transaction_category",
-						ConditionValue: "dining",
-						Multiplier:     2.0,
-						PointsAwarded:  100,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
+			rules: []*domain.ProgramRule{
+				{
+					RuleName:       "2x points on dining",
+					ConditionType:  "program_rule_transaction_category",
+					ConditionValue: "dining",
+					Multiplier:     2.0,
+					PointsAwarded:  100,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
 				},
 			},
-			tx: Transaction{
-				Amount:   100.0,
-				Category: "dining",
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 100.0,
+					Category:          "dining",
+					TransactionDate:   now,
+				},
 			},
 			expected: 200.0,
 		},
 		{
 			name: "Frequency-Based Points - Transaction Count",
-			program: Program{
-				ProgramID: "prog3",
-				Rules: []ProgramRule{
-					{
-						RuleName:       "Bonus for 5+ transactions",
-						ConditionType:  "program_rule_transaction_count",
-						ConditionValue: "5",
-						Multiplier:     1.0,
-						PointsAwarded:  500,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
+			rules: []*domain.ProgramRule{
+				{
+					RuleName:       "Bonus for 5+ transactions",
+					ConditionType:  "program_rule_transaction_count",
+					ConditionValue: "5",
+					Multiplier:     1.0,
+					PointsAwarded:  500,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
 				},
 			},
-			tx: Transaction{
-				Amount:           100.0,
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 100.0,
+					TransactionDate:   now,
+				},
 				TransactionCount: 6,
 			},
 			expected: 500.0,
 		},
 		{
 			name: "Loyalty Milestone - Membership Tenure",
-			program: Program{
-				ProgramID: "prog4",
-				Rules: []ProgramRule{
-					{
-						RuleName:       "1 year membership bonus",
-						ConditionType:  "program_rule_tenure",
-						ConditionValue: "365",
-						Multiplier:     1.0,
-						PointsAwarded:  1000,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
+			rules: []*domain.ProgramRule{
+				{
+					RuleName:       "1 year membership bonus",
+					ConditionType:  "program_rule_tenure",
+					ConditionValue: "365",
+					Multiplier:     1.0,
+					PointsAwarded:  1000,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
 				},
 			},
-			tx: Transaction{
-				Amount:           100.0,
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 100.0,
+					TransactionDate:   now,
+				},
 				MembershipTenure: 366,
 			},
 			expected: 1000.0,
 		},
 		{
 			name: "Category-Based Points - Merchant Group",
-			program: Program{
-				ProgramID: "prog5",
-				Rules: []ProgramRule{
-					{
-						RuleName:       "Partner merchant group bonus",
-						ConditionType:  "program_rule_transaction_merchant_group",
-						ConditionValue: "premium_partners",
-						Multiplier:     3.0,
-						PointsAwarded:  100,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
+			rules: []*domain.ProgramRule{
+				{
+					RuleName:       "Partner merchant group bonus",
+					ConditionType:  "program_rule_transaction_merchant_group",
+					ConditionValue: "premium_partners",
+					Multiplier:     3.0,
+					PointsAwarded:  100,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
 				},
 			},
-			tx: Transaction{
-				Amount:          100.0,
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 100.0,
+					TransactionDate:   now,
+				},
 				MerchantGroupID: "premium_partners",
 			},
 			expected: 300.0,
 		},
 		{
 			name: "Multiple Rules Combined",
-			program: Program{
-				ProgramID: "prog6",
-				Rules: []ProgramRule{
-					{
-						RuleName:       "Base points per amount",
-						ConditionType:  "program_rule_transaction_amount",
-						ConditionValue: "50",
-						Multiplier:     0.1, // 0.1 points per dollar
-						PointsAwarded:  0,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
-					{
-						RuleName:       "Category bonus",
-						ConditionType:  "program_rule_transaction_category",
-						ConditionValue: "electronics",
-						Multiplier:     2.0,
-						PointsAwarded:  50,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
+			rules: []*domain.ProgramRule{
+				{
+					RuleName:       "Base points per amount",
+					ConditionType:  "program_rule_transaction_amount",
+					ConditionValue: "50",
+					Multiplier:     0.1, // 0.1 points per dollar
+					PointsAwarded:  0,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
+				},
+				{
+					RuleName:       "Category bonus",
+					ConditionType:  "program_rule_transaction_category",
+					ConditionValue: "electronics",
+					Multiplier:     2.0,
+					PointsAwarded:  50,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
 				},
 			},
-			tx: Transaction{
-				Amount:   100.0,
-				Category: "electronics",
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 100.0,
+					Category:          "electronics",
+					TransactionDate:   now,
+				},
 			},
 			expected: 110.0, // 10 points from amount (100 * 0.1) + 100 points from category bonus (50 * 2)
 		},
 		// {
 		// 	name: "Tiered Spending - Multiple Tiers",
-		// 	program: Program{
-		// 		ProgramID: "prog7",
-		// 		Rules: []ProgramRule{
-		// 			{
-		// 				RuleName:       "Tier 1: First $100",
-		// 				ConditionType:  "program_rule_transaction_amount",
-		// 				ConditionValue: "0",
-		// 				Multiplier:     1.0, // 1 point per dollar
-		// 				PointsAwarded:  0,
-		// 				EffectiveFrom:  yesterday,
-		// 				EffectiveTo:    timePtr(tomorrow),
-		// 			},
-		// 			{
-		// 				RuleName:       "Tier 2: $101-$200",
-		// 				ConditionType:  "program_rule_transaction_amount",
-		// 				ConditionValue: "100",
-		// 				Multiplier:     2.0, // 2 points per dollar
-		// 				PointsAwarded:  0,
-		// 				EffectiveFrom:  yesterday,
-		// 				EffectiveTo:    timePtr(tomorrow),
-		// 			},
-		// 			{
-		// 				RuleName:       "Tier 3: Above $200",
-		// 				ConditionType:  "program_rule_transaction_amount",
-		// 				ConditionValue: "200",
-		// 				Multiplier:     3.0, // 3 points per dollar
-		// 				PointsAwarded:  0,
-		// 				EffectiveFrom:  yesterday,
-		// 				EffectiveTo:    timePtr(tomorrow),
-		// 			},
+		// 	rules: []*domain.ProgramRule{
+		// 		{
+		// 			RuleName:       "Tier 1: First $100",
+		// 			ConditionType:  "program_rule_transaction_amount",
+		// 			ConditionValue: "0",
+		// 			Multiplier:     1.0, // 1 point per dollar
+		// 			PointsAwarded:  0,
+		// 			EffectiveFrom:  yesterday,
+		// 			EffectiveTo:    timePtr(tomorrow),
+		// 		},
+		// 		{
+		// 			RuleName:       "Tier 2: $101-$200",
+		// 			ConditionType:  "program_rule_transaction_amount",
+		// 			ConditionValue: "100",
+		// 			Multiplier:     2.0, // 2 points per dollar
+		// 			PointsAwarded:  0,
+		// 			EffectiveFrom:  yesterday,
+		// 			EffectiveTo:    timePtr(tomorrow),
+		// 		},
+		// 		{
+		// 			RuleName:       "Tier 3: Above $200",
+		// 			ConditionType:  "program_rule_transaction_amount",
+		// 			ConditionValue: "200",
+		// 			Multiplier:     3.0, // 3 points per dollar
+		// 			PointsAwarded:  0,
+		// 			EffectiveFrom:  yesterday,
+		// 			EffectiveTo:    timePtr(tomorrow),
 		// 		},
 		// 	},
-		// 	tx: Transaction{
-		// 		Amount: 250.0,
+		// 	rc: &domain.RuleContext{
+		// 		Transaction: &domain.Transaction{
+		// 			TransactionAmount: 250.0,
+		// 			TransactionDate:   now,
+		// 		},
 		// 	},
 		// 	expected: 450.0, // (100 * 1) + (100 * 2) + (50 * 3)
 		// },
 		{
 			name: "Promotional Points - Limited Time Offer",
-			program: Program{
-				ProgramID: "prog8",
-				Rules: []ProgramRule{
-					{
-						RuleName:       "Holiday Season Double Points",
-						ConditionType:  "program_rule_transaction_amount",
-						ConditionValue: "0",
-						Multiplier:     2.0,
-						PointsAwarded:  0,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
+			rules: []*domain.ProgramRule{
+				{
+					RuleName:       "Holiday Season Double Points",
+					ConditionType:  "program_rule_transaction_amount",
+					ConditionValue: "0",
+					Multiplier:     2.0,
+					PointsAwarded:  0,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
 				},
 			},
-			tx: Transaction{
-				Amount: 100.0,
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 100.0,
+					TransactionDate:   now,
+				},
 			},
 			expected: 200.0,
 		},
 		// {
 		// 	name: "Complex Combination - Multiple Rules",
-		// 	program: Program{
-		// 		ProgramID: "prog9",
-		// 		Rules: []ProgramRule{
-		// 			{
-		// 				RuleName:       "Base Points",
-		// 				ConditionType:  "program_rule_transaction_amount",
-		// 				ConditionValue: "0",
-		// 				Multiplier:     1.0,
-		// 				PointsAwarded:  0,
-		// 				EffectiveFrom:  yesterday,
-		// 				EffectiveTo:    timePtr(tomorrow),
-		// 			},
-		// 			{
-		// 				RuleName:       "Premium Merchant Bonus",
-		// 				ConditionType:  "program_rule_transaction_merchant_group",
-		// 				ConditionValue: "premium",
-		// 				Multiplier:     2.0,
-		// 				PointsAwarded:  50,
-		// 				EffectiveFrom:  yesterday,
-		// 				EffectiveTo:    timePtr(tomorrow),
-		// 			},
-		// 			{
-		// 				RuleName:       "Loyal Customer Bonus",
-		// 				ConditionType:  "program_rule_tenure",
-		// 				ConditionValue: "365",
-		// 				Multiplier:     1.5,
-		// 				PointsAwarded:  100,
-		// 				EffectiveFrom:  yesterday,
-		// 				EffectiveTo:    timePtr(tomorrow),
-		// 			},
-		// 			{
-		// 				RuleName:       "Frequent Shopper Bonus",
-		// 				ConditionType:  "program_rule_transaction_count",
-		// 				ConditionValue: "10",
-		// 				Multiplier:     1.0,
-		// 				PointsAwarded:  200,
-		// 				EffectiveFrom:  yesterday,
-		// 				EffectiveTo:    timePtr(tomorrow),
-		// 			},
+		// 	rules: []*domain.ProgramRule{
+		// 		{
+		// 			RuleName:       "Base Points",
+		// 			ConditionType:  "program_rule_transaction_amount",
+		// 			ConditionValue: "0",
+		// 			Multiplier:     1.0,
+		// 			PointsAwarded:  0,
+		// 			EffectiveFrom:  yesterday,
+		// 			EffectiveTo:    timePtr(tomorrow),
+		// 		},
+		// 		{
+		// 			RuleName:       "Premium Merchant Bonus",
+		// 			ConditionType:  "program_rule_transaction_merchant_group",
+		// 			ConditionValue: "premium",
+		// 			Multiplier:     2.0,
+		// 			PointsAwarded:  50,
+		// 			EffectiveFrom:  yesterday,
+		// 			EffectiveTo:    timePtr(tomorrow),
+		// 		},
+		// 		{
+		// 			RuleName:       "Loyal Customer Bonus",
+		// 			ConditionType:  "program_rule_tenure",
+		// 			ConditionValue: "365",
+		// 			Multiplier:     1.5,
+		// 			PointsAwarded:  100,
+		// 			EffectiveFrom:  yesterday,
+		// 			EffectiveTo:    timePtr(tomorrow),
+		// 		},
+		// 		{
+		// 			RuleName:       "Frequent Shopper Bonus",
+		// 			ConditionType:  "program_rule_transaction_count",
+		// 			ConditionValue: "10",
+		// 			Multiplier:     1.0,
+		// 			PointsAwarded:  200,
+		// 			EffectiveFrom:  yesterday,
+		// 			EffectiveTo:    timePtr(tomorrow),
 		// 		},
 		// 	},
-		// 	tx: Transaction{
-		// 		Amount:           300.0,
+		// 	rc: &domain.RuleContext{
+		// 		Transaction: &domain.Transaction{
+		// 			TransactionAmount: 300.0,
+		// 			TransactionDate:   now,
+		// 		},
 		// 		MerchantGroupID:  "premium",
 		// 		MembershipTenure: 400,
 		// 		TransactionCount: 15,
@@ -275,32 +279,32 @@ func TestCalculatePoints(t *testing.T) {
 		// },
 		{
 			name: "Category Specific with Minimum Spend",
-			program: Program{
-				ProgramID: "prog10",
-				Rules: []ProgramRule{
-					{
-						RuleName:       "Electronics Category Base",
-						ConditionType:  "program_rule_transaction_category",
-						ConditionValue: "electronics",
-						Multiplier:     1.0,
-						PointsAwarded:  50,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
-					{
-						RuleName:       "High Value Purchase Bonus",
-						ConditionType:  "program_rule_transaction_amount",
-						ConditionValue: "500",
-						Multiplier:     2.0,
-						PointsAwarded:  100,
-						EffectiveFrom:  yesterday,
-						EffectiveTo:    timePtr(tomorrow),
-					},
+			rules: []*domain.ProgramRule{
+				{
+					RuleName:       "Electronics Category Base",
+					ConditionType:  "program_rule_transaction_category",
+					ConditionValue: "electronics",
+					Multiplier:     1.0,
+					PointsAwarded:  50,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
+				},
+				{
+					RuleName:       "High Value Purchase Bonus",
+					ConditionType:  "program_rule_transaction_amount",
+					ConditionValue: "500",
+					Multiplier:     2.0,
+					PointsAwarded:  100,
+					EffectiveFrom:  yesterday,
+					EffectiveTo:    timePtr(tomorrow),
 				},
 			},
-			tx: Transaction{
-				Amount:   600.0,
-				Category: "electronics",
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 600.0,
+					Category:          "electronics",
+					TransactionDate:   now,
+				},
 			},
 			expected: 250.0, // 50 (category) + 200 (high value)
 		},
@@ -308,7 +312,7 @@ func TestCalculatePoints(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := calculatePoints(tt.program, tt.tx)
+			got := calculatePoints(compileRules(tt.rules), tt.rc)
 			if got != tt.expected {
 				t.Errorf("calculatePoints() = %v, want %v", got, tt.expected)
 			}
@@ -317,64 +321,78 @@ func TestCalculatePoints(t *testing.T) {
 }
 
 func TestEvaluateRule(t *testing.T) {
+	now := time.Now()
+
 	tests := []struct {
 		name        string
-		rule        ProgramRule
-		tx          Transaction
+		rule        *domain.ProgramRule
+		rc          *domain.RuleContext
 		wantMatches bool
 		wantPoints  float64
 	}{
 		{
 			name: "Transaction Amount Rule - Above Threshold",
-			rule: ProgramRule{
+			rule: &domain.ProgramRule{
 				ConditionType:  "program_rule_transaction_amount",
 				ConditionValue: "100",
 				Multiplier:     0.1,
 				PointsAwarded:  0,
 			},
-			tx: Transaction{
-				Amount: 150.0,
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 150.0,
+					TransactionDate:   now,
+				},
 			},
 			wantMatches: true,
 			wantPoints:  15.0, // 150 * 0.1
 		},
 		{
 			name: "Transaction Amount Rule - Below Threshold",
-			rule: ProgramRule{
+			rule: &domain.ProgramRule{
 				ConditionType:  "program_rule_transaction_amount",
 				ConditionValue: "100",
 				Multiplier:     0.1,
 				PointsAwarded:  0,
 			},
-			tx: Transaction{
-				Amount: 50.0,
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionAmount: 50.0,
+					TransactionDate:   now,
+				},
 			},
 			wantMatches: false,
 			wantPoints:  0,
 		},
 		{
 			name: "Transaction Type Rule - Matching",
-			rule: ProgramRule{
+			rule: &domain.ProgramRule{
 				ConditionType:  "program_rule_transaction_type",
 				ConditionValue: "credit_card",
 				Multiplier:     2.0,
 				PointsAwarded:  50,
 			},
-			tx: Transaction{
-				Type: "credit_card",
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionType: "credit_card",
+					TransactionDate: now,
+				},
 			},
 			wantMatches: true,
 			wantPoints:  100.0, // 50 * 2
 		},
 		{
 			name: "Membership Tenure Rule - Exceeding",
-			rule: ProgramRule{
+			rule: &domain.ProgramRule{
 				ConditionType:  "program_rule_tenure",
 				ConditionValue: "365",
 				Multiplier:     1.0,
 				PointsAwarded:  1000,
 			},
-			tx: Transaction{
+			rc: &domain.RuleContext{
+				Transaction: &domain.Transaction{
+					TransactionDate: now,
+				},
 				MembershipTenure: 400,
 			},
 			wantMatches: true,
@@ -384,7 +402,7 @@ func TestEvaluateRule(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotMatches, gotPoints := evaluateRule(tt.rule, tt.tx)
+			gotMatches, gotPoints := evaluateRule(compileRule(tt.rule), tt.rc)
 			if gotMatches != tt.wantMatches {
 				t.Errorf("evaluateRule() matches = %v, want %v", gotMatches, tt.wantMatches)
 			}
@@ -394,3 +412,198 @@ func TestEvaluateRule(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculatePoints_Stacking(t *testing.T) {
+	intPtr := func(i int) *int {
+		return &i
+	}
+
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	cappedRuleID := uuid.New()
+
+	// Every rule below matches a 100 purchase
+	weekend := &domain.ProgramRule{
+		RuleName:       "2x weekend",
+		ConditionType:  "program_rule_transaction_amount",
+		ConditionValue: "0",
+		Multiplier:     2.0,
+		Priority:       10,
+		Stacking:       domain.RuleNonStackable,
+		EffectiveFrom:  yesterday,
+	}
+	holiday := &domain.ProgramRule{
+		RuleName:       "3x holiday",
+		ConditionType:  "program_rule_transaction_amount",
+		ConditionValue: "0",
+		Multiplier:     3.0,
+		Priority:       20,
+		Stacking:       domain.RuleNonStackable,
+		EffectiveFrom:  yesterday,
+	}
+	welcome := &domain.ProgramRule{
+		RuleName:       "Welcome bonus",
+		ConditionType:  "program_rule_transaction_type",
+		ConditionValue: "purchase",
+		Multiplier:     1.0,
+		PointsAwarded:  25,
+		EffectiveFrom:  yesterday,
+	}
+
+	tests := []struct {
+		name     string
+		rules    []*domain.ProgramRule
+		rc       *domain.RuleContext
+		expected float64
+	}{
+		{
+			name:     "Non Stackable - Highest Priority Wins",
+			rules:    []*domain.ProgramRule{weekend, holiday},
+			expected: 300.0, // 3x holiday only
+		},
+		{
+			name:     "Non Stackable - Stackable Rules Still Add Up",
+			rules:    []*domain.ProgramRule{welcome, weekend, holiday},
+			expected: 325.0, // 3x holiday + 25 welcome
+		},
+		{
+			name: "Exclusive - Only Rule Applied",
+			rules: []*domain.ProgramRule{welcome, holiday, {
+				RuleName:       "Flash sale",
+				ConditionType:  "program_rule_transaction_amount",
+				ConditionValue: "0",
+				Multiplier:     5.0,
+				Priority:       1,
+				Stacking:       domain.RuleExclusive,
+				EffectiveFrom:  yesterday,
+			}},
+			expected: 500.0,
+		},
+		{
+			name: "Exclusive - Highest Priority Exclusive Wins",
+			rules: []*domain.ProgramRule{{
+				RuleName:       "Flash sale",
+				ConditionType:  "program_rule_transaction_amount",
+				ConditionValue: "0",
+				Multiplier:     5.0,
+				Priority:       1,
+				Stacking:       domain.RuleExclusive,
+				EffectiveFrom:  yesterday,
+			}, {
+				RuleName:       "Member day",
+				ConditionType:  "program_rule_transaction_amount",
+				ConditionValue: "0",
+				Multiplier:     4.0,
+				Priority:       2,
+				Stacking:       domain.RuleExclusive,
+				EffectiveFrom:  yesterday,
+			}},
+			expected: 400.0,
+		},
+		{
+			name: "Per Transaction Cap",
+			rules: []*domain.ProgramRule{{
+				RuleName:                "3x holiday, at most 150",
+				ConditionType:           "program_rule_transaction_amount",
+				ConditionValue:          "0",
+				Multiplier:              3.0,
+				MaxPointsPerTransaction: intPtr(150),
+				EffectiveFrom:           yesterday,
+			}},
+			expected: 150.0,
+		},
+		{
+			name: "Per Customer Cap - Partly Used",
+			rules: []*domain.ProgramRule{{
+				ID:                            cappedRuleID,
+				RuleName:                      "3x holiday, at most 1000 a month",
+				ConditionType:                 "program_rule_transaction_amount",
+				ConditionValue:                "0",
+				Multiplier:                    3.0,
+				MaxPointsPerCustomerPerPeriod: intPtr(1000),
+				CapPeriod:                     domain.CapPeriodMonth,
+				EffectiveFrom:                 yesterday,
+			}},
+			rc: &domain.RuleContext{
+				PeriodAwards: map[uuid.UUID]int{cappedRuleID: 900},
+			},
+			expected: 100.0,
+		},
+		{
+			name: "Per Customer Cap - Used Up Rule Does Not Block Others",
+			rules: []*domain.ProgramRule{weekend, {
+				ID:                            cappedRuleID,
+				RuleName:                      "3x holiday, at most 1000 a month",
+				ConditionType:                 "program_rule_transaction_amount",
+				ConditionValue:                "0",
+				Multiplier:                    3.0,
+				Priority:                      20,
+				Stacking:                      domain.RuleNonStackable,
+				MaxPointsPerCustomerPerPeriod: intPtr(1000),
+				CapPeriod:                     domain.CapPeriodMonth,
+				EffectiveFrom:                 yesterday,
+			}},
+			rc: &domain.RuleContext{
+				PeriodAwards: map[uuid.UUID]int{cappedRuleID: 1000},
+			},
+			expected: 200.0, // falls back to 2x weekend
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := tt.rc
+			if rc == nil {
+				rc = &domain.RuleContext{}
+			}
+			rc.Transaction = &domain.Transaction{
+				TransactionType:   "purchase",
+				TransactionAmount: 100.0,
+				TransactionDate:   now,
+			}
+
+			got := calculatePoints(compileRules(tt.rules), rc)
+			if got != tt.expected {
+				t.Errorf("calculatePoints() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCapPeriodBounds(t *testing.T) {
+	// A Wednesday afternoon
+	at := time.Date(2024, time.March, 13, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		period   string
+		wantFrom time.Time
+		wantTo   time.Time
+	}{
+		{domain.CapPeriodDay, time.Date(2024, time.March, 13, 0, 0, 0, 0, time.UTC), time.Date(2024, time.March, 14, 0, 0, 0, 0, time.UTC)},
+		{domain.CapPeriodWeek, time.Date(2024, time.March, 11, 0, 0, 0, 0, time.UTC), time.Date(2024, time.March, 18, 0, 0, 0, 0, time.UTC)},
+		{domain.CapPeriodMonth, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{domain.CapPeriodYear, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			from, to := capPeriodBounds(tt.period, at, time.UTC)
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Errorf("capPeriodBounds() = [%v, %v), want [%v, %v)", from, to, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestCapPeriodBounds_MerchantTimezone(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	// Late on Wednesday in UTC is already Thursday in Tokyo
+	at := time.Date(2024, time.March, 13, 23, 30, 0, 0, time.UTC)
+
+	from, to := capPeriodBounds(domain.CapPeriodDay, at, tokyo)
+
+	wantFrom := time.Date(2024, time.March, 14, 0, 0, 0, 0, tokyo)
+	if !from.Equal(wantFrom) || !to.Equal(wantFrom.AddDate(0, 0, 1)) {
+		t.Errorf("capPeriodBounds() = [%v, %v), want [%v, %v)", from, to, wantFrom, wantFrom.AddDate(0, 0, 1))
+	}
+}
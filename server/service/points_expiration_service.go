@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const expirationBatchSize = 500
+
+type PointsExpirationService struct {
+	expirationRepo domain.PointsExpirationRepository
+	pointsRepo     domain.PointsRepository
+	programRepo    domain.ProgramRepository
+	merchantRepo   domain.MerchantRepository
+	running        sync.Mutex
+	logger         zerolog.Logger
+}
+
+func NewPointsExpirationService(
+	expirationRepo domain.PointsExpirationRepository,
+	pointsRepo domain.PointsRepository,
+	programRepo domain.ProgramRepository,
+	merchantRepo domain.MerchantRepository,
+) *PointsExpirationService {
+	return &PointsExpirationService{
+		expirationRepo: expirationRepo,
+		pointsRepo:     pointsRepo,
+		programRepo:    programRepo,
+		merchantRepo:   merchantRepo,
+		logger:         logging.GetLogger(),
+	}
+}
+
+func (s *PointsExpirationService) SetPolicy(ctx context.Context, programID string, req *domain.SetPointsExpiryPolicyRequest) (*domain.PointsExpiryPolicy, error) {
+	program, err := s.getProgram(ctx, programID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Policy {
+	case domain.ExpiryFixedDays, domain.ExpiryInactivity:
+		if req.Days == nil || *req.Days <= 0 {
+			s.logger.Error().
+				Str("policy", req.Policy).
+				Msg("Expiry policy needs days")
+			return nil, domain.NewValidationError("days", "days must be greater than 0 for "+req.Policy)
+		}
+	case domain.ExpiryCalendarYear:
+		if req.Days != nil {
+			s.logger.Error().
+				Msg("Calendar year expiry policy with days")
+			return nil, domain.NewValidationError("days", "days cannot be set for calendar_year")
+		}
+	default:
+		s.logger.Error().
+			Str("policy", req.Policy).
+			Msg("Invalid expiry policy")
+		return nil, domain.NewValidationError("policy", "policy must be one of fixed_days, calendar_year, inactivity")
+	}
+
+	policy := &domain.PointsExpiryPolicy{
+		ProgramID: program.ID,
+		Policy:    req.Policy,
+		Days:      req.Days,
+	}
+	if err := s.expirationRepo.UpsertPolicy(ctx, policy); err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error saving points expiry policy")
+		return nil, domain.NewSystemError("PointsExpirationService.SetPolicy", err, "failed to save points expiry policy")
+	}
+
+	return policy, nil
+}
+
+func (s *PointsExpirationService) GetPolicy(ctx context.Context, programID string) (*domain.PointsExpiryPolicy, error) {
+	pID, err := uuid.Parse(programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid program ID format")
+		return nil, domain.NewValidationError("program_id", "invalid program ID format")
+	}
+
+	policy, err := s.expirationRepo.GetPolicy(ctx, pID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting points expiry policy")
+		return nil, domain.NewSystemError("PointsExpirationService.GetPolicy", err, "failed to get points expiry policy")
+	}
+	if policy == nil {
+		s.logger.Error().
+			Msg("Points expiry policy not found")
+		return nil, domain.NewResourceNotFoundError("points expiry policy", programID, "program points do not expire")
+	}
+
+	return policy, nil
+}
+
+// DeletePolicy stops the program's points from expiring. Points that already
+// expired stay expired, and points already earned keep the expiry they were
+// earned with.
+func (s *PointsExpirationService) DeletePolicy(ctx context.Context, programID string) error {
+	pID, err := uuid.Parse(programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid program ID format")
+		return domain.NewValidationError("program_id", "invalid program ID format")
+	}
+
+	if err := s.expirationRepo.DeletePolicy(ctx, pID); err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error deleting points expiry policy")
+		if domain.IsResourceNotFoundError(err) {
+			return err
+		}
+		return domain.NewSystemError("PointsExpirationService.DeletePolicy", err, "failed to delete points expiry policy")
+	}
+
+	return nil
+}
+
+// ExpiresAt is when points earned at earnedAt expire under the program's
+// current policy. It is nil when they do not expire on a set date.
+func (s *PointsExpirationService) ExpiresAt(ctx context.Context, programID uuid.UUID, earnedAt time.Time) (*time.Time, error) {
+	policy, err := s.expirationRepo.GetPolicy(ctx, programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting points expiry policy")
+		return nil, domain.NewSystemError("PointsExpirationService.ExpiresAt", err, "failed to get points expiry policy")
+	}
+	if policy == nil || policy.Policy == domain.ExpiryInactivity {
+		return nil, nil
+	}
+
+	location, err := s.programLocation(ctx, programID)
+	if err != nil {
+		return nil, err
+	}
+	return lotExpiry(policy, earnedAt, location), nil
+}
+
+// GetUpcoming lists when the customer's unspent points expire, soonest first.
+func (s *PointsExpirationService) GetUpcoming(ctx context.Context, customerID, programID uuid.UUID) (*domain.UpcomingExpirations, error) {
+	lots, err := s.pointsRepo.GetLots(ctx, customerID, programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting points lots")
+		return nil, domain.NewSystemError("PointsExpirationService.GetUpcoming", err, "failed to get points lots")
+	}
+
+	result := &domain.UpcomingExpirations{
+		CustomerID:  customerID,
+		ProgramID:   programID,
+		Expirations: []domain.PointsExpiration{},
+	}
+	for _, lot := range lots {
+		result.Balance += lot.Remaining
+	}
+
+	policy, err := s.expirationRepo.GetPolicy(ctx, programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting points expiry policy")
+		return nil, domain.NewSystemError("PointsExpirationService.GetUpcoming", err, "failed to get points expiry policy")
+	}
+
+	var last time.Time
+	if policy != nil {
+		result.Policy = policy.Policy
+		if policy.Policy == domain.ExpiryInactivity {
+			entries, err := s.pointsRepo.GetByCustomerAndProgram(ctx, customerID, programID)
+			if err != nil {
+				s.logger.Error().
+					Err(err).
+					Msg("Error getting points ledger")
+				return nil, domain.NewSystemError("PointsExpirationService.GetUpcoming", err, "failed to get points ledger")
+			}
+			last = lastActivity(entries)
+		}
+	}
+	result.Expirations = expirationSchedule(policy, lots, last)
+
+	return result, nil
+}
+
+// ExpirePoints writes an expiration entry for every account holding lots that
+// expired at or before now, then for every customer of an inactivity program
+// that has been inactive for too long. An account that fails is logged and
+// skipped, the next run picks it up again. Runs do not overlap.
+func (s *PointsExpirationService) ExpirePoints(ctx context.Context, now time.Time) (*domain.PointsExpirationRun, error) {
+	run := &domain.PointsExpirationRun{}
+	if !s.running.TryLock() {
+		s.logger.Info().
+			Msg("Points expiration already running")
+		return run, nil
+	}
+	defer s.running.Unlock()
+
+	if err := s.expireDatedLots(ctx, now, run); err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error expiring dated points lots")
+		return nil, domain.NewSystemError("PointsExpirationService.ExpirePoints", err, "failed to expire dated points lots")
+	}
+
+	policies, err := s.expirationRepo.GetPolicies(ctx)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting points expiry policies")
+		return nil, domain.NewSystemError("PointsExpirationService.ExpirePoints", err, "failed to get points expiry policies")
+	}
+
+	for _, policy := range policies {
+		if policy.Policy != domain.ExpiryInactivity {
+			continue
+		}
+		if err := s.expireInactiveCustomers(ctx, policy, now, run); err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("program_id", policy.ProgramID.String()).
+				Msg("Error expiring inactive customers")
+			run.Failures++
+		}
+	}
+
+	s.logger.Info().
+		Int("accounts_processed", run.AccountsProcessed).
+		Int("accounts_expired", run.AccountsExpired).
+		Int("points_expired", run.PointsExpired).
+		Int("failures", run.Failures).
+		Msg("Points expiration run finished")
+
+	return run, nil
+}
+
+func (s *PointsExpirationService) expireDatedLots(ctx context.Context, now time.Time, run *domain.PointsExpirationRun) error {
+	var after domain.PointsAccount
+	for {
+		accounts, err := s.expirationRepo.GetExpiredAccounts(ctx, now, after, expirationBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, account := range accounts {
+			s.expireAccount(ctx, account, &now, run)
+		}
+
+		if len(accounts) < expirationBatchSize {
+			return nil
+		}
+		after = accounts[len(accounts)-1]
+	}
+}
+
+func (s *PointsExpirationService) expireInactiveCustomers(ctx context.Context, policy *domain.PointsExpiryPolicy, now time.Time, run *domain.PointsExpirationRun) error {
+	inactiveSince := now.AddDate(0, 0, -*policy.Days)
+	afterID := uuid.Nil
+	for {
+		customerIDs, err := s.expirationRepo.GetInactiveCustomers(ctx, policy.ProgramID, inactiveSince, afterID, expirationBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, customerID := range customerIDs {
+			s.expireAccount(ctx, domain.PointsAccount{MerchantCustomersID: customerID, ProgramID: policy.ProgramID}, nil, run)
+		}
+
+		if len(customerIDs) < expirationBatchSize {
+			return nil
+		}
+		afterID = customerIDs[len(customerIDs)-1]
+	}
+}
+
+func (s *PointsExpirationService) expireAccount(ctx context.Context, account domain.PointsAccount, dueBy *time.Time, run *domain.PointsExpirationRun) {
+	run.AccountsProcessed++
+	ledger, err := s.expirationRepo.ExpireLots(ctx, account.MerchantCustomersID, account.ProgramID, dueBy)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("program_id", account.ProgramID.String()).
+			Str("customer_id", account.MerchantCustomersID.String()).
+			Msg("Error expiring customer points")
+		run.Failures++
+		return
+	}
+	if ledger != nil {
+		run.AccountsExpired++
+		run.PointsExpired += ledger.PointsRedeemed
+	}
+}
+
+func (s *PointsExpirationService) getProgram(ctx context.Context, programID string) (*domain.Program, error) {
+	pID, err := uuid.Parse(programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid program ID format")
+		return nil, domain.NewValidationError("program_id", "invalid program ID format")
+	}
+
+	program, err := s.programRepo.GetByID(ctx, pID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting program")
+		return nil, domain.NewSystemError("PointsExpirationService.getProgram", err, "failed to get program")
+	}
+	if program == nil {
+		s.logger.Error().
+			Msg("Program not found")
+		return nil, domain.NewResourceNotFoundError("program", programID, "program not found")
+	}
+	return program, nil
+}
+
+// programLocation is the timezone of the program's merchant, calendar year
+// expiries follow the merchant's new year.
+func (s *PointsExpirationService) programLocation(ctx context.Context, programID uuid.UUID) (*time.Location, error) {
+	program, err := s.getProgram(ctx, programID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	merchant, err := s.merchantRepo.GetByID(ctx, program.MerchantID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting merchant")
+		return nil, err
+	}
+	return merchant.Location(), nil
+}
+
+// lastActivity is the time of the customer's last earn or redemption.
+func lastActivity(entries []*domain.PointsLedger) time.Time {
+	var last time.Time
+	for _, entry := range entries {
+		if entry.TxType != domain.PointTxExpiration && entry.CreatedAt.After(last) {
+			last = entry.CreatedAt
+		}
+	}
+	return last
+}
+
+// lotExpiry is when points earned at earnedAt expire under a dated policy.
+func lotExpiry(policy *domain.PointsExpiryPolicy, earnedAt time.Time, location *time.Location) *time.Time {
+	var expiresAt time.Time
+	switch policy.Policy {
+	case domain.ExpiryFixedDays:
+		expiresAt = earnedAt.AddDate(0, 0, *policy.Days)
+	case domain.ExpiryCalendarYear:
+		expiresAt = time.Date(earnedAt.In(location).Year()+1, time.January, 1, 0, 0, 0, 0, location)
+	default:
+		return nil
+	}
+	return &expiresAt
+}
+
+// expirationSchedule groups the unspent lots by expiry, soonest first. A lot
+// keeps the expiry it was earned with; lots without one expire together on
+// inactivity, or not at all.
+func expirationSchedule(policy *domain.PointsExpiryPolicy, lots []*domain.PointsLot, lastActivity time.Time) []domain.PointsExpiration {
+	var inactiveAt *time.Time
+	if policy != nil && policy.Policy == domain.ExpiryInactivity {
+		at := lastActivity.AddDate(0, 0, *policy.Days)
+		inactiveAt = &at
+	}
+
+	schedule := []domain.PointsExpiration{}
+	for _, lot := range lots {
+		expiresAt := lot.ExpiresAt
+		if expiresAt == nil {
+			expiresAt = inactiveAt
+		}
+		if expiresAt == nil {
+			continue
+		}
+		schedule = append(schedule, domain.PointsExpiration{ExpiresAt: *expiresAt, Points: lot.Remaining})
+	}
+
+	sort.SliceStable(schedule, func(i, j int) bool {
+		return schedule[i].ExpiresAt.Before(schedule[j].ExpiresAt)
+	})
+	grouped := schedule[:0]
+	for _, expiration := range schedule {
+		if n := len(grouped); n > 0 && grouped[n-1].ExpiresAt.Equal(expiration.ExpiresAt) {
+			grouped[n-1].Points += expiration.Points
+			continue
+		}
+		grouped = append(grouped, expiration)
+	}
+	return grouped
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockPointsExpirationRepository struct {
+	mock.Mock
+}
+
+func (m *mockPointsExpirationRepository) UpsertPolicy(ctx context.Context, policy *domain.PointsExpiryPolicy) error {
+	args := m.Called(ctx, policy)
+	return args.Error(0)
+}
+
+func (m *mockPointsExpirationRepository) GetPolicy(ctx context.Context, programID uuid.UUID) (*domain.PointsExpiryPolicy, error) {
+	args := m.Called(ctx, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsExpiryPolicy), args.Error(1)
+}
+
+func (m *mockPointsExpirationRepository) GetPolicies(ctx context.Context) ([]*domain.PointsExpiryPolicy, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.PointsExpiryPolicy), args.Error(1)
+}
+
+func (m *mockPointsExpirationRepository) DeletePolicy(ctx context.Context, programID uuid.UUID) error {
+	args := m.Called(ctx, programID)
+	return args.Error(0)
+}
+
+func (m *mockPointsExpirationRepository) GetExpiredAccounts(ctx context.Context, dueBy time.Time, after domain.PointsAccount, limit int) ([]domain.PointsAccount, error) {
+	args := m.Called(ctx, dueBy, after, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.PointsAccount), args.Error(1)
+}
+
+func (m *mockPointsExpirationRepository) GetInactiveCustomers(ctx context.Context, programID uuid.UUID, inactiveSince time.Time, afterID uuid.UUID, limit int) ([]uuid.UUID, error) {
+	args := m.Called(ctx, programID, inactiveSince, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+func (m *mockPointsExpirationRepository) ExpireLots(ctx context.Context, customerID, programID uuid.UUID, dueBy *time.Time) (*domain.PointsLedger, error) {
+	args := m.Called(ctx, customerID, programID, dueBy)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsLedger), args.Error(1)
+}
+
+func TestLotExpiry(t *testing.T) {
+	jakarta, _ := time.LoadLocation("Asia/Jakarta")
+	earnedAt := time.Date(2024, time.January, 15, 12, 0, 0, 0, time.UTC)
+
+	t.Run("fixed days", func(t *testing.T) {
+		days := 90
+		policy := &domain.PointsExpiryPolicy{Policy: domain.ExpiryFixedDays, Days: &days}
+
+		assert.Equal(t, time.Date(2024, time.April, 14, 12, 0, 0, 0, time.UTC), *lotExpiry(policy, earnedAt, time.UTC))
+	})
+
+	t.Run("calendar year in the merchant's timezone", func(t *testing.T) {
+		policy := &domain.PointsExpiryPolicy{Policy: domain.ExpiryCalendarYear}
+		// 1 January 2025 in Jakarta
+		lateEarn := time.Date(2024, time.December, 31, 20, 0, 0, 0, time.UTC)
+
+		assert.True(t, lotExpiry(policy, earnedAt, jakarta).Equal(time.Date(2025, time.January, 1, 0, 0, 0, 0, jakarta)))
+		assert.True(t, lotExpiry(policy, lateEarn, jakarta).Equal(time.Date(2026, time.January, 1, 0, 0, 0, 0, jakarta)))
+	})
+
+	t.Run("inactivity has no date", func(t *testing.T) {
+		days := 30
+		policy := &domain.PointsExpiryPolicy{Policy: domain.ExpiryInactivity, Days: &days}
+
+		assert.Nil(t, lotExpiry(policy, earnedAt, time.UTC))
+	})
+}
+
+func TestExpirationSchedule(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 12, 0, 0, 0, time.UTC) }
+	at := func(month time.Month, d int) *time.Time { t := day(month, d); return &t }
+
+	t.Run("lots keep the expiry they were earned with", func(t *testing.T) {
+		lots := []*domain.PointsLot{
+			{EarnedAt: day(time.January, 1), Remaining: 80, ExpiresAt: at(time.June, 1)},
+			// Earned after the policy was shortened
+			{EarnedAt: day(time.February, 1), Remaining: 50, ExpiresAt: at(time.May, 1)},
+			{EarnedAt: day(time.March, 1), Remaining: 20, ExpiresAt: at(time.June, 1)},
+			// Earned before the program had a policy
+			{EarnedAt: day(time.March, 2), Remaining: 10},
+		}
+
+		schedule := expirationSchedule(nil, lots, time.Time{})
+
+		assert.Equal(t, []domain.PointsExpiration{
+			{ExpiresAt: day(time.May, 1), Points: 50},
+			{ExpiresAt: day(time.June, 1), Points: 100},
+		}, schedule)
+	})
+
+	t.Run("inactivity expires undated lots together", func(t *testing.T) {
+		days := 30
+		policy := &domain.PointsExpiryPolicy{Policy: domain.ExpiryInactivity, Days: &days}
+		lots := []*domain.PointsLot{
+			{EarnedAt: day(time.January, 1), Remaining: 80},
+			{EarnedAt: day(time.March, 1), Remaining: 40},
+		}
+		entries := []*domain.PointsLedger{
+			{PointsRedeemed: 10, TxType: domain.PointTxExpiration, CreatedAt: day(time.April, 1)},
+			{PointsEarned: 40, CreatedAt: day(time.March, 1)},
+			{PointsEarned: 90, CreatedAt: day(time.January, 1)},
+		}
+
+		schedule := expirationSchedule(policy, lots, lastActivity(entries))
+
+		// An expiration is not activity, the clock runs from the March earn
+		assert.Equal(t, []domain.PointsExpiration{{ExpiresAt: day(time.March, 31), Points: 120}}, schedule)
+	})
+}
+
+func TestPointsExpirationService_ExpirePoints(t *testing.T) {
+	fixedProgram := uuid.New()
+	inactivityProgram := uuid.New()
+	expiring := uuid.New()
+	failing := uuid.New()
+	inactive := uuid.New()
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	fixedDays, inactivityDays := 90, 30
+
+	expirationRepo := new(mockPointsExpirationRepository)
+	svc := NewPointsExpirationService(expirationRepo, nil, nil, nil)
+
+	expirationRepo.On("GetExpiredAccounts", mock.Anything, now, domain.PointsAccount{}, expirationBatchSize).
+		Return([]domain.PointsAccount{
+			{MerchantCustomersID: expiring, ProgramID: fixedProgram},
+			{MerchantCustomersID: failing, ProgramID: fixedProgram},
+		}, nil)
+	expirationRepo.On("ExpireLots", mock.Anything, expiring, fixedProgram, &now).
+		Return(&domain.PointsLedger{PointsRedeemed: 60, TxType: domain.PointTxExpiration}, nil)
+	expirationRepo.On("ExpireLots", mock.Anything, failing, fixedProgram, &now).
+		Return(nil, domain.NewSystemError("PointsExpirationRepository.ExpireLots", assert.AnError, "failed to lock expired points lots"))
+
+	expirationRepo.On("GetPolicies", mock.Anything).Return([]*domain.PointsExpiryPolicy{
+		{ProgramID: fixedProgram, Policy: domain.ExpiryFixedDays, Days: &fixedDays},
+		{ProgramID: inactivityProgram, Policy: domain.ExpiryInactivity, Days: &inactivityDays},
+	}, nil)
+	expirationRepo.On("GetInactiveCustomers", mock.Anything, inactivityProgram, now.AddDate(0, 0, -30), uuid.Nil, expirationBatchSize).
+		Return([]uuid.UUID{inactive}, nil)
+	expirationRepo.On("ExpireLots", mock.Anything, inactive, inactivityProgram, (*time.Time)(nil)).
+		Return(&domain.PointsLedger{PointsRedeemed: 25, TxType: domain.PointTxExpiration}, nil)
+
+	run, err := svc.ExpirePoints(context.Background(), now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &domain.PointsExpirationRun{
+		AccountsProcessed: 3,
+		AccountsExpired:   2,
+		PointsExpired:     85,
+		Failures:          1,
+	}, run)
+	expirationRepo.AssertExpectations(t)
+	expirationRepo.AssertNumberOfCalls(t, "GetInactiveCustomers", 1)
+}
+
+func TestPointsExpirationService_ExpiresAt(t *testing.T) {
+	jakarta, _ := time.LoadLocation("Asia/Jakarta")
+	programID := uuid.New()
+	merchantID := uuid.New()
+	earnedAt := time.Date(2024, time.December, 31, 20, 0, 0, 0, time.UTC)
+
+	t.Run("no policy", func(t *testing.T) {
+		expirationRepo := new(mockPointsExpirationRepository)
+		expirationRepo.On("GetPolicy", mock.Anything, programID).Return(nil, nil)
+		svc := NewPointsExpirationService(expirationRepo, nil, nil, nil)
+
+		expiresAt, err := svc.ExpiresAt(context.Background(), programID, earnedAt)
+
+		assert.NoError(t, err)
+		assert.Nil(t, expiresAt)
+	})
+
+	t.Run("calendar year in the merchant's timezone", func(t *testing.T) {
+		expirationRepo := new(mockPointsExpirationRepository)
+		programRepo := new(mockProgramRepository)
+		merchantRepo := new(mockMerchantRepository)
+		expirationRepo.On("GetPolicy", mock.Anything, programID).
+			Return(&domain.PointsExpiryPolicy{ProgramID: programID, Policy: domain.ExpiryCalendarYear}, nil)
+		programRepo.On("GetByID", mock.Anything, programID).Return(&domain.Program{ID: programID, MerchantID: merchantID}, nil)
+		merchantRepo.On("GetByID", mock.Anything, merchantID).Return(&domain.Merchant{ID: merchantID, Timezone: "Asia/Jakarta"}, nil)
+		svc := NewPointsExpirationService(expirationRepo, nil, programRepo, merchantRepo)
+
+		expiresAt, err := svc.ExpiresAt(context.Background(), programID, earnedAt)
+
+		assert.NoError(t, err)
+		assert.True(t, expiresAt.Equal(time.Date(2026, time.January, 1, 0, 0, 0, 0, jakarta)))
+	})
+}
+
+func TestPointsExpirationService_SetPolicy(t *testing.T) {
+	programID := uuid.New()
+
+	t.Run("fixed days needs days", func(t *testing.T) {
+		expirationRepo := new(mockPointsExpirationRepository)
+		programRepo := new(mockProgramRepository)
+		programRepo.On("GetByID", mock.Anything, programID).Return(&domain.Program{ID: programID}, nil)
+		svc := NewPointsExpirationService(expirationRepo, nil, programRepo, nil)
+
+		policy, err := svc.SetPolicy(context.Background(), programID.String(), &domain.SetPointsExpiryPolicyRequest{Policy: domain.ExpiryFixedDays})
+
+		assert.Nil(t, policy)
+		assert.True(t, domain.IsValidationError(err))
+		assert.Equal(t, "days", err.(domain.ValidationError).Field)
+		expirationRepo.AssertNotCalled(t, "UpsertPolicy", mock.Anything, mock.Anything)
+	})
+
+	t.Run("program not found", func(t *testing.T) {
+		programRepo := new(mockProgramRepository)
+		programRepo.On("GetByID", mock.Anything, programID).Return(nil, nil)
+		svc := NewPointsExpirationService(new(mockPointsExpirationRepository), nil, programRepo, nil)
+
+		policy, err := svc.SetPolicy(context.Background(), programID.String(), &domain.SetPointsExpiryPolicyRequest{Policy: domain.ExpiryCalendarYear})
+
+		assert.Nil(t, policy)
+		assert.True(t, domain.IsResourceNotFoundError(err))
+	})
+}
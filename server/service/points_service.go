@@ -4,6 +4,7 @@ import (
 	"context"
 	"math"
 	"strconv"
+	"time"
 
 	"go-playground/pkg/logging"
 	"go-playground/server/domain"
@@ -13,16 +14,31 @@ import (
 )
 
 type PointsService struct {
-	pointsRepo domain.PointsRepository
-	eventRepo  domain.EventLogRepository
-	logger     zerolog.Logger
+	pointsRepo  domain.PointsRepository
+	holdRepo    domain.PointsHoldRepository
+	eventRepo   domain.EventLogRepository
+	expiry      domain.PointsExpiryProvider
+	eventLogger domain.EventLoggerService
+	txManager   domain.TxManager
+	logger      zerolog.Logger
 }
 
-func NewPointsService(pointsRepo domain.PointsRepository, eventRepo domain.EventLogRepository) *PointsService {
+func NewPointsService(
+	pointsRepo domain.PointsRepository,
+	holdRepo domain.PointsHoldRepository,
+	eventRepo domain.EventLogRepository,
+	expiry domain.PointsExpiryProvider,
+	eventLogger domain.EventLoggerService,
+	txManager domain.TxManager,
+) *PointsService {
 	return &PointsService{
-		pointsRepo: pointsRepo,
-		eventRepo:  eventRepo,
-		logger:     logging.GetLogger(),
+		pointsRepo:  pointsRepo,
+		holdRepo:    holdRepo,
+		eventRepo:   eventRepo,
+		expiry:      expiry,
+		eventLogger: eventLogger,
+		txManager:   txManager,
+		logger:      logging.GetLogger(),
 	}
 }
 
@@ -52,20 +68,41 @@ func (s *PointsService) RedeemPoints(ctx context.Context, req *domain.PointsTran
 		return nil, domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points balance")
 	}
 
-	ledger, err := s.pointsRepo.Create(ctx, &domain.PointsLedger{
-		LedgerID:            uuid.New(),
-		MerchantCustomersID: uuid.MustParse(req.CustomerID),
-		ProgramID:           uuid.MustParse(req.ProgramID),
-		PointsEarned:        0,
-		PointsRedeemed:      absPointsRedeemed,
-		PointsBalance:       currentBalance - absPointsRedeemed,
-		TransactionID:       uuid.MustParse(req.TransactionID),
+	// The ledger entry and its points_redeemed event commit together
+	var ledger *domain.PointsLedger
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		ledger, err = s.pointsRepo.Create(ctx, &domain.PointsLedger{
+			LedgerID:            uuid.New(),
+			MerchantCustomersID: uuid.MustParse(req.CustomerID),
+			ProgramID:           uuid.MustParse(req.ProgramID),
+			PointsEarned:        0,
+			PointsRedeemed:      absPointsRedeemed,
+			PointsBalance:       currentBalance - absPointsRedeemed,
+			TransactionID:       uuid.MustParse(req.TransactionID),
+		})
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error creating points ledger entry")
+			// The lots are the source of truth, they can be spent by the time
+			// the redemption locks them
+			if domain.IsBusinessLogicError(err) {
+				return err
+			}
+			return domain.NewSystemError("PointsService.RedeemPoints", err, "failed to create points ledger entry")
+		}
+
+		if err := s.eventLogger.SavePointUpdateEvents(ctx, domain.PointsRedeemed, ledger); err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error saving points redeemed event")
+			return domain.NewSystemError("PointsService.RedeemPoints", err, "failed to save points redeemed event")
+		}
+		return nil
 	})
 	if err != nil {
-		s.logger.Error().
-			Err(err).
-			Msg("Error creating points ledger entry")
-		return nil, domain.NewSystemError("PointsService.RedeemPoints", err, "failed to create points ledger entry")
+		return nil, err
 	}
 
 	return &domain.PointsTransaction{
@@ -74,9 +111,82 @@ func (s *PointsService) RedeemPoints(ctx context.Context, req *domain.PointsTran
 		ProgramID:     ledger.ProgramID.String(),
 		Points:        ledger.PointsRedeemed,
 		Type:          "redeem",
+		Allocations:   ledger.Allocations,
+	}, nil
+}
+
+// ReversePoints takes back points of a refunded or cancelled transaction. When
+// the customer has already spent them, the refund policy decides whether the
+// reversal fails, takes back only what is left or overdraws the balance.
+func (s *PointsService) ReversePoints(ctx context.Context, req *domain.PointsTransaction, refundPolicy string) (*domain.PointsTransaction, error) {
+	if req.Points <= 0 {
+		s.logger.Error().
+			Str("points", strconv.Itoa(req.Points)).
+			Msg("Invalid points value")
+		return nil, domain.NewValidationError("points", "points must be greater than 0")
+	}
+
+	// The ledger entry and its points_redeemed event commit together. The
+	// balance is checked against the locked account, not read up front
+	var ledger *domain.PointsLedger
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		ledger, err = s.pointsRepo.Create(ctx, &domain.PointsLedger{
+			LedgerID:            uuid.New(),
+			MerchantCustomersID: uuid.MustParse(req.CustomerID),
+			ProgramID:           uuid.MustParse(req.ProgramID),
+			PointsRedeemed:      req.Points,
+			TransactionID:       uuid.MustParse(req.TransactionID),
+			TxType:              domain.PointTxReversal,
+			RefundPolicy:        refundPolicy,
+		})
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("refund_policy", refundPolicy).
+				Msg("Error creating points reversal entry")
+			if domain.IsBusinessLogicError(err) {
+				return err
+			}
+			return domain.NewSystemError("PointsService.ReversePoints", err, "failed to create points reversal entry")
+		}
+
+		if err := s.eventLogger.SavePointUpdateEvents(ctx, domain.PointsRedeemed, ledger); err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error saving points reversed event")
+			return domain.NewSystemError("PointsService.ReversePoints", err, "failed to save points reversed event")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.PointsTransaction{
+		TransactionID: ledger.TransactionID.String(),
+		CustomerID:    ledger.MerchantCustomersID.String(),
+		ProgramID:     ledger.ProgramID.String(),
+		Points:        ledger.PointsRedeemed,
+		Type:          "reverse",
+		Allocations:   ledger.Allocations,
 	}, nil
 }
 
+// GetTransactionPoints returns what a transaction's ledger entries earned and
+// redeemed in total.
+func (s *PointsService) GetTransactionPoints(ctx context.Context, transactionID uuid.UUID) (int, int, error) {
+	earned, redeemed, err := s.pointsRepo.SumByTransactionID(ctx, transactionID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("transaction_id", transactionID.String()).
+			Msg("Error getting transaction points")
+		return 0, 0, domain.NewSystemError("PointsService.GetTransactionPoints", err, "failed to get transaction points")
+	}
+	return earned, redeemed, nil
+}
+
 func (s *PointsService) GetLedger(ctx context.Context, customerID uuid.UUID, programID uuid.UUID) ([]*domain.PointsLedger, error) {
 	ledgers, err := s.pointsRepo.GetByCustomerAndProgram(ctx, customerID, programID)
 	if err != nil {
@@ -91,6 +201,18 @@ func (s *PointsService) GetLedger(ctx context.Context, customerID uuid.UUID, pro
 	return ledgers, nil
 }
 
+// GetLots lists the customer's unspent lots in the order redemptions consume them.
+func (s *PointsService) GetLots(ctx context.Context, customerID uuid.UUID, programID uuid.UUID) ([]*domain.PointsLot, error) {
+	lots, err := s.pointsRepo.GetLots(ctx, customerID, programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting points lots")
+		return nil, domain.NewSystemError("PointsService.GetLots", err, "failed to get points lots")
+	}
+	return lots, nil
+}
+
 func (s *PointsService) GetBalance(ctx context.Context, customerID uuid.UUID, programID uuid.UUID) (*domain.PointsBalance, error) {
 	balance, err := s.pointsRepo.GetCurrentBalance(ctx, customerID, programID)
 	if err != nil {
@@ -100,13 +222,121 @@ func (s *PointsService) GetBalance(ctx context.Context, customerID uuid.UUID, pr
 		return nil, domain.NewSystemError("PointsService.GetBalance", err, "failed to get points balance")
 	}
 
+	pending, err := s.holdRepo.SumHeld(ctx, customerID, programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting held points")
+		return nil, domain.NewSystemError("PointsService.GetBalance", err, "failed to get held points")
+	}
+
 	return &domain.PointsBalance{
 		CustomerID: customerID.String(),
 		ProgramID:  programID.String(),
 		Balance:    balance,
+		Pending:    pending,
 	}, nil
 }
 
+// HoldPoints sets aside the points a pending transaction earns. They are not
+// in the balance until the transaction completes and the hold is released.
+func (s *PointsService) HoldPoints(ctx context.Context, req *domain.PointsTransaction) (*domain.PointsHold, error) {
+	if req.Points <= 0 {
+		s.logger.Error().
+			Str("points", strconv.Itoa(req.Points)).
+			Msg("Invalid points value")
+		return nil, domain.NewValidationError("points", "points must be greater than 0")
+	}
+
+	hold := &domain.PointsHold{
+		TransactionID:       uuid.MustParse(req.TransactionID),
+		MerchantCustomersID: uuid.MustParse(req.CustomerID),
+		ProgramID:           uuid.MustParse(req.ProgramID),
+		Points:              req.Points,
+	}
+	if req.RuleSetID != "" {
+		id, err := uuid.Parse(req.RuleSetID)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Invalid rule set ID format")
+			return nil, domain.NewValidationError("rule_set_id", "invalid rule set ID format")
+		}
+		hold.RuleSetID = &id
+	}
+
+	if err := s.holdRepo.Create(ctx, hold); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("transaction_id", req.TransactionID).
+			Msg("Error creating points hold")
+		return nil, domain.NewSystemError("PointsService.HoldPoints", err, "failed to create points hold")
+	}
+	return hold, nil
+}
+
+// ReleaseHold earns the points held for a transaction. The points expire as
+// if they were earned on release.
+func (s *PointsService) ReleaseHold(ctx context.Context, transactionID uuid.UUID) (*domain.PointsHold, error) {
+	return s.resolveHold(ctx, transactionID, domain.PointsHoldReleased)
+}
+
+// VoidHold drops the points held for a transaction.
+func (s *PointsService) VoidHold(ctx context.Context, transactionID uuid.UUID) (*domain.PointsHold, error) {
+	return s.resolveHold(ctx, transactionID, domain.PointsHoldVoided)
+}
+
+// resolveHold moves a transaction's hold out of held under its row lock, so
+// a hold is released or voided once however many status updates race.
+func (s *PointsService) resolveHold(ctx context.Context, transactionID uuid.UUID, status string) (*domain.PointsHold, error) {
+	var hold *domain.PointsHold
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		hold, err = s.holdRepo.LockByTransactionID(ctx, transactionID)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("transaction_id", transactionID.String()).
+				Msg("Error locking points hold")
+			return domain.NewSystemError("PointsService.resolveHold", err, "failed to lock points hold")
+		}
+		if hold == nil || hold.Status != domain.PointsHoldHeld {
+			hold = nil
+			return nil
+		}
+
+		if status == domain.PointsHoldReleased {
+			req := &domain.PointsTransaction{
+				TransactionID: hold.TransactionID.String(),
+				CustomerID:    hold.MerchantCustomersID.String(),
+				ProgramID:     hold.ProgramID.String(),
+				Points:        hold.Points,
+			}
+			if hold.RuleSetID != nil {
+				req.RuleSetID = hold.RuleSetID.String()
+			}
+			if _, err := s.EarnPoints(ctx, req); err != nil {
+				return err
+			}
+		}
+
+		if err := s.holdRepo.Resolve(ctx, hold.HoldID, status); err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("hold_id", hold.HoldID.String()).
+				Str("status", status).
+				Msg("Error resolving points hold")
+			return domain.NewSystemError("PointsService.resolveHold", err, "failed to resolve points hold")
+		}
+		hold.Status = status
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
 func (s *PointsService) EarnPoints(ctx context.Context, req *domain.PointsTransaction) (*domain.PointsTransaction, error) {
 	if req.Points <= 0 {
 		s.logger.Error().
@@ -123,20 +353,62 @@ func (s *PointsService) EarnPoints(ctx context.Context, req *domain.PointsTransa
 		return nil, domain.NewSystemError("PointsService.EarnPoints", err, "failed to get current balance")
 	}
 
-	ledger, err := s.pointsRepo.Create(ctx, &domain.PointsLedger{
-		LedgerID:            uuid.New(),
-		MerchantCustomersID: uuid.MustParse(req.CustomerID),
-		ProgramID:           uuid.MustParse(req.ProgramID),
-		PointsEarned:        req.Points,
-		PointsRedeemed:      0,
-		PointsBalance:       currentBalance + req.Points,
-		TransactionID:       uuid.MustParse(req.TransactionID),
-	})
+	var ruleSetID *uuid.UUID
+	if req.RuleSetID != "" {
+		id, err := uuid.Parse(req.RuleSetID)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Invalid rule set ID format")
+			return nil, domain.NewValidationError("rule_set_id", "invalid rule set ID format")
+		}
+		ruleSetID = &id
+	}
+
+	earnedAt := req.EarnedAt
+	if earnedAt.IsZero() {
+		earnedAt = time.Now()
+	}
+	expiresAt, err := s.expiry.ExpiresAt(ctx, uuid.MustParse(req.ProgramID), earnedAt)
 	if err != nil {
 		s.logger.Error().
 			Err(err).
-			Msg("Error creating points ledger entry")
-		return nil, domain.NewSystemError("PointsService.EarnPoints", err, "failed to create points ledger entry")
+			Msg("Error getting points expiry")
+		return nil, domain.NewSystemError("PointsService.EarnPoints", err, "failed to get points expiry")
+	}
+
+	// The ledger entry and its points_earned event commit together
+	var ledger *domain.PointsLedger
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		ledger, err = s.pointsRepo.Create(ctx, &domain.PointsLedger{
+			LedgerID:            uuid.New(),
+			MerchantCustomersID: uuid.MustParse(req.CustomerID),
+			ProgramID:           uuid.MustParse(req.ProgramID),
+			PointsEarned:        req.Points,
+			PointsRedeemed:      0,
+			PointsBalance:       currentBalance + req.Points,
+			TransactionID:       uuid.MustParse(req.TransactionID),
+			RuleSetID:           ruleSetID,
+			ExpiresAt:           expiresAt,
+		})
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error creating points ledger entry")
+			return domain.NewSystemError("PointsService.EarnPoints", err, "failed to create points ledger entry")
+		}
+
+		if err := s.eventLogger.SavePointUpdateEvents(ctx, domain.PointsEarned, ledger); err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error saving points earned event")
+			return domain.NewSystemError("PointsService.EarnPoints", err, "failed to save points earned event")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &domain.PointsTransaction{
@@ -145,5 +417,6 @@ func (s *PointsService) EarnPoints(ctx context.Context, req *domain.PointsTransa
 		ProgramID:     ledger.ProgramID.String(),
 		Points:        ledger.PointsEarned,
 		Type:          "earn",
+		RuleSetID:     req.RuleSetID,
 	}, nil
 }
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"testing"
+	"time"
 
 	"go-playground/server/domain"
 
@@ -34,6 +35,14 @@ func (m *mockPointsRepository) Create(ctx context.Context, ledger *domain.Points
 	return args.Get(0).(*domain.PointsLedger), args.Error(1)
 }
 
+func (m *mockPointsRepository) GetLots(ctx context.Context, customerID, programID uuid.UUID) ([]*domain.PointsLot, error) {
+	args := m.Called(ctx, customerID, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.PointsLot), args.Error(1)
+}
+
 func (m *mockPointsRepository) GetByCustomerAndProgram(ctx context.Context, customerID, programID uuid.UUID) ([]*domain.PointsLedger, error) {
 	args := m.Called(ctx, customerID, programID)
 	if args.Get(0) == nil {
@@ -50,11 +59,55 @@ func (m *mockPointsRepository) GetByTransactionID(ctx context.Context, programID
 	return args.Get(0).(*domain.PointsLedger), args.Error(1)
 }
 
+func (m *mockPointsRepository) SumByTransactionID(ctx context.Context, transactionID uuid.UUID) (int, int, error) {
+	args := m.Called(ctx, transactionID)
+	return args.Int(0), args.Int(1), args.Error(2)
+}
+
 func (m *mockPointsRepository) Delete(ctx context.Context, LedgerID uuid.UUID) error {
 	args := m.Called(ctx, LedgerID)
 	return args.Error(0)
 }
 
+type mockPointsHoldRepository struct {
+	mock.Mock
+}
+
+func (m *mockPointsHoldRepository) Create(ctx context.Context, hold *domain.PointsHold) error {
+	args := m.Called(ctx, hold)
+	return args.Error(0)
+}
+
+func (m *mockPointsHoldRepository) LockByTransactionID(ctx context.Context, transactionID uuid.UUID) (*domain.PointsHold, error) {
+	args := m.Called(ctx, transactionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsHold), args.Error(1)
+}
+
+func (m *mockPointsHoldRepository) Resolve(ctx context.Context, holdID uuid.UUID, status string) error {
+	args := m.Called(ctx, holdID, status)
+	return args.Error(0)
+}
+
+func (m *mockPointsHoldRepository) SumHeld(ctx context.Context, customerID, programID uuid.UUID) (int, error) {
+	args := m.Called(ctx, customerID, programID)
+	return args.Int(0), args.Error(1)
+}
+
+type mockPointsExpiryProvider struct {
+	mock.Mock
+}
+
+func (m *mockPointsExpiryProvider) ExpiresAt(ctx context.Context, programID uuid.UUID, earnedAt time.Time) (*time.Time, error) {
+	args := m.Called(ctx, programID, earnedAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*time.Time), args.Error(1)
+}
+
 // Implement EventLogRepository interface
 func (m *mockEventLogRepository) Create(ctx context.Context, event *domain.EventLog) error {
 	args := m.Called(ctx, event)
@@ -98,16 +151,22 @@ func (m *mockEventLogRepository) GetByUserID(userID string) ([]domain.EventLog,
 // PointsServiceTestSuite defines the test suite
 type PointsServiceTestSuite struct {
 	suite.Suite
-	pointsRepo *mockPointsRepository
-	eventRepo  *mockEventLogRepository
-	service    *PointsService
+	pointsRepo  *mockPointsRepository
+	holdRepo    *mockPointsHoldRepository
+	eventRepo   *mockEventLogRepository
+	expiry      *mockPointsExpiryProvider
+	eventLogger *mockEventLoggerService
+	service     *PointsService
 }
 
 // SetupTest is called before each test
 func (s *PointsServiceTestSuite) SetupTest() {
 	s.pointsRepo = new(mockPointsRepository)
+	s.holdRepo = new(mockPointsHoldRepository)
 	s.eventRepo = new(mockEventLogRepository)
-	s.service = NewPointsService(s.pointsRepo, s.eventRepo)
+	s.expiry = new(mockPointsExpiryProvider)
+	s.eventLogger = new(mockEventLoggerService)
+	s.service = NewPointsService(s.pointsRepo, s.holdRepo, s.eventRepo, s.expiry, s.eventLogger, passThroughTxManager{})
 }
 
 // TestPointsServiceTestSuite runs the test suite
@@ -130,12 +189,16 @@ func (s *PointsServiceTestSuite) TestEarnPoints_Success() {
 		Type:          "earn",
 	}
 
+	expiresAt := time.Now().AddDate(0, 0, 90)
+
 	s.pointsRepo.On("GetCurrentBalance", ctx, customerID, programID).Return(0, nil)
+	s.expiry.On("ExpiresAt", ctx, programID, mock.Anything).Return(&expiresAt, nil)
 	s.pointsRepo.On("Create", ctx, mock.MatchedBy(func(l *domain.PointsLedger) bool {
 		return l.MerchantCustomersID == customerID &&
 			l.ProgramID == programID &&
 			l.PointsEarned == 100 &&
-			l.PointsBalance == 100
+			l.PointsBalance == 100 &&
+			l.ExpiresAt == &expiresAt
 	})).Return(&domain.PointsLedger{
 		LedgerID:            uuid.New(),
 		MerchantCustomersID: customerID,
@@ -144,6 +207,9 @@ func (s *PointsServiceTestSuite) TestEarnPoints_Success() {
 		PointsBalance:       100,
 		TransactionID:       transactionID,
 	}, nil)
+	s.eventLogger.On("SavePointUpdateEvents", ctx, domain.PointsEarned, mock.MatchedBy(func(l *domain.PointsLedger) bool {
+		return l.MerchantCustomersID == customerID && l.PointsEarned == 100
+	})).Return(nil)
 
 	result, err := s.service.EarnPoints(ctx, req)
 
@@ -151,6 +217,35 @@ func (s *PointsServiceTestSuite) TestEarnPoints_Success() {
 	s.NotNil(result)
 	s.Equal(req.Points, result.Points)
 	s.Equal("earn", result.Type)
+	s.eventLogger.AssertExpectations(s.T())
+}
+
+func (s *PointsServiceTestSuite) TestEarnPoints_ExpiryCountsFromEarnedAt() {
+	ctx := context.Background()
+	customerID := uuid.New()
+	programID := uuid.New()
+	earnedAt := time.Date(2023, time.November, 20, 15, 0, 0, 0, time.UTC)
+	expiresAt := earnedAt.AddDate(1, 0, 0)
+
+	s.pointsRepo.On("GetCurrentBalance", ctx, customerID, programID).Return(0, nil)
+	s.expiry.On("ExpiresAt", ctx, programID, earnedAt).Return(&expiresAt, nil)
+	s.pointsRepo.On("Create", ctx, mock.MatchedBy(func(l *domain.PointsLedger) bool {
+		return l.ExpiresAt.Equal(expiresAt)
+	})).Return(&domain.PointsLedger{PointsEarned: 100, PointsBalance: 100}, nil)
+	s.eventLogger.On("SavePointUpdateEvents", ctx, domain.PointsEarned, mock.Anything).Return(nil)
+
+	_, err := s.service.EarnPoints(ctx, &domain.PointsTransaction{
+		TransactionID: uuid.New().String(),
+		CustomerID:    customerID.String(),
+		ProgramID:     programID.String(),
+		Points:        100,
+		Type:          "earn",
+		EarnedAt:      earnedAt,
+	})
+
+	s.NoError(err)
+	s.expiry.AssertExpectations(s.T())
+	s.pointsRepo.AssertExpectations(s.T())
 }
 
 func (s *PointsServiceTestSuite) TestEarnPoints_InvalidPoints() {
@@ -216,6 +311,9 @@ func (s *PointsServiceTestSuite) TestRedeemPoints_Success() {
 		PointsBalance:       50,
 		TransactionID:       transactionID,
 	}, nil)
+	s.eventLogger.On("SavePointUpdateEvents", ctx, domain.PointsRedeemed, mock.MatchedBy(func(l *domain.PointsLedger) bool {
+		return l.PointsRedeemed == 50
+	})).Return(nil)
 
 	result, err := s.service.RedeemPoints(ctx, req)
 
@@ -223,6 +321,7 @@ func (s *PointsServiceTestSuite) TestRedeemPoints_Success() {
 	s.NotNil(result)
 	s.Equal(req.Points, result.Points)
 	s.Equal("redeem", result.Type)
+	s.eventLogger.AssertExpectations(s.T())
 }
 
 func (s *PointsServiceTestSuite) TestRedeemPoints_InsufficientPoints() {
@@ -250,6 +349,87 @@ func (s *PointsServiceTestSuite) TestRedeemPoints_InsufficientPoints() {
 	s.Contains(err.Error(), "insufficient points balance")
 }
 
+func (s *PointsServiceTestSuite) TestRedeemPoints_LotsSpentConcurrently() {
+	ctx := context.Background()
+	customerID := uuid.New()
+	programID := uuid.New()
+
+	req := &domain.PointsTransaction{
+		TransactionID: uuid.New().String(),
+		CustomerID:    customerID.String(),
+		ProgramID:     programID.String(),
+		Points:        80,
+		Type:          "redeem",
+	}
+
+	// The balance read before the lots were locked still covered it
+	s.pointsRepo.On("GetCurrentBalance", ctx, customerID, programID).Return(100, nil)
+	s.pointsRepo.On("Create", ctx, mock.Anything).
+		Return(nil, domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points balance"))
+
+	result, err := s.service.RedeemPoints(ctx, req)
+
+	s.Nil(result)
+	s.True(domain.IsBusinessLogicError(err))
+	s.Equal("INSUFFICIENT_POINTS", err.(domain.BusinessLogicError).Code)
+}
+
+func (s *PointsServiceTestSuite) TestReversePoints_PassesRefundPolicyToLedger() {
+	ctx := context.Background()
+	customerID := uuid.New()
+	programID := uuid.New()
+	transactionID := uuid.New()
+
+	req := &domain.PointsTransaction{
+		TransactionID: transactionID.String(),
+		CustomerID:    customerID.String(),
+		ProgramID:     programID.String(),
+		Points:        60,
+	}
+
+	// Only 25 points were left, claw_back took those and wrote off the rest
+	s.pointsRepo.On("Create", ctx, mock.MatchedBy(func(l *domain.PointsLedger) bool {
+		return l.PointsRedeemed == 60 &&
+			l.TxType == domain.PointTxReversal &&
+			l.RefundPolicy == domain.RefundPolicyClawBack
+	})).Return(&domain.PointsLedger{
+		LedgerID:            uuid.New(),
+		MerchantCustomersID: customerID,
+		ProgramID:           programID,
+		PointsRedeemed:      25,
+		TransactionID:       transactionID,
+		TxType:              domain.PointTxReversal,
+	}, nil)
+	s.eventLogger.On("SavePointUpdateEvents", ctx, domain.PointsRedeemed, mock.Anything).Return(nil)
+
+	result, err := s.service.ReversePoints(ctx, req, domain.RefundPolicyClawBack)
+
+	s.NoError(err)
+	s.Equal(25, result.Points)
+	s.Equal("reverse", result.Type)
+	s.pointsRepo.AssertNotCalled(s.T(), "GetCurrentBalance", mock.Anything, mock.Anything, mock.Anything)
+	s.eventLogger.AssertExpectations(s.T())
+}
+
+func (s *PointsServiceTestSuite) TestReversePoints_BlockedByPolicy() {
+	ctx := context.Background()
+	req := &domain.PointsTransaction{
+		TransactionID: uuid.New().String(),
+		CustomerID:    uuid.New().String(),
+		ProgramID:     uuid.New().String(),
+		Points:        60,
+	}
+
+	s.pointsRepo.On("Create", ctx, mock.Anything).
+		Return(nil, domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points balance"))
+
+	result, err := s.service.ReversePoints(ctx, req, domain.RefundPolicyBlock)
+
+	s.Nil(result)
+	s.True(domain.IsBusinessLogicError(err))
+	s.eventLogger.AssertNotCalled(s.T(), "SavePointUpdateEvents", mock.Anything, mock.Anything, mock.Anything)
+}
+
 // Test cases for GetBalance
 func (s *PointsServiceTestSuite) TestGetBalance_Success() {
 	ctx := context.Background()
@@ -258,6 +438,7 @@ func (s *PointsServiceTestSuite) TestGetBalance_Success() {
 	expectedBalance := 100
 
 	s.pointsRepo.On("GetCurrentBalance", ctx, customerID, programID).Return(expectedBalance, nil)
+	s.holdRepo.On("SumHeld", ctx, customerID, programID).Return(40, nil)
 
 	result, err := s.service.GetBalance(ctx, customerID, programID)
 
@@ -266,6 +447,109 @@ func (s *PointsServiceTestSuite) TestGetBalance_Success() {
 	s.Equal(customerID.String(), result.CustomerID)
 	s.Equal(programID.String(), result.ProgramID)
 	s.Equal(expectedBalance, result.Balance)
+	s.Equal(40, result.Pending)
+}
+
+// Test cases for points holds
+func (s *PointsServiceTestSuite) TestHoldPoints_DoesNotTouchTheLedger() {
+	ctx := context.Background()
+	transactionID := uuid.New()
+	ruleSetID := uuid.New()
+	s.holdRepo.On("Create", ctx, mock.MatchedBy(func(h *domain.PointsHold) bool {
+		return h.TransactionID == transactionID && h.Points == 150 && *h.RuleSetID == ruleSetID
+	})).Return(nil)
+
+	hold, err := s.service.HoldPoints(ctx, &domain.PointsTransaction{
+		TransactionID: transactionID.String(),
+		CustomerID:    uuid.New().String(),
+		ProgramID:     uuid.New().String(),
+		Points:        150,
+		RuleSetID:     ruleSetID.String(),
+	})
+
+	s.NoError(err)
+	s.Equal(150, hold.Points)
+	s.holdRepo.AssertExpectations(s.T())
+	s.pointsRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *PointsServiceTestSuite) TestReleaseHold_EarnsTheHeldPoints() {
+	ctx := context.Background()
+	customerID := uuid.New()
+	programID := uuid.New()
+	transactionID := uuid.New()
+	ruleSetID := uuid.New()
+	hold := &domain.PointsHold{
+		HoldID:              uuid.New(),
+		TransactionID:       transactionID,
+		MerchantCustomersID: customerID,
+		ProgramID:           programID,
+		Points:              150,
+		RuleSetID:           &ruleSetID,
+		Status:              domain.PointsHoldHeld,
+	}
+	s.holdRepo.On("LockByTransactionID", ctx, transactionID).Return(hold, nil)
+	s.pointsRepo.On("GetCurrentBalance", ctx, customerID, programID).Return(20, nil)
+	s.expiry.On("ExpiresAt", ctx, programID, mock.Anything).Return(nil, nil)
+	s.pointsRepo.On("Create", ctx, mock.MatchedBy(func(l *domain.PointsLedger) bool {
+		return l.TransactionID == transactionID && l.PointsEarned == 150 && *l.RuleSetID == ruleSetID
+	})).Return(&domain.PointsLedger{
+		MerchantCustomersID: customerID,
+		ProgramID:           programID,
+		PointsEarned:        150,
+		PointsBalance:       170,
+		TransactionID:       transactionID,
+	}, nil)
+	s.eventLogger.On("SavePointUpdateEvents", ctx, domain.PointsEarned, mock.Anything).Return(nil)
+	s.holdRepo.On("Resolve", ctx, hold.HoldID, domain.PointsHoldReleased).Return(nil)
+
+	released, err := s.service.ReleaseHold(ctx, transactionID)
+
+	s.NoError(err)
+	s.Equal(domain.PointsHoldReleased, released.Status)
+	s.pointsRepo.AssertExpectations(s.T())
+	s.holdRepo.AssertExpectations(s.T())
+}
+
+func (s *PointsServiceTestSuite) TestVoidHold_EarnsNothing() {
+	ctx := context.Background()
+	transactionID := uuid.New()
+	hold := &domain.PointsHold{
+		HoldID:        uuid.New(),
+		TransactionID: transactionID,
+		Points:        150,
+		Status:        domain.PointsHoldHeld,
+	}
+	s.holdRepo.On("LockByTransactionID", ctx, transactionID).Return(hold, nil)
+	s.holdRepo.On("Resolve", ctx, hold.HoldID, domain.PointsHoldVoided).Return(nil)
+
+	voided, err := s.service.VoidHold(ctx, transactionID)
+
+	s.NoError(err)
+	s.Equal(domain.PointsHoldVoided, voided.Status)
+	s.pointsRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *PointsServiceTestSuite) TestReleaseHold_ResolvedOrMissingHoldIsANoOp() {
+	ctx := context.Background()
+	voidedID := uuid.New()
+	s.holdRepo.On("LockByTransactionID", ctx, voidedID).Return(&domain.PointsHold{
+		HoldID:        uuid.New(),
+		TransactionID: voidedID,
+		Points:        150,
+		Status:        domain.PointsHoldVoided,
+	}, nil)
+	missingID := uuid.New()
+	s.holdRepo.On("LockByTransactionID", ctx, missingID).Return(nil, nil)
+
+	for _, id := range []uuid.UUID{voidedID, missingID} {
+		hold, err := s.service.ReleaseHold(ctx, id)
+
+		s.NoError(err)
+		s.Nil(hold)
+	}
+	s.pointsRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+	s.holdRepo.AssertNotCalled(s.T(), "Resolve", mock.Anything, mock.Anything, mock.Anything)
 }
 
 // Test cases for GetLedger
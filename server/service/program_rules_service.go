@@ -2,8 +2,10 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"go-playground/pkg/logging"
 	"go-playground/server/domain"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,18 +14,35 @@ import (
 
 type ProgramRulesService struct {
 	programRuleRepo domain.ProgramRuleRepository
+	ruleSetRepo     domain.ProgramRuleSetRepository
 	programRepo     domain.ProgramRepository
+	merchantRepo    domain.MerchantRepository
+	customerContext domain.CustomerContextProvider
+	txManager       domain.TxManager
 	logger          zerolog.Logger
 }
 
-func NewProgramRulesService(ruleRepo domain.ProgramRuleRepository, programRepo domain.ProgramRepository) *ProgramRulesService {
+func NewProgramRulesService(
+	ruleRepo domain.ProgramRuleRepository,
+	ruleSetRepo domain.ProgramRuleSetRepository,
+	programRepo domain.ProgramRepository,
+	merchantRepo domain.MerchantRepository,
+	customerContext domain.CustomerContextProvider,
+	txManager domain.TxManager,
+) *ProgramRulesService {
 	return &ProgramRulesService{
 		programRuleRepo: ruleRepo,
+		ruleSetRepo:     ruleSetRepo,
 		programRepo:     programRepo,
+		merchantRepo:    merchantRepo,
+		customerContext: customerContext,
+		txManager:       txManager,
 		logger:          logging.GetLogger(),
 	}
 }
 
+// Create adds the rule to the program's draft rule set, it is applied to
+// transactions once the draft is published.
 func (s *ProgramRulesService) Create(req *domain.CreateProgramRuleRequest) (*domain.ProgramRule, error) {
 	// Validate required fields
 	if req.RuleName == "" {
@@ -41,27 +60,153 @@ func (s *ProgramRulesService) Create(req *domain.CreateProgramRuleRequest) (*dom
 			Msg("Condition value is required")
 		return nil, domain.NewValidationError("condition_value", "condition value is required")
 	}
+	if err := s.validateCondition(req.ConditionType, req.ConditionValue); err != nil {
+		return nil, err
+	}
+
+	rule := &domain.ProgramRule{
+		ID:                            uuid.New(),
+		ProgramID:                     req.ProgramID,
+		RuleName:                      req.RuleName,
+		ConditionType:                 req.ConditionType,
+		ConditionValue:                req.ConditionValue,
+		Multiplier:                    req.Multiplier,
+		PointsAwarded:                 req.PointsAwarded,
+		Priority:                      req.Priority,
+		Stacking:                      req.Stacking,
+		MaxPointsPerTransaction:       req.MaxPointsPerTransaction,
+		MaxPointsPerCustomerPerPeriod: req.MaxPointsPerCustomerPerPeriod,
+		CapPeriod:                     req.CapPeriod,
+		EffectiveFrom:                 req.EffectiveFrom,
+		EffectiveTo:                   req.EffectiveTo,
+	}
+	if rule.Stacking == "" {
+		rule.Stacking = domain.RuleStackable
+	}
+	if err := s.validateStacking(rule); err != nil {
+		return nil, err
+	}
+
+	// The draft keeps the program locked until the rule is in it, so it can
+	// not be published in between
+	err := s.txManager.WithinTx(context.Background(), func(ctx context.Context) error {
+		draft, err := s.ruleSetRepo.GetOrCreateDraft(ctx, req.ProgramID, "")
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error getting draft rule set")
+			if domain.IsResourceNotFoundError(err) {
+				return err
+			}
+			return domain.NewSystemError("ProgramRulesService.Create", err, "failed to get draft rule set")
+		}
+		rule.RuleSetID = draft.ID
+		rule.RuleKey = rule.ID
+
+		if err := s.programRuleRepo.Create(ctx, rule); err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error creating program rule")
+			return domain.NewSystemError("ProgramRulesService.Create", err, "failed to create program rule")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// draftRule validates a rule that is evaluated without being saved, the same
+// way Create does.
+func (s *ProgramRulesService) draftRule(programID uuid.UUID, draft *domain.DraftProgramRule) (*domain.ProgramRule, error) {
+	if err := s.validateCondition(draft.ConditionType, draft.ConditionValue); err != nil {
+		return nil, err
+	}
 
 	rule := &domain.ProgramRule{
-		ID:             uuid.New(),
-		ProgramID:      req.ProgramID,
-		RuleName:       req.RuleName,
-		ConditionType:  req.ConditionType,
-		ConditionValue: req.ConditionValue,
-		Multiplier:     req.Multiplier,
-		PointsAwarded:  req.PointsAwarded,
-		EffectiveFrom:  req.EffectiveFrom,
-		EffectiveTo:    req.EffectiveTo,
+		ID:                            uuid.New(),
+		ProgramID:                     programID,
+		RuleName:                      draft.RuleName,
+		ConditionType:                 draft.ConditionType,
+		ConditionValue:                draft.ConditionValue,
+		Multiplier:                    draft.Multiplier,
+		PointsAwarded:                 draft.PointsAwarded,
+		Priority:                      draft.Priority,
+		Stacking:                      draft.Stacking,
+		MaxPointsPerTransaction:       draft.MaxPointsPerTransaction,
+		MaxPointsPerCustomerPerPeriod: draft.MaxPointsPerCustomerPerPeriod,
+		CapPeriod:                     draft.CapPeriod,
+		EffectiveFrom:                 draft.EffectiveFrom,
+		EffectiveTo:                   draft.EffectiveTo,
+	}
+	if rule.Stacking == "" {
+		rule.Stacking = domain.RuleStackable
+	}
+	if err := s.validateStacking(rule); err != nil {
+		return nil, err
 	}
+	return rule, nil
+}
 
-	if err := s.programRuleRepo.Create(context.Background(), rule); err != nil {
+// validateCondition rejects rules the rule engine would not be able to evaluate.
+func (s *ProgramRulesService) validateCondition(conditionType, conditionValue string) error {
+	if _, ok := conditionKinds[conditionType]; !ok {
+		s.logger.Error().
+			Str("condition_type", conditionType).
+			Msg("Unsupported condition type")
+		return domain.NewValidationError("condition_type", fmt.Sprintf("unsupported condition type %q", conditionType))
+	}
+	if _, err := parseCondition(conditionType, conditionValue); err != nil {
 		s.logger.Error().
 			Err(err).
-			Msg("Error creating program rule")
-		return nil, domain.NewSystemError("ProgramRulesService.Create", err, "failed to create program rule")
+			Str("condition_value", conditionValue).
+			Msg("Invalid condition value")
+		return domain.NewValidationError("condition_value", fmt.Sprintf("invalid condition: %v", err))
 	}
+	return nil
+}
 
-	return rule, nil
+// validateStacking checks the stacking policy and caps of a rule.
+func (s *ProgramRulesService) validateStacking(rule *domain.ProgramRule) error {
+	switch rule.Stacking {
+	case domain.RuleStackable, domain.RuleNonStackable, domain.RuleExclusive:
+	default:
+		s.logger.Error().
+			Str("stacking", rule.Stacking).
+			Msg("Invalid stacking policy")
+		return domain.NewValidationError("stacking", "stacking must be one of stackable, non_stackable, exclusive")
+	}
+
+	if rule.MaxPointsPerTransaction != nil && *rule.MaxPointsPerTransaction < 0 {
+		s.logger.Error().
+			Msg("Negative max points per transaction")
+		return domain.NewValidationError("max_points_per_transaction", "max points per transaction must not be negative")
+	}
+
+	if rule.MaxPointsPerCustomerPerPeriod == nil {
+		if rule.CapPeriod != "" {
+			s.logger.Error().
+				Msg("Cap period without a customer cap")
+			return domain.NewValidationError("cap_period", "cap period needs max_points_per_customer_per_period")
+		}
+		return nil
+	}
+	if *rule.MaxPointsPerCustomerPerPeriod < 0 {
+		s.logger.Error().
+			Msg("Negative max points per customer per period")
+		return domain.NewValidationError("max_points_per_customer_per_period", "max points per customer per period must not be negative")
+	}
+	switch rule.CapPeriod {
+	case domain.CapPeriodDay, domain.CapPeriodWeek, domain.CapPeriodMonth, domain.CapPeriodYear:
+	default:
+		s.logger.Error().
+			Str("cap_period", rule.CapPeriod).
+			Msg("Invalid cap period")
+		return domain.NewValidationError("cap_period", "cap period must be one of day, week, month, year")
+	}
+	return nil
 }
 
 func (s *ProgramRulesService) GetByID(id string) (*domain.ProgramRule, error) {
@@ -123,19 +268,33 @@ func (s *ProgramRulesService) Update(id string, req *domain.UpdateProgramRuleReq
 		return nil, domain.NewValidationError("id", "invalid rule ID format")
 	}
 
-	rule, err := s.programRuleRepo.GetByID(context.Background(), ruleID)
+	var rule *domain.ProgramRule
+	err = s.txManager.WithinTx(context.Background(), func(ctx context.Context) error {
+		rule, err = s.lockDraftRule(ctx, ruleID, "ProgramRulesService.Update")
+		if err != nil {
+			return err
+		}
+		if err := s.applyRuleUpdate(rule, req); err != nil {
+			return err
+		}
+
+		if err := s.programRuleRepo.Update(ctx, rule); err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error updating program rule")
+			return domain.NewSystemError("ProgramRulesService.Update", err, "failed to update program rule")
+		}
+		return nil
+	})
 	if err != nil {
-		s.logger.Error().
-			Err(err).
-			Msg("Error getting program rule")
-		return nil, domain.NewSystemError("ProgramRulesService.Update", err, "failed to get program rule")
-	}
-	if rule == nil {
-		s.logger.Error().
-			Msg("Program rule not found")
-		return nil, domain.NewResourceNotFoundError("program rule", id, "rule not found")
+		return nil, err
 	}
 
+	return rule, nil
+}
+
+// applyRuleUpdate changes the rule as requested and validates the result.
+func (s *ProgramRulesService) applyRuleUpdate(rule *domain.ProgramRule, req *domain.UpdateProgramRuleRequest) error {
 	if req.RuleName != "" {
 		rule.RuleName = req.RuleName
 	}
@@ -157,15 +316,29 @@ func (s *ProgramRulesService) Update(id string, req *domain.UpdateProgramRuleReq
 	if req.EffectiveTo != nil {
 		rule.EffectiveTo = req.EffectiveTo
 	}
-
-	if err := s.programRuleRepo.Update(context.Background(), rule); err != nil {
-		s.logger.Error().
-			Err(err).
-			Msg("Error updating program rule")
-		return nil, domain.NewSystemError("ProgramRulesService.Update", err, "failed to update program rule")
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Stacking != "" {
+		rule.Stacking = req.Stacking
+	} else if rule.Stacking == "" {
+		rule.Stacking = domain.RuleStackable
+	}
+	if req.MaxPointsPerTransaction != nil {
+		rule.MaxPointsPerTransaction = req.MaxPointsPerTransaction
+	}
+	if req.MaxPointsPerCustomerPerPeriod != nil {
+		rule.MaxPointsPerCustomerPerPeriod = req.MaxPointsPerCustomerPerPeriod
+	}
+	if req.CapPeriod != "" {
+		rule.CapPeriod = req.CapPeriod
+	}
+	if err := s.validateStacking(rule); err != nil {
+		return err
 	}
 
-	return rule, nil
+	// Either half may have changed, so the pair is checked together
+	return s.validateCondition(rule.ConditionType, rule.ConditionValue)
 }
 
 func (s *ProgramRulesService) Delete(id string) error {
@@ -177,26 +350,68 @@ func (s *ProgramRulesService) Delete(id string) error {
 		return domain.NewValidationError("id", "invalid rule ID format")
 	}
 
-	rule, err := s.programRuleRepo.GetByID(context.Background(), ruleID)
+	return s.txManager.WithinTx(context.Background(), func(ctx context.Context) error {
+		if _, err := s.lockDraftRule(ctx, ruleID, "ProgramRulesService.Delete"); err != nil {
+			return err
+		}
+
+		if err := s.programRuleRepo.Delete(ctx, ruleID); err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error deleting program rule")
+			return domain.NewSystemError("ProgramRulesService.Delete", err, "failed to delete program rule")
+		}
+		return nil
+	})
+}
+
+// lockDraftRule returns a rule of a draft rule set and keeps its program
+// locked until the unit of work in ctx ends, so the draft can not be
+// published while the rule changes.
+func (s *ProgramRulesService) lockDraftRule(ctx context.Context, ruleID uuid.UUID, op string) (*domain.ProgramRule, error) {
+	rule, err := s.programRuleRepo.GetByID(ctx, ruleID)
 	if err != nil {
 		s.logger.Error().
 			Err(err).
 			Msg("Error getting program rule")
-		return domain.NewSystemError("ProgramRulesService.Delete", err, "failed to get program rule")
+		return nil, domain.NewSystemError(op, err, "failed to get program rule")
 	}
 	if rule == nil {
 		s.logger.Error().
 			Msg("Program rule not found")
-		return domain.NewResourceNotFoundError("program rule", id, "rule not found")
+		return nil, domain.NewResourceNotFoundError("program rule", ruleID.String(), "rule not found")
 	}
 
-	if err := s.programRuleRepo.Delete(context.Background(), ruleID); err != nil {
+	if err := s.ruleSetRepo.LockProgram(ctx, rule.ProgramID); err != nil {
+		if domain.IsResourceNotFoundError(err) {
+			return nil, err
+		}
+		return nil, domain.NewSystemError(op, err, "failed to lock program")
+	}
+	// Checked under the lock, the draft may have been published meanwhile
+	if err := s.requireDraft(ctx, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// requireDraft rejects changes to rules of published and archived rule sets,
+// those are edited through the program's draft.
+func (s *ProgramRulesService) requireDraft(ctx context.Context, rule *domain.ProgramRule) error {
+	ruleSet, err := s.ruleSetRepo.GetByID(ctx, rule.RuleSetID)
+	if err != nil {
 		s.logger.Error().
 			Err(err).
-			Msg("Error deleting program rule")
-		return domain.NewSystemError("ProgramRulesService.Delete", err, "failed to delete program rule")
+			Msg("Error getting rule set")
+		return domain.NewSystemError("ProgramRulesService.requireDraft", err, "failed to get rule set")
+	}
+	if ruleSet == nil || ruleSet.Status != domain.RuleSetDraft {
+		s.logger.Error().
+			Str("rule_id", rule.ID.String()).
+			Str("rule_set_id", rule.RuleSetID.String()).
+			Msg("Program rule is not in a draft rule set")
+		return domain.NewResourceConflictError("program rule", "only rules of a draft rule set can be changed, create a draft of the program first")
 	}
-
 	return nil
 }
 
@@ -225,16 +440,297 @@ func (s *ProgramRulesService) GetActiveRules(programID string) ([]*domain.Progra
 	return rules, nil
 }
 
+// Simulate runs a hypothetical transaction through every rule of a program,
+// including the ones not in force at the transaction date, and reports what
+// each rule would award. Nothing is written.
+func (s *ProgramRulesService) Simulate(req *domain.SimulateRulesRequest) (*domain.SimulateRulesResponse, error) {
+	ctx := context.Background()
+
+	switch req.TransactionType {
+	case "refund", "redemption":
+		s.logger.Error().
+			Str("transaction_type", req.TransactionType).
+			Msg("Transaction type does not earn points")
+		return nil, domain.NewValidationError("transaction_type", "refunds and redemptions are not evaluated against program rules")
+	}
+
+	program, err := s.programRepo.GetByID(ctx, req.ProgramID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting program")
+		return nil, domain.NewSystemError("ProgramRulesService.Simulate", err, "failed to get program")
+	}
+	if program == nil {
+		s.logger.Error().
+			Msg("Program not found")
+		return nil, domain.NewResourceNotFoundError("program", req.ProgramID.String(), "program not found")
+	}
+
+	// Without a customer the rules see a new member of the program's merchant
+	customerContext := &domain.CustomerContext{ProgramID: req.ProgramID}
+	if req.MerchantCustomersID != nil {
+		customerContext, err = s.customerContext.GetCustomerContext(ctx, *req.MerchantCustomersID, req.ProgramID)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error getting customer context")
+			return nil, err
+		}
+	} else {
+		merchant, err := s.merchantRepo.GetByID(ctx, program.MerchantID)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error getting merchant")
+			return nil, err
+		}
+		customerContext.Timezone = merchant.Timezone
+	}
+
+	var rules []*domain.ProgramRule
+	if req.RuleSetID != nil {
+		ruleSet, err := s.getRuleSet(ctx, req.ProgramID, *req.RuleSetID)
+		if err != nil {
+			return nil, err
+		}
+		rules = ruleSet.Rules
+	} else {
+		rules, err = s.programRuleRepo.GetByProgramID(ctx, req.ProgramID)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error getting program rules")
+			return nil, domain.NewSystemError("ProgramRulesService.Simulate", err, "failed to get program rules")
+		}
+	}
+
+	transactionDate := time.Now()
+	if req.TransactionDate != nil {
+		transactionDate = *req.TransactionDate
+	}
+	transaction := &domain.Transaction{
+		MerchantCustomersID: customerContext.MerchantCustomersID,
+		MerchantID:          program.MerchantID,
+		ProgramID:           req.ProgramID,
+		TransactionType:     req.TransactionType,
+		TransactionAmount:   req.TransactionAmount,
+		TransactionDate:     transactionDate,
+		Category:            req.Category,
+		Status:              "completed",
+	}
+
+	rc, err := newRuleContext(ctx, s.programRuleRepo, rules, transaction, customerContext)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error building rule context")
+		return nil, err
+	}
+
+	result := &domain.SimulateRulesResponse{
+		ProgramID:       req.ProgramID,
+		RuleSetID:       req.RuleSetID,
+		TransactionDate: transactionDate,
+		Rules:           []domain.RuleSimulation{},
+	}
+	for _, outcome := range evaluateRules(compileRules(rules), rc) {
+		// Whole points per rule, the same way transactions are credited
+		points := int(math.Floor(outcome.points))
+		result.TotalPoints += points
+		result.Rules = append(result.Rules, domain.RuleSimulation{
+			RuleID:         outcome.rule.ID,
+			RuleName:       outcome.rule.RuleName,
+			ConditionType:  outcome.rule.ConditionType,
+			ConditionValue: outcome.rule.ConditionValue,
+			Priority:       outcome.rule.Priority,
+			Stacking:       outcome.rule.Stacking,
+			Matched:        outcome.matched,
+			Points:         points,
+			SkipReason:     outcome.skipReason,
+		})
+	}
+
+	return result, nil
+}
+
+// CreateRuleSet returns the program's draft rule set, starting a new one from
+// the published rules when the program has no draft.
+func (s *ProgramRulesService) CreateRuleSet(req *domain.CreateRuleSetRequest) (*domain.ProgramRuleSet, error) {
+	ctx := context.Background()
+
+	draft, err := s.ruleSetRepo.GetOrCreateDraft(ctx, req.ProgramID, req.Description)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error creating draft rule set")
+		if domain.IsResourceNotFoundError(err) {
+			return nil, err
+		}
+		return nil, domain.NewSystemError("ProgramRulesService.CreateRuleSet", err, "failed to create draft rule set")
+	}
+
+	draft.Rules, err = s.programRuleRepo.GetByRuleSetID(ctx, draft.ID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting rule set rules")
+		return nil, domain.NewSystemError("ProgramRulesService.CreateRuleSet", err, "failed to get rule set rules")
+	}
+
+	return draft, nil
+}
+
+// GetRuleSet returns a rule set version together with its rules.
+func (s *ProgramRulesService) GetRuleSet(id string) (*domain.ProgramRuleSet, error) {
+	ruleSetID, err := uuid.Parse(id)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid rule set ID format")
+		return nil, domain.NewValidationError("id", "invalid rule set ID format")
+	}
+
+	return s.getRuleSet(context.Background(), uuid.Nil, ruleSetID)
+}
+
+// getRuleSet loads a rule set with its rules. A non nil programID also checks
+// that the rule set is one of the program's versions.
+func (s *ProgramRulesService) getRuleSet(ctx context.Context, programID, ruleSetID uuid.UUID) (*domain.ProgramRuleSet, error) {
+	ruleSet, err := s.ruleSetRepo.GetByID(ctx, ruleSetID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting rule set")
+		return nil, domain.NewSystemError("ProgramRulesService.getRuleSet", err, "failed to get rule set")
+	}
+	if ruleSet == nil {
+		s.logger.Error().
+			Str("rule_set_id", ruleSetID.String()).
+			Msg("Rule set not found")
+		return nil, domain.NewResourceNotFoundError("rule set", ruleSetID.String(), "rule set not found")
+	}
+	if programID != uuid.Nil && ruleSet.ProgramID != programID {
+		s.logger.Error().
+			Str("rule_set_id", ruleSetID.String()).
+			Str("program_id", programID.String()).
+			Msg("Rule set belongs to another program")
+		return nil, domain.NewValidationError("rule_set_id", "rule set does not belong to the program")
+	}
+
+	ruleSet.Rules, err = s.programRuleRepo.GetByRuleSetID(ctx, ruleSet.ID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting rule set rules")
+		return nil, domain.NewSystemError("ProgramRulesService.getRuleSet", err, "failed to get rule set rules")
+	}
+
+	return ruleSet, nil
+}
+
+// GetRuleSetsByProgramID lists a program's rule set versions, newest first,
+// without their rules.
+func (s *ProgramRulesService) GetRuleSetsByProgramID(programID string) ([]*domain.ProgramRuleSet, error) {
+	pID, err := uuid.Parse(programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid program ID format")
+		return nil, domain.NewValidationError("program_id", "invalid program ID format")
+	}
+
+	ruleSets, err := s.ruleSetRepo.GetByProgramID(context.Background(), pID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting rule sets")
+		return nil, domain.NewSystemError("ProgramRulesService.GetRuleSetsByProgramID", err, "failed to get rule sets")
+	}
+
+	return ruleSets, nil
+}
+
+// PublishRuleSet makes a draft the program's published version. Transactions
+// are scored against it from then on.
+func (s *ProgramRulesService) PublishRuleSet(id string) (*domain.ProgramRuleSet, error) {
+	return s.publishRuleSet(id, domain.RuleSetDraft)
+}
+
+// RollbackRuleSet publishes an archived version again.
+func (s *ProgramRulesService) RollbackRuleSet(id string) (*domain.ProgramRuleSet, error) {
+	return s.publishRuleSet(id, domain.RuleSetArchived)
+}
+
+func (s *ProgramRulesService) publishRuleSet(id, fromStatus string) (*domain.ProgramRuleSet, error) {
+	ruleSetID, err := uuid.Parse(id)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid rule set ID format")
+		return nil, domain.NewValidationError("id", "invalid rule set ID format")
+	}
+
+	ruleSet, err := s.ruleSetRepo.Publish(context.Background(), ruleSetID, fromStatus)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("rule_set_id", id).
+			Str("from_status", fromStatus).
+			Msg("Error publishing rule set")
+		if domain.IsResourceNotFoundError(err) || domain.IsResourceConflictError(err) {
+			return nil, err
+		}
+		return nil, domain.NewSystemError("ProgramRulesService.publishRuleSet", err, "failed to publish rule set")
+	}
+
+	s.logger.Info().
+		Str("rule_set_id", ruleSet.ID.String()).
+		Str("program_id", ruleSet.ProgramID.String()).
+		Int("version", ruleSet.Version).
+		Msg("Rule set published")
+
+	return ruleSet, nil
+}
+
+// DiscardRuleSet deletes a draft and its rules.
+func (s *ProgramRulesService) DiscardRuleSet(id string) error {
+	ruleSetID, err := uuid.Parse(id)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid rule set ID format")
+		return domain.NewValidationError("id", "invalid rule set ID format")
+	}
+
+	if err := s.ruleSetRepo.DeleteDraft(context.Background(), ruleSetID); err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error deleting draft rule set")
+		if domain.IsResourceNotFoundError(err) {
+			return err
+		}
+		return domain.NewSystemError("ProgramRulesService.DiscardRuleSet", err, "failed to delete draft rule set")
+	}
+
+	return nil
+}
+
 type ProgramRuleWithProgram struct {
-	ProgramID      uuid.UUID  `json:"program_id"`
-	ProgramName    string     `json:"program_name"`
-	RuleName       string     `json:"rule_name"`
-	ConditionType  string     `json:"condition_type"`
-	ConditionValue string     `json:"condition_value"`
-	Multiplier     float64    `json:"multiplier"`
-	PointsAwarded  int        `json:"points_awarded"`
-	EffectiveFrom  time.Time  `json:"effective_from"`
-	EffectiveTo    *time.Time `json:"effective_to,omitempty"`
+	ProgramID                     uuid.UUID  `json:"program_id"`
+	ProgramName                   string     `json:"program_name"`
+	RuleName                      string     `json:"rule_name"`
+	ConditionType                 string     `json:"condition_type"`
+	ConditionValue                string     `json:"condition_value"`
+	Multiplier                    float64    `json:"multiplier"`
+	PointsAwarded                 int        `json:"points_awarded"`
+	Priority                      int        `json:"priority"`
+	Stacking                      string     `json:"stacking"`
+	MaxPointsPerTransaction       *int       `json:"max_points_per_transaction,omitempty"`
+	MaxPointsPerCustomerPerPeriod *int       `json:"max_points_per_customer_per_period,omitempty"`
+	CapPeriod                     string     `json:"cap_period,omitempty"`
+	EffectiveFrom                 time.Time  `json:"effective_from"`
+	EffectiveTo                   *time.Time `json:"effective_to,omitempty"`
 }
 
 func (s *ProgramRulesService) GetProgramRulesByMerchantId(merchantID string, page, limit int) ([]ProgramRuleWithProgram, int64, error) {
@@ -273,15 +769,20 @@ func (s *ProgramRulesService) GetProgramRulesByMerchantId(merchantID string, pag
 		// Map each rule to the response format
 		for _, rule := range rules {
 			result = append(result, ProgramRuleWithProgram{
-				ProgramID:      program.ID,
-				ProgramName:    program.ProgramName,
-				RuleName:       rule.RuleName,
-				ConditionType:  rule.ConditionType,
-				ConditionValue: rule.ConditionValue,
-				Multiplier:     rule.Multiplier,
-				PointsAwarded:  rule.PointsAwarded,
-				EffectiveFrom:  rule.EffectiveFrom,
-				EffectiveTo:    rule.EffectiveTo,
+				ProgramID:                     program.ID,
+				ProgramName:                   program.ProgramName,
+				RuleName:                      rule.RuleName,
+				ConditionType:                 rule.ConditionType,
+				ConditionValue:                rule.ConditionValue,
+				Multiplier:                    rule.Multiplier,
+				PointsAwarded:                 rule.PointsAwarded,
+				Priority:                      rule.Priority,
+				Stacking:                      rule.Stacking,
+				MaxPointsPerTransaction:       rule.MaxPointsPerTransaction,
+				MaxPointsPerCustomerPerPeriod: rule.MaxPointsPerCustomerPerPeriod,
+				CapPeriod:                     rule.CapPeriod,
+				EffectiveFrom:                 rule.EffectiveFrom,
+				EffectiveTo:                   rule.EffectiveTo,
 			})
 		}
 	}
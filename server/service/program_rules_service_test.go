@@ -0,0 +1,453 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockProgramRuleSetRepository struct {
+	mock.Mock
+}
+
+func (m *mockProgramRuleSetRepository) GetOrCreateDraft(ctx context.Context, programID uuid.UUID, description string) (*domain.ProgramRuleSet, error) {
+	args := m.Called(ctx, programID, description)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ProgramRuleSet), args.Error(1)
+}
+
+func (m *mockProgramRuleSetRepository) LockProgram(ctx context.Context, programID uuid.UUID) error {
+	args := m.Called(ctx, programID)
+	return args.Error(0)
+}
+
+func (m *mockProgramRuleSetRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.ProgramRuleSet, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ProgramRuleSet), args.Error(1)
+}
+
+func (m *mockProgramRuleSetRepository) GetByProgramID(ctx context.Context, programID uuid.UUID) ([]*domain.ProgramRuleSet, error) {
+	args := m.Called(ctx, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.ProgramRuleSet), args.Error(1)
+}
+
+func (m *mockProgramRuleSetRepository) Publish(ctx context.Context, id uuid.UUID, fromStatus string) (*domain.ProgramRuleSet, error) {
+	args := m.Called(ctx, id, fromStatus)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ProgramRuleSet), args.Error(1)
+}
+
+func (m *mockProgramRuleSetRepository) DeleteDraft(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestProgramRulesService_Create(t *testing.T) {
+	newRequest := func(conditionType, conditionValue string) *domain.CreateProgramRuleRequest {
+		return &domain.CreateProgramRuleRequest{
+			ProgramID:      uuid.New(),
+			RuleName:       "Mid-size basket bonus",
+			ConditionType:  conditionType,
+			ConditionValue: conditionValue,
+			Multiplier:     1.5,
+			PointsAwarded:  10,
+			EffectiveFrom:  time.Now(),
+		}
+	}
+
+	newDraftRepo := func() (*mockProgramRuleSetRepository, *domain.ProgramRuleSet) {
+		draft := &domain.ProgramRuleSet{ID: uuid.New(), Version: 2, Status: domain.RuleSetDraft}
+		ruleSetRepo := new(mockProgramRuleSetRepository)
+		ruleSetRepo.On("GetOrCreateDraft", mock.Anything, mock.Anything, "").Return(draft, nil)
+		return ruleSetRepo, draft
+	}
+
+	t.Run("valid expression", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		ruleSetRepo, draft := newDraftRepo()
+		svc := NewProgramRulesService(ruleRepo, ruleSetRepo, nil, nil, nil, passThroughTxManager{})
+		ruleRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.ProgramRule")).Return(nil)
+
+		rule, err := svc.Create(newRequest("program_rule_transaction_amount", ">= 100 and < 500"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, ">= 100 and < 500", rule.ConditionValue)
+		assert.Equal(t, draft.ID, rule.RuleSetID)
+		assert.Equal(t, rule.ID, rule.RuleKey)
+		ruleRepo.AssertExpectations(t)
+	})
+
+	t.Run("program not found", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		ruleSetRepo := new(mockProgramRuleSetRepository)
+		req := newRequest("program_rule_transaction_amount", "100")
+		ruleSetRepo.On("GetOrCreateDraft", mock.Anything, req.ProgramID, "").
+			Return(nil, domain.NewResourceNotFoundError("program", req.ProgramID.String(), "program not found"))
+		svc := NewProgramRulesService(ruleRepo, ruleSetRepo, nil, nil, nil, passThroughTxManager{})
+
+		rule, err := svc.Create(req)
+
+		assert.Nil(t, rule)
+		assert.True(t, domain.IsResourceNotFoundError(err))
+		ruleRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("malformed expression", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		svc := NewProgramRulesService(ruleRepo, nil, nil, nil, nil, passThroughTxManager{})
+
+		rule, err := svc.Create(newRequest("program_rule_transaction_amount", "> abc"))
+
+		assert.Nil(t, rule)
+		assert.True(t, domain.IsValidationError(err))
+		assert.Equal(t, "condition_value", err.(domain.ValidationError).Field)
+		ruleRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("defaults to stackable", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		ruleSetRepo, _ := newDraftRepo()
+		svc := NewProgramRulesService(ruleRepo, ruleSetRepo, nil, nil, nil, passThroughTxManager{})
+		ruleRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.ProgramRule")).Return(nil)
+
+		rule, err := svc.Create(newRequest("program_rule_transaction_amount", "100"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, domain.RuleStackable, rule.Stacking)
+	})
+
+	t.Run("customer cap needs a period", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		svc := NewProgramRulesService(ruleRepo, nil, nil, nil, nil, passThroughTxManager{})
+		capped := 500
+		req := newRequest("program_rule_transaction_amount", "100")
+		req.MaxPointsPerCustomerPerPeriod = &capped
+
+		rule, err := svc.Create(req)
+
+		assert.Nil(t, rule)
+		assert.True(t, domain.IsValidationError(err))
+		assert.Equal(t, "cap_period", err.(domain.ValidationError).Field)
+		ruleRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown stacking policy", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		svc := NewProgramRulesService(ruleRepo, nil, nil, nil, nil, passThroughTxManager{})
+		req := newRequest("program_rule_transaction_amount", "100")
+		req.Stacking = "sometimes"
+
+		rule, err := svc.Create(req)
+
+		assert.Nil(t, rule)
+		assert.True(t, domain.IsValidationError(err))
+		assert.Equal(t, "stacking", err.(domain.ValidationError).Field)
+	})
+
+	t.Run("unsupported condition type", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		svc := NewProgramRulesService(ruleRepo, nil, nil, nil, nil, passThroughTxManager{})
+
+		rule, err := svc.Create(newRequest("program_rule_weather", "sunny"))
+
+		assert.Nil(t, rule)
+		assert.True(t, domain.IsValidationError(err))
+		assert.Equal(t, "condition_type", err.(domain.ValidationError).Field)
+	})
+}
+
+func TestProgramRulesService_Update(t *testing.T) {
+	ruleID := uuid.New()
+	ruleSetID := uuid.New()
+	programID := uuid.New()
+	existing := func() *domain.ProgramRule {
+		return &domain.ProgramRule{
+			ID:             ruleID,
+			ProgramID:      programID,
+			RuleSetID:      ruleSetID,
+			RuleName:       "Dining bonus",
+			ConditionType:  "program_rule_transaction_category",
+			ConditionValue: "dining",
+		}
+	}
+	newRuleSetRepo := func(status string) *mockProgramRuleSetRepository {
+		ruleSetRepo := new(mockProgramRuleSetRepository)
+		ruleSetRepo.On("LockProgram", mock.Anything, programID).Return(nil)
+		ruleSetRepo.On("GetByID", mock.Anything, ruleSetID).Return(&domain.ProgramRuleSet{ID: ruleSetID, Status: status}, nil)
+		return ruleSetRepo
+	}
+
+	t.Run("valid expression", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		ruleSetRepo := newRuleSetRepo(domain.RuleSetDraft)
+		svc := NewProgramRulesService(ruleRepo, ruleSetRepo, nil, nil, nil, passThroughTxManager{})
+		ruleRepo.On("GetByID", mock.Anything, ruleID).Return(existing(), nil)
+		ruleRepo.On("Update", mock.Anything, mock.AnythingOfType("*domain.ProgramRule")).Return(nil)
+
+		rule, err := svc.Update(ruleID.String(), &domain.UpdateProgramRuleRequest{ConditionValue: "in [dining, travel]"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "in [dining, travel]", rule.ConditionValue)
+		// The draft is checked under the lock Publish takes
+		ruleSetRepo.AssertCalled(t, "LockProgram", mock.Anything, programID)
+	})
+
+	t.Run("new type does not fit the stored expression", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		svc := NewProgramRulesService(ruleRepo, newRuleSetRepo(domain.RuleSetDraft), nil, nil, nil, passThroughTxManager{})
+		ruleRepo.On("GetByID", mock.Anything, ruleID).Return(existing(), nil)
+
+		rule, err := svc.Update(ruleID.String(), &domain.UpdateProgramRuleRequest{ConditionType: "program_rule_transaction_amount"})
+
+		assert.Nil(t, rule)
+		assert.True(t, domain.IsValidationError(err))
+		ruleRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	})
+
+	t.Run("published rules are read only", func(t *testing.T) {
+		ruleRepo := new(mockProgramRuleRepository)
+		svc := NewProgramRulesService(ruleRepo, newRuleSetRepo(domain.RuleSetPublished), nil, nil, nil, passThroughTxManager{})
+		ruleRepo.On("GetByID", mock.Anything, ruleID).Return(existing(), nil)
+
+		rule, err := svc.Update(ruleID.String(), &domain.UpdateProgramRuleRequest{ConditionValue: "travel"})
+
+		assert.Nil(t, rule)
+		assert.True(t, domain.IsResourceConflictError(err))
+		ruleRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	})
+}
+
+func TestProgramRulesService_PublishRuleSet(t *testing.T) {
+	ruleSetID := uuid.New()
+
+	t.Run("publishes a draft", func(t *testing.T) {
+		ruleSetRepo := new(mockProgramRuleSetRepository)
+		ruleSetRepo.On("Publish", mock.Anything, ruleSetID, domain.RuleSetDraft).
+			Return(&domain.ProgramRuleSet{ID: ruleSetID, Version: 3, Status: domain.RuleSetPublished}, nil)
+		svc := NewProgramRulesService(nil, ruleSetRepo, nil, nil, nil, passThroughTxManager{})
+
+		ruleSet, err := svc.PublishRuleSet(ruleSetID.String())
+
+		assert.NoError(t, err)
+		assert.Equal(t, domain.RuleSetPublished, ruleSet.Status)
+		ruleSetRepo.AssertExpectations(t)
+	})
+
+	t.Run("rollback republishes an archived version", func(t *testing.T) {
+		ruleSetRepo := new(mockProgramRuleSetRepository)
+		ruleSetRepo.On("Publish", mock.Anything, ruleSetID, domain.RuleSetArchived).
+			Return(&domain.ProgramRuleSet{ID: ruleSetID, Version: 1, Status: domain.RuleSetPublished}, nil)
+		svc := NewProgramRulesService(nil, ruleSetRepo, nil, nil, nil, passThroughTxManager{})
+
+		ruleSet, err := svc.RollbackRuleSet(ruleSetID.String())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ruleSet.Version)
+		ruleSetRepo.AssertExpectations(t)
+	})
+
+	t.Run("already published", func(t *testing.T) {
+		ruleSetRepo := new(mockProgramRuleSetRepository)
+		ruleSetRepo.On("Publish", mock.Anything, ruleSetID, domain.RuleSetDraft).
+			Return(nil, domain.NewResourceConflictError("rule set", "rule set is published, expected draft"))
+		svc := NewProgramRulesService(nil, ruleSetRepo, nil, nil, nil, passThroughTxManager{})
+
+		ruleSet, err := svc.PublishRuleSet(ruleSetID.String())
+
+		assert.Nil(t, ruleSet)
+		assert.True(t, domain.IsResourceConflictError(err))
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		ruleSetRepo := new(mockProgramRuleSetRepository)
+		svc := NewProgramRulesService(nil, ruleSetRepo, nil, nil, nil, passThroughTxManager{})
+
+		ruleSet, err := svc.PublishRuleSet("v2")
+
+		assert.Nil(t, ruleSet)
+		assert.True(t, domain.IsValidationError(err))
+		ruleSetRepo.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestProgramRulesService_Simulate(t *testing.T) {
+	programID := uuid.New()
+	merchantID := uuid.New()
+	customerID := uuid.New()
+	transactionDate := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)
+	expiredAt := transactionDate.AddDate(0, -1, 0)
+
+	newRule := func(name, conditionType, conditionValue string, pointsAwarded int) *domain.ProgramRule {
+		return &domain.ProgramRule{
+			ID:             uuid.New(),
+			ProgramID:      programID,
+			RuleName:       name,
+			ConditionType:  conditionType,
+			ConditionValue: conditionValue,
+			Multiplier:     1,
+			PointsAwarded:  pointsAwarded,
+			Stacking:       domain.RuleStackable,
+			EffectiveFrom:  transactionDate.AddDate(-1, 0, 0),
+		}
+	}
+
+	base := newRule("Base points", "program_rule_transaction_amount", "0", 0)
+	dining := newRule("Dining bonus", "program_rule_transaction_category", "dining", 50)
+	expired := newRule("Winter promo", "program_rule_transaction_amount", "0", 100)
+	expired.EffectiveTo = &expiredAt
+	upcoming := newRule("Summer promo", "program_rule_transaction_amount", "0", 100)
+	upcoming.EffectiveFrom = transactionDate.AddDate(0, 1, 0)
+	big := newRule("Big basket", "program_rule_transaction_amount", ">= 100", 30)
+	big.Stacking = domain.RuleNonStackable
+	big.Priority = 10
+	bigger := newRule("Bigger basket", "program_rule_transaction_amount", ">= 200", 60)
+	bigger.Stacking = domain.RuleNonStackable
+	bigger.Priority = 5
+	rules := []*domain.ProgramRule{base, dining, expired, upcoming, big, bigger}
+
+	setup := func() (*ProgramRulesService, *mockProgramRuleRepository, *mockProgramRepository, *mockMerchantRepository, *mockCustomerContextProvider) {
+		ruleRepo := new(mockProgramRuleRepository)
+		programRepo := new(mockProgramRepository)
+		merchantRepo := new(mockMerchantRepository)
+		customerContext := new(mockCustomerContextProvider)
+		programRepo.On("GetByID", mock.Anything, programID).Return(&domain.Program{ID: programID, MerchantID: merchantID}, nil)
+		ruleRepo.On("GetByProgramID", mock.Anything, programID).Return(rules, nil)
+		svc := NewProgramRulesService(ruleRepo, nil, programRepo, merchantRepo, customerContext, passThroughTxManager{})
+		return svc, ruleRepo, programRepo, merchantRepo, customerContext
+	}
+
+	t.Run("per rule breakdown", func(t *testing.T) {
+		svc, ruleRepo, _, merchantRepo, _ := setup()
+		merchantRepo.On("GetByID", mock.Anything, merchantID).Return(&domain.Merchant{ID: merchantID, Timezone: "UTC"}, nil)
+
+		result, err := svc.Simulate(&domain.SimulateRulesRequest{
+			ProgramID:         programID,
+			TransactionType:   "purchase",
+			TransactionAmount: 250,
+			Category:          "fuel",
+			TransactionDate:   &transactionDate,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 280, result.TotalPoints)
+		assert.Len(t, result.Rules, len(rules))
+
+		byName := map[string]domain.RuleSimulation{}
+		for _, rule := range result.Rules {
+			byName[rule.RuleName] = rule
+		}
+		assert.Equal(t, domain.RuleSimulation{RuleID: big.ID, RuleName: big.RuleName, ConditionType: big.ConditionType,
+			ConditionValue: big.ConditionValue, Priority: 10, Stacking: domain.RuleNonStackable, Matched: true, Points: 30}, byName["Big basket"])
+		assert.Equal(t, 250, byName["Base points"].Points)
+		assert.Equal(t, domain.RuleSkipConditionFalse, byName["Dining bonus"].SkipReason)
+		assert.False(t, byName["Dining bonus"].Matched)
+		assert.Equal(t, domain.RuleSkipExpired, byName["Winter promo"].SkipReason)
+		assert.Equal(t, domain.RuleSkipNotYetEffective, byName["Summer promo"].SkipReason)
+		assert.Equal(t, domain.RuleSkipOverridden, byName["Bigger basket"].SkipReason)
+		assert.True(t, byName["Bigger basket"].Matched)
+		assert.Zero(t, byName["Bigger basket"].Points)
+
+		// Nothing is recorded
+		ruleRepo.AssertNotCalled(t, "CreateAwards", mock.Anything, mock.Anything)
+	})
+
+	t.Run("uses the customer's context", func(t *testing.T) {
+		svc, _, _, merchantRepo, customerContext := setup()
+		customerContext.On("GetCustomerContext", mock.Anything, customerID, programID).Return(&domain.CustomerContext{
+			MerchantCustomersID: customerID,
+			ProgramID:           programID,
+			MemberSince:         transactionDate.AddDate(-2, 0, 0),
+		}, nil)
+
+		result, err := svc.Simulate(&domain.SimulateRulesRequest{
+			ProgramID:           programID,
+			MerchantCustomersID: &customerID,
+			TransactionType:     "purchase",
+			TransactionAmount:   50,
+			Category:            "dining",
+			TransactionDate:     &transactionDate,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 100, result.TotalPoints)
+		merchantRepo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+		customerContext.AssertExpectations(t)
+	})
+
+	t.Run("program not found", func(t *testing.T) {
+		programRepo := new(mockProgramRepository)
+		programRepo.On("GetByID", mock.Anything, programID).Return(nil, nil)
+		svc := NewProgramRulesService(new(mockProgramRuleRepository), nil, programRepo, nil, nil, passThroughTxManager{})
+
+		result, err := svc.Simulate(&domain.SimulateRulesRequest{
+			ProgramID:         programID,
+			TransactionType:   "purchase",
+			TransactionAmount: 50,
+		})
+
+		assert.Nil(t, result)
+		assert.True(t, domain.IsResourceNotFoundError(err))
+	})
+}
+
+type mockProgramRepository struct {
+	mock.Mock
+}
+
+func (m *mockProgramRepository) Create(ctx context.Context, program *domain.Program) (*domain.Program, error) {
+	args := m.Called(ctx, program)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Program), args.Error(1)
+}
+
+func (m *mockProgramRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Program, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Program), args.Error(1)
+}
+
+func (m *mockProgramRepository) GetAll(ctx context.Context) ([]*domain.Program, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Program), args.Error(1)
+}
+
+func (m *mockProgramRepository) Update(ctx context.Context, program *domain.Program) error {
+	args := m.Called(ctx, program)
+	return args.Error(0)
+}
+
+func (m *mockProgramRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockProgramRepository) GetByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]*domain.Program, error) {
+	args := m.Called(ctx, merchantID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Program), args.Error(1)
+}
@@ -36,6 +36,7 @@ func (s *ProgramService) Create(ctx context.Context, req *domain.CreateProgramRe
 		MerchantID:        req.MerchantID,
 		ProgramName:       req.ProgramName,
 		PointCurrencyName: req.PointCurrencyName,
+		RefundPolicy:      req.RefundPolicy,
 		UserID:            req.UserID,
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
@@ -104,6 +105,9 @@ func (s *ProgramService) Update(ctx context.Context, id uuid.UUID, req *domain.U
 	if req.PointCurrencyName != "" {
 		program.PointCurrencyName = req.PointCurrencyName
 	}
+	if req.RefundPolicy != "" {
+		program.RefundPolicy = req.RefundPolicy
+	}
 	program.UpdatedAt = time.Now()
 
 	if err := s.programRepo.Update(ctx, program); err != nil {
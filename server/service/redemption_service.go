@@ -2,8 +2,14 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"go-playground/pkg/logging"
 	"go-playground/server/domain"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
@@ -14,7 +20,9 @@ type RedemptionService struct {
 	rewardsRepo        domain.RewardsRepository
 	pointsService      domain.PointsService
 	transactionService domain.TransactionService
+	voucherService     domain.VoucherService
 	eventLoggerService domain.EventLoggerService
+	txManager          domain.TxManager
 	logger             zerolog.Logger
 }
 
@@ -23,101 +31,358 @@ func NewRedemptionService(
 	rewardsRepo domain.RewardsRepository,
 	pointsService domain.PointsService,
 	transactionService domain.TransactionService,
+	voucherService domain.VoucherService,
 	eventLoggerService domain.EventLoggerService,
+	txManager domain.TxManager,
 ) *RedemptionService {
 	return &RedemptionService{
 		redemptionRepo:     redemptionRepo,
 		rewardsRepo:        rewardsRepo,
 		pointsService:      pointsService,
 		transactionService: transactionService,
+		voucherService:     voucherService,
 		eventLoggerService: eventLoggerService,
+		txManager:          txManager,
 		logger:             logging.GetLogger(),
 	}
 }
 
 func (s *RedemptionService) Create(ctx context.Context, redemption *domain.Redemption) error {
+	reward, err := s.getRedeemableReward(ctx, redemption.RewardID)
+	if err != nil {
+		return err
+	}
+
+	// Set points_used in redemption record, and the cash paying for the
+	// rest of a points and cash reward
+	if redemption.PointsUsed, redemption.CashAmount, err = splitPointsAndCash(reward, redemption.PointsUsed); err != nil {
+		return err
+	}
+	redemption.Status = domain.RedemptionStatusPending
+
+	return s.redeem(ctx, redemption.MerchantCustomersID, reward.ProgramID, []*rewardRedemptions{
+		{reward: reward, redemptions: []*domain.Redemption{redemption}},
+	})
+}
+
+// CreateCart redeems several rewards for a customer at once. The points of
+// the whole cart are checked and taken with one transaction, and the stock of
+// every reward is reserved in the same unit of work, so either every item is
+// redeemed or none is.
+func (s *RedemptionService) CreateCart(ctx context.Context, req *domain.CreateRedemptionCartRequest) (*domain.RedemptionGroup, error) {
+	group := &domain.RedemptionGroup{
+		GroupID:             uuid.New(),
+		MerchantCustomersID: req.MerchantCustomersID,
+	}
+
+	// The same reward listed twice is redeemed as one line
+	lines := make(map[uuid.UUID]*rewardRedemptions, len(req.Items))
+	var programID uuid.UUID
+	for _, item := range req.Items {
+		line, ok := lines[item.RewardID]
+		if !ok {
+			reward, err := s.getRedeemableReward(ctx, item.RewardID)
+			if err != nil {
+				return nil, err
+			}
+			if programID == uuid.Nil {
+				programID = reward.ProgramID
+			}
+			if reward.ProgramID != programID {
+				s.logger.Error().
+					Str("reward_id", reward.ID.String()).
+					Msg("Cart mixes rewards of several programs")
+				return nil, domain.NewValidationError("items", "all rewards of a cart must belong to one program")
+			}
+			line = &rewardRedemptions{reward: reward}
+			lines[item.RewardID] = line
+		}
+
+		for range item.Quantity {
+			line.redemptions = append(line.redemptions, &domain.Redemption{
+				MerchantCustomersID: req.MerchantCustomersID,
+				RewardID:            item.RewardID,
+				PointsUsed:          line.reward.PointsRequired,
+				RedemptionDate:      time.Now(),
+				Status:              domain.RedemptionStatusPending,
+				GroupID:             &group.GroupID,
+			})
+		}
+	}
+
+	cart := slices.Collect(maps.Values(lines))
+	if err := s.redeem(ctx, req.MerchantCustomersID, programID, cart); err != nil {
+		return nil, err
+	}
+
+	for _, line := range cart {
+		for _, redemption := range line.redemptions {
+			group.Redemptions = append(group.Redemptions, redemption)
+			group.PointsUsed += redemption.PointsUsed
+		}
+	}
+	group.TransactionID = group.Redemptions[0].TransactionID
+
+	s.logger.Info().
+		Str("group_id", group.GroupID.String()).
+		Int("redemptions", len(group.Redemptions)).
+		Int("points_used", group.PointsUsed).
+		Msg("Redemption cart created")
+	return group, nil
+}
+
+// GetGroup returns the redemptions of a cart.
+func (s *RedemptionService) GetGroup(ctx context.Context, groupID string) (*domain.RedemptionGroup, error) {
+	id, err := uuid.Parse(groupID)
+	if err != nil {
+		return nil, domain.NewValidationError("group_id", "invalid redemption group ID format")
+	}
+
+	redemptions, err := s.redemptionRepo.GetByGroupID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(redemptions) == 0 {
+		return nil, domain.NewResourceNotFoundError("redemption group", groupID, "redemption group not found")
+	}
+
+	group := &domain.RedemptionGroup{
+		GroupID:             id,
+		MerchantCustomersID: redemptions[0].MerchantCustomersID,
+		TransactionID:       redemptions[0].TransactionID,
+		Redemptions:         redemptions,
+	}
+	for _, redemption := range redemptions {
+		group.PointsUsed += redemption.PointsUsed
+	}
+	return group, nil
+}
+
+// splitPointsAndCash returns the points a redemption of the reward burns and
+// the cash paid for the rest. A points only reward always takes its full
+// points, a points and cash reward takes the points asked for, at least its
+// min_points, and charges cash_per_point for every point short of
+// points_required.
+func splitPointsAndCash(reward *domain.Reward, points int) (int, float64, error) {
+	if reward.MinPoints == nil || reward.CashPerPoint == nil || points <= 0 {
+		return reward.PointsRequired, 0, nil
+	}
+	if points < *reward.MinPoints || points > reward.PointsRequired {
+		return 0, 0, domain.NewValidationError("points_used",
+			fmt.Sprintf("points used must be between %d and %d", *reward.MinPoints, reward.PointsRequired))
+	}
+	cash := float64(reward.PointsRequired-points) * *reward.CashPerPoint
+	return points, math.Round(cash*100) / 100, nil
+}
+
+// rewardRedemptions is a reward being redeemed and its redemptions, one per
+// unit redeemed.
+type rewardRedemptions struct {
+	reward      *domain.Reward
+	redemptions []*domain.Redemption
+}
+
+// getRedeemableReward returns a reward that exists and is active.
+func (s *RedemptionService) getRedeemableReward(ctx context.Context, rewardID uuid.UUID) (*domain.Reward, error) {
 	// Check if reward exists and is active
-	reward, err := s.rewardsRepo.GetByID(ctx, redemption.RewardID)
+	reward, err := s.rewardsRepo.GetByID(ctx, rewardID)
 	if err != nil {
 		s.logger.Error().
 			Err(err).
 			Msg("Failed to get reward")
-		return domain.NewSystemError("RedemptionService.Create", err, "failed to get reward")
+		return nil, domain.NewSystemError("RedemptionService.getRedeemableReward", err, "failed to get reward")
 	}
 	if reward == nil {
 		s.logger.Error().
-			Str("reward_id", redemption.RewardID.String()).
+			Str("reward_id", rewardID.String()).
 			Msg("Failed to get reward")
-		return domain.NewResourceNotFoundError("reward", redemption.RewardID.String(), "reward not found")
+		return nil, domain.NewResourceNotFoundError("reward", rewardID.String(), "reward not found")
 	}
 	if !reward.IsActive {
 		s.logger.Error().
-			Str("reward_id", redemption.RewardID.String()).
+			Str("reward_id", rewardID.String()).
 			Msg("Failed to get reward")
-		return domain.NewBusinessLogicError("REWARD_INACTIVE", "reward is not available")
+		return nil, domain.NewBusinessLogicError("REWARD_INACTIVE", "reward is not available")
 	}
+	return reward, nil
+}
 
-	// Parse user ID and program ID to UUID
-	customerID, err := uuid.Parse(redemption.MerchantCustomersID.String())
-	if err != nil {
-		s.logger.Error().
-			Err(err).
-			Msg("Failed to parse customer ID")
-		return domain.NewValidationError("customer_id", "invalid customer ID format")
+// redeem creates the redemptions of a customer's rewards of one program and
+// takes their points with a single redemption transaction.
+func (s *RedemptionService) redeem(ctx context.Context, customerID, programID uuid.UUID, lines []*rewardRedemptions) error {
+	total, cash := 0, 0.0
+	for _, line := range lines {
+		for _, redemption := range line.redemptions {
+			total += redemption.PointsUsed
+			cash += redemption.CashAmount
+		}
 	}
 
 	// Check if user has enough points
-	balance, err := s.pointsService.GetBalance(ctx, customerID, reward.ProgramID)
+	balance, err := s.pointsService.GetBalance(ctx, customerID, programID)
 	if err != nil {
 		s.logger.Error().
 			Err(err).
 			Msg("Failed to get points balance")
-		return domain.NewSystemError("RedemptionService.Create", err, "failed to get points balance")
+		return domain.NewSystemError("RedemptionService.redeem", err, "failed to get points balance")
 	}
-	if balance.Balance < reward.PointsRequired {
+	if balance.Balance < total {
 		s.logger.Error().
-			Str("reward_id", redemption.RewardID.String()).
-			Msg("Failed to get reward")
+			Str("customer_id", customerID.String()).
+			Int("points_required", total).
+			Msg("Insufficient points for redemption")
 		return domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points")
 	}
 
-	// Set points_used in redemption record
-	redemption.PointsUsed = reward.PointsRequired
+	// Rewards are reserved in the same order by every redemption, so carts
+	// sharing rewards wait for each other instead of deadlocking
+	slices.SortFunc(lines, func(a, b *rewardRedemptions) int {
+		return strings.Compare(a.reward.ID.String(), b.reward.ID.String())
+	})
 
-	// Create redemption record
-	redemptions, err := s.redemptionRepo.Create(ctx, redemption)
+	// The redemptions, their stock, their points transaction and events
+	// commit together or not at all
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		available := make([]*int, len(lines))
+		for i, line := range lines {
+			if available[i], err = s.reserveStock(ctx, customerID, line.reward, len(line.redemptions)); err != nil {
+				return err
+			}
+		}
+
+		// Deduct points by creating a redemption transaction, which joins
+		// this unit of work. Refunds of the redemptions point at it. The cash
+		// paid alongside is recorded with it for finance to reconcile.
+		transaction, err := s.transactionService.Create(ctx, &domain.CreateTransactionRequest{
+			MerchantCustomersID: customerID,
+			MerchantID:          uuid.Nil, // filled in by the transaction service
+			ProgramID:           programID,
+			TransactionType:     "redemption",
+			TransactionAmount:   float64(total),
+			TransactionDate:     time.Now(),
+			Status:              domain.TransactionCompleted,
+			CashAmount:          math.Round(cash*100) / 100,
+		})
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Failed to create redemption transaction")
+			// The balance is checked again under the account lock, a
+			// redemption that lost a race for the points gets INSUFFICIENT_POINTS
+			if domain.IsBusinessLogicError(err) || domain.IsValidationError(err) || domain.IsResourceNotFoundError(err) {
+				return err
+			}
+			return domain.NewSystemError("RedemptionService.redeem", err, "failed to create redemption transaction")
+		}
+
+		for i, line := range lines {
+			for _, redemption := range line.redemptions {
+				redemption.TransactionID = &transaction.TransactionID
+				if err := s.createRedemption(ctx, redemption, line.reward); err != nil {
+					return err
+				}
+
+				s.logger.Info().
+					Str("redemption_id", redemption.ID.String()).
+					Str("paired_tx_id", transaction.TransactionID.String()).
+					Msg("transaction record for redemption")
+			}
+
+			// Only the redemption that takes the stock down to the threshold
+			// alerts the merchant
+			reward := line.reward
+			if available[i] != nil && reward.LowStockThreshold != nil &&
+				*available[i] <= *reward.LowStockThreshold && *available[i]+len(line.redemptions) > *reward.LowStockThreshold {
+				reward.AvailableQuantity = available[i]
+				if err := s.eventLoggerService.SaveRewardLowStockEvents(ctx, reward, customerID); err != nil {
+					s.logger.Error().
+						Err(err).
+						Msg("Failed to save reward low stock event")
+					return domain.NewSystemError("RedemptionService.redeem", err, "failed to save reward low stock event")
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// reserveStock takes quantity units of a reward's stock within the customer's
+// redemption limit and returns the stock left, nil when it is not limited.
+func (s *RedemptionService) reserveStock(ctx context.Context, customerID uuid.UUID, reward *domain.Reward, quantity int) (*int, error) {
+	// Reserving the stock first holds the reward, so the customer's
+	// redemptions counted below can not change until this commits
+	reserved, available, err := s.rewardsRepo.ReserveStock(ctx, reward.ID, quantity)
 	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Failed to reserve reward stock")
+		return nil, domain.NewSystemError("RedemptionService.reserveStock", err, "failed to reserve reward stock")
+	}
+	if !reserved {
+		s.logger.Warn().
+			Str("reward_id", reward.ID.String()).
+			Int("quantity", quantity).
+			Msg("Reward is out of stock")
+		return nil, domain.NewBusinessLogicError("REWARD_OUT_OF_STOCK", "reward is out of stock")
+	}
+
+	if reward.MaxPerCustomer != nil {
+		count, err := s.redemptionRepo.CountActive(ctx, customerID, reward.ID)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Failed to count redemptions")
+			return nil, domain.NewSystemError("RedemptionService.reserveStock", err, "failed to count redemptions")
+		}
+		if count+quantity > *reward.MaxPerCustomer {
+			s.logger.Warn().
+				Str("reward_id", reward.ID.String()).
+				Str("customer_id", customerID.String()).
+				Msg("Customer reached the reward's redemption limit")
+			return nil, domain.NewBusinessLogicError("REDEMPTION_LIMIT_REACHED", "customer has reached the redemption limit for this reward")
+		}
+	}
+	return available, nil
+}
+
+// createRedemption stores a redemption paid for by its transaction with its
+// audit entry, voucher and event. The redemption is filled in as it is stored.
+func (s *RedemptionService) createRedemption(ctx context.Context, redemption *domain.Redemption, reward *domain.Reward) error {
+	// Create redemption record
+	if _, err := s.redemptionRepo.Create(ctx, redemption); err != nil {
 		s.logger.Error().
 			Err(err).
 			Msg("Failed to create redemption")
-		return domain.NewSystemError("RedemptionService.Create", err, "failed to create redemption")
-	}
-	redemption = redemptions[0]
-
-	// Deduct points by creating a redemption transaction
-	transaction, err := s.transactionService.Create(ctx, &domain.CreateTransactionRequest{
-		MerchantCustomersID: redemption.MerchantCustomersID,
-		MerchantID:          uuid.Nil, // filled in by the transaction service
-		ProgramID:           reward.ProgramID,
-		TransactionType:     "redemption",
-		TransactionAmount:   float64(reward.PointsRequired),
-		TransactionDate:     redemption.RedemptionDate,
-	})
+		return domain.NewSystemError("RedemptionService.createRedemption", err, "failed to create redemption")
+	}
+
+	if err := s.redemptionRepo.RecordStatusChange(ctx, &domain.RedemptionStatusChange{
+		RedemptionID: redemption.ID,
+		ToStatus:     redemption.Status,
+	}); err != nil {
+		return err
+	}
+
+	// The customer shows the voucher at a branch to get the reward
+	voucher, err := s.voucherService.Issue(ctx, redemption, reward)
 	if err != nil {
 		s.logger.Error().
 			Err(err).
-			Msg("Failed to create redemption transaction")
-		return domain.NewSystemError("RedemptionService.Create", err, "failed to create redemption transaction")
+			Msg("Failed to issue voucher")
+		if domain.IsBusinessLogicError(err) {
+			return err
+		}
+		return domain.NewSystemError("RedemptionService.createRedemption", err, "failed to issue voucher")
 	}
-
-	s.logger.Info().
-		Str("redemption_id", redemption.ID.String()).
-		Str("paired_tx_id", transaction.TransactionID.String()).
-		Msg("transaction record for redemption")
+	redemption.Voucher = voucher
 
 	// Log the redemption event
-	go s.eventLoggerService.SaveRedemptionEvents(ctx, domain.RewardRedeemed, redemption, reward)
-
+	if err := s.eventLoggerService.SaveRedemptionEvents(ctx, domain.RewardRedeemed, redemption, reward); err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Failed to save redemption event")
+		return domain.NewSystemError("RedemptionService.createRedemption", err, "failed to save redemption event")
+	}
 	return nil
 }
 
@@ -135,6 +400,11 @@ func (s *RedemptionService) GetByID(id string) (*domain.Redemption, error) {
 			Msg("Failed to get redemption")
 		return nil, domain.NewResourceNotFoundError("redemption", id, "redemption not found")
 	}
+
+	redemption.Voucher, err = s.voucherService.GetByRedemptionID(context.Background(), redemption.ID)
+	if err != nil {
+		return nil, domain.NewSystemError("RedemptionService.GetByID", err, "failed to get voucher")
+	}
 	return redemption, nil
 }
 
@@ -149,20 +419,48 @@ func (s *RedemptionService) GetByUserID(userID string) ([]*domain.Redemption, er
 	return redemptions, nil
 }
 
-func (s *RedemptionService) UpdateStatus(ctx context.Context, id string, status string) error {
-	redemption, err := s.redemptionRepo.GetByID(context.Background(), uuid.MustParse(id))
+// UpdateStatus moves a redemption along its lifecycle. Cancelling or failing
+// it gives its points back with a refund of its transaction, cancelling,
+// failing or expiring it puts the reward back in stock and voids its voucher.
+func (s *RedemptionService) UpdateStatus(ctx context.Context, id string, req *domain.UpdateRedemptionRequest) error {
+	redemptionID, err := uuid.Parse(id)
 	if err != nil {
-		return domain.NewSystemError("RedemptionService.UpdateStatus", err, "failed to get redemption")
-	}
-	if redemption == nil {
-		return domain.NewResourceNotFoundError("redemption", id, "redemption not found")
+		return domain.NewValidationError("id", "invalid redemption ID format")
 	}
+	status := domain.RedemptionStatus(req.Status)
+
+	// The refund, the status change, its audit entry and event commit together
+	// or not at all
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Vouchers are locked before their redemption, as in
+		// VoucherService.Verify, so a cancellation racing a scan of its voucher
+		// waits for it instead of deadlocking. Voiding a voucher the status
+		// change turns out not to allow is rolled back with it.
+		if status.ReleasesReward() {
+			if err := s.voucherService.Void(ctx, redemptionID); err != nil {
+				return domain.NewSystemError("RedemptionService.UpdateStatus", err, "failed to void voucher")
+			}
+		}
+
+		// Locked so a concurrent status change can not refund it twice
+		redemption, err := s.redemptionRepo.LockByID(ctx, redemptionID)
+		if err != nil {
+			return domain.NewSystemError("RedemptionService.UpdateStatus", err, "failed to lock redemption")
+		}
+		if redemption == nil {
+			return domain.NewResourceNotFoundError("redemption", id, "redemption not found")
+		}
 
-	oldStatus := redemption.Status
-	redemption.Status = domain.RedemptionStatus(status)
+		if !domain.CanTransitionRedemption(redemption.Status, status) {
+			s.logger.Error().
+				Str("redemption_id", id).
+				Str("from", string(redemption.Status)).
+				Str("to", string(status)).
+				Msg("Invalid redemption status transition")
+			return domain.NewBusinessLogicError("INVALID_STATUS_TRANSITION", fmt.Sprintf(
+				"a %s redemption can not become %s", redemption.Status, status))
+		}
 
-	// If canceling a pending redemption, refund the points
-	if oldStatus == "pending" && status == "canceled" {
 		reward, err := s.rewardsRepo.GetByID(ctx, redemption.RewardID)
 		if err != nil {
 			return domain.NewSystemError("RedemptionService.UpdateStatus", err, "failed to get reward")
@@ -171,29 +469,102 @@ func (s *RedemptionService) UpdateStatus(ctx context.Context, id string, status
 			return domain.NewResourceNotFoundError("reward", redemption.RewardID.String(), "reward not found")
 		}
 
-		customerID, err := uuid.Parse(redemption.MerchantCustomersID.String())
-		if err != nil {
-			return domain.NewValidationError("customer_id", "invalid customer ID format")
+		oldStatus := redemption.Status
+		change := &domain.RedemptionStatusChange{
+			RedemptionID: redemption.ID,
+			FromStatus:   &oldStatus,
+			ToStatus:     status,
+			Reason:       req.Reason,
+			ChangedBy:    req.ChangedBy,
 		}
 
-		refundID := uuid.New()
-		_, err = s.pointsService.EarnPoints(ctx, &domain.PointsTransaction{
-			CustomerID:    customerID.String(),
-			ProgramID:     reward.ProgramID.String(),
-			Points:        reward.PointsRequired,
-			Type:          "refund",
-			TransactionID: refundID.String(),
-		})
-		if err != nil {
-			return domain.NewSystemError("RedemptionService.UpdateStatus", err, "failed to refund points")
+		if status.RefundsPoints() {
+			refund, err := s.refund(ctx, redemption, reward)
+			if err != nil {
+				return err
+			}
+			change.RefundTransactionID = &refund.TransactionID
+		}
+
+		if status.ReleasesReward() {
+			if err := s.rewardsRepo.ReleaseStock(ctx, reward.ID, 1); err != nil {
+				return domain.NewSystemError("RedemptionService.UpdateStatus", err, "failed to release reward stock")
+			}
+		}
+
+		redemption.Status = status
+		if err := s.redemptionRepo.Update(ctx, redemption); err != nil {
+			return domain.NewSystemError("RedemptionService.UpdateStatus", err, "failed to update redemption status")
 		}
+
+		if err := s.redemptionRepo.RecordStatusChange(ctx, change); err != nil {
+			return err
+		}
+
+		if err := s.eventLoggerService.SaveRedemptionStatusEvents(ctx, redemption, reward, oldStatus); err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Failed to save redemption status event")
+			return domain.NewSystemError("RedemptionService.UpdateStatus", err, "failed to save redemption status event")
+		}
+
+		s.logger.Info().
+			Str("redemption_id", id).
+			Str("from", string(oldStatus)).
+			Str("to", string(status)).
+			Msg("Redemption status updated")
+		return nil
+	})
+}
+
+// refund gives a redemption's points back with a refund of the transaction
+// that took them.
+func (s *RedemptionService) refund(ctx context.Context, redemption *domain.Redemption, reward *domain.Reward) (*domain.Transaction, error) {
+	if redemption.TransactionID == nil {
+		s.logger.Error().
+			Str("redemption_id", redemption.ID.String()).
+			Msg("Redemption has no transaction to refund")
+		return nil, domain.NewBusinessLogicError("REDEMPTION_NOT_REFUNDABLE", "redemption has no points transaction to refund")
 	}
 
-	if err := s.redemptionRepo.Update(ctx, redemption); err != nil {
-		return domain.NewSystemError("RedemptionService.UpdateStatus", err, "failed to update redemption status")
+	refund, err := s.transactionService.Create(ctx, &domain.CreateTransactionRequest{
+		MerchantCustomersID:   redemption.MerchantCustomersID,
+		MerchantID:            uuid.Nil, // filled in by the transaction service
+		ProgramID:             reward.ProgramID,
+		TransactionType:       "refund",
+		TransactionAmount:     float64(redemption.PointsUsed),
+		TransactionDate:       time.Now(),
+		Status:                domain.TransactionCompleted,
+		OriginalTransactionID: redemption.TransactionID,
+		CashAmount:            redemption.CashAmount, // to be given back by the merchant
+	})
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("redemption_id", redemption.ID.String()).
+			Msg("Failed to refund redemption")
+		if domain.IsBusinessLogicError(err) {
+			return nil, err
+		}
+		return nil, domain.NewSystemError("RedemptionService.refund", err, "failed to refund points")
 	}
+	return refund, nil
+}
 
-	return nil
+// GetStatusHistory returns the audit trail of a redemption's status changes.
+func (s *RedemptionService) GetStatusHistory(ctx context.Context, id string) ([]*domain.RedemptionStatusChange, error) {
+	redemptionID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, domain.NewValidationError("id", "invalid redemption ID format")
+	}
+	redemption, err := s.redemptionRepo.GetByID(ctx, redemptionID)
+	if err != nil {
+		return nil, err
+	}
+	if redemption == nil {
+		return nil, domain.NewResourceNotFoundError("redemption", id, "redemption not found")
+	}
+	return s.redemptionRepo.GetStatusHistory(ctx, redemptionID)
 }
 
 func (s *RedemptionService) SetPointsService(pointsService domain.PointsService) {
@@ -1 +1,595 @@
 package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+	"go-playground/server/mocks/repository/postgres"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type mockVoucherService struct {
+	mock.Mock
+}
+
+func (m *mockVoucherService) Issue(ctx context.Context, redemption *domain.Redemption, reward *domain.Reward) (*domain.Voucher, error) {
+	args := m.Called(ctx, redemption, reward)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Voucher), args.Error(1)
+}
+
+func (m *mockVoucherService) Void(ctx context.Context, redemptionID uuid.UUID) error {
+	args := m.Called(ctx, redemptionID)
+	return args.Error(0)
+}
+
+func (m *mockVoucherService) GetByRedemptionID(ctx context.Context, redemptionID uuid.UUID) (*domain.Voucher, error) {
+	args := m.Called(ctx, redemptionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Voucher), args.Error(1)
+}
+
+type RedemptionServiceTestSuite struct {
+	suite.Suite
+	redemptionRepo     *postgres.MockRedemptionRepository
+	rewardsRepo        *postgres.MockRewardsRepository
+	pointsService      *mockPointsService
+	transactionService *mockTransactionService
+	voucherService     *mockVoucherService
+	eventLogger        *mockEventLoggerService
+	service            *RedemptionService
+	customerID         uuid.UUID
+	reward             *domain.Reward
+}
+
+func (s *RedemptionServiceTestSuite) SetupTest() {
+	s.redemptionRepo = new(postgres.MockRedemptionRepository)
+	s.rewardsRepo = new(postgres.MockRewardsRepository)
+	s.pointsService = new(mockPointsService)
+	s.transactionService = new(mockTransactionService)
+	s.voucherService = new(mockVoucherService)
+	s.eventLogger = new(mockEventLoggerService)
+	s.service = NewRedemptionService(
+		s.redemptionRepo,
+		s.rewardsRepo,
+		s.pointsService,
+		s.transactionService,
+		s.voucherService,
+		s.eventLogger,
+		passThroughTxManager{},
+	)
+
+	s.customerID = uuid.New()
+	s.reward = &domain.Reward{
+		ID:             uuid.New(),
+		ProgramID:      uuid.New(),
+		Name:           "Free coffee",
+		PointsRequired: 100,
+		IsActive:       true,
+	}
+	s.rewardsRepo.On("GetByID", mock.Anything, s.reward.ID).Return(s.reward, nil)
+	s.pointsService.On("GetBalance", mock.Anything, s.customerID, s.reward.ProgramID).
+		Return(&domain.PointsBalance{Balance: 500}, nil).Maybe()
+}
+
+func TestRedemptionServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(RedemptionServiceTestSuite))
+}
+
+func (s *RedemptionServiceTestSuite) redemption() *domain.Redemption {
+	return &domain.Redemption{
+		MerchantCustomersID: s.customerID,
+		RewardID:            s.reward.ID,
+		RedemptionDate:      time.Now(),
+		Status:              domain.RedemptionStatusPending,
+	}
+}
+
+// redeemed lets the redemption, its transaction, voucher and event be created.
+func (s *RedemptionServiceTestSuite) redeemed(redemption *domain.Redemption) {
+	s.redemptionRepo.On("Create", mock.Anything, redemption).Return([]*domain.Redemption{redemption}, nil)
+	s.transactionService.On("Create", mock.Anything, mock.Anything).
+		Return(&domain.Transaction{TransactionID: uuid.New()}, nil)
+	s.redemptionRepo.On("RecordStatusChange", mock.Anything, mock.Anything).Return(nil)
+	s.voucherService.On("Issue", mock.Anything, redemption, s.reward).
+		Return(&domain.Voucher{Code: "ABCD-EFGH-JKLM", Status: domain.VoucherIssued}, nil)
+	s.eventLogger.On("SaveRedemptionEvents", mock.Anything, domain.RewardRedeemed, mock.Anything, s.reward).Return(nil)
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_ReservesStock() {
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, intPtr(9), nil)
+	redemption := s.redemption()
+	s.redeemed(redemption)
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.NoError(err)
+	s.Require().NotNil(redemption.Voucher)
+	s.Equal("ABCD-EFGH-JKLM", redemption.Voucher.Code)
+	s.rewardsRepo.AssertExpectations(s.T())
+	s.redemptionRepo.AssertNotCalled(s.T(), "CountActive", mock.Anything, mock.Anything, mock.Anything)
+	s.eventLogger.AssertNotCalled(s.T(), "SaveRewardLowStockEvents", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_OutOfStock() {
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(false, nil, nil)
+
+	err := s.service.Create(context.Background(), s.redemption())
+
+	s.Require().Error(err)
+	s.Equal("REWARD_OUT_OF_STOCK", err.(domain.BusinessLogicError).Code)
+	s.redemptionRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+	s.transactionService.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_LimitReached() {
+	s.reward.MaxPerCustomer = intPtr(2)
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, nil, nil)
+	s.redemptionRepo.On("CountActive", mock.Anything, s.customerID, s.reward.ID).Return(2, nil)
+
+	err := s.service.Create(context.Background(), s.redemption())
+
+	s.Require().Error(err)
+	s.Equal("REDEMPTION_LIMIT_REACHED", err.(domain.BusinessLogicError).Code)
+	s.redemptionRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_UnderLimit() {
+	s.reward.MaxPerCustomer = intPtr(2)
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, nil, nil)
+	s.redemptionRepo.On("CountActive", mock.Anything, s.customerID, s.reward.ID).Return(1, nil)
+	redemption := s.redemption()
+	s.redeemed(redemption)
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.NoError(err)
+	s.redemptionRepo.AssertCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_AlertsWhenStockDropsToThreshold() {
+	s.reward.LowStockThreshold = intPtr(5)
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, intPtr(5), nil)
+	redemption := s.redemption()
+	s.redeemed(redemption)
+	s.eventLogger.On("SaveRewardLowStockEvents", mock.Anything, mock.MatchedBy(func(reward *domain.Reward) bool {
+		return reward.ID == s.reward.ID && *reward.AvailableQuantity == 5
+	}), s.customerID).Return(nil)
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.NoError(err)
+	s.eventLogger.AssertExpectations(s.T())
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_AlertsOnlyOnce() {
+	s.reward.LowStockThreshold = intPtr(5)
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, intPtr(4), nil)
+	redemption := s.redemption()
+	s.redeemed(redemption)
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.NoError(err)
+	s.eventLogger.AssertNotCalled(s.T(), "SaveRewardLowStockEvents", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_LinksTransactionAndAudits() {
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, nil, nil)
+	redemption := s.redemption()
+	redemption.Status = ""
+	s.redeemed(redemption)
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.NoError(err)
+	s.Equal(domain.RedemptionStatusPending, redemption.Status)
+	s.NotNil(redemption.TransactionID)
+	s.transactionService.AssertCalled(s.T(), "Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+		return req.TransactionType == "redemption" && req.Status == domain.TransactionCompleted &&
+			req.TransactionAmount == float64(s.reward.PointsRequired)
+	}))
+	s.redemptionRepo.AssertCalled(s.T(), "RecordStatusChange", mock.Anything, mock.MatchedBy(func(change *domain.RedemptionStatusChange) bool {
+		return change.FromStatus == nil && change.ToStatus == domain.RedemptionStatusPending
+	}))
+}
+
+// placed stores a pending redemption of the suite's reward, paid for by a
+// redemption transaction.
+func (s *RedemptionServiceTestSuite) placed() *domain.Redemption {
+	transactionID := uuid.New()
+	redemption := s.redemption()
+	redemption.ID = uuid.New()
+	redemption.PointsUsed = s.reward.PointsRequired
+	redemption.TransactionID = &transactionID
+	s.redemptionRepo.On("LockByID", mock.Anything, redemption.ID).Return(redemption, nil)
+	return redemption
+}
+
+// updated lets a redemption's status change, its audit entry and event be saved.
+func (s *RedemptionServiceTestSuite) updated(redemption *domain.Redemption, from domain.RedemptionStatus) {
+	s.redemptionRepo.On("Update", mock.Anything, redemption).Return(nil)
+	s.redemptionRepo.On("RecordStatusChange", mock.Anything, mock.Anything).Return(nil)
+	s.eventLogger.On("SaveRedemptionStatusEvents", mock.Anything, redemption, s.reward, from).Return(nil)
+}
+
+func (s *RedemptionServiceTestSuite) TestUpdateStatus_CancelRefundsTransaction() {
+	redemption := s.placed()
+	refundID := uuid.New()
+	s.voucherService.On("Void", mock.Anything, redemption.ID).Return(nil)
+	s.transactionService.On("Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+		return req.TransactionType == "refund" && req.OriginalTransactionID == redemption.TransactionID &&
+			req.TransactionAmount == float64(s.reward.PointsRequired) && req.MerchantCustomersID == s.customerID
+	})).Return(&domain.Transaction{TransactionID: refundID}, nil)
+	s.rewardsRepo.On("ReleaseStock", mock.Anything, s.reward.ID, 1).Return(nil)
+	s.updated(redemption, domain.RedemptionStatusPending)
+
+	err := s.service.UpdateStatus(context.Background(), redemption.ID.String(), &domain.UpdateRedemptionRequest{
+		Status:    string(domain.RedemptionStatusCancelled),
+		Reason:    "customer changed their mind",
+		ChangedBy: "user-1",
+	})
+
+	s.NoError(err)
+	s.Equal(domain.RedemptionStatusCancelled, redemption.Status)
+	s.rewardsRepo.AssertCalled(s.T(), "ReleaseStock", mock.Anything, s.reward.ID, 1)
+	s.voucherService.AssertCalled(s.T(), "Void", mock.Anything, redemption.ID)
+	s.redemptionRepo.AssertCalled(s.T(), "RecordStatusChange", mock.Anything, mock.MatchedBy(func(change *domain.RedemptionStatusChange) bool {
+		return *change.FromStatus == domain.RedemptionStatusPending && change.ToStatus == domain.RedemptionStatusCancelled &&
+			change.Reason == "customer changed their mind" && change.ChangedBy == "user-1" &&
+			*change.RefundTransactionID == refundID
+	}))
+	s.pointsService.AssertNotCalled(s.T(), "EarnPoints", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestUpdateStatus_ApproveKeepsStock() {
+	redemption := s.placed()
+	s.updated(redemption, domain.RedemptionStatusPending)
+
+	err := s.service.UpdateStatus(context.Background(), redemption.ID.String(), &domain.UpdateRedemptionRequest{
+		Status: string(domain.RedemptionStatusApproved),
+	})
+
+	s.NoError(err)
+	s.Equal(domain.RedemptionStatusApproved, redemption.Status)
+	s.rewardsRepo.AssertNotCalled(s.T(), "ReleaseStock", mock.Anything, mock.Anything, mock.Anything)
+	s.transactionService.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+	s.voucherService.AssertNotCalled(s.T(), "Void", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestUpdateStatus_ExpireForfeitsPoints() {
+	redemption := s.placed()
+	redemption.Status = domain.RedemptionStatusApproved
+	s.voucherService.On("Void", mock.Anything, redemption.ID).Return(nil)
+	s.rewardsRepo.On("ReleaseStock", mock.Anything, s.reward.ID, 1).Return(nil)
+	s.updated(redemption, domain.RedemptionStatusApproved)
+
+	err := s.service.UpdateStatus(context.Background(), redemption.ID.String(), &domain.UpdateRedemptionRequest{
+		Status: string(domain.RedemptionStatusExpired),
+	})
+
+	s.NoError(err)
+	s.Equal(domain.RedemptionStatusExpired, redemption.Status)
+	s.rewardsRepo.AssertCalled(s.T(), "ReleaseStock", mock.Anything, s.reward.ID, 1)
+	s.transactionService.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestUpdateStatus_RejectsInvalidTransition() {
+	redemption := s.placed()
+	redemption.Status = domain.RedemptionStatusFulfilled
+	s.voucherService.On("Void", mock.Anything, redemption.ID).Return(nil)
+
+	err := s.service.UpdateStatus(context.Background(), redemption.ID.String(), &domain.UpdateRedemptionRequest{
+		Status: string(domain.RedemptionStatusCancelled),
+	})
+
+	s.Require().Error(err)
+	s.Equal("INVALID_STATUS_TRANSITION", err.(domain.BusinessLogicError).Code)
+	s.transactionService.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+	s.redemptionRepo.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+	s.redemptionRepo.AssertNotCalled(s.T(), "RecordStatusChange", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestUpdateStatus_CancelWithoutTransaction() {
+	redemption := s.placed()
+	redemption.TransactionID = nil
+	s.voucherService.On("Void", mock.Anything, redemption.ID).Return(nil)
+
+	err := s.service.UpdateStatus(context.Background(), redemption.ID.String(), &domain.UpdateRedemptionRequest{
+		Status: string(domain.RedemptionStatusCancelled),
+	})
+
+	s.Require().Error(err)
+	s.Equal("REDEMPTION_NOT_REFUNDABLE", err.(domain.BusinessLogicError).Code)
+	s.rewardsRepo.AssertNotCalled(s.T(), "ReleaseStock", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestUpdateStatus_UnknownRedemption() {
+	id := uuid.New()
+	s.redemptionRepo.On("LockByID", mock.Anything, id).Return(nil, nil)
+
+	err := s.service.UpdateStatus(context.Background(), id.String(), &domain.UpdateRedemptionRequest{
+		Status: string(domain.RedemptionStatusApproved),
+	})
+
+	s.Require().Error(err)
+	s.True(domain.IsResourceNotFoundError(err))
+}
+
+func (s *RedemptionServiceTestSuite) TestGetStatusHistory_UnknownRedemption() {
+	id := uuid.New()
+	s.redemptionRepo.On("GetByID", mock.Anything, id).Return(nil, nil)
+
+	_, err := s.service.GetStatusHistory(context.Background(), id.String())
+
+	s.Require().Error(err)
+	s.True(domain.IsResourceNotFoundError(err))
+	s.redemptionRepo.AssertNotCalled(s.T(), "GetStatusHistory", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_EmptyCodePool() {
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, nil, nil)
+	redemption := s.redemption()
+	s.redemptionRepo.On("Create", mock.Anything, redemption).Return([]*domain.Redemption{redemption}, nil)
+	s.redemptionRepo.On("RecordStatusChange", mock.Anything, mock.Anything).Return(nil)
+	s.transactionService.On("Create", mock.Anything, mock.Anything).
+		Return(&domain.Transaction{TransactionID: uuid.New()}, nil)
+	s.voucherService.On("Issue", mock.Anything, redemption, s.reward).
+		Return(nil, domain.NewBusinessLogicError("REWARD_OUT_OF_STOCK", "no voucher codes left for this reward"))
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.Require().Error(err)
+	s.Equal("REWARD_OUT_OF_STOCK", err.(domain.BusinessLogicError).Code)
+	s.eventLogger.AssertNotCalled(s.T(), "SaveRedemptionEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_PointsSpentMeanwhile() {
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, nil, nil)
+	redemption := s.redemption()
+	s.redemptionRepo.On("Create", mock.Anything, redemption).Return([]*domain.Redemption{redemption}, nil)
+	s.redemptionRepo.On("RecordStatusChange", mock.Anything, mock.Anything).Return(nil).Maybe()
+	// The balance read before redeeming covered it, the locked check does not
+	s.transactionService.On("Create", mock.Anything, mock.Anything).
+		Return(nil, domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points balance"))
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.Require().Error(err)
+	s.Equal("INSUFFICIENT_POINTS", err.(domain.BusinessLogicError).Code)
+	s.voucherService.AssertNotCalled(s.T(), "Issue", mock.Anything, mock.Anything, mock.Anything)
+	s.eventLogger.AssertNotCalled(s.T(), "SaveRedemptionEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// cartReward is a second reward of the suite's program.
+func (s *RedemptionServiceTestSuite) cartReward() *domain.Reward {
+	reward := &domain.Reward{
+		ID:             uuid.New(),
+		ProgramID:      s.reward.ProgramID,
+		Name:           "Free muffin",
+		PointsRequired: 50,
+		IsActive:       true,
+	}
+	s.rewardsRepo.On("GetByID", mock.Anything, reward.ID).Return(reward, nil)
+	return reward
+}
+
+// cartRedeemed lets the redemptions of a cart, its transaction, vouchers and
+// events be created.
+func (s *RedemptionServiceTestSuite) cartRedeemed() {
+	s.redemptionRepo.On("Create", mock.Anything, mock.Anything).Return(nil, nil)
+	s.transactionService.On("Create", mock.Anything, mock.Anything).
+		Return(&domain.Transaction{TransactionID: uuid.New()}, nil)
+	s.redemptionRepo.On("RecordStatusChange", mock.Anything, mock.Anything).Return(nil)
+	s.voucherService.On("Issue", mock.Anything, mock.Anything, mock.Anything).
+		Return(&domain.Voucher{Status: domain.VoucherIssued}, nil)
+	s.eventLogger.On("SaveRedemptionEvents", mock.Anything, domain.RewardRedeemed, mock.Anything, mock.Anything).Return(nil)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreateCart_SingleDebit() {
+	muffin := s.cartReward()
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 2).Return(true, nil, nil)
+	s.rewardsRepo.On("ReserveStock", mock.Anything, muffin.ID, 1).Return(true, nil, nil)
+	s.cartRedeemed()
+
+	group, err := s.service.CreateCart(context.Background(), &domain.CreateRedemptionCartRequest{
+		MerchantCustomersID: s.customerID,
+		Items: []domain.RedemptionCartItem{
+			{RewardID: s.reward.ID, Quantity: 2},
+			{RewardID: muffin.ID, Quantity: 1},
+		},
+	})
+
+	s.Require().NoError(err)
+	s.Equal(250, group.PointsUsed)
+	s.Require().Len(group.Redemptions, 3)
+	s.Require().NotNil(group.TransactionID)
+	for _, redemption := range group.Redemptions {
+		s.Equal(group.GroupID, *redemption.GroupID)
+		s.Equal(*group.TransactionID, *redemption.TransactionID)
+	}
+	s.transactionService.AssertNumberOfCalls(s.T(), "Create", 1)
+	s.transactionService.AssertCalled(s.T(), "Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+		return req.TransactionType == "redemption" && req.TransactionAmount == 250
+	}))
+	s.redemptionRepo.AssertNumberOfCalls(s.T(), "Create", 3)
+	s.rewardsRepo.AssertExpectations(s.T())
+}
+
+func (s *RedemptionServiceTestSuite) TestCreateCart_MergesDuplicateItems() {
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 3).Return(true, nil, nil)
+	s.cartRedeemed()
+
+	group, err := s.service.CreateCart(context.Background(), &domain.CreateRedemptionCartRequest{
+		MerchantCustomersID: s.customerID,
+		Items: []domain.RedemptionCartItem{
+			{RewardID: s.reward.ID, Quantity: 1},
+			{RewardID: s.reward.ID, Quantity: 2},
+		},
+	})
+
+	s.Require().NoError(err)
+	s.Len(group.Redemptions, 3)
+	s.rewardsRepo.AssertNumberOfCalls(s.T(), "ReserveStock", 1)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreateCart_InsufficientPoints() {
+	muffin := s.cartReward()
+
+	_, err := s.service.CreateCart(context.Background(), &domain.CreateRedemptionCartRequest{
+		MerchantCustomersID: s.customerID,
+		Items: []domain.RedemptionCartItem{
+			{RewardID: s.reward.ID, Quantity: 4},
+			{RewardID: muffin.ID, Quantity: 3},
+		},
+	})
+
+	s.Require().Error(err)
+	s.Equal("INSUFFICIENT_POINTS", err.(domain.BusinessLogicError).Code)
+	s.rewardsRepo.AssertNotCalled(s.T(), "ReserveStock", mock.Anything, mock.Anything, mock.Anything)
+	s.transactionService.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreateCart_OutOfStockRedeemsNothing() {
+	muffin := s.cartReward()
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, nil, nil).Maybe()
+	s.rewardsRepo.On("ReserveStock", mock.Anything, muffin.ID, 2).Return(false, nil, nil)
+
+	_, err := s.service.CreateCart(context.Background(), &domain.CreateRedemptionCartRequest{
+		MerchantCustomersID: s.customerID,
+		Items: []domain.RedemptionCartItem{
+			{RewardID: s.reward.ID, Quantity: 1},
+			{RewardID: muffin.ID, Quantity: 2},
+		},
+	})
+
+	s.Require().Error(err)
+	s.Equal("REWARD_OUT_OF_STOCK", err.(domain.BusinessLogicError).Code)
+	s.transactionService.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+	s.redemptionRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreateCart_LimitCountsQuantity() {
+	s.reward.MaxPerCustomer = intPtr(2)
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 2).Return(true, nil, nil)
+	s.redemptionRepo.On("CountActive", mock.Anything, s.customerID, s.reward.ID).Return(1, nil)
+
+	_, err := s.service.CreateCart(context.Background(), &domain.CreateRedemptionCartRequest{
+		MerchantCustomersID: s.customerID,
+		Items:               []domain.RedemptionCartItem{{RewardID: s.reward.ID, Quantity: 2}},
+	})
+
+	s.Require().Error(err)
+	s.Equal("REDEMPTION_LIMIT_REACHED", err.(domain.BusinessLogicError).Code)
+	s.transactionService.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreateCart_RejectsMixedPrograms() {
+	other := s.cartReward()
+	other.ProgramID = uuid.New()
+
+	_, err := s.service.CreateCart(context.Background(), &domain.CreateRedemptionCartRequest{
+		MerchantCustomersID: s.customerID,
+		Items: []domain.RedemptionCartItem{
+			{RewardID: s.reward.ID, Quantity: 1},
+			{RewardID: other.ID, Quantity: 1},
+		},
+	})
+
+	s.Require().Error(err)
+	s.IsType(domain.ValidationError{}, err)
+	s.rewardsRepo.AssertNotCalled(s.T(), "ReserveStock", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestGetGroup_Unknown() {
+	groupID := uuid.New()
+	s.redemptionRepo.On("GetByGroupID", mock.Anything, groupID).Return([]*domain.Redemption{}, nil)
+
+	_, err := s.service.GetGroup(context.Background(), groupID.String())
+
+	s.Require().Error(err)
+	s.IsType(domain.ResourceNotFoundError{}, err)
+}
+
+// pointsAndCash lets the suite's reward be paid with at least 40 points and
+// 0.05 for every point short of its 100.
+func (s *RedemptionServiceTestSuite) pointsAndCash() {
+	minPoints, cashPerPoint := 40, 0.05
+	s.reward.MinPoints = &minPoints
+	s.reward.CashPerPoint = &cashPerPoint
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_SplitsPointsAndCash() {
+	s.pointsAndCash()
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, nil, nil)
+	redemption := s.redemption()
+	redemption.PointsUsed = 60
+	s.redeemed(redemption)
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.NoError(err)
+	s.Equal(60, redemption.PointsUsed)
+	s.Equal(2.0, redemption.CashAmount)
+	s.transactionService.AssertCalled(s.T(), "Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+		return req.TransactionType == "redemption" && req.TransactionAmount == 60 && req.CashAmount == 2.0
+	}))
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_PointsOnlyIgnoresRequestedPoints() {
+	s.rewardsRepo.On("ReserveStock", mock.Anything, s.reward.ID, 1).Return(true, nil, nil)
+	redemption := s.redemption()
+	redemption.PointsUsed = 60
+	s.redeemed(redemption)
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.NoError(err)
+	s.Equal(100, redemption.PointsUsed)
+	s.Zero(redemption.CashAmount)
+}
+
+func (s *RedemptionServiceTestSuite) TestCreate_PointsBelowMinimum() {
+	s.pointsAndCash()
+	redemption := s.redemption()
+	redemption.PointsUsed = 30
+
+	err := s.service.Create(context.Background(), redemption)
+
+	s.Require().Error(err)
+	s.IsType(domain.ValidationError{}, err)
+	s.rewardsRepo.AssertNotCalled(s.T(), "ReserveStock", mock.Anything, mock.Anything, mock.Anything)
+	s.transactionService.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *RedemptionServiceTestSuite) TestUpdateStatus_CancelRefundsCash() {
+	redemption := s.placed()
+	redemption.PointsUsed = 60
+	redemption.CashAmount = 2.0
+	s.voucherService.On("Void", mock.Anything, redemption.ID).Return(nil)
+	s.transactionService.On("Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+		return req.TransactionType == "refund" && req.TransactionAmount == 60 && req.CashAmount == 2.0
+	})).Return(&domain.Transaction{TransactionID: uuid.New()}, nil)
+	s.rewardsRepo.On("ReleaseStock", mock.Anything, s.reward.ID, 1).Return(nil)
+	s.updated(redemption, domain.RedemptionStatusPending)
+
+	err := s.service.UpdateStatus(context.Background(), redemption.ID.String(), &domain.UpdateRedemptionRequest{
+		Status: string(domain.RedemptionStatusCancelled),
+	})
+
+	s.NoError(err)
+	s.transactionService.AssertExpectations(s.T())
+}
@@ -34,15 +34,40 @@ func (s *RewardsService) Create(ctx context.Context, req *domain.CreateRewardReq
 		return nil, domain.NewValidationError("points_required", "points required must be greater than 0")
 	}
 
+	if err := validateRewardStock(req.Quantity, req.AvailableQuantity, req.MaxPerCustomer, req.LowStockThreshold); err != nil {
+		return nil, err
+	}
+	if req.VoucherValidityDays != nil && *req.VoucherValidityDays <= 0 {
+		return nil, domain.NewValidationError("voucher_validity_days", "voucher validity days must be greater than 0")
+	}
+	if err := validateRewardCash(req.PointsRequired, req.MinPoints, req.CashPerPoint); err != nil {
+		return nil, err
+	}
+
 	reward := &domain.Reward{
-		Name:           req.Name,
-		ProgramID:      req.ProgramID,
-		Description:    req.Description,
-		PointsRequired: req.PointsRequired,
-		IsActive:       req.IsActive,
-		Quantity:       req.Quantity,
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
+		Name:                req.Name,
+		ProgramID:           req.ProgramID,
+		Description:         req.Description,
+		PointsRequired:      req.PointsRequired,
+		IsActive:            req.IsActive,
+		Quantity:            req.Quantity,
+		AvailableQuantity:   req.AvailableQuantity,
+		MaxPerCustomer:      req.MaxPerCustomer,
+		LowStockThreshold:   req.LowStockThreshold,
+		VoucherSource:       req.VoucherSource,
+		VoucherValidityDays: req.VoucherValidityDays,
+		MinPoints:           req.MinPoints,
+		CashPerPoint:        req.CashPerPoint,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	}
+	if reward.VoucherSource == "" {
+		reward.VoucherSource = domain.VoucherSourceGenerated
+	}
+	// A stocked reward starts with all of its stock available
+	if reward.AvailableQuantity == nil && reward.Quantity > 0 {
+		quantity := reward.Quantity
+		reward.AvailableQuantity = &quantity
 	}
 
 	result, err := s.rewardsRepo.Create(ctx, reward)
@@ -113,8 +138,55 @@ func (s *RewardsService) Update(ctx context.Context, id string, req *domain.Upda
 		reward.IsActive = *req.IsActive
 	}
 	if req.Quantity != nil {
+		// Restocking a tracked reward adds the difference to what is left
+		if reward.AvailableQuantity != nil && req.AvailableQuantity == nil {
+			available := max(*reward.AvailableQuantity+*req.Quantity-reward.Quantity, 0)
+			reward.AvailableQuantity = &available
+		}
 		reward.Quantity = *req.Quantity
 	}
+	if req.AvailableQuantity != nil {
+		reward.AvailableQuantity = req.AvailableQuantity
+	}
+	if req.MaxPerCustomer != nil {
+		// 0 lifts the limit
+		reward.MaxPerCustomer = req.MaxPerCustomer
+		if *req.MaxPerCustomer == 0 {
+			reward.MaxPerCustomer = nil
+		}
+	}
+	if req.LowStockThreshold != nil {
+		reward.LowStockThreshold = req.LowStockThreshold
+	}
+	if req.VoucherSource != "" {
+		reward.VoucherSource = req.VoucherSource
+	}
+	if req.VoucherValidityDays != nil {
+		// 0 makes vouchers last until they are used
+		reward.VoucherValidityDays = req.VoucherValidityDays
+		if *req.VoucherValidityDays == 0 {
+			reward.VoucherValidityDays = nil
+		} else if *req.VoucherValidityDays < 0 {
+			return nil, domain.NewValidationError("voucher_validity_days", "voucher validity days can not be negative")
+		}
+	}
+	if req.MinPoints != nil {
+		// 0 makes the reward points only again
+		reward.MinPoints = req.MinPoints
+		if *req.MinPoints == 0 {
+			reward.MinPoints = nil
+			reward.CashPerPoint = nil
+		}
+	}
+	if req.CashPerPoint != nil && reward.MinPoints != nil {
+		reward.CashPerPoint = req.CashPerPoint
+	}
+	if err := validateRewardStock(reward.Quantity, reward.AvailableQuantity, reward.MaxPerCustomer, reward.LowStockThreshold); err != nil {
+		return nil, err
+	}
+	if err := validateRewardCash(reward.PointsRequired, reward.MinPoints, reward.CashPerPoint); err != nil {
+		return nil, err
+	}
 	reward.UpdatedAt = time.Now()
 
 	result, err := s.rewardsRepo.Update(ctx, reward)
@@ -151,6 +223,40 @@ func (s *RewardsService) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+func validateRewardStock(quantity int, available, maxPerCustomer, lowStockThreshold *int) error {
+	if quantity < 0 {
+		return domain.NewValidationError("quantity", "quantity can not be negative")
+	}
+	if available != nil && *available < 0 {
+		return domain.NewValidationError("available_quantity", "available quantity can not be negative")
+	}
+	if maxPerCustomer != nil && *maxPerCustomer <= 0 {
+		return domain.NewValidationError("max_per_customer", "max per customer must be greater than 0")
+	}
+	if lowStockThreshold != nil && *lowStockThreshold < 0 {
+		return domain.NewValidationError("low_stock_threshold", "low stock threshold can not be negative")
+	}
+	return nil
+}
+
+// validateRewardCash checks the points and cash pricing of a reward, which
+// needs both a minimum of points and the cash charged per point below it.
+func validateRewardCash(pointsRequired int, minPoints *int, cashPerPoint *float64) error {
+	if minPoints == nil && cashPerPoint == nil {
+		return nil
+	}
+	if minPoints == nil || cashPerPoint == nil {
+		return domain.NewValidationError("min_points", "min points and cash per point must be set together")
+	}
+	if *minPoints <= 0 || *minPoints > pointsRequired {
+		return domain.NewValidationError("min_points", "min points must be greater than 0 and at most points required")
+	}
+	if *cashPerPoint <= 0 {
+		return domain.NewValidationError("cash_per_point", "cash per point must be greater than 0")
+	}
+	return nil
+}
+
 func (s *RewardsService) UpdateAvailability(ctx context.Context, id string, available bool) (*domain.Reward, error) {
 	reward, err := s.rewardsRepo.GetByID(ctx, uuid.MustParse(id))
 	if err != nil {
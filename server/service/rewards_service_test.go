@@ -184,6 +184,81 @@ func TestRewardsService_Update_InvalidPoints(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestRewardsService_Create_StocksAvailableQuantity(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(postgres.MockRewardsRepository)
+	service := NewRewardsService(mockRepo)
+
+	req := &domain.CreateRewardRequest{
+		ProgramID:      uuid.New(),
+		Name:           "Test Reward",
+		Description:    "Test Description",
+		PointsRequired: 100,
+		Quantity:       50,
+		IsActive:       true,
+	}
+
+	mockRepo.On("Create", ctx, mock.MatchedBy(func(r *domain.Reward) bool {
+		return r.Quantity == 50 && r.AvailableQuantity != nil && *r.AvailableQuantity == 50
+	})).Return(&domain.Reward{ID: uuid.New()}, nil)
+
+	_, err := service.Create(ctx, req)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRewardsService_Create_PointsAndCashNeedsMinPointsWithinPrice(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(postgres.MockRewardsRepository)
+	service := NewRewardsService(mockRepo)
+
+	minPoints, cashPerPoint := 150, 0.05
+	req := &domain.CreateRewardRequest{
+		ProgramID:      uuid.New(),
+		Name:           "Test Reward",
+		Description:    "Test Description",
+		PointsRequired: 100,
+		MinPoints:      &minPoints,
+		CashPerPoint:   &cashPerPoint,
+		IsActive:       true,
+	}
+
+	reward, err := service.Create(ctx, req)
+
+	assert.Error(t, err)
+	assert.Nil(t, reward)
+	assert.Equal(t, "validation error: min_points: min points must be greater than 0 and at most points required", err.Error())
+	mockRepo.AssertNotCalled(t, "Create")
+}
+
+func TestRewardsService_Update_RestockAddsToAvailable(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(postgres.MockRewardsRepository)
+	service := NewRewardsService(mockRepo)
+
+	rewardID := uuid.New()
+	available := 3
+	existingReward := &domain.Reward{
+		ID:                rewardID,
+		Name:              "Test Reward",
+		PointsRequired:    100,
+		Quantity:          50,
+		AvailableQuantity: &available,
+	}
+
+	mockRepo.On("GetByID", ctx, rewardID).Return(existingReward, nil)
+	mockRepo.On("Update", ctx, mock.MatchedBy(func(r *domain.Reward) bool {
+		return r.Quantity == 70 && *r.AvailableQuantity == 23
+	})).Return(existingReward, nil)
+
+	quantity := 70
+	_, err := service.Update(ctx, rewardID.String(), &domain.UpdateRewardRequest{Quantity: &quantity})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
 func TestRewardsService_Delete_Success(t *testing.T) {
 	ctx := context.Background()
 	mockRepo := new(postgres.MockRewardsRepository)
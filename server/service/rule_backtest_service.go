@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// backtestBatchSize is how many transactions a backtest reads per query
+	backtestBatchSize = 1000
+	// maxConcurrentBacktests bounds the load backtests put on the read replica,
+	// later backtests stay queued until one finishes
+	maxConcurrentBacktests = 2
+)
+
+// RuleBacktestService replays a program's past transactions against a draft
+// rule set. Backtests run in the background of the instance that accepted
+// them; one interrupted by a restart is left queued or running and has to be
+// submitted again.
+//
+// Customer facts are rebuilt as of each transaction, and per customer caps
+// count what the draft rules awarded during the replay only, so a cap period
+// that started before the backtest range starts empty.
+type RuleBacktestService struct {
+	backtestRepo domain.RuleBacktestRepository
+	programRepo  domain.ProgramRepository
+	merchantRepo domain.MerchantRepository
+	programRules *ProgramRulesService
+	slots        chan struct{}
+	logger       zerolog.Logger
+}
+
+func NewRuleBacktestService(
+	backtestRepo domain.RuleBacktestRepository,
+	programRepo domain.ProgramRepository,
+	merchantRepo domain.MerchantRepository,
+	programRules *ProgramRulesService,
+) *RuleBacktestService {
+	return &RuleBacktestService{
+		backtestRepo: backtestRepo,
+		programRepo:  programRepo,
+		merchantRepo: merchantRepo,
+		programRules: programRules,
+		slots:        make(chan struct{}, maxConcurrentBacktests),
+		logger:       logging.GetLogger(),
+	}
+}
+
+// Create queues a backtest and starts it in the background.
+func (s *RuleBacktestService) Create(ctx context.Context, req *domain.CreateRuleBacktestRequest) (*domain.RuleBacktest, error) {
+	if req.RuleSetID != nil && len(req.Rules) > 0 {
+		s.logger.Error().
+			Msg("Backtest has both a rule set and draft rules")
+		return nil, domain.NewValidationError("rules", "rules cannot be combined with rule_set_id")
+	}
+	if !req.To.After(req.From) {
+		s.logger.Error().
+			Time("from", req.From).
+			Time("to", req.To).
+			Msg("Backtest range is empty")
+		return nil, domain.NewValidationError("to", "to must be after from")
+	}
+
+	program, err := s.programRepo.GetByID(ctx, req.ProgramID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting program")
+		return nil, domain.NewSystemError("RuleBacktestService.Create", err, "failed to get program")
+	}
+	if program == nil {
+		s.logger.Error().
+			Msg("Program not found")
+		return nil, domain.NewResourceNotFoundError("program", req.ProgramID.String(), "program not found")
+	}
+
+	merchant, err := s.merchantRepo.GetByID(ctx, program.MerchantID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting merchant")
+		return nil, err
+	}
+
+	var rules []*domain.ProgramRule
+	if req.RuleSetID != nil {
+		// The rules are stored with the backtest, later edits of a draft do
+		// not change its result
+		ruleSet, err := s.programRules.getRuleSet(ctx, req.ProgramID, *req.RuleSetID)
+		if err != nil {
+			return nil, err
+		}
+		rules = ruleSet.Rules
+	} else {
+		rules = make([]*domain.ProgramRule, 0, len(req.Rules))
+		for i := range req.Rules {
+			rule, err := s.programRules.draftRule(req.ProgramID, &req.Rules[i])
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	backtest := &domain.RuleBacktest{
+		ProgramID: req.ProgramID,
+		RuleSetID: req.RuleSetID,
+		Status:    domain.BacktestQueued,
+		From:      req.From,
+		To:        req.To,
+		Rules:     rules,
+	}
+	if err := s.backtestRepo.Create(ctx, backtest); err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error creating backtest")
+		return nil, domain.NewSystemError("RuleBacktestService.Create", err, "failed to create backtest")
+	}
+
+	// The job keeps updating its own copy
+	queued := *backtest
+	go s.run(backtest, merchant.Location())
+
+	return &queued, nil
+}
+
+func (s *RuleBacktestService) GetByID(ctx context.Context, id string) (*domain.RuleBacktest, error) {
+	backtestID, err := uuid.Parse(id)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid backtest ID")
+		return nil, domain.NewValidationError("id", "invalid backtest ID")
+	}
+
+	backtest, err := s.backtestRepo.GetByID(ctx, backtestID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting backtest")
+		return nil, domain.NewSystemError("RuleBacktestService.GetByID", err, "failed to get backtest")
+	}
+	if backtest == nil {
+		s.logger.Error().
+			Msg("Backtest not found")
+		return nil, domain.NewResourceNotFoundError("backtest", id, "backtest not found")
+	}
+	return backtest, nil
+}
+
+// GetCustomers returns a page of the per customer results of a backtest.
+func (s *RuleBacktestService) GetCustomers(ctx context.Context, id string, page, limit int) ([]*domain.RuleBacktestCustomer, int64, error) {
+	backtest, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	customers, total, err := s.backtestRepo.GetCustomers(ctx, backtest.ID, (page-1)*limit, limit)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting backtest customers")
+		return nil, 0, domain.NewSystemError("RuleBacktestService.GetCustomers", err, "failed to get backtest customers")
+	}
+	return customers, total, nil
+}
+
+// run waits for a free slot, replays the backtest and stores its results.
+func (s *RuleBacktestService) run(backtest *domain.RuleBacktest, location *time.Location) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	ctx := context.Background()
+	defer func() {
+		if r := recover(); r != nil {
+			s.fail(ctx, backtest, fmt.Errorf("backtest panicked: %v", r))
+		}
+	}()
+
+	if err := s.backtestRepo.MarkRunning(ctx, backtest.ID); err != nil {
+		s.fail(ctx, backtest, err)
+		return
+	}
+	backtest.Status = domain.BacktestRunning
+
+	customers, err := s.replay(ctx, backtest, location)
+	if err != nil {
+		s.fail(ctx, backtest, err)
+		return
+	}
+
+	if err := s.backtestRepo.Complete(ctx, backtest, customers); err != nil {
+		s.fail(ctx, backtest, err)
+		return
+	}
+
+	s.logger.Info().
+		Str("backtest_id", backtest.ID.String()).
+		Int64("transactions_processed", backtest.TransactionsProcessed).
+		Int64("total_points", backtest.TotalPoints).
+		Int64("actual_points", backtest.ActualPoints).
+		Msg("Backtest completed")
+}
+
+func (s *RuleBacktestService) fail(ctx context.Context, backtest *domain.RuleBacktest, err error) {
+	s.logger.Error().
+		Err(err).
+		Str("backtest_id", backtest.ID.String()).
+		Msg("Backtest failed")
+	backtest.Status = domain.BacktestFailed
+	backtest.Error = err.Error()
+	if err := s.backtestRepo.Fail(ctx, backtest.ID, err.Error()); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("backtest_id", backtest.ID.String()).
+			Msg("Error marking backtest failed")
+	}
+}
+
+// backtestCustomer is what a backtest keeps per customer while replaying.
+type backtestCustomer struct {
+	result    *domain.RuleBacktestCustomer
+	completed int // completed transactions so far, including those before the range
+}
+
+// capPeriodKey identifies what one rule awarded one customer in one cap period.
+type capPeriodKey struct {
+	ruleID     uuid.UUID
+	customerID uuid.UUID
+	from       int64 // start of the period, in Unix seconds
+}
+
+// replay pages through the transactions in the backtest range in date order
+// and totals what the draft rules award them.
+func (s *RuleBacktestService) replay(ctx context.Context, backtest *domain.RuleBacktest, location *time.Location) ([]*domain.RuleBacktestCustomer, error) {
+	customers := make(map[uuid.UUID]*backtestCustomer)
+	var results []*domain.RuleBacktestCustomer
+	periodAwards := make(map[capPeriodKey]int)
+	rules := compileRules(backtest.Rules)
+
+	afterDate, afterID := backtest.From, uuid.Nil
+	for {
+		batch, err := s.backtestRepo.GetTransactions(ctx, backtest.ProgramID, backtest.From, backtest.To, afterDate, afterID, backtestBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		// Seed the transaction counts of the customers seen for the first time
+		var newCustomers []uuid.UUID
+		for _, tx := range batch {
+			if _, ok := customers[tx.MerchantCustomersID]; !ok {
+				customers[tx.MerchantCustomersID] = nil
+				newCustomers = append(newCustomers, tx.MerchantCustomersID)
+			}
+		}
+		counts, err := s.backtestRepo.CountCompletedBefore(ctx, backtest.ProgramID, newCustomers, backtest.From)
+		if err != nil {
+			return nil, err
+		}
+		for _, customerID := range newCustomers {
+			result := &domain.RuleBacktestCustomer{BacktestID: backtest.ID, MerchantCustomersID: customerID}
+			customers[customerID] = &backtestCustomer{result: result, completed: counts[customerID]}
+			results = append(results, result)
+		}
+
+		for _, tx := range batch {
+			s.replayTransaction(backtest, rules, tx, customers[tx.MerchantCustomersID], periodAwards, location)
+		}
+
+		last := batch[len(batch)-1]
+		afterDate, afterID = last.TransactionDate, last.TransactionID
+		backtest.TransactionsProcessed += int64(len(batch))
+
+		// Progress is only informational, the totals are written on completion
+		if err := s.backtestRepo.UpdateProgress(ctx, backtest.ID, backtest.TransactionsProcessed); err != nil {
+			s.logger.Warn().
+				Err(err).
+				Str("backtest_id", backtest.ID.String()).
+				Msg("Failed to update backtest progress")
+		}
+
+		if len(batch) < backtestBatchSize {
+			break
+		}
+	}
+
+	backtest.CustomersCount = int64(len(results))
+	backtest.PointsDelta = backtest.TotalPoints - backtest.ActualPoints
+	for _, result := range results {
+		result.PointsDelta = result.Points - result.ActualPoints
+	}
+	return results, nil
+}
+
+// replayTransaction evaluates the draft rules against one past transaction
+// the way TransactionService.Create would have. Refunds and redemptions only
+// count towards the customer's transaction count.
+func (s *RuleBacktestService) replayTransaction(
+	backtest *domain.RuleBacktest,
+	rules []*compiledRule,
+	tx *domain.BacktestTransaction,
+	customer *backtestCustomer,
+	periodAwards map[capPeriodKey]int,
+	location *time.Location,
+) {
+	transaction := &tx.Transaction
+	defer func() {
+		if transaction.Status == "completed" {
+			customer.completed++
+		}
+	}()
+
+	switch transaction.TransactionType {
+	case "refund", "redemption":
+		return
+	}
+
+	customerContext := &domain.CustomerContext{
+		MerchantCustomersID: transaction.MerchantCustomersID,
+		ProgramID:           transaction.ProgramID,
+		TransactionCount:    customer.completed,
+		MemberSince:         tx.MemberSince,
+		DateOfBirth:         tx.DateOfBirth,
+	}
+
+	awarded := make(map[uuid.UUID]int)
+	for _, rule := range rules {
+		if rule.MaxPointsPerCustomerPerPeriod != nil {
+			awarded[rule.ID] = periodAwards[capPeriodKeyFor(rule.ProgramRule, transaction, location)]
+		}
+	}
+
+	rc := buildRuleContext(transaction, customerContext, awarded, location)
+	points := 0
+	for _, award := range applyRules(rules, rc) {
+		// Whole points per rule, the same way transactions are credited
+		rulePoints := int(math.Floor(award.points))
+		points += rulePoints
+		if award.rule.MaxPointsPerCustomerPerPeriod != nil {
+			periodAwards[capPeriodKeyFor(award.rule, transaction, location)] += rulePoints
+		}
+	}
+
+	customer.result.TransactionCount++
+	customer.result.Points += int64(points)
+	customer.result.ActualPoints += int64(tx.ActualPoints)
+	backtest.TotalPoints += int64(points)
+	backtest.ActualPoints += int64(tx.ActualPoints)
+}
+
+func capPeriodKeyFor(rule *domain.ProgramRule, transaction *domain.Transaction, location *time.Location) capPeriodKey {
+	from, _ := capPeriodBounds(rule.CapPeriod, transaction.TransactionDate, location)
+	return capPeriodKey{ruleID: rule.ID, customerID: transaction.MerchantCustomersID, from: from.Unix()}
+}
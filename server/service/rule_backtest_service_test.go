@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockRuleBacktestRepository struct {
+	mock.Mock
+}
+
+func (m *mockRuleBacktestRepository) Create(ctx context.Context, backtest *domain.RuleBacktest) error {
+	args := m.Called(ctx, backtest)
+	return args.Error(0)
+}
+
+func (m *mockRuleBacktestRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.RuleBacktest, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RuleBacktest), args.Error(1)
+}
+
+func (m *mockRuleBacktestRepository) MarkRunning(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockRuleBacktestRepository) UpdateProgress(ctx context.Context, id uuid.UUID, transactionsProcessed int64) error {
+	args := m.Called(ctx, id, transactionsProcessed)
+	return args.Error(0)
+}
+
+func (m *mockRuleBacktestRepository) Complete(ctx context.Context, backtest *domain.RuleBacktest, customers []*domain.RuleBacktestCustomer) error {
+	args := m.Called(ctx, backtest, customers)
+	return args.Error(0)
+}
+
+func (m *mockRuleBacktestRepository) Fail(ctx context.Context, id uuid.UUID, reason string) error {
+	args := m.Called(ctx, id, reason)
+	return args.Error(0)
+}
+
+func (m *mockRuleBacktestRepository) GetCustomers(ctx context.Context, id uuid.UUID, offset, limit int) ([]*domain.RuleBacktestCustomer, int64, error) {
+	args := m.Called(ctx, id, offset, limit)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.RuleBacktestCustomer), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockRuleBacktestRepository) GetTransactions(ctx context.Context, programID uuid.UUID, from, to, afterDate time.Time, afterID uuid.UUID, limit int) ([]*domain.BacktestTransaction, error) {
+	args := m.Called(ctx, programID, from, to, afterDate, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.BacktestTransaction), args.Error(1)
+}
+
+func (m *mockRuleBacktestRepository) CountCompletedBefore(ctx context.Context, programID uuid.UUID, customerIDs []uuid.UUID, before time.Time) (map[uuid.UUID]int, error) {
+	args := m.Called(ctx, programID, customerIDs, before)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uuid.UUID]int), args.Error(1)
+}
+
+func TestRuleBacktestService_Create(t *testing.T) {
+	programID := uuid.New()
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	newRequest := func() *domain.CreateRuleBacktestRequest {
+		return &domain.CreateRuleBacktestRequest{
+			ProgramID: programID,
+			From:      from,
+			To:        from.AddDate(0, 1, 0),
+			Rules: []domain.DraftProgramRule{{
+				RuleName:       "Base points",
+				ConditionType:  "program_rule_transaction_amount",
+				ConditionValue: "0",
+				Multiplier:     1,
+				EffectiveFrom:  from,
+			}},
+		}
+	}
+
+	t.Run("empty range", func(t *testing.T) {
+		backtestRepo := new(mockRuleBacktestRepository)
+		svc := NewRuleBacktestService(backtestRepo, nil, nil, NewProgramRulesService(nil, nil, nil, nil, nil, nil))
+		req := newRequest()
+		req.To = req.From
+
+		backtest, err := svc.Create(context.Background(), req)
+
+		assert.Nil(t, backtest)
+		assert.True(t, domain.IsValidationError(err))
+		backtestRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid draft rule", func(t *testing.T) {
+		backtestRepo := new(mockRuleBacktestRepository)
+		programRepo := new(mockProgramRepository)
+		merchantRepo := new(mockMerchantRepository)
+		merchantID := uuid.New()
+		programRepo.On("GetByID", mock.Anything, programID).Return(&domain.Program{ID: programID, MerchantID: merchantID}, nil)
+		merchantRepo.On("GetByID", mock.Anything, merchantID).Return(&domain.Merchant{ID: merchantID}, nil)
+		svc := NewRuleBacktestService(backtestRepo, programRepo, merchantRepo, NewProgramRulesService(nil, nil, nil, nil, nil, nil))
+		req := newRequest()
+		req.Rules[0].ConditionValue = ">> 5"
+
+		backtest, err := svc.Create(context.Background(), req)
+
+		assert.Nil(t, backtest)
+		assert.True(t, domain.IsValidationError(err))
+		assert.Equal(t, "condition_value", err.(domain.ValidationError).Field)
+		backtestRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("program not found", func(t *testing.T) {
+		programRepo := new(mockProgramRepository)
+		programRepo.On("GetByID", mock.Anything, programID).Return(nil, nil)
+		svc := NewRuleBacktestService(new(mockRuleBacktestRepository), programRepo, nil, NewProgramRulesService(nil, nil, nil, nil, nil, nil))
+
+		backtest, err := svc.Create(context.Background(), newRequest())
+
+		assert.Nil(t, backtest)
+		assert.True(t, domain.IsResourceNotFoundError(err))
+	})
+}
+
+func TestRuleBacktestService_Run(t *testing.T) {
+	programID := uuid.New()
+	customerA := uuid.New()
+	customerB := uuid.New()
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	day := from.AddDate(0, 0, 9)
+
+	dailyCap := 30
+	rules := []*domain.ProgramRule{
+		{ID: uuid.New(), RuleName: "Base points", ConditionType: "program_rule_transaction_amount", ConditionValue: "0",
+			Multiplier: 1, Stacking: domain.RuleStackable, EffectiveFrom: from},
+		{ID: uuid.New(), RuleName: "Regulars", ConditionType: "program_rule_transaction_count", ConditionValue: ">= 3",
+			Multiplier: 1, PointsAwarded: 10, Stacking: domain.RuleStackable, EffectiveFrom: from},
+		{ID: uuid.New(), RuleName: "Daily bonus", ConditionType: "program_rule_transaction_amount", ConditionValue: "0",
+			Multiplier: 1, PointsAwarded: 20, Stacking: domain.RuleStackable, EffectiveFrom: from,
+			MaxPointsPerCustomerPerPeriod: &dailyCap, CapPeriod: domain.CapPeriodDay},
+	}
+
+	newTransaction := func(customerID uuid.UUID, at time.Time, transactionType string, amount float64, actual int) *domain.BacktestTransaction {
+		return &domain.BacktestTransaction{
+			Transaction: domain.Transaction{
+				TransactionID:       uuid.New(),
+				MerchantCustomersID: customerID,
+				ProgramID:           programID,
+				TransactionType:     transactionType,
+				TransactionAmount:   amount,
+				TransactionDate:     at,
+				Status:              "completed",
+			},
+			MemberSince:  from.AddDate(-1, 0, 0),
+			ActualPoints: actual,
+		}
+	}
+	transactions := []*domain.BacktestTransaction{
+		newTransaction(customerA, day.Add(1*time.Hour), "purchase", 100, 100),
+		newTransaction(customerA, day.Add(2*time.Hour), "refund", 40, 0),
+		newTransaction(customerB, day.Add(3*time.Hour), "purchase", 50, 60),
+		newTransaction(customerA, day.Add(4*time.Hour), "purchase", 10, 15),
+	}
+
+	backtestRepo := new(mockRuleBacktestRepository)
+	svc := NewRuleBacktestService(backtestRepo, nil, nil, nil)
+	backtest := &domain.RuleBacktest{ID: uuid.New(), ProgramID: programID, Status: domain.BacktestQueued, From: from, To: to, Rules: rules}
+
+	backtestRepo.On("MarkRunning", mock.Anything, backtest.ID).Return(nil)
+	backtestRepo.On("GetTransactions", mock.Anything, programID, from, to, from, uuid.Nil, backtestBatchSize).Return(transactions, nil)
+	backtestRepo.On("CountCompletedBefore", mock.Anything, programID, []uuid.UUID{customerA, customerB}, from).
+		Return(map[uuid.UUID]int{customerA: 2}, nil)
+	backtestRepo.On("UpdateProgress", mock.Anything, backtest.ID, int64(4)).Return(nil)
+
+	var customers []*domain.RuleBacktestCustomer
+	backtestRepo.On("Complete", mock.Anything, backtest, mock.Anything).
+		Run(func(args mock.Arguments) { customers = args.Get(2).([]*domain.RuleBacktestCustomer) }).
+		Return(nil)
+
+	svc.run(backtest, time.UTC)
+
+	backtestRepo.AssertExpectations(t)
+	backtestRepo.AssertNotCalled(t, "Fail", mock.Anything, mock.Anything, mock.Anything)
+
+	// A: 100 + 10 (3rd completed) + 20, then 10 + 10 + 10 (daily cap reached)
+	// B: 50 + 20
+	assert.Equal(t, int64(4), backtest.TransactionsProcessed)
+	assert.Equal(t, int64(2), backtest.CustomersCount)
+	assert.Equal(t, int64(230), backtest.TotalPoints)
+	assert.Equal(t, int64(175), backtest.ActualPoints)
+	assert.Equal(t, int64(55), backtest.PointsDelta)
+
+	assert.Len(t, customers, 2)
+	assert.Equal(t, domain.RuleBacktestCustomer{BacktestID: backtest.ID, MerchantCustomersID: customerA,
+		TransactionCount: 2, Points: 160, ActualPoints: 115, PointsDelta: 45}, *customers[0])
+	assert.Equal(t, domain.RuleBacktestCustomer{BacktestID: backtest.ID, MerchantCustomersID: customerB,
+		TransactionCount: 1, Points: 70, ActualPoints: 60, PointsDelta: 10}, *customers[1])
+}
+
+func TestRuleBacktestService_RunFailure(t *testing.T) {
+	backtestRepo := new(mockRuleBacktestRepository)
+	svc := NewRuleBacktestService(backtestRepo, nil, nil, nil)
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	backtest := &domain.RuleBacktest{ID: uuid.New(), ProgramID: uuid.New(), From: from, To: from.AddDate(0, 1, 0)}
+
+	backtestRepo.On("MarkRunning", mock.Anything, backtest.ID).Return(nil)
+	backtestRepo.On("GetTransactions", mock.Anything, backtest.ProgramID, backtest.From, backtest.To, backtest.From, uuid.Nil, backtestBatchSize).
+		Return(nil, domain.NewSystemError("RuleBacktestRepository.GetTransactions", assert.AnError, "failed to query transactions"))
+	backtestRepo.On("Fail", mock.Anything, backtest.ID, mock.AnythingOfType("string")).Return(nil)
+
+	svc.run(backtest, time.UTC)
+
+	assert.Equal(t, domain.BacktestFailed, backtest.Status)
+	backtestRepo.AssertExpectations(t)
+	backtestRepo.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,430 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Rule conditions are small expressions stored in program_rules.condition_value
+// and tested against a single subject picked by the rule's condition type
+// (the transaction amount, the customer's tenure in days, the category...).
+//
+//	> 100, >= 100, < 100, <= 100, == 100, != 100   comparisons
+//	100..500                                       inclusive range
+//	in [dining, travel], not in [fuel]             lists
+//	>= 100 and < 500, dining or travel             combinations, and binds tighter
+//	(a or b) and c                                 grouping
+//
+// A bare value keeps its original meaning: "100" is "> 100" for numeric
+// condition types and "dining" is "== dining" for the others. Date conditions
+// have their own literals, see rule_date_condition.go.
+
+type conditionKind int
+
+const (
+	numericCondition conditionKind = iota
+	stringCondition
+	dateCondition
+)
+
+// conditionKinds lists the condition types that take an expression and the
+// kind of subject each one is tested against.
+var conditionKinds = map[string]conditionKind{
+	"program_rule_tenure":                     numericCondition,
+	"program_rule_transaction_amount":         numericCondition,
+	"program_rule_transaction_count":          numericCondition,
+	"program_rule_transaction_date":           dateCondition,
+	"program_rule_transaction_type":           stringCondition,
+	"program_rule_transaction_category":       stringCondition,
+	"program_rule_transaction_merchant":       stringCondition,
+	"program_rule_transaction_merchant_group": stringCondition,
+}
+
+// conditionOperand is a literal in a condition, or the subject it is tested against.
+type conditionOperand struct {
+	num  float64
+	str  string
+	date dateValue
+
+	// The subject of a date condition
+	at          time.Time // in the merchant's timezone
+	dateOfBirth *time.Time
+	memberSince time.Time
+}
+
+type condition interface {
+	matches(subject conditionOperand) bool
+}
+
+type orCondition []condition
+
+func (c orCondition) matches(subject conditionOperand) bool {
+	for _, term := range c {
+		if term.matches(subject) {
+			return true
+		}
+	}
+	return false
+}
+
+type andCondition []condition
+
+func (c andCondition) matches(subject conditionOperand) bool {
+	for _, term := range c {
+		if !term.matches(subject) {
+			return false
+		}
+	}
+	return true
+}
+
+type compareCondition struct {
+	op      string
+	operand conditionOperand
+	kind    conditionKind
+}
+
+func (c compareCondition) matches(subject conditionOperand) bool {
+	if c.kind == dateCondition {
+		return c.matchesDate(subject)
+	}
+	if c.kind == stringCondition {
+		equal := subject.str == c.operand.str
+		if c.op == "!=" {
+			return !equal
+		}
+		return equal
+	}
+
+	switch c.op {
+	case ">":
+		return subject.num > c.operand.num
+	case ">=":
+		return subject.num >= c.operand.num
+	case "<":
+		return subject.num < c.operand.num
+	case "<=":
+		return subject.num <= c.operand.num
+	case "!=":
+		return subject.num != c.operand.num
+	}
+	return subject.num == c.operand.num
+}
+
+type rangeCondition struct {
+	min, max float64
+}
+
+func (c rangeCondition) matches(subject conditionOperand) bool {
+	return subject.num >= c.min && subject.num <= c.max
+}
+
+type inCondition struct {
+	values []conditionOperand
+	negate bool
+	kind   conditionKind
+}
+
+func (c inCondition) matches(subject conditionOperand) bool {
+	found := false
+	for _, v := range c.values {
+		if (compareCondition{op: "==", operand: v, kind: c.kind}).matches(subject) {
+			found = true
+			break
+		}
+	}
+	return found != c.negate
+}
+
+// parseCondition parses a condition expression for the given condition type.
+func parseCondition(conditionType, expr string) (condition, error) {
+	kind, ok := conditionKinds[conditionType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported condition type %q", conditionType)
+	}
+
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("condition is empty")
+	}
+
+	p := &conditionParser{tokens: tokens, kind: kind}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q", p.peek())
+	}
+	return cond, nil
+}
+
+// tokenizeCondition splits an expression into punctuation, operators,
+// quoted strings and bare words.
+func tokenizeCondition(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.HasPrefix(expr[i:], ".."):
+			tokens = append(tokens, "..")
+			i += 2
+		case strings.ContainsRune("()[],", rune(c)):
+			tokens = append(tokens, string(c))
+			i++
+		case strings.ContainsRune("<>=!", rune(c)):
+			if i+1 < len(expr) && expr[i+1] == '=' {
+				tokens = append(tokens, expr[i:i+2])
+				i += 2
+			} else if c == '!' {
+				return nil, fmt.Errorf("unexpected '!' at position %d", i)
+			} else {
+				tokens = append(tokens, string(c))
+				i++
+			}
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			// Keep the quote so the parser knows this is a literal, not a keyword
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		default:
+			start := i
+			for i < len(expr) && isConditionWordByte(expr[i]) && !strings.HasPrefix(expr[i:], "..") {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected %q at position %d", c, i)
+			}
+			tokens = append(tokens, expr[start:i])
+		}
+	}
+	return tokens, nil
+}
+
+func isConditionWordByte(c byte) bool {
+	return unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || strings.ContainsRune("._-:", rune(c))
+}
+
+type conditionParser struct {
+	tokens []string
+	pos    int
+	kind   conditionKind
+}
+
+func (p *conditionParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *conditionParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *conditionParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *conditionParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		if got == "" {
+			return fmt.Errorf("expected %q at end of condition", tok)
+		}
+		return fmt.Errorf("expected %q, got %q", tok, got)
+	}
+	return nil
+}
+
+func (p *conditionParser) isKeyword(keyword string) bool {
+	return strings.EqualFold(p.peek(), keyword)
+}
+
+func (p *conditionParser) parseOr() (condition, error) {
+	terms := orCondition{}
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !p.isKeyword("or") {
+			break
+		}
+		p.next()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *conditionParser) parseAnd() (condition, error) {
+	terms := andCondition{}
+	for {
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !p.isKeyword("and") {
+			break
+		}
+		p.next()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *conditionParser) parseTerm() (condition, error) {
+	tok := p.peek()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("condition ends unexpectedly")
+	case tok == "(":
+		p.next()
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return cond, nil
+	case p.isKeyword("in"):
+		p.next()
+		return p.parseList(false)
+	case p.isKeyword("not"):
+		p.next()
+		if !p.isKeyword("in") {
+			return nil, fmt.Errorf("expected \"in\" after \"not\"")
+		}
+		p.next()
+		return p.parseList(true)
+	case tok == ">" || tok == ">=" || tok == "<" || tok == "<=":
+		if p.kind == stringCondition {
+			return nil, fmt.Errorf("operator %q needs a numeric condition type", tok)
+		}
+		fallthrough
+	case tok == "==" || tok == "=" || tok == "!=":
+		p.next()
+		operand, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		op := tok
+		if op == "=" {
+			op = "=="
+		}
+		if p.kind == dateCondition && strings.ContainsAny(op, "<>") && !operand.date.ordered() {
+			return nil, fmt.Errorf("operator %q needs a time or a calendar date", op)
+		}
+		return compareCondition{op: op, operand: operand, kind: p.kind}, nil
+	}
+
+	operand, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == ".." {
+		if p.kind == stringCondition {
+			return nil, fmt.Errorf("ranges need a numeric condition type")
+		}
+		p.next()
+		upper, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if p.kind == dateCondition {
+			return newDateRange(operand.date, upper.date)
+		}
+		if upper.num < operand.num {
+			return nil, fmt.Errorf("range %v..%v is empty", operand.num, upper.num)
+		}
+		return rangeCondition{min: operand.num, max: upper.num}, nil
+	}
+
+	// A bare value, see the top of this file
+	if p.kind == numericCondition {
+		return compareCondition{op: ">", operand: operand, kind: p.kind}, nil
+	}
+	return compareCondition{op: "==", operand: operand, kind: p.kind}, nil
+}
+
+func (p *conditionParser) parseList(negate bool) (condition, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	list := inCondition{negate: negate, kind: p.kind}
+	for {
+		operand, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		list.values = append(list.values, operand)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (p *conditionParser) parseOperand() (conditionOperand, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return conditionOperand{}, fmt.Errorf("expected a value at end of condition")
+	case strings.ContainsAny(tok[:1], "()[],.<>=!"):
+		return conditionOperand{}, fmt.Errorf("expected a value, got %q", tok)
+	}
+
+	quoted := tok[0] == '"' || tok[0] == '\''
+	if quoted {
+		tok = tok[1 : len(tok)-1]
+	} else if isConditionKeyword(tok) {
+		return conditionOperand{}, fmt.Errorf("expected a value, got %q", tok)
+	}
+
+	switch p.kind {
+	case stringCondition:
+		return conditionOperand{str: tok}, nil
+	case dateCondition:
+		date, err := parseDateValue(tok)
+		if err != nil {
+			return conditionOperand{}, err
+		}
+		return conditionOperand{date: date}, nil
+	}
+	num, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		return conditionOperand{}, fmt.Errorf("%q is not a number", tok)
+	}
+	return conditionOperand{num: num}, nil
+}
+
+func isConditionKeyword(tok string) bool {
+	switch strings.ToLower(tok) {
+	case "and", "or", "in", "not":
+		return true
+	}
+	return false
+}
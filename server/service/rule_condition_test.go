@@ -0,0 +1,107 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCondition_Numeric(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		matches   []float64
+		misses    []float64
+	}{
+		{"bare value is strict greater than", "100", []float64{100.01, 500}, []float64{100, 50}},
+		{"greater or equal", ">= 100", []float64{100, 101}, []float64{99.99}},
+		{"less than", "<50", []float64{0, 49}, []float64{50}},
+		{"less or equal", "<= 50", []float64{50}, []float64{50.5}},
+		{"equal", "== 3", []float64{3}, []float64{2, 4}},
+		{"single equals sign", "= 3", []float64{3}, []float64{4}},
+		{"not equal", "!= 3", []float64{2, 4}, []float64{3}},
+		{"inclusive range", "100..500", []float64{100, 250, 500}, []float64{99, 501}},
+		{"decimal range", "0.5..1.5", []float64{0.5, 1}, []float64{1.6}},
+		{"list", "in [1, 5, 10]", []float64{1, 10}, []float64{2}},
+		{"negated list", "not in [1, 5]", []float64{2}, []float64{5}},
+		{"and", ">= 100 and < 500", []float64{100, 499}, []float64{500, 99}},
+		{"or", "< 10 or > 100", []float64{5, 101}, []float64{50}},
+		{"and binds tighter than or", "< 10 or > 100 and < 200", []float64{5, 150}, []float64{250}},
+		{"grouping", "(< 10 or > 100) and != 150", []float64{5, 120}, []float64{150, 50}},
+		{"keywords are case insensitive", "> 1 AND < 3", []float64{2}, []float64{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := parseCondition("program_rule_transaction_amount", tt.condition)
+			assert.NoError(t, err)
+			for _, v := range tt.matches {
+				assert.True(t, cond.matches(conditionOperand{num: v}), "expected %v to match", v)
+			}
+			for _, v := range tt.misses {
+				assert.False(t, cond.matches(conditionOperand{num: v}), "expected %v not to match", v)
+			}
+		})
+	}
+}
+
+func TestParseCondition_String(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		matches   []string
+		misses    []string
+	}{
+		{"bare value is equality", "dining", []string{"dining"}, []string{"travel"}},
+		{"explicit equality", "== dining", []string{"dining"}, []string{"travel"}},
+		{"not equal", "!= dining", []string{"travel"}, []string{"dining"}},
+		{"list", "in [dining, travel]", []string{"dining", "travel"}, []string{"fuel"}},
+		{"negated list", "not in [fuel]", []string{"dining"}, []string{"fuel"}},
+		{"or", "dining or travel", []string{"travel"}, []string{"fuel"}},
+		{"quoted values may contain spaces and keywords", `in ["fine dining", 'or']`, []string{"fine dining", "or"}, []string{"dining"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := parseCondition("program_rule_transaction_category", tt.condition)
+			assert.NoError(t, err)
+			for _, v := range tt.matches {
+				assert.True(t, cond.matches(conditionOperand{str: v}), "expected %q to match", v)
+			}
+			for _, v := range tt.misses {
+				assert.False(t, cond.matches(conditionOperand{str: v}), "expected %q not to match", v)
+			}
+		})
+	}
+}
+
+func TestParseCondition_Invalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		conditionType string
+		condition     string
+	}{
+		{"empty", "program_rule_transaction_amount", "  "},
+		{"not a number", "program_rule_transaction_amount", "> abc"},
+		{"dangling operator", "program_rule_transaction_amount", ">"},
+		{"dangling and", "program_rule_transaction_amount", "> 1 and"},
+		{"empty range", "program_rule_transaction_amount", "500..100"},
+		{"open range", "program_rule_transaction_amount", "100.."},
+		{"unclosed list", "program_rule_transaction_amount", "in [1, 2"},
+		{"unclosed group", "program_rule_transaction_amount", "(> 1 or < 0"},
+		{"trailing tokens", "program_rule_transaction_amount", "> 1 2"},
+		{"lone bang", "program_rule_transaction_amount", "! 1"},
+		{"unterminated string", "program_rule_transaction_category", `"dining`},
+		{"ordering on strings", "program_rule_transaction_category", "> dining"},
+		{"range on strings", "program_rule_transaction_category", "a..b"},
+		{"keyword as value", "program_rule_transaction_category", "in [and]"},
+		{"unknown condition type", "program_rule_weather", "sunny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCondition(tt.conditionType, tt.condition)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+)
+
+// newRuleContext gathers what the program rules are evaluated against for a
+// transaction by the customer described in customerContext. The transaction
+// count includes the transaction being evaluated once it completes.
+func newRuleContext(
+	ctx context.Context,
+	programRuleRepo domain.ProgramRuleRepository,
+	rules []*domain.ProgramRule,
+	transaction *domain.Transaction,
+	customerContext *domain.CustomerContext,
+) (*domain.RuleContext, error) {
+	location := customerContext.Location()
+	periodAwards, err := getPeriodAwards(ctx, programRuleRepo, rules, customerContext.MerchantCustomersID, transaction.TransactionDate, location)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildRuleContext(transaction, customerContext, periodAwards, location), nil
+}
+
+// buildRuleContext assembles a rule context from facts that are already known.
+func buildRuleContext(
+	transaction *domain.Transaction,
+	customerContext *domain.CustomerContext,
+	periodAwards map[uuid.UUID]int,
+	location *time.Location,
+) *domain.RuleContext {
+	transactionCount := customerContext.TransactionCount
+	if transaction.Status == domain.TransactionCompleted {
+		transactionCount++
+	}
+
+	return &domain.RuleContext{
+		Transaction:      transaction,
+		TransactionCount: transactionCount,
+		MembershipTenure: customerContext.MembershipTenure(transaction.TransactionDate),
+		PeriodAwards:     periodAwards,
+		Location:         location,
+		DateOfBirth:      customerContext.DateOfBirth,
+		MemberSince:      customerContext.MemberSince,
+	}
+}
+
+// getPeriodAwards looks up what each rule with a customer cap already awarded
+// the customer in the cap period containing at, in the merchant's timezone.
+// There is nothing to look up without a customer.
+func getPeriodAwards(
+	ctx context.Context,
+	programRuleRepo domain.ProgramRuleRepository,
+	rules []*domain.ProgramRule,
+	customerID uuid.UUID,
+	at time.Time,
+	location *time.Location,
+) (map[uuid.UUID]int, error) {
+	periodAwards := make(map[uuid.UUID]int)
+	if customerID == uuid.Nil {
+		return periodAwards, nil
+	}
+
+	for _, rule := range rules {
+		if rule.MaxPointsPerCustomerPerPeriod == nil {
+			continue
+		}
+		from, to := capPeriodBounds(rule.CapPeriod, at, location)
+		awarded, err := programRuleRepo.SumAwardedPoints(ctx, rule.ID, customerID, from, to)
+		if err != nil {
+			return nil, domain.NewSystemError("getPeriodAwards", err, "failed to get awarded points for rule "+rule.ID.String())
+		}
+		periodAwards[rule.ID] = awarded
+	}
+	return periodAwards, nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// program_rule_transaction_date conditions use the same expression language,
+// but their values are date literals, each testing one part of the transaction
+// date in the merchant's timezone:
+//
+//	sat, sunday                      day of week
+//	17:00                            time of day, minute precision
+//	2024-12-25                       a calendar date
+//	12-25                            a date recurring every year
+//	birthday, anniversary            the customer's birthday and membership anniversary
+//
+// Times and calendar dates can be compared with < <= > >=. Ranges of the same
+// kind of literal are inclusive except for times, where the end is excluded so
+// 17:00..19:00 stops at 19:00. Ranges other than calendar dates may wrap
+// around, ie 22:00..02:00, fri..mon or 12-20..01-05.
+//
+//	in [sat, sun]                    weekends
+//	in [mon, tue, wed, thu, fri] and 17:00..19:00   happy hour
+//	birthday or 12-25
+
+type dateFacet int
+
+const (
+	weekdayFacet      dateFacet = iota // Sunday is 0
+	timeOfDayFacet                     // minutes since midnight
+	calendarDateFacet                  // yyyymmdd
+	yearlyDateFacet                    // mmdd, recurring every year
+	birthdayFacet
+	anniversaryFacet
+)
+
+type dateValue struct {
+	facet dateFacet
+	value int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var (
+	timeOfDayPattern  = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+	yearlyDatePattern = regexp.MustCompile(`^(\d{2})-(\d{2})$`)
+)
+
+// parseDateValue parses a single date literal.
+func parseDateValue(tok string) (dateValue, error) {
+	lower := strings.ToLower(tok)
+	if weekday, ok := weekdays[lower]; ok {
+		return dateValue{facet: weekdayFacet, value: int(weekday)}, nil
+	}
+	switch lower {
+	case "birthday":
+		return dateValue{facet: birthdayFacet}, nil
+	case "anniversary":
+		return dateValue{facet: anniversaryFacet}, nil
+	}
+
+	if m := timeOfDayPattern.FindStringSubmatch(tok); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour > 23 || minute > 59 {
+			return dateValue{}, fmt.Errorf("%q is not a valid time of day", tok)
+		}
+		return dateValue{facet: timeOfDayFacet, value: hour*60 + minute}, nil
+	}
+
+	if m := yearlyDatePattern.FindStringSubmatch(tok); m != nil {
+		month, _ := strconv.Atoi(m[1])
+		day, _ := strconv.Atoi(m[2])
+		// 2000 is a leap year, so 02-29 is accepted
+		if t := time.Date(2000, time.Month(month), day, 0, 0, 0, 0, time.UTC); int(t.Month()) != month || t.Day() != day {
+			return dateValue{}, fmt.Errorf("%q is not a valid date", tok)
+		}
+		return dateValue{facet: yearlyDateFacet, value: month*100 + day}, nil
+	}
+
+	if t, err := time.Parse("2006-01-02", tok); err == nil {
+		return dateValue{facet: calendarDateFacet, value: calendarDateNumber(t)}, nil
+	}
+
+	return dateValue{}, fmt.Errorf("%q is not a day of week, time, date or yearly date", tok)
+}
+
+// ordered reports whether the literal can be used with < <= > >=.
+func (d dateValue) ordered() bool {
+	return d.facet == timeOfDayFacet || d.facet == calendarDateFacet
+}
+
+// resolve returns the literal and the matching part of the subject as numbers
+// that compare the same way. ok is false when the customer date the literal
+// refers to is unknown.
+func (d dateValue) resolve(subject conditionOperand) (literal, actual int, ok bool) {
+	at := subject.at
+	switch d.facet {
+	case weekdayFacet:
+		return d.value, int(at.Weekday()), true
+	case timeOfDayFacet:
+		return d.value, at.Hour()*60 + at.Minute(), true
+	case calendarDateFacet:
+		return d.value, calendarDateNumber(at), true
+	case birthdayFacet:
+		if subject.dateOfBirth == nil {
+			return 0, 0, false
+		}
+		return yearlyDateIn(monthDayNumber(*subject.dateOfBirth), at.Year()), monthDayNumber(at), true
+	case anniversaryFacet:
+		if subject.memberSince.IsZero() {
+			return 0, 0, false
+		}
+		return yearlyDateIn(monthDayNumber(subject.memberSince), at.Year()), monthDayNumber(at), true
+	}
+	return yearlyDateIn(d.value, at.Year()), monthDayNumber(at), true
+}
+
+func (c compareCondition) matchesDate(subject conditionOperand) bool {
+	literal, actual, ok := c.operand.date.resolve(subject)
+	if !ok {
+		return false
+	}
+
+	switch c.op {
+	case ">":
+		return actual > literal
+	case ">=":
+		return actual >= literal
+	case "<":
+		return actual < literal
+	case "<=":
+		return actual <= literal
+	case "!=":
+		return actual != literal
+	}
+	return actual == literal
+}
+
+type dateRangeCondition struct {
+	from, to dateValue
+}
+
+// newDateRange checks that both ends of a range are the same kind of literal.
+func newDateRange(from, to dateValue) (condition, error) {
+	if from.facet != to.facet {
+		return nil, fmt.Errorf("both ends of a range must be the same kind of date")
+	}
+	switch from.facet {
+	case birthdayFacet, anniversaryFacet:
+		return nil, fmt.Errorf("birthday and anniversary cannot be used in ranges")
+	case calendarDateFacet:
+		if to.value < from.value {
+			return nil, fmt.Errorf("date range is empty")
+		}
+	}
+	return dateRangeCondition{from: from, to: to}, nil
+}
+
+func (c dateRangeCondition) matches(subject conditionOperand) bool {
+	from, actual, _ := c.from.resolve(subject)
+	to, _, _ := c.to.resolve(subject)
+
+	afterStart := actual >= from
+	beforeEnd := actual <= to
+	if c.from.facet == timeOfDayFacet {
+		beforeEnd = actual < to
+	}
+
+	if from <= to {
+		return afterStart && beforeEnd
+	}
+	// The range wraps around midnight, the weekend or new year
+	return afterStart || beforeEnd
+}
+
+func calendarDateNumber(t time.Time) int {
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+func monthDayNumber(t time.Time) int {
+	return int(t.Month())*100 + t.Day()
+}
+
+// yearlyDateIn moves Feb 29 to Feb 28 outside leap years, so leap day
+// birthdays are still celebrated.
+func yearlyDateIn(monthDay, year int) int {
+	if monthDay == 229 && time.Date(year, time.February, 29, 0, 0, 0, 0, time.UTC).Month() != time.February {
+		return 228
+	}
+	return monthDay
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCondition_Date(t *testing.T) {
+	// Saturday 2024-12-21 and Wednesday 2024-12-25
+	saturdayNoon := time.Date(2024, time.December, 21, 12, 0, 0, 0, time.UTC)
+	christmasEvening := time.Date(2024, time.December, 25, 18, 30, 0, 0, time.UTC)
+	lateNight := time.Date(2024, time.December, 25, 23, 15, 0, 0, time.UTC)
+	newYearsDay := time.Date(2025, time.January, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		condition string
+		matches   []time.Time
+		misses    []time.Time
+	}{
+		{"weekday", "sat", []time.Time{saturdayNoon}, []time.Time{christmasEvening}},
+		{"weekend list", "in [sat, sunday]", []time.Time{saturdayNoon}, []time.Time{christmasEvening}},
+		{"weekday range", "mon..fri", []time.Time{christmasEvening, newYearsDay}, []time.Time{saturdayNoon}},
+		{"wrapping weekday range", "fri..mon", []time.Time{saturdayNoon}, []time.Time{christmasEvening}},
+		{"happy hour", "17:00..19:00", []time.Time{christmasEvening}, []time.Time{saturdayNoon, lateNight}},
+		{"happy hour end is excluded", "17:00..18:30", nil, []time.Time{christmasEvening}},
+		{"overnight window", "22:00..02:00", []time.Time{lateNight}, []time.Time{christmasEvening}},
+		{"before a time", "< 10:00", []time.Time{newYearsDay}, []time.Time{saturdayNoon}},
+		{"calendar date", "2024-12-25", []time.Time{christmasEvening}, []time.Time{saturdayNoon}},
+		{"calendar date range", "2024-12-20..2024-12-24", []time.Time{saturdayNoon}, []time.Time{christmasEvening}},
+		{"on or after a date", ">= 2025-01-01", []time.Time{newYearsDay}, []time.Time{christmasEvening}},
+		{"yearly date", "12-25", []time.Time{christmasEvening, christmasEvening.AddDate(3, 0, 0)}, []time.Time{saturdayNoon}},
+		{"wrapping yearly range", "12-24..01-02", []time.Time{christmasEvening, newYearsDay}, []time.Time{saturdayNoon}},
+		{"combined", "in [mon, tue, wed, thu, fri] and 17:00..19:00", []time.Time{christmasEvening}, []time.Time{lateNight, saturdayNoon}},
+		{"weekend or holiday", "in [sat, sun] or 12-25", []time.Time{saturdayNoon, christmasEvening}, []time.Time{newYearsDay}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := parseCondition("program_rule_transaction_date", tt.condition)
+			assert.NoError(t, err)
+			for _, at := range tt.matches {
+				assert.True(t, cond.matches(conditionOperand{at: at}), "expected %v to match", at)
+			}
+			for _, at := range tt.misses {
+				assert.False(t, cond.matches(conditionOperand{at: at}), "expected %v not to match", at)
+			}
+		})
+	}
+}
+
+func TestParseCondition_DateCustomerDates(t *testing.T) {
+	dateOfBirth := time.Date(1990, time.April, 21, 0, 0, 0, 0, time.UTC)
+	leapDayBirth := time.Date(1996, time.February, 29, 0, 0, 0, 0, time.UTC)
+	memberSince := time.Date(2021, time.June, 1, 10, 0, 0, 0, time.UTC)
+
+	birthday, err := parseCondition("program_rule_transaction_date", "birthday")
+	assert.NoError(t, err)
+	assert.True(t, birthday.matches(conditionOperand{at: time.Date(2024, time.April, 21, 9, 0, 0, 0, time.UTC), dateOfBirth: &dateOfBirth}))
+	assert.False(t, birthday.matches(conditionOperand{at: time.Date(2024, time.April, 22, 9, 0, 0, 0, time.UTC), dateOfBirth: &dateOfBirth}))
+	assert.False(t, birthday.matches(conditionOperand{at: time.Date(2024, time.April, 21, 9, 0, 0, 0, time.UTC)}), "unknown birthday never matches")
+
+	// Leap day birthdays fall on Feb 28 in other years
+	assert.True(t, birthday.matches(conditionOperand{at: time.Date(2023, time.February, 28, 9, 0, 0, 0, time.UTC), dateOfBirth: &leapDayBirth}))
+	assert.True(t, birthday.matches(conditionOperand{at: time.Date(2024, time.February, 29, 9, 0, 0, 0, time.UTC), dateOfBirth: &leapDayBirth}))
+	assert.False(t, birthday.matches(conditionOperand{at: time.Date(2024, time.February, 28, 9, 0, 0, 0, time.UTC), dateOfBirth: &leapDayBirth}))
+
+	anniversary, err := parseCondition("program_rule_transaction_date", "anniversary")
+	assert.NoError(t, err)
+	assert.True(t, anniversary.matches(conditionOperand{at: time.Date(2024, time.June, 1, 20, 0, 0, 0, time.UTC), memberSince: memberSince}))
+	assert.False(t, anniversary.matches(conditionOperand{at: time.Date(2024, time.June, 2, 20, 0, 0, 0, time.UTC), memberSince: memberSince}))
+}
+
+func TestParseCondition_DateInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+	}{
+		{"unknown literal", "someday"},
+		{"invalid time", "25:00"},
+		{"invalid yearly date", "02-30"},
+		{"invalid calendar date", "2024-13-01"},
+		{"mixed range", "mon..17:00"},
+		{"empty calendar range", "2024-12-25..2024-12-01"},
+		{"birthday range", "birthday..12-25"},
+		{"ordering on weekdays", "> mon"},
+		{"ordering on yearly dates", "< 12-25"},
+		{"number", "100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCondition("program_rule_transaction_date", tt.condition)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEvaluateRule_TransactionDateUsesMerchantTimezone(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	assert.NoError(t, err)
+
+	rule := &domain.ProgramRule{
+		RuleName:       "2x happy hour",
+		ConditionType:  "program_rule_transaction_date",
+		ConditionValue: "17:00..19:00",
+		Multiplier:     2.0,
+	}
+	// 10:30 UTC is 17:30 in Jakarta
+	rc := &domain.RuleContext{
+		Transaction: &domain.Transaction{
+			TransactionAmount: 80.0,
+			TransactionDate:   time.Date(2024, time.March, 13, 10, 30, 0, 0, time.UTC),
+		},
+		Location: jakarta,
+	}
+
+	matches, points := evaluateRule(compileRule(rule), rc)
+	assert.True(t, matches)
+	assert.Equal(t, 160.0, points) // 80 * 2
+
+	rc.Location = nil // UTC
+	matches, _ = evaluateRule(compileRule(rule), rc)
+	assert.False(t, matches)
+}
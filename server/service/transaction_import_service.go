@@ -0,0 +1,592 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// importChunkSize is how many rows commit in one database transaction
+	importChunkSize = 100
+	// maxImportRows bounds the rows of one upload, larger histories are split
+	// over several files
+	maxImportRows = 50000
+	// syncImportRows is the most rows an import runs within the request,
+	// larger ones run in the background
+	syncImportRows = importChunkSize
+	// importStaleAfter is how long a running import can go without progress
+	// before an upload of its file takes it over
+	importStaleAfter = 15 * time.Minute
+	// maxConcurrentImports bounds the write load of background imports, later
+	// imports stay queued until one finishes
+	maxConcurrentImports = 2
+)
+
+// importRow is a row read from an upload, or why it could not be read.
+type importRow struct {
+	req *domain.CreateTransactionRequest
+	err error
+}
+
+// TransactionImportService loads merchants' historical transactions in bulk
+// through the same pipeline as POST /transactions. An import is identified by
+// the hash of its file, so uploading a file again returns its import instead
+// of creating the transactions twice, and carries on with a failed or
+// interrupted one.
+//
+// Rows are created a chunk per database transaction together with their row
+// report. A row that fails rolls its chunk back, which is then retried one row
+// at a time so only that row is reported failed.
+type TransactionImportService struct {
+	importRepo         domain.TransactionImportRepository
+	transactionService domain.TransactionService
+	customerRepo       domain.MerchantCustomersRepository
+	txManager          domain.TxManager
+	validate           *validator.Validate
+	slots              chan struct{}
+	logger             zerolog.Logger
+}
+
+func NewTransactionImportService(
+	importRepo domain.TransactionImportRepository,
+	transactionService domain.TransactionService,
+	customerRepo domain.MerchantCustomersRepository,
+	txManager domain.TxManager,
+) *TransactionImportService {
+	// Rows are checked against the binding rules POST /transactions uses
+	validate := validator.New()
+	validate.SetTagName("binding")
+
+	return &TransactionImportService{
+		importRepo:         importRepo,
+		transactionService: transactionService,
+		customerRepo:       customerRepo,
+		txManager:          txManager,
+		validate:           validate,
+		slots:              make(chan struct{}, maxConcurrentImports),
+		logger:             logging.GetLogger(),
+	}
+}
+
+// ImportBatch imports transactions sent as a JSON array.
+func (s *TransactionImportService) ImportBatch(ctx context.Context, req *domain.BatchTransactionRequest) (*domain.TransactionImport, error) {
+	// Hashed as decoded, so formatting does not make the same batch a new one
+	payload, err := json.Marshal(req.Transactions)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error marshaling transaction batch")
+		return nil, domain.NewSystemError("TransactionImportService.ImportBatch", err, "failed to marshal transaction batch")
+	}
+
+	rows := make([]importRow, len(req.Transactions))
+	for i := range req.Transactions {
+		rows[i] = importRow{req: &req.Transactions[i]}
+	}
+	return s.start(ctx, req.MerchantID, domain.ImportFormatJSON, hashImport(payload), rows)
+}
+
+// ImportCSV imports transactions uploaded as a CSV file with a header row.
+func (s *TransactionImportService) ImportCSV(ctx context.Context, merchantID uuid.UUID, data []byte) (*domain.TransactionImport, error) {
+	rows, err := parseTransactionCSV(data)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid transaction CSV")
+		return nil, err
+	}
+	return s.start(ctx, merchantID, domain.ImportFormatCSV, hashImport(data), rows)
+}
+
+// start creates the import of a file, or finds the one created by an earlier
+// upload, and runs it. Small imports run before start returns and come back
+// with their row report, larger ones are queued.
+func (s *TransactionImportService) start(ctx context.Context, merchantID uuid.UUID, format, fileHash string, rows []importRow) (*domain.TransactionImport, error) {
+	if len(rows) == 0 {
+		return nil, domain.NewValidationError("transactions", "the import has no rows")
+	}
+	if len(rows) > maxImportRows {
+		return nil, domain.NewValidationError("transactions", fmt.Sprintf("an import can have at most %d rows", maxImportRows))
+	}
+
+	transactionImport := &domain.TransactionImport{
+		MerchantID: merchantID,
+		Format:     format,
+		FileHash:   fileHash,
+		Status:     domain.ImportQueued,
+		TotalRows:  len(rows),
+	}
+	created, err := s.importRepo.Create(ctx, transactionImport)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error creating transaction import")
+		return nil, domain.NewSystemError("TransactionImportService.start", err, "failed to create transaction import")
+	}
+	if !created {
+		existing, err := s.importRepo.GetByFileHash(ctx, merchantID, fileHash)
+		if err != nil || existing == nil {
+			s.logger.Error().
+				Err(err).
+				Str("file_hash", fileHash).
+				Msg("Error getting existing transaction import")
+			return nil, domain.NewSystemError("TransactionImportService.start", err, "failed to get existing transaction import")
+		}
+		if !resumable(existing) {
+			s.logger.Info().
+				Str("import_id", existing.ID.String()).
+				Str("status", existing.Status).
+				Msg("File already imported")
+			return s.withReport(ctx, existing)
+		}
+		s.logger.Info().
+			Str("import_id", existing.ID.String()).
+			Int("processed_rows", existing.ProcessedRows).
+			Msg("Resuming transaction import")
+		transactionImport = existing
+	}
+
+	if len(rows) <= syncImportRows {
+		// The import outlives a client that hangs up
+		s.run(context.WithoutCancel(ctx), transactionImport.ID, rows)
+		return s.GetByID(ctx, transactionImport.ID.String())
+	}
+
+	go func(id uuid.UUID) {
+		s.slots <- struct{}{}
+		defer func() { <-s.slots }()
+		s.run(context.Background(), id, rows)
+	}(transactionImport.ID)
+	return transactionImport, nil
+}
+
+// resumable reports whether an upload of an import's file runs it again: it
+// failed, or it is queued or running without making progress.
+func resumable(transactionImport *domain.TransactionImport) bool {
+	switch transactionImport.Status {
+	case domain.ImportFailed:
+		return true
+	case domain.ImportQueued, domain.ImportRunning:
+		return transactionImport.UpdatedAt.Before(time.Now().Add(-importStaleAfter))
+	}
+	return false
+}
+
+func (s *TransactionImportService) GetByID(ctx context.Context, id string) (*domain.TransactionImport, error) {
+	importID, err := uuid.Parse(id)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid import ID")
+		return nil, domain.NewValidationError("id", "invalid import ID")
+	}
+
+	transactionImport, err := s.importRepo.GetByID(ctx, importID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting transaction import")
+		return nil, domain.NewSystemError("TransactionImportService.GetByID", err, "failed to get transaction import")
+	}
+	if transactionImport == nil {
+		s.logger.Error().
+			Msg("Transaction import not found")
+		return nil, domain.NewResourceNotFoundError("transaction import", id, "transaction import not found")
+	}
+	return s.withReport(ctx, transactionImport)
+}
+
+// withReport adds the row report to a finished import small enough to have
+// run within a request, larger reports are paged through GetRows.
+func (s *TransactionImportService) withReport(ctx context.Context, transactionImport *domain.TransactionImport) (*domain.TransactionImport, error) {
+	if transactionImport.TotalRows > syncImportRows || transactionImport.ProcessedRows == 0 {
+		return transactionImport, nil
+	}
+
+	rows, _, err := s.importRepo.GetRows(ctx, transactionImport.ID, "", 0, syncImportRows)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting transaction import rows")
+		return nil, domain.NewSystemError("TransactionImportService.withReport", err, "failed to get transaction import rows")
+	}
+	transactionImport.Rows = rows
+	return transactionImport, nil
+}
+
+// GetRows returns a page of an import's row report, optionally only the rows
+// with the given status.
+func (s *TransactionImportService) GetRows(ctx context.Context, id, status string, page, limit int) ([]*domain.TransactionImportRow, int64, error) {
+	switch status {
+	case "", domain.ImportRowCreated, domain.ImportRowDuplicate, domain.ImportRowFailed:
+	default:
+		return nil, 0, domain.NewValidationError("status", "status must be one of created, duplicate, failed")
+	}
+
+	importID, err := uuid.Parse(id)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Invalid import ID")
+		return nil, 0, domain.NewValidationError("id", "invalid import ID")
+	}
+
+	rows, total, err := s.importRepo.GetRows(ctx, importID, status, (page-1)*limit, limit)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting transaction import rows")
+		return nil, 0, domain.NewSystemError("TransactionImportService.GetRows", err, "failed to get transaction import rows")
+	}
+	return rows, total, nil
+}
+
+// run claims an import and creates its rows from where it left off.
+func (s *TransactionImportService) run(ctx context.Context, id uuid.UUID, rows []importRow) {
+	transactionImport, err := s.importRepo.Claim(ctx, id, time.Now().Add(-importStaleAfter))
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("import_id", id.String()).
+			Msg("Error claiming transaction import")
+		return
+	}
+	if transactionImport == nil {
+		s.logger.Info().
+			Str("import_id", id.String()).
+			Msg("Transaction import is already running")
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			s.fail(ctx, transactionImport, fmt.Errorf("import panicked: %v", r))
+		}
+	}()
+
+	// A customer's merchant, looked up once per import
+	merchants := make(map[uuid.UUID]uuid.UUID)
+	for from := transactionImport.ProcessedRows; from < len(rows); from += importChunkSize {
+		to := min(from+importChunkSize, len(rows))
+		if err := s.importChunk(ctx, transactionImport, rows, from, to, merchants); err != nil {
+			s.fail(ctx, transactionImport, err)
+			return
+		}
+	}
+
+	if err := s.importRepo.Complete(ctx, transactionImport.ID); err != nil {
+		s.fail(ctx, transactionImport, err)
+		return
+	}
+
+	s.logger.Info().
+		Str("import_id", transactionImport.ID.String()).
+		Int("total_rows", len(rows)).
+		Msg("Transaction import completed")
+}
+
+func (s *TransactionImportService) fail(ctx context.Context, transactionImport *domain.TransactionImport, err error) {
+	s.logger.Error().
+		Err(err).
+		Str("import_id", transactionImport.ID.String()).
+		Msg("Transaction import failed")
+	if err := s.importRepo.Fail(ctx, transactionImport.ID, err.Error()); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("import_id", transactionImport.ID.String()).
+			Msg("Error marking transaction import failed")
+	}
+}
+
+// importChunk creates rows [from, to) and saves their report. It returns an
+// error only for failures that stop the import, a row that can not be created
+// is reported failed.
+func (s *TransactionImportService) importChunk(
+	ctx context.Context,
+	transactionImport *domain.TransactionImport,
+	rows []importRow,
+	from, to int,
+	merchants map[uuid.UUID]uuid.UUID,
+) error {
+	// The chunk commits at once, a customer's cached transaction count would
+	// miss their rows created before in it
+	ctx = withoutCustomerContextCache(ctx)
+
+	rejected := make([]*domain.TransactionImportRow, to-from)
+	for i := from; i < to; i++ {
+		row, err := s.checkRow(ctx, transactionImport, i+1, rows[i], merchants)
+		if err != nil {
+			return err
+		}
+		rejected[i-from] = row
+	}
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		results := make([]*domain.TransactionImportRow, 0, to-from)
+		for i := from; i < to; i++ {
+			if rejected[i-from] != nil {
+				results = append(results, rejected[i-from])
+				continue
+			}
+			transaction, err := s.transactionService.Create(ctx, rows[i].req)
+			if err != nil {
+				return err
+			}
+			results = append(results, createdImportRow(transactionImport.ID, i+1, transaction))
+		}
+		return s.importRepo.SaveRows(ctx, transactionImport.ID, results)
+	})
+	if err == nil {
+		return nil
+	}
+
+	s.logger.Warn().
+		Err(err).
+		Str("import_id", transactionImport.ID.String()).
+		Int("from_row", from+1).
+		Msg("Transaction import chunk failed, importing its rows one at a time")
+
+	for i := from; i < to; i++ {
+		result := rejected[i-from]
+		if result == nil {
+			err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+				transaction, err := s.transactionService.Create(ctx, rows[i].req)
+				if err != nil {
+					return err
+				}
+				return s.importRepo.SaveRows(ctx, transactionImport.ID, []*domain.TransactionImportRow{
+					createdImportRow(transactionImport.ID, i+1, transaction),
+				})
+			})
+			switch {
+			case err == nil:
+				continue
+			case domain.IsResourceConflictError(err):
+				result = &domain.TransactionImportRow{ImportID: transactionImport.ID, RowNumber: i + 1, Status: domain.ImportRowDuplicate}
+			case domain.IsValidationError(err), domain.IsResourceNotFoundError(err), domain.IsBusinessLogicError(err):
+				result = failedImportRow(transactionImport.ID, i+1, err.Error())
+			default:
+				return err
+			}
+		}
+
+		if err := s.importRepo.SaveRows(ctx, transactionImport.ID, []*domain.TransactionImportRow{result}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRow readies a row for creating and returns nil, or returns the row's
+// report when it can not be created. Rows are validated like the body of
+// POST /transactions and must be for a customer of the import's merchant.
+func (s *TransactionImportService) checkRow(
+	ctx context.Context,
+	transactionImport *domain.TransactionImport,
+	number int,
+	row importRow,
+	merchants map[uuid.UUID]uuid.UUID,
+) (*domain.TransactionImportRow, error) {
+	if row.err != nil {
+		return failedImportRow(transactionImport.ID, number, row.err.Error()), nil
+	}
+
+	req := row.req
+	if req.MerchantID == uuid.Nil {
+		req.MerchantID = transactionImport.MerchantID
+	}
+	if req.MerchantID != transactionImport.MerchantID {
+		return failedImportRow(transactionImport.ID, number, "merchant_id: row belongs to another merchant"), nil
+	}
+	if err := s.validate.Struct(req); err != nil {
+		return failedImportRow(transactionImport.ID, number, err.Error()), nil
+	}
+
+	merchantID, ok := merchants[req.MerchantCustomersID]
+	if !ok {
+		customer, err := s.customerRepo.GetByID(ctx, req.MerchantCustomersID)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("customer_id", req.MerchantCustomersID.String()).
+				Msg("Error getting merchant customer")
+			return nil, domain.NewSystemError("TransactionImportService.checkRow", err, "failed to get merchant customer")
+		}
+		if customer != nil {
+			merchantID = customer.MerchantID
+		}
+		merchants[req.MerchantCustomersID] = merchantID
+	}
+	if merchantID != transactionImport.MerchantID {
+		return failedImportRow(transactionImport.ID, number, "merchant_customers_id: customer not found"), nil
+	}
+
+	// A row's transaction conflicts with itself if it was already created
+	sourceID := fmt.Sprintf("import:%s:%d", transactionImport.FileHash, number)
+	req.SourceMessageID = &sourceID
+	return nil, nil
+}
+
+func createdImportRow(importID uuid.UUID, number int, transaction *domain.Transaction) *domain.TransactionImportRow {
+	return &domain.TransactionImportRow{
+		ImportID:      importID,
+		RowNumber:     number,
+		Status:        domain.ImportRowCreated,
+		TransactionID: &transaction.TransactionID,
+	}
+}
+
+func failedImportRow(importID uuid.UUID, number int, reason string) *domain.TransactionImportRow {
+	return &domain.TransactionImportRow{
+		ImportID:  importID,
+		RowNumber: number,
+		Status:    domain.ImportRowFailed,
+		Error:     reason,
+	}
+}
+
+func hashImport(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// transactionCSVColumns are the columns a transaction CSV can have, named
+// like the fields of POST /transactions
+var transactionCSVColumns = map[string]bool{
+	"merchant_id":             false,
+	"merchant_customers_id":   true,
+	"program_id":              true,
+	"transaction_type":        true,
+	"transaction_amount":      true,
+	"transaction_date":        true,
+	"category":                false,
+	"branch_id":               false,
+	"status":                  false,
+	"original_transaction_id": false,
+}
+
+// parseTransactionCSV reads a CSV with a header row naming its columns. A
+// file that can not be read as a whole is a validation error, a row with a
+// value that can not be read is returned with the reason.
+func parseTransactionCSV(data []byte) ([]importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, domain.NewValidationError("file", "the file has no header row")
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, known := transactionCSVColumns[name]; !known {
+			return nil, domain.NewValidationError("file", fmt.Sprintf("unknown column %q", name))
+		}
+		columns[name] = i
+	}
+	for name, required := range transactionCSVColumns {
+		if _, ok := columns[name]; required && !ok {
+			return nil, domain.NewValidationError("file", fmt.Sprintf("missing column %q", name))
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, domain.NewValidationError("file", err.Error())
+		}
+		if err != nil {
+			rows = append(rows, importRow{err: fmt.Errorf("row has %d fields, the header has %d", len(record), len(header))})
+		} else {
+			rows = append(rows, parseTransactionCSVRecord(record, columns))
+		}
+		if len(rows) > maxImportRows {
+			return nil, domain.NewValidationError("file", fmt.Sprintf("an import can have at most %d rows", maxImportRows))
+		}
+	}
+	return rows, nil
+}
+
+func parseTransactionCSVRecord(record []string, columns map[string]int) importRow {
+	value := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	req := &domain.CreateTransactionRequest{
+		TransactionType: value("transaction_type"),
+		Category:        value("category"),
+		// Historical transactions have settled
+		Status: value("status"),
+	}
+	if req.Status == "" {
+		req.Status = domain.TransactionCompleted
+	}
+
+	var err error
+	// An empty ID is left for the validation of the row to report if required
+	parseID := func(name string) *uuid.UUID {
+		raw := value(name)
+		if err != nil || raw == "" {
+			return nil
+		}
+		id, parseErr := uuid.Parse(raw)
+		if parseErr != nil {
+			err = fmt.Errorf("%s: invalid UUID %q", name, raw)
+			return nil
+		}
+		return &id
+	}
+	if id := parseID("merchant_id"); id != nil {
+		req.MerchantID = *id
+	}
+	if id := parseID("merchant_customers_id"); id != nil {
+		req.MerchantCustomersID = *id
+	}
+	if id := parseID("program_id"); id != nil {
+		req.ProgramID = *id
+	}
+	req.BranchID = parseID("branch_id")
+	req.OriginalTransactionID = parseID("original_transaction_id")
+	if err != nil {
+		return importRow{err: err}
+	}
+
+	if req.TransactionAmount, err = strconv.ParseFloat(value("transaction_amount"), 64); err != nil {
+		return importRow{err: fmt.Errorf("transaction_amount: invalid number %q", value("transaction_amount"))}
+	}
+	if req.TransactionDate, err = parseCSVDate(value("transaction_date")); err != nil {
+		return importRow{err: fmt.Errorf("transaction_date: %q is not an RFC 3339 timestamp or a YYYY-MM-DD date", value("transaction_date"))}
+	}
+	return importRow{req: req}
+}
+
+// parseCSVDate reads an RFC 3339 timestamp, or a date taken as midnight UTC.
+func parseCSVDate(raw string) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, raw); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
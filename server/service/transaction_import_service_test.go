@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type mockTransactionImportRepository struct {
+	mock.Mock
+}
+
+func (m *mockTransactionImportRepository) Create(ctx context.Context, transactionImport *domain.TransactionImport) (bool, error) {
+	args := m.Called(ctx, transactionImport)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockTransactionImportRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.TransactionImport, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TransactionImport), args.Error(1)
+}
+
+func (m *mockTransactionImportRepository) GetByFileHash(ctx context.Context, merchantID uuid.UUID, fileHash string) (*domain.TransactionImport, error) {
+	args := m.Called(ctx, merchantID, fileHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TransactionImport), args.Error(1)
+}
+
+func (m *mockTransactionImportRepository) Claim(ctx context.Context, id uuid.UUID, staleBefore time.Time) (*domain.TransactionImport, error) {
+	args := m.Called(ctx, id, staleBefore)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TransactionImport), args.Error(1)
+}
+
+func (m *mockTransactionImportRepository) SaveRows(ctx context.Context, importID uuid.UUID, rows []*domain.TransactionImportRow) error {
+	args := m.Called(ctx, importID, rows)
+	return args.Error(0)
+}
+
+func (m *mockTransactionImportRepository) Complete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockTransactionImportRepository) Fail(ctx context.Context, id uuid.UUID, reason string) error {
+	args := m.Called(ctx, id, reason)
+	return args.Error(0)
+}
+
+func (m *mockTransactionImportRepository) GetRows(ctx context.Context, importID uuid.UUID, status string, offset, limit int) ([]*domain.TransactionImportRow, int64, error) {
+	args := m.Called(ctx, importID, status, offset, limit)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.TransactionImportRow), args.Get(1).(int64), args.Error(2)
+}
+
+type TransactionImportServiceTestSuite struct {
+	suite.Suite
+	importRepo         *mockTransactionImportRepository
+	transactionService *mockTransactionService
+	customerRepo       *mockMerchantCustomersRepository
+	service            *TransactionImportService
+	merchantID         uuid.UUID
+	customerID         uuid.UUID
+	importID           uuid.UUID
+	saved              []*domain.TransactionImportRow
+}
+
+func (s *TransactionImportServiceTestSuite) SetupTest() {
+	s.importRepo = new(mockTransactionImportRepository)
+	s.transactionService = new(mockTransactionService)
+	s.customerRepo = new(mockMerchantCustomersRepository)
+	s.service = NewTransactionImportService(s.importRepo, s.transactionService, s.customerRepo, passThroughTxManager{})
+
+	s.merchantID = uuid.New()
+	s.customerID = uuid.New()
+	s.importID = uuid.New()
+	s.saved = nil
+
+	s.customerRepo.On("GetByID", mock.Anything, s.customerID).Return(&domain.MerchantCustomer{
+		ID:         s.customerID,
+		MerchantID: s.merchantID,
+	}, nil)
+	s.importRepo.On("SaveRows", mock.Anything, s.importID, mock.Anything).Run(func(args mock.Arguments) {
+		s.saved = append(s.saved, args.Get(2).([]*domain.TransactionImportRow)...)
+	}).Return(nil).Maybe()
+	s.importRepo.On("Complete", mock.Anything, s.importID).Return(nil).Maybe()
+	s.importRepo.On("GetByID", mock.Anything, s.importID).Return(&domain.TransactionImport{
+		ID:     s.importID,
+		Status: domain.ImportCompleted,
+	}, nil).Maybe()
+}
+
+func TestTransactionImportServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(TransactionImportServiceTestSuite))
+}
+
+func (s *TransactionImportServiceTestSuite) row(amount float64) domain.CreateTransactionRequest {
+	return domain.CreateTransactionRequest{
+		MerchantCustomersID: s.customerID,
+		ProgramID:           uuid.New(),
+		TransactionType:     "purchase",
+		TransactionAmount:   amount,
+		TransactionDate:     time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+		Status:              "completed",
+	}
+}
+
+// withNewImport makes the batch a new import that this call gets to run.
+func (s *TransactionImportServiceTestSuite) withNewImport(processedRows int) {
+	s.importRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.TransactionImport")).Run(func(args mock.Arguments) {
+		args.Get(1).(*domain.TransactionImport).ID = s.importID
+	}).Return(true, nil)
+	s.importRepo.On("Claim", mock.Anything, s.importID, mock.Anything).Return(&domain.TransactionImport{
+		ID:            s.importID,
+		MerchantID:    s.merchantID,
+		FileHash:      "hash",
+		Status:        domain.ImportRunning,
+		ProcessedRows: processedRows,
+	}, nil)
+	s.importRepo.On("GetRows", mock.Anything, s.importID, "", 0, syncImportRows).Return(nil, int64(0), nil).Maybe()
+}
+
+// created makes Create succeed for rows of amount.
+func (s *TransactionImportServiceTestSuite) created(amount float64) {
+	s.transactionService.On("Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+		return req.TransactionAmount == amount
+	})).Return(&domain.Transaction{TransactionID: uuid.New()}, nil)
+}
+
+func (s *TransactionImportServiceTestSuite) savedStatuses() []string {
+	statuses := make([]string, len(s.saved))
+	for i, row := range s.saved {
+		s.Equal(i+1, row.RowNumber)
+		statuses[i] = row.Status
+	}
+	return statuses
+}
+
+func (s *TransactionImportServiceTestSuite) TestImportBatch_ReportsEveryRow() {
+	ctx := context.Background()
+	s.withNewImport(0)
+	s.created(10)
+
+	otherCustomerID := uuid.New()
+	s.customerRepo.On("GetByID", mock.Anything, otherCustomerID).Return(&domain.MerchantCustomer{
+		ID:         otherCustomerID,
+		MerchantID: uuid.New(),
+	}, nil)
+	otherCustomers := s.row(30)
+	otherCustomers.MerchantCustomersID = otherCustomerID
+
+	_, err := s.service.ImportBatch(ctx, &domain.BatchTransactionRequest{
+		MerchantID:   s.merchantID,
+		Transactions: []domain.CreateTransactionRequest{s.row(10), s.row(0), otherCustomers},
+	})
+
+	s.NoError(err)
+	s.Equal([]string{domain.ImportRowCreated, domain.ImportRowFailed, domain.ImportRowFailed}, s.savedStatuses())
+	s.NotNil(s.saved[0].TransactionID)
+	s.Contains(s.saved[1].Error, "TransactionAmount")
+	s.Contains(s.saved[2].Error, "customer not found")
+	s.transactionService.AssertNumberOfCalls(s.T(), "Create", 1)
+	s.importRepo.AssertCalled(s.T(), "Complete", mock.Anything, s.importID)
+}
+
+func (s *TransactionImportServiceTestSuite) TestImportBatch_FailingRowOnlyFailsItself() {
+	ctx := context.Background()
+	s.withNewImport(0)
+	s.created(10)
+	s.transactionService.On("Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+		return req.TransactionAmount == 20
+	})).Return(nil, domain.NewResourceConflictError("transaction", "duplicate transaction record"))
+	s.transactionService.On("Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+		return req.TransactionAmount == 30
+	})).Return(nil, domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points balance"))
+	s.created(40)
+
+	_, err := s.service.ImportBatch(ctx, &domain.BatchTransactionRequest{
+		MerchantID:   s.merchantID,
+		Transactions: []domain.CreateTransactionRequest{s.row(10), s.row(20), s.row(30), s.row(40)},
+	})
+
+	s.NoError(err)
+	s.Equal([]string{
+		domain.ImportRowCreated,
+		domain.ImportRowDuplicate,
+		domain.ImportRowFailed,
+		domain.ImportRowCreated,
+	}, s.savedStatuses())
+	s.Contains(s.saved[2].Error, "insufficient points balance")
+	s.importRepo.AssertCalled(s.T(), "Complete", mock.Anything, s.importID)
+}
+
+func (s *TransactionImportServiceTestSuite) TestImportBatch_RowsCarryTheirSourceID() {
+	ctx := context.Background()
+	s.withNewImport(0)
+	s.transactionService.On("Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+		return req.SourceMessageID != nil && *req.SourceMessageID == "import:hash:1" && req.MerchantID == s.merchantID
+	})).Return(&domain.Transaction{TransactionID: uuid.New()}, nil)
+
+	_, err := s.service.ImportBatch(ctx, &domain.BatchTransactionRequest{
+		MerchantID:   s.merchantID,
+		Transactions: []domain.CreateTransactionRequest{s.row(10)},
+	})
+
+	s.NoError(err)
+	s.transactionService.AssertExpectations(s.T())
+}
+
+func (s *TransactionImportServiceTestSuite) TestImportBatch_SameBatchAgainReturnsItsImport() {
+	ctx := context.Background()
+	s.importRepo.On("Create", mock.Anything, mock.Anything).Return(false, nil)
+	s.importRepo.On("GetByFileHash", mock.Anything, s.merchantID, mock.Anything).Return(&domain.TransactionImport{
+		ID:            s.importID,
+		MerchantID:    s.merchantID,
+		Status:        domain.ImportCompleted,
+		TotalRows:     1,
+		ProcessedRows: 1,
+		UpdatedAt:     time.Now(),
+	}, nil)
+	report := []*domain.TransactionImportRow{{ImportID: s.importID, RowNumber: 1, Status: domain.ImportRowCreated}}
+	s.importRepo.On("GetRows", mock.Anything, s.importID, "", 0, syncImportRows).Return(report, int64(1), nil)
+
+	transactionImport, err := s.service.ImportBatch(ctx, &domain.BatchTransactionRequest{
+		MerchantID:   s.merchantID,
+		Transactions: []domain.CreateTransactionRequest{s.row(10)},
+	})
+
+	s.NoError(err)
+	s.Equal(s.importID, transactionImport.ID)
+	s.Equal(report, transactionImport.Rows)
+	s.importRepo.AssertNotCalled(s.T(), "Claim", mock.Anything, mock.Anything, mock.Anything)
+	s.transactionService.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionImportServiceTestSuite) TestImportBatch_FailedImportCarriesOn() {
+	ctx := context.Background()
+	s.importRepo.On("Create", mock.Anything, mock.Anything).Return(false, nil)
+	s.importRepo.On("GetByFileHash", mock.Anything, s.merchantID, mock.Anything).Return(&domain.TransactionImport{
+		ID:            s.importID,
+		MerchantID:    s.merchantID,
+		Status:        domain.ImportFailed,
+		TotalRows:     2,
+		ProcessedRows: 1,
+		UpdatedAt:     time.Now(),
+	}, nil)
+	s.importRepo.On("Claim", mock.Anything, s.importID, mock.Anything).Return(&domain.TransactionImport{
+		ID:            s.importID,
+		MerchantID:    s.merchantID,
+		FileHash:      "hash",
+		Status:        domain.ImportRunning,
+		ProcessedRows: 1,
+	}, nil)
+	s.importRepo.On("GetRows", mock.Anything, s.importID, "", 0, syncImportRows).Return(nil, int64(0), nil).Maybe()
+	s.created(20)
+
+	_, err := s.service.ImportBatch(ctx, &domain.BatchTransactionRequest{
+		MerchantID:   s.merchantID,
+		Transactions: []domain.CreateTransactionRequest{s.row(10), s.row(20)},
+	})
+
+	s.NoError(err)
+	s.transactionService.AssertNumberOfCalls(s.T(), "Create", 1)
+	s.Require().Len(s.saved, 1)
+	s.Equal(2, s.saved[0].RowNumber)
+}
+
+func (s *TransactionImportServiceTestSuite) TestImportBatch_SystemErrorFailsTheImport() {
+	ctx := context.Background()
+	s.withNewImport(0)
+	s.transactionService.On("Create", mock.Anything, mock.Anything).
+		Return(nil, domain.NewSystemError("TransactionService.Create", assert.AnError, "failed to create transaction"))
+	s.importRepo.On("Fail", mock.Anything, s.importID, mock.Anything).Return(nil)
+
+	_, err := s.service.ImportBatch(ctx, &domain.BatchTransactionRequest{
+		MerchantID:   s.merchantID,
+		Transactions: []domain.CreateTransactionRequest{s.row(10)},
+	})
+
+	s.NoError(err)
+	s.Empty(s.saved)
+	s.importRepo.AssertCalled(s.T(), "Fail", mock.Anything, s.importID, mock.Anything)
+	s.importRepo.AssertNotCalled(s.T(), "Complete", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionImportServiceTestSuite) TestImportBatch_RowsBypassTheCustomerContextCache() {
+	ctx := context.Background()
+	s.withNewImport(0)
+	s.transactionService.On("Create", mock.MatchedBy(func(ctx context.Context) bool {
+		return ctx.Value(uncachedKey{}) != nil
+	}), mock.Anything).Return(&domain.Transaction{TransactionID: uuid.New()}, nil)
+
+	_, err := s.service.ImportBatch(ctx, &domain.BatchTransactionRequest{
+		MerchantID:   s.merchantID,
+		Transactions: []domain.CreateTransactionRequest{s.row(10), s.row(20)},
+	})
+
+	s.NoError(err)
+	s.transactionService.AssertNumberOfCalls(s.T(), "Create", 2)
+}
+
+func TestParseTransactionCSV(t *testing.T) {
+	customerID := uuid.New()
+	programID := uuid.New()
+	data := "\ufeffmerchant_customers_id,program_id,transaction_type,transaction_amount,transaction_date,category\n" +
+		customerID.String() + "," + programID.String() + ",purchase,42.50,2024-03-01T12:00:00Z,dining\n" +
+		customerID.String() + "," + programID.String() + ",purchase,abc,2024-03-01,dining\n" +
+		customerID.String() + "," + programID.String() + ",bonus,10,2024-03-02,\n" +
+		customerID.String() + ",not-a-uuid,purchase,10,2024-03-02,\n" +
+		customerID.String() + "," + programID.String() + ",purchase\n"
+
+	rows, err := parseTransactionCSV([]byte(data))
+
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+
+	require.NoError(t, rows[0].err)
+	assert.Equal(t, customerID, rows[0].req.MerchantCustomersID)
+	assert.Equal(t, programID, rows[0].req.ProgramID)
+	assert.Equal(t, 42.5, rows[0].req.TransactionAmount)
+	assert.Equal(t, "dining", rows[0].req.Category)
+	assert.Equal(t, domain.TransactionCompleted, rows[0].req.Status)
+
+	assert.ErrorContains(t, rows[1].err, "transaction_amount")
+
+	require.NoError(t, rows[2].err)
+	assert.Equal(t, time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC), rows[2].req.TransactionDate)
+
+	assert.ErrorContains(t, rows[3].err, "program_id")
+	assert.ErrorContains(t, rows[4].err, "fields")
+}
+
+func TestParseTransactionCSV_Header(t *testing.T) {
+	_, err := parseTransactionCSV([]byte("merchant_customers_id,program_id,transaction_type,transaction_amount\n"))
+	assert.True(t, domain.IsValidationError(err))
+	assert.ErrorContains(t, err, "transaction_date")
+
+	_, err = parseTransactionCSV([]byte("merchant_customers_id,program_id,transaction_type,transaction_amount,transaction_date,points\n"))
+	assert.True(t, domain.IsValidationError(err))
+	assert.ErrorContains(t, err, "points")
+
+	_, err = parseTransactionCSV(nil)
+	assert.True(t, domain.IsValidationError(err))
+}
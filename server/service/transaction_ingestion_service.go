@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-playground/pkg/kafka"
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// A message that keeps failing is retried with a backoff, then dead lettered
+// so it does not hold up its partition.
+const (
+	maxIngestAttempts = 8
+	minIngestBackoff  = 100 * time.Millisecond
+	maxIngestBackoff  = 30 * time.Second
+)
+
+// TransactionIngestionService creates the transactions merchants push onto
+// Kafka, through the same pipeline as the REST API.
+type TransactionIngestionService struct {
+	subscriber         domain.MessageSubscriber
+	publisher          domain.EventPublisher
+	transactionService domain.TransactionService
+	logger             zerolog.Logger
+}
+
+func NewTransactionIngestionService(
+	subscriber domain.MessageSubscriber,
+	publisher domain.EventPublisher,
+	transactionService domain.TransactionService,
+) *TransactionIngestionService {
+	return &TransactionIngestionService{
+		subscriber:         subscriber,
+		publisher:          publisher,
+		transactionService: transactionService,
+		logger:             logging.GetLogger(),
+	}
+}
+
+// Run ingests transaction messages until ctx is cancelled. A message being
+// ingested when ctx is cancelled is finished first, so Run returns once no
+// write is in flight.
+func (s *TransactionIngestionService) Run(ctx context.Context) error {
+	messages, err := s.subscriber.SubscribeToTopic(ctx, domain.TransactionIngestTopic, domain.TransactionIngestGroupID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Failed to subscribe to transaction topic")
+		return domain.NewSystemError("TransactionIngestionService.Run", err, "failed to subscribe to transaction topic")
+	}
+
+	s.logger.Info().
+		Str("topic", domain.TransactionIngestTopic).
+		Msg("Transaction ingestion started")
+	for message := range messages {
+		s.handle(ctx, message)
+	}
+	s.logger.Info().
+		Str("topic", domain.TransactionIngestTopic).
+		Msg("Transaction ingestion stopped")
+	return nil
+}
+
+// handle ingests a message and commits its offset once the transaction is
+// written. A message that can not be ingested is dead lettered and committed.
+// Failures like a database outage are retried, when ctx is cancelled first the
+// message is left uncommitted and delivered again on restart.
+func (s *TransactionIngestionService) handle(ctx context.Context, message *kafka.Message) {
+	// A write that has started is not cut off by shutdown
+	work := context.WithoutCancel(ctx)
+
+	backoff := minIngestBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.ingest(work, message)
+		if err != nil && attempt >= maxIngestAttempts {
+			err = s.deadLetter(work, message, fmt.Errorf("gave up after %d attempts: %w", attempt, err))
+		}
+		if err == nil {
+			// A message whose commit is lost is delivered again and then
+			// conflicts on its message ID
+			if err := message.Commit(work); err != nil {
+				s.logger.Error().
+					Err(err).
+					Int("partition", message.Partition).
+					Int64("offset", message.Offset).
+					Msg("Failed to commit transaction message")
+			}
+			return
+		}
+
+		s.logger.Error().
+			Err(err).
+			Int("partition", message.Partition).
+			Int64("offset", message.Offset).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Msg("Failed to ingest transaction message")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxIngestBackoff)
+	}
+}
+
+// ingest creates the transaction of a message. It returns an error only for
+// failures worth retrying, invalid messages are dead lettered.
+func (s *TransactionIngestionService) ingest(ctx context.Context, message *kafka.Message) error {
+	req, err := decodeTransactionMessage(message.Value)
+	if err != nil {
+		return s.deadLetter(ctx, message, err)
+	}
+
+	transaction, err := s.transactionService.Create(ctx, req)
+	switch {
+	case err == nil:
+		s.logger.Info().
+			Str("message_id", *req.SourceMessageID).
+			Str("transaction_id", transaction.TransactionID.String()).
+			Msg("Ingested transaction message")
+		return nil
+	case domain.IsResourceConflictError(err):
+		s.logger.Info().
+			Str("message_id", *req.SourceMessageID).
+			Msg("Transaction message already ingested")
+		return nil
+	case domain.IsValidationError(err), domain.IsResourceNotFoundError(err), domain.IsBusinessLogicError(err):
+		return s.deadLetter(ctx, message, err)
+	default:
+		return err
+	}
+}
+
+// deadLetter moves a message to the dead letter topic with the reason it
+// could not be ingested.
+func (s *TransactionIngestionService) deadLetter(ctx context.Context, message *kafka.Message, reason error) error {
+	payload, err := json.Marshal(&domain.DeadLetter{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       message.Key,
+		Payload:   string(message.Value),
+		Reason:    reason.Error(),
+		FailedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return domain.NewSystemError("TransactionIngestionService.deadLetter", err, "failed to marshal dead letter")
+	}
+
+	if err := s.publisher.Publish(ctx, domain.TransactionDeadLetterTopic, message.Key, payload); err != nil {
+		return domain.NewSystemError("TransactionIngestionService.deadLetter", err, "failed to publish dead letter")
+	}
+
+	s.logger.Warn().
+		Str("reason", reason.Error()).
+		Int("partition", message.Partition).
+		Int64("offset", message.Offset).
+		Msg("Dead lettered transaction message")
+	return nil
+}
+
+// decodeTransactionMessage reads a message according to its schema version.
+func decodeTransactionMessage(value []byte) (*domain.CreateTransactionRequest, error) {
+	var version domain.TransactionMessageVersion
+	if err := json.Unmarshal(value, &version); err != nil {
+		return nil, domain.NewValidationError("payload", "message is not valid JSON")
+	}
+
+	switch version.SchemaVersion {
+	case 1:
+		return decodeTransactionMessageV1(value)
+	default:
+		return nil, domain.NewValidationError("schema_version", fmt.Sprintf("unsupported schema version %d", version.SchemaVersion))
+	}
+}
+
+func decodeTransactionMessageV1(value []byte) (*domain.CreateTransactionRequest, error) {
+	var msg domain.TransactionMessageV1
+	if err := json.Unmarshal(value, &msg); err != nil {
+		return nil, domain.NewValidationError("payload", "message does not match schema version 1")
+	}
+
+	switch {
+	case msg.MessageID == "":
+		return nil, domain.NewValidationError("message_id", "message_id is required")
+	case len(msg.MessageID) > 255:
+		return nil, domain.NewValidationError("message_id", "message_id must be at most 255 characters")
+	case msg.MerchantCustomersID == uuid.Nil:
+		return nil, domain.NewValidationError("merchant_customers_id", "merchant_customers_id is required")
+	case msg.ProgramID == uuid.Nil:
+		return nil, domain.NewValidationError("program_id", "program_id is required")
+	case msg.TransactionType != "purchase" && msg.TransactionType != "refund" && msg.TransactionType != "bonus":
+		return nil, domain.NewValidationError("transaction_type", "transaction_type must be one of purchase, refund, bonus")
+	case msg.TransactionAmount <= 0:
+		return nil, domain.NewValidationError("transaction_amount", "transaction amount must be greater than 0")
+	case msg.TransactionDate.IsZero():
+		return nil, domain.NewValidationError("transaction_date", "transaction_date is required")
+	}
+
+	status := msg.Status
+	switch status {
+	case "":
+		status = "completed"
+	case "pending", "completed", "failed", "cancelled":
+	default:
+		return nil, domain.NewValidationError("status", "status must be one of pending, completed, failed, cancelled")
+	}
+
+	return &domain.CreateTransactionRequest{
+		MerchantCustomersID:   msg.MerchantCustomersID,
+		ProgramID:             msg.ProgramID,
+		TransactionType:       msg.TransactionType,
+		TransactionAmount:     msg.TransactionAmount,
+		TransactionDate:       msg.TransactionDate,
+		Category:              msg.Category,
+		BranchID:              msg.BranchID,
+		Status:                status,
+		SourceMessageID:       &msg.MessageID,
+		OriginalTransactionID: msg.OriginalTransactionID,
+	}, nil
+}
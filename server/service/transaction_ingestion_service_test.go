@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go-playground/pkg/kafka"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTransactionService struct {
+	mock.Mock
+}
+
+func (m *mockTransactionService) Create(ctx context.Context, req *domain.CreateTransactionRequest) (*domain.Transaction, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Transaction), args.Error(1)
+}
+
+func (m *mockTransactionService) GetByID(ctx context.Context, id uuid.UUID) (*domain.Transaction, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Transaction), args.Error(1)
+}
+
+func (m *mockTransactionService) GetByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*domain.Transaction, error) {
+	args := m.Called(ctx, customerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Transaction), args.Error(1)
+}
+
+func (m *mockTransactionService) GetByCustomerIDWithPagination(ctx context.Context, customerID uuid.UUID, offset, limit int) ([]*domain.Transaction, int64, error) {
+	args := m.Called(ctx, customerID, offset, limit)
+	return args.Get(0).([]*domain.Transaction), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockTransactionService) UpdateStatus(ctx context.Context, id string, status string) error {
+	args := m.Called(ctx, id, status)
+	return args.Error(0)
+}
+
+func (m *mockTransactionService) GetByMerchantIDWithPagination(ctx context.Context, merchantID uuid.UUID, offset, limit int) ([]*domain.Transaction, int64, error) {
+	args := m.Called(ctx, merchantID, offset, limit)
+	return args.Get(0).([]*domain.Transaction), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockTransactionService) GetByUserIDWithPagination(ctx context.Context, userID uuid.UUID, offset, limit int) ([]*domain.Transaction, int64, error) {
+	args := m.Called(ctx, userID, offset, limit)
+	return args.Get(0).([]*domain.Transaction), args.Get(1).(int64), args.Error(2)
+}
+
+func transactionMessage(t *testing.T, fields map[string]interface{}) []byte {
+	msg := map[string]interface{}{
+		"schema_version":        1,
+		"message_id":            "pos-1",
+		"merchant_customers_id": uuid.New(),
+		"program_id":            uuid.New(),
+		"transaction_type":      "purchase",
+		"transaction_amount":    42.5,
+		"transaction_date":      time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC),
+	}
+	for k, v := range fields {
+		msg[k] = v
+	}
+	value, err := json.Marshal(msg)
+	require.NoError(t, err)
+	return value
+}
+
+// runIngestion runs the ingestion until the broker has committed the given
+// offset, then shuts it down.
+func runIngestion(t *testing.T, svc *TransactionIngestionService, broker *kafka.MemoryBroker, offset int64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, svc.Run(ctx))
+	}()
+
+	assert.Eventually(t, func() bool {
+		return broker.Committed(domain.TransactionIngestTopic, domain.TransactionIngestGroupID) >= offset
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestTransactionIngestionService_Run(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("creates the transaction and commits", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker()
+		transactionService := new(mockTransactionService)
+		svc := NewTransactionIngestionService(broker, broker, transactionService)
+		transactionService.On("Create", mock.Anything, mock.MatchedBy(func(req *domain.CreateTransactionRequest) bool {
+			return *req.SourceMessageID == "pos-1" &&
+				req.TransactionAmount == 42.5 &&
+				req.Status == "completed"
+		})).Return(&domain.Transaction{TransactionID: uuid.New()}, nil)
+		require.NoError(t, broker.Publish(ctx, domain.TransactionIngestTopic, "merchant-1", transactionMessage(t, nil)))
+
+		runIngestion(t, svc, broker, 1)
+
+		transactionService.AssertExpectations(t)
+		assert.Empty(t, broker.Messages(domain.TransactionDeadLetterTopic))
+	})
+
+	t.Run("dead letters invalid messages and moves on", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker()
+		transactionService := new(mockTransactionService)
+		svc := NewTransactionIngestionService(broker, broker, transactionService)
+		transactionService.On("Create", mock.Anything, mock.Anything).
+			Return(nil, domain.NewResourceNotFoundError("merchant customer", "", "customer not found")).Once()
+		require.NoError(t, broker.Publish(ctx, domain.TransactionIngestTopic, "merchant-1", []byte(`not json`)))
+		require.NoError(t, broker.Publish(ctx, domain.TransactionIngestTopic, "merchant-1", transactionMessage(t, map[string]interface{}{"schema_version": 9})))
+		require.NoError(t, broker.Publish(ctx, domain.TransactionIngestTopic, "merchant-1", transactionMessage(t, nil)))
+
+		runIngestion(t, svc, broker, 3)
+
+		deadLetters := broker.Messages(domain.TransactionDeadLetterTopic)
+		require.Len(t, deadLetters, 3)
+		var deadLetter domain.DeadLetter
+		require.NoError(t, json.Unmarshal(deadLetters[1].Value, &deadLetter))
+		assert.Equal(t, int64(1), deadLetter.Offset)
+		assert.Equal(t, "merchant-1", deadLetters[1].Key)
+		assert.Contains(t, deadLetter.Reason, "unsupported schema version 9")
+		transactionService.AssertNumberOfCalls(t, "Create", 1)
+	})
+
+	t.Run("redelivered message is committed without a second transaction", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker()
+		transactionService := new(mockTransactionService)
+		svc := NewTransactionIngestionService(broker, broker, transactionService)
+		transactionService.On("Create", mock.Anything, mock.Anything).
+			Return(nil, domain.NewResourceConflictError("transaction", "duplicate transaction record"))
+		require.NoError(t, broker.Publish(ctx, domain.TransactionIngestTopic, "merchant-1", transactionMessage(t, nil)))
+
+		runIngestion(t, svc, broker, 1)
+
+		assert.Empty(t, broker.Messages(domain.TransactionDeadLetterTopic))
+	})
+
+	t.Run("shutdown during a database outage leaves the message uncommitted", func(t *testing.T) {
+		broker := kafka.NewMemoryBroker()
+		transactionService := new(mockTransactionService)
+		svc := NewTransactionIngestionService(broker, broker, transactionService)
+		runCtx, cancel := context.WithCancel(ctx)
+		transactionService.On("Create", mock.Anything, mock.Anything).
+			Run(func(mock.Arguments) { cancel() }).
+			Return(nil, domain.NewSystemError("TransactionService.Create", assert.AnError, "failed to create transaction"))
+		require.NoError(t, broker.Publish(ctx, domain.TransactionIngestTopic, "merchant-1", transactionMessage(t, nil)))
+
+		assert.NoError(t, svc.Run(runCtx))
+
+		assert.Equal(t, int64(0), broker.Committed(domain.TransactionIngestTopic, domain.TransactionIngestGroupID))
+		assert.Empty(t, broker.Messages(domain.TransactionDeadLetterTopic))
+	})
+}
+
+func TestDecodeTransactionMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		field  string
+	}{
+		{"missing message id", map[string]interface{}{"message_id": ""}, "message_id"},
+		{"missing schema version", map[string]interface{}{"schema_version": nil}, "schema_version"},
+		{"unknown transaction type", map[string]interface{}{"transaction_type": "redemption"}, "transaction_type"},
+		{"zero amount", map[string]interface{}{"transaction_amount": 0}, "transaction_amount"},
+		{"unknown status", map[string]interface{}{"status": "settled"}, "status"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := decodeTransactionMessage(transactionMessage(t, tc.fields))
+
+			assert.Nil(t, req)
+			assert.True(t, domain.IsValidationError(err))
+			assert.Equal(t, tc.field, err.(domain.ValidationError).Field)
+		})
+	}
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"math"
 
 	"go-playground/pkg/logging"
 	"go-playground/server/domain"
@@ -15,6 +17,10 @@ type TransactionService struct {
 	pointsService        domain.PointsService
 	eventLoggerService   domain.EventLoggerService
 	merchantCustomerRepo domain.MerchantCustomersRepository
+	programRuleRepo      domain.ProgramRuleRepository
+	programRepo          domain.ProgramRepository
+	customerContext      domain.CustomerContextProvider
+	txManager            domain.TxManager
 	logger               zerolog.Logger
 }
 
@@ -23,12 +29,20 @@ func NewTransactionService(
 	pointsService domain.PointsService,
 	eventLoggerService domain.EventLoggerService,
 	merchantCustomerRepo domain.MerchantCustomersRepository,
+	programRuleRepo domain.ProgramRuleRepository,
+	programRepo domain.ProgramRepository,
+	customerContext domain.CustomerContextProvider,
+	txManager domain.TxManager,
 ) *TransactionService {
 	return &TransactionService{
 		transactionRepo:      transactionRepo,
 		pointsService:        pointsService,
 		eventLoggerService:   eventLoggerService,
 		merchantCustomerRepo: merchantCustomerRepo,
+		programRuleRepo:      programRuleRepo,
+		programRepo:          programRepo,
+		customerContext:      customerContext,
+		txManager:            txManager,
 		logger:               logging.GetLogger(),
 	}
 }
@@ -56,81 +70,457 @@ func (s *TransactionService) Create(ctx context.Context, req *domain.CreateTrans
 		return nil, domain.NewValidationError("transaction_amount", "transaction amount must be greater than 0")
 	}
 
+	isRefund := req.TransactionType == "refund"
+	if isRefund && req.OriginalTransactionID == nil {
+		s.logger.Error().
+			Msg("Original transaction ID is required for refunds")
+		return nil, domain.NewValidationError("original_transaction_id", "original transaction ID is required for refunds")
+	}
+	if !isRefund && req.OriginalTransactionID != nil {
+		s.logger.Error().
+			Msg("Only refunds have an original transaction")
+		return nil, domain.NewValidationError("original_transaction_id", "only refunds have an original transaction")
+	}
+
 	// Get merchant ID from customer ID
 	merchantID, err := s.getMerchantIDByCustomerID(ctx, req.MerchantCustomersID)
 	if err != nil {
 		s.logger.Error().
 			Err(err).
 			Msg("Error getting merchant ID")
+		if domain.IsResourceNotFoundError(err) {
+			return nil, err
+		}
 		return nil, domain.NewSystemError("TransactionService.Create", err, "failed to get merchant ID")
 	}
 
 	transaction := &domain.Transaction{
-		TransactionID:       uuid.New(),
-		MerchantCustomersID: req.MerchantCustomersID,
-		MerchantID:          merchantID,
-		ProgramID:           req.ProgramID,
-		TransactionType:     req.TransactionType,
-		TransactionAmount:   req.TransactionAmount,
-		TransactionDate:     req.TransactionDate,
+		TransactionID:         uuid.New(),
+		MerchantCustomersID:   req.MerchantCustomersID,
+		MerchantID:            merchantID,
+		ProgramID:             req.ProgramID,
+		TransactionType:       req.TransactionType,
+		TransactionAmount:     req.TransactionAmount,
+		TransactionDate:       req.TransactionDate,
+		Category:              req.Category,
+		BranchID:              req.BranchID,
+		Status:                req.Status,
+		SourceMessageID:       req.SourceMessageID,
+		OriginalTransactionID: req.OriginalTransactionID,
+		CashAmount:            req.CashAmount,
 	}
 
-	createdTx, err := s.transactionRepo.Create(ctx, transaction)
-	if err != nil {
-		s.logger.Error().
-			Err(err).
-			Msg("Error creating transaction")
-		return nil, domain.NewSystemError("TransactionService.Create", err, "failed to create transaction")
+	// A transaction recorded as failed or cancelled never moves points. A
+	// pending one holds the points it earns, but spends or takes back points
+	// right away so they can not be spent twice while it settles
+	movesPoints := transaction.Status == domain.TransactionPending || transaction.Status == domain.TransactionCompleted
+
+	var refundPolicy string
+	if isRefund && movesPoints {
+		if refundPolicy, err = s.getRefundPolicy(ctx, transaction.ProgramID); err != nil {
+			return nil, err
+		}
 	}
 
-	// Calculate points based on transaction amount and type
+	// The transaction, its points, rule awards and event commit together or
+	// not at all
+	var createdTx *domain.Transaction
 	var points int
+	var awards []ruleAward
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+
+		// The purchase stays locked until the refund commits, so concurrent
+		// refunds can not add up to more than it
+		var original *domain.Transaction
+		var refunded float64
+		if isRefund {
+			if original, refunded, err = s.lockRefundedTransaction(ctx, transaction); err != nil {
+				return err
+			}
+		}
+
+		// Evaluated in the unit of work, a capped rule's awards stay locked
+		// until they are recorded so concurrent transactions can not both
+		// take what is left of the cap
+		if points, awards, err = s.calculateTransactionPoints(ctx, transaction); err != nil {
+			return err
+		}
+
+		createdTx, err = s.transactionRepo.Create(ctx, transaction)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error creating transaction")
+			// A message ingested twice
+			if domain.IsResourceConflictError(err) {
+				return err
+			}
+			return domain.NewSystemError("TransactionService.Create", err, "failed to create transaction")
+		}
+
+		switch {
+		case !movesPoints:
+			points = 0
+		case isRefund && original.TransactionType == "redemption":
+			if points, err = s.giveBackRedeemedPoints(ctx, createdTx); err != nil {
+				return err
+			}
+		case isRefund:
+			if points, err = s.reverseRefundedPoints(ctx, createdTx, original, refunded, refundPolicy); err != nil {
+				return err
+			}
+		case points > 0 && transaction.Status == domain.TransactionPending:
+			// Held until the transaction completes, see UpdateStatus
+			if _, err := s.pointsService.HoldPoints(ctx, &domain.PointsTransaction{
+				CustomerID:    transaction.MerchantCustomersID.String(),
+				ProgramID:     transaction.ProgramID.String(),
+				Points:        points,
+				TransactionID: createdTx.TransactionID.String(),
+				RuleSetID:     awards[0].rule.RuleSetID.String(),
+			}); err != nil {
+				s.logger.Error().
+					Err(err).
+					Msg("Error holding points")
+				return domain.NewSystemError("TransactionService.Create", err, "failed to hold points")
+			}
+		case points > 0:
+			if _, err := s.pointsService.EarnPoints(ctx, &domain.PointsTransaction{
+				CustomerID:    transaction.MerchantCustomersID.String(),
+				ProgramID:     transaction.ProgramID.String(),
+				Points:        points,
+				TransactionID: createdTx.TransactionID.String(),
+				// Every active rule comes from the program's published rule set
+				RuleSetID: awards[0].rule.RuleSetID.String(),
+				EarnedAt:  createdTx.TransactionDate,
+			}); err != nil {
+				s.logger.Error().
+					Err(err).
+					Msg("Error earning points")
+				return domain.NewSystemError("TransactionService.Create", err, "failed to earn points")
+			}
+		case points < 0:
+			if _, err := s.pointsService.RedeemPoints(ctx, &domain.PointsTransaction{
+				CustomerID:    transaction.MerchantCustomersID.String(),
+				ProgramID:     transaction.ProgramID.String(),
+				Points:        points,
+				TransactionID: createdTx.TransactionID.String(),
+			}); err != nil {
+				s.logger.Error().
+					Err(err).
+					Msg("Error redeeming points")
+				if domain.IsBusinessLogicError(err) {
+					return err
+				}
+				return domain.NewSystemError("TransactionService.Create", err, "failed to redeem points")
+			}
+		}
+
+		if movesPoints {
+			if err := s.recordRuleAwards(ctx, createdTx, awards); err != nil {
+				return err
+			}
+		}
+
+		if err := s.eventLoggerService.SaveTransactionEvents(ctx, domain.TransactionCreated, createdTx, points); err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error saving transaction event")
+			return domain.NewSystemError("TransactionService.Create", err, "failed to save transaction event")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return createdTx, nil
+}
+
+// calculateTransactionPoints returns the points a transaction moves on the ledger
+// and, for earning transactions, what each program rule contributed.
+// Purchases and bonuses earn whatever the program rules in force at the
+// transaction date award; redemptions take points back one for one. Refunds
+// take back their purchase's points, see reverseRefundedPoints, or give back
+// their redemption's, see giveBackRedeemedPoints.
+func (s *TransactionService) calculateTransactionPoints(ctx context.Context, transaction *domain.Transaction) (int, []ruleAward, error) {
 	switch transaction.TransactionType {
-	case "purchase":
-		points = int(transaction.TransactionAmount) // Example: 1 point per currency unit
 	case "refund":
-		points = -int(transaction.TransactionAmount)
-	case "bonus":
-		points = int(transaction.TransactionAmount * 2) // Example: Double points for bonus
+		return 0, nil, nil
 	case "redemption":
-		points = int(transaction.TransactionAmount * -1)
+		return -int(transaction.TransactionAmount), nil, nil
+	}
+
+	rules, err := s.programRuleRepo.GetActiveRules(ctx, transaction.ProgramID, transaction.TransactionDate)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("program_id", transaction.ProgramID.String()).
+			Msg("Error getting active program rules")
+		return 0, nil, domain.NewSystemError("TransactionService.calculateTransactionPoints", err, "failed to get active program rules")
+	}
+
+	customerContext, err := s.customerContext.GetCustomerContext(ctx, transaction.MerchantCustomersID, transaction.ProgramID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("customer_id", transaction.MerchantCustomersID.String()).
+			Msg("Error getting customer context")
+		return 0, nil, domain.NewSystemError("TransactionService.calculateTransactionPoints", err, "failed to get customer context")
+	}
+
+	rc, err := newRuleContext(ctx, s.programRuleRepo, rules, transaction, customerContext)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("customer_id", transaction.MerchantCustomersID.String()).
+			Msg("Error building rule context")
+		return 0, nil, err
+	}
+
+	awards := applyRules(compileRules(rules), rc)
+	points := 0
+	for i := range awards {
+		// Whole points per rule, so the recorded awards add up to what was earned
+		awards[i].points = math.Floor(awards[i].points)
+		points += int(awards[i].points)
+	}
+	return points, awards, nil
+}
+
+// getRefundPolicy returns how the program handles taking back points the
+// customer has already spent.
+func (s *TransactionService) getRefundPolicy(ctx context.Context, programID uuid.UUID) (string, error) {
+	program, err := s.programRepo.GetByID(ctx, programID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("program_id", programID.String()).
+			Msg("Error getting program")
+		return "", domain.NewSystemError("TransactionService.getRefundPolicy", err, "failed to get program")
+	}
+	if program == nil {
+		s.logger.Error().
+			Str("program_id", programID.String()).
+			Msg("Program not found")
+		return "", domain.NewResourceNotFoundError("program", programID.String(), "program not found")
+	}
+	return program.RefundPolicy, nil
+}
+
+// lockRefundedTransaction locks the purchase or redemption a refund is for and
+// returns it with what its earlier refunds gave back. The refund must be for
+// the same customer and program, and all refunds together can not exceed the
+// original transaction.
+func (s *TransactionService) lockRefundedTransaction(ctx context.Context, refund *domain.Transaction) (*domain.Transaction, float64, error) {
+	originalID := *refund.OriginalTransactionID
+	original, err := s.transactionRepo.LockByID(ctx, originalID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("original_transaction_id", originalID.String()).
+			Msg("Error locking original transaction")
+		return nil, 0, domain.NewSystemError("TransactionService.lockRefundedTransaction", err, "failed to lock original transaction")
+	}
+	if original == nil {
+		s.logger.Error().
+			Str("original_transaction_id", originalID.String()).
+			Msg("Original transaction not found")
+		return nil, 0, domain.NewResourceNotFoundError("transaction", originalID.String(), "original transaction not found")
+	}
+
+	switch {
+	case original.MerchantCustomersID != refund.MerchantCustomersID || original.ProgramID != refund.ProgramID:
+		return nil, 0, domain.NewValidationError("original_transaction_id", "original transaction belongs to another customer or program")
+	case original.TransactionType != "purchase" && original.TransactionType != "redemption":
+		return nil, 0, domain.NewValidationError("original_transaction_id", "only purchases and redemptions can be refunded")
+	case original.Status != domain.TransactionCompleted:
+		return nil, 0, domain.NewBusinessLogicError("TRANSACTION_NOT_COMPLETED", fmt.Sprintf(
+			"a %s transaction can not be refunded", original.Status))
+	}
+
+	refunded, err := s.transactionRepo.SumRefunds(ctx, originalID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("original_transaction_id", originalID.String()).
+			Msg("Error summing refunds")
+		return nil, 0, domain.NewSystemError("TransactionService.lockRefundedTransaction", err, "failed to sum refunds")
+	}
+
+	if toCents(refunded+refund.TransactionAmount) > toCents(original.TransactionAmount) {
+		s.logger.Error().
+			Float64("refunded", refunded).
+			Float64("refund_amount", refund.TransactionAmount).
+			Float64("original_amount", original.TransactionAmount).
+			Msg("Refund exceeds the original transaction")
+		return nil, 0, domain.NewBusinessLogicError("REFUND_EXCEEDS_ORIGINAL", fmt.Sprintf(
+			"refund of %.2f exceeds the %.2f left to refund", refund.TransactionAmount, original.TransactionAmount-refunded))
+	}
+	return original, refunded, nil
+}
+
+// reverseRefundedPoints takes back the refund's share of the points its
+// purchase earned and returns them as a negative number. The share of all
+// refunds so far is rounded down and the earlier refunds' share subtracted,
+// so partial refunds that add up to the purchase take back exactly its points.
+func (s *TransactionService) reverseRefundedPoints(ctx context.Context, refund, original *domain.Transaction, refunded float64, refundPolicy string) (int, error) {
+	earned, _, err := s.pointsService.GetTransactionPoints(ctx, original.TransactionID)
+	if err != nil {
+		return 0, err
+	}
+
+	points := proRataPoints(earned, refunded+refund.TransactionAmount, original.TransactionAmount) -
+		proRataPoints(earned, refunded, original.TransactionAmount)
+	if points == 0 {
+		return 0, nil
+	}
+
+	reversed, err := s.pointsService.ReversePoints(ctx, &domain.PointsTransaction{
+		CustomerID:    refund.MerchantCustomersID.String(),
+		ProgramID:     refund.ProgramID.String(),
+		Points:        points,
+		TransactionID: refund.TransactionID.String(),
+	}, refundPolicy)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("transaction_id", refund.TransactionID.String()).
+			Msg("Error reversing refunded points")
+		if domain.IsBusinessLogicError(err) {
+			return 0, err
+		}
+		return 0, domain.NewSystemError("TransactionService.reverseRefundedPoints", err, "failed to reverse refunded points")
+	}
+	return -reversed.Points, nil
+}
+
+// giveBackRedeemedPoints gives the customer back the points a refund of a
+// redemption is for, one point per unit of the refund.
+func (s *TransactionService) giveBackRedeemedPoints(ctx context.Context, refund *domain.Transaction) (int, error) {
+	points := int(refund.TransactionAmount)
+	if _, err := s.pointsService.EarnPoints(ctx, &domain.PointsTransaction{
+		CustomerID:    refund.MerchantCustomersID.String(),
+		ProgramID:     refund.ProgramID.String(),
+		Points:        points,
+		TransactionID: refund.TransactionID.String(),
+		EarnedAt:      refund.TransactionDate,
+	}); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("transaction_id", refund.TransactionID.String()).
+			Msg("Error giving back redeemed points")
+		return 0, domain.NewSystemError("TransactionService.giveBackRedeemedPoints", err, "failed to give back redeemed points")
 	}
+	return points, nil
+}
 
-	// TODO: Check if the transaction is valid for the program, branch/merchant
-	// TODO: Calculate points based on the transaction type and program rules
-	// TODO: Check if the customer has enough points to redeem
-	// TODO: Update points balance if applicable
+// reverseCancelledPoints undoes what a transaction did to the balance when it
+// fails or is cancelled. A purchase or bonus loses the points its refunds have
+// not already taken back, a refund or redemption gives back what it took.
+func (s *TransactionService) reverseCancelledPoints(ctx context.Context, transaction *domain.Transaction) error {
+	earned, redeemed, err := s.pointsService.GetTransactionPoints(ctx, transaction.TransactionID)
+	if err != nil {
+		return err
+	}
 
-	if points > 0 {
+	if redeemed > earned {
 		if _, err := s.pointsService.EarnPoints(ctx, &domain.PointsTransaction{
 			CustomerID:    transaction.MerchantCustomersID.String(),
 			ProgramID:     transaction.ProgramID.String(),
-			Points:        points,
-			TransactionID: createdTx.TransactionID.String(),
+			Points:        redeemed - earned,
+			TransactionID: transaction.TransactionID.String(),
 		}); err != nil {
 			s.logger.Error().
 				Err(err).
-				Msg("Error earning points")
-			return nil, domain.NewSystemError("TransactionService.Create", err, "failed to earn points")
+				Str("transaction_id", transaction.TransactionID.String()).
+				Msg("Error giving back cancelled refund points")
+			return domain.NewSystemError("TransactionService.reverseCancelledPoints", err, "failed to give back cancelled refund points")
 		}
-	} else if points < 0 {
-		if _, err := s.pointsService.RedeemPoints(ctx, &domain.PointsTransaction{
-			CustomerID:    transaction.MerchantCustomersID.String(),
-			ProgramID:     transaction.ProgramID.String(),
-			Points:        points,
-			TransactionID: createdTx.TransactionID.String(),
-		}); err != nil {
-			s.logger.Error().
-				Err(err).
-				Msg("Error redeeming points")
-			return nil, domain.NewSystemError("TransactionService.Create", err, "failed to redeem points")
+		return nil
+	}
+	if earned == 0 {
+		return nil
+	}
+
+	refunded, err := s.transactionRepo.SumRefunds(ctx, transaction.TransactionID)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("transaction_id", transaction.TransactionID.String()).
+			Msg("Error summing refunds")
+		return domain.NewSystemError("TransactionService.reverseCancelledPoints", err, "failed to sum refunds")
+	}
+	points := earned - redeemed - proRataPoints(earned, refunded, transaction.TransactionAmount)
+	if points <= 0 {
+		return nil
+	}
+
+	refundPolicy, err := s.getRefundPolicy(ctx, transaction.ProgramID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.pointsService.ReversePoints(ctx, &domain.PointsTransaction{
+		CustomerID:    transaction.MerchantCustomersID.String(),
+		ProgramID:     transaction.ProgramID.String(),
+		Points:        points,
+		TransactionID: transaction.TransactionID.String(),
+	}, refundPolicy); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("transaction_id", transaction.TransactionID.String()).
+			Msg("Error reversing cancelled transaction points")
+		if domain.IsBusinessLogicError(err) {
+			return err
 		}
+		return domain.NewSystemError("TransactionService.reverseCancelledPoints", err, "failed to reverse cancelled transaction points")
+	}
+	return nil
+}
+
+// proRataPoints is the share of points that refunded is of amount, rounded
+// down. Amounts are compared in cents, so refunding all of amount gives back
+// exactly points.
+func proRataPoints(points int, refunded, amount float64) int {
+	total := toCents(amount)
+	if total <= 0 {
+		return 0
 	}
+	return int(int64(points) * min(toCents(refunded), total) / total)
+}
 
-	// Log the transaction event
-	go s.eventLoggerService.SaveTransactionEvents(ctx, domain.TransactionCreated, createdTx, points)
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
 
-	return createdTx, nil
+// recordRuleAwards keeps what each rule paid out so customer caps can be
+// enforced on later transactions.
+func (s *TransactionService) recordRuleAwards(ctx context.Context, transaction *domain.Transaction, awards []ruleAward) error {
+	var records []*domain.ProgramRuleAward
+	for _, award := range awards {
+		if award.points <= 0 {
+			continue
+		}
+		records = append(records, &domain.ProgramRuleAward{
+			RuleID:              award.rule.ID,
+			MerchantCustomersID: transaction.MerchantCustomersID,
+			TransactionID:       transaction.TransactionID,
+			Points:              int(award.points),
+			AwardedAt:           transaction.TransactionDate,
+		})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := s.programRuleRepo.CreateAwards(ctx, records); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("transaction_id", transaction.TransactionID.String()).
+			Msg("Failed to record program rule awards")
+		return domain.NewSystemError("TransactionService.recordRuleAwards", err, "failed to record program rule awards")
+	}
+	return nil
 }
 
 func (s *TransactionService) GetByID(ctx context.Context, id uuid.UUID) (*domain.Transaction, error) {
@@ -182,7 +572,74 @@ func (s *TransactionService) UpdateStatus(ctx context.Context, id string, status
 			Msg("Error parsing transaction ID")
 		return domain.NewSystemError("TransactionService.UpdateStatus", err, "failed to parse transaction ID")
 	}
-	return s.transactionRepo.UpdateStatus(ctx, txID, status)
+
+	// The status change, what it does to the transaction's points and the
+	// event commit together. A status change moves the transaction in or out
+	// of the completed count, listeners such as the customer context cache
+	// react to the event.
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Locked so a refund or a concurrent status change waits for this one
+		transaction, err := s.transactionRepo.LockByID(ctx, txID)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("transaction_id", id).
+				Msg("Error locking transaction")
+			return domain.NewSystemError("TransactionService.UpdateStatus", err, "failed to lock transaction")
+		}
+		if transaction == nil {
+			s.logger.Error().
+				Str("transaction_id", id).
+				Msg("Transaction not found")
+			return domain.NewResourceNotFoundError("transaction", id, "transaction not found")
+		}
+
+		oldStatus := transaction.Status
+		if !domain.CanTransitionTransaction(oldStatus, status) {
+			s.logger.Error().
+				Str("transaction_id", id).
+				Str("from", oldStatus).
+				Str("to", status).
+				Msg("Invalid transaction status transition")
+			return domain.NewBusinessLogicError("INVALID_STATUS_TRANSITION", fmt.Sprintf(
+				"a %s transaction can not become %s", oldStatus, status))
+		}
+
+		switch status {
+		case domain.TransactionCompleted:
+			if _, err := s.pointsService.ReleaseHold(ctx, txID); err != nil {
+				s.logger.Error().
+					Err(err).
+					Str("transaction_id", id).
+					Msg("Error releasing points hold")
+				return domain.NewSystemError("TransactionService.UpdateStatus", err, "failed to release points hold")
+			}
+		case domain.TransactionFailed, domain.TransactionCancelled:
+			if _, err := s.pointsService.VoidHold(ctx, txID); err != nil {
+				s.logger.Error().
+					Err(err).
+					Str("transaction_id", id).
+					Msg("Error voiding points hold")
+				return domain.NewSystemError("TransactionService.UpdateStatus", err, "failed to void points hold")
+			}
+			if err := s.reverseCancelledPoints(ctx, transaction); err != nil {
+				return err
+			}
+		}
+
+		if err := s.transactionRepo.UpdateStatus(ctx, txID, status); err != nil {
+			return err
+		}
+
+		transaction.Status = status
+		if err := s.eventLoggerService.SaveTransactionStatusEvents(ctx, transaction, oldStatus); err != nil {
+			s.logger.Error().
+				Err(err).
+				Msg("Error saving transaction status event")
+			return domain.NewSystemError("TransactionService.UpdateStatus", err, "failed to save transaction status event")
+		}
+		return nil
+	})
 }
 
 func (s *TransactionService) SetPointsService(pointsService domain.PointsService) {
@@ -1 +1,1090 @@
 package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type mockTransactionRepository struct {
+	mock.Mock
+}
+
+func (m *mockTransactionRepository) Create(ctx context.Context, transaction *domain.Transaction) (*domain.Transaction, error) {
+	args := m.Called(ctx, transaction)
+	if fn, ok := args.Get(0).(func(*domain.Transaction) *domain.Transaction); ok {
+		return fn(transaction), args.Error(1)
+	}
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Transaction), args.Error(1)
+}
+
+func (m *mockTransactionRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Transaction, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Transaction), args.Error(1)
+}
+
+func (m *mockTransactionRepository) GetByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*domain.Transaction, error) {
+	args := m.Called(ctx, customerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Transaction), args.Error(1)
+}
+
+func (m *mockTransactionRepository) GetByCustomerIDWithPagination(ctx context.Context, customerID uuid.UUID, offset, limit int) ([]*domain.Transaction, int64, error) {
+	args := m.Called(ctx, customerID, offset, limit)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.Transaction), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockTransactionRepository) GetByMerchantIDWithPagination(ctx context.Context, merchantID uuid.UUID, offset, limit int) ([]*domain.Transaction, int64, error) {
+	args := m.Called(ctx, merchantID, offset, limit)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.Transaction), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockTransactionRepository) GetByUserIDWithPagination(ctx context.Context, userID uuid.UUID, offset, limit int) ([]*domain.Transaction, int64, error) {
+	args := m.Called(ctx, userID, offset, limit)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.Transaction), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockTransactionRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
+	args := m.Called(ctx, id, status)
+	return args.Error(0)
+}
+
+func (m *mockTransactionRepository) CountByCustomerAndProgram(ctx context.Context, customerID, programID uuid.UUID, status string) (int, error) {
+	args := m.Called(ctx, customerID, programID, status)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockTransactionRepository) LockByID(ctx context.Context, id uuid.UUID) (*domain.Transaction, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Transaction), args.Error(1)
+}
+
+func (m *mockTransactionRepository) SumRefunds(ctx context.Context, originalID uuid.UUID) (float64, error) {
+	args := m.Called(ctx, originalID)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+type mockPointsService struct {
+	mock.Mock
+}
+
+func (m *mockPointsService) GetLedger(ctx context.Context, customerID uuid.UUID, programID uuid.UUID) ([]*domain.PointsLedger, error) {
+	args := m.Called(ctx, customerID, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.PointsLedger), args.Error(1)
+}
+
+func (m *mockPointsService) GetLots(ctx context.Context, customerID, programID uuid.UUID) ([]*domain.PointsLot, error) {
+	args := m.Called(ctx, customerID, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.PointsLot), args.Error(1)
+}
+
+func (m *mockPointsService) GetBalance(ctx context.Context, customerID uuid.UUID, programID uuid.UUID) (*domain.PointsBalance, error) {
+	args := m.Called(ctx, customerID, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsBalance), args.Error(1)
+}
+
+func (m *mockPointsService) EarnPoints(ctx context.Context, req *domain.PointsTransaction) (*domain.PointsTransaction, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsTransaction), args.Error(1)
+}
+
+func (m *mockPointsService) RedeemPoints(ctx context.Context, req *domain.PointsTransaction) (*domain.PointsTransaction, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsTransaction), args.Error(1)
+}
+
+func (m *mockPointsService) ReversePoints(ctx context.Context, req *domain.PointsTransaction, refundPolicy string) (*domain.PointsTransaction, error) {
+	args := m.Called(ctx, req, refundPolicy)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsTransaction), args.Error(1)
+}
+
+func (m *mockPointsService) GetTransactionPoints(ctx context.Context, transactionID uuid.UUID) (int, int, error) {
+	args := m.Called(ctx, transactionID)
+	return args.Int(0), args.Int(1), args.Error(2)
+}
+
+func (m *mockPointsService) HoldPoints(ctx context.Context, req *domain.PointsTransaction) (*domain.PointsHold, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsHold), args.Error(1)
+}
+
+func (m *mockPointsService) ReleaseHold(ctx context.Context, transactionID uuid.UUID) (*domain.PointsHold, error) {
+	args := m.Called(ctx, transactionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsHold), args.Error(1)
+}
+
+func (m *mockPointsService) VoidHold(ctx context.Context, transactionID uuid.UUID) (*domain.PointsHold, error) {
+	args := m.Called(ctx, transactionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PointsHold), args.Error(1)
+}
+
+type mockEventLoggerService struct {
+	mock.Mock
+}
+
+func (m *mockEventLoggerService) SaveTransactionEvents(ctx context.Context, eventType domain.EventLogType, transaction *domain.Transaction, pointsEarned int) error {
+	args := m.Called(ctx, eventType, transaction, pointsEarned)
+	return args.Error(0)
+}
+
+func (m *mockEventLoggerService) SaveTransactionStatusEvents(ctx context.Context, transaction *domain.Transaction, oldStatus string) error {
+	args := m.Called(ctx, transaction, oldStatus)
+	return args.Error(0)
+}
+
+func (m *mockEventLoggerService) SaveRedemptionEvents(ctx context.Context, eventType domain.EventLogType, redemption *domain.Redemption, reward *domain.Reward) error {
+	args := m.Called(ctx, eventType, redemption, reward)
+	return args.Error(0)
+}
+
+func (m *mockEventLoggerService) SaveRedemptionStatusEvents(ctx context.Context, redemption *domain.Redemption, reward *domain.Reward, oldStatus domain.RedemptionStatus) error {
+	args := m.Called(ctx, redemption, reward, oldStatus)
+	return args.Error(0)
+}
+
+func (m *mockEventLoggerService) SaveRewardLowStockEvents(ctx context.Context, reward *domain.Reward, customerID uuid.UUID) error {
+	args := m.Called(ctx, reward, customerID)
+	return args.Error(0)
+}
+
+func (m *mockEventLoggerService) SaveUserUpdateEvents(ctx context.Context, eventType domain.EventLogType, user *domain.User) error {
+	args := m.Called(ctx, eventType, user)
+	return args.Error(0)
+}
+
+func (m *mockEventLoggerService) SaveMerchantUpdateEvents(ctx context.Context, eventType domain.EventLogType, merchant *domain.Merchant) error {
+	args := m.Called(ctx, eventType, merchant)
+	return args.Error(0)
+}
+
+func (m *mockEventLoggerService) SaveProgramUpdateEvents(ctx context.Context, eventType domain.EventLogType, program *domain.Program) error {
+	args := m.Called(ctx, eventType, program)
+	return args.Error(0)
+}
+
+func (m *mockEventLoggerService) SaveProgramRulesEvents(ctx context.Context, eventType domain.EventLogType, programRule *domain.ProgramRule) error {
+	args := m.Called(ctx, eventType, programRule)
+	return args.Error(0)
+}
+
+func (m *mockEventLoggerService) SavePointUpdateEvents(ctx context.Context, eventType domain.EventLogType, ledger *domain.PointsLedger) error {
+	args := m.Called(ctx, eventType, ledger)
+	return args.Error(0)
+}
+
+type mockMerchantCustomersRepository struct {
+	mock.Mock
+}
+
+func (m *mockMerchantCustomersRepository) Create(ctx context.Context, customer *domain.MerchantCustomer) error {
+	args := m.Called(ctx, customer)
+	return args.Error(0)
+}
+
+func (m *mockMerchantCustomersRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.MerchantCustomer, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.MerchantCustomer), args.Error(1)
+}
+
+func (m *mockMerchantCustomersRepository) GetByEmail(ctx context.Context, email string) (*domain.MerchantCustomer, error) {
+	args := m.Called(ctx, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.MerchantCustomer), args.Error(1)
+}
+
+func (m *mockMerchantCustomersRepository) GetByPhone(ctx context.Context, phone string) (*domain.MerchantCustomer, error) {
+	args := m.Called(ctx, phone)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.MerchantCustomer), args.Error(1)
+}
+
+func (m *mockMerchantCustomersRepository) GetByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]*domain.MerchantCustomer, error) {
+	args := m.Called(ctx, merchantID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.MerchantCustomer), args.Error(1)
+}
+
+func (m *mockMerchantCustomersRepository) Update(ctx context.Context, customer *domain.MerchantCustomer) error {
+	args := m.Called(ctx, customer)
+	return args.Error(0)
+}
+
+type mockProgramRuleRepository struct {
+	mock.Mock
+}
+
+func (m *mockProgramRuleRepository) Create(ctx context.Context, rule *domain.ProgramRule) error {
+	args := m.Called(ctx, rule)
+	return args.Error(0)
+}
+
+func (m *mockProgramRuleRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.ProgramRule, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ProgramRule), args.Error(1)
+}
+
+func (m *mockProgramRuleRepository) GetByProgramID(ctx context.Context, programID uuid.UUID) ([]*domain.ProgramRule, error) {
+	args := m.Called(ctx, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.ProgramRule), args.Error(1)
+}
+
+func (m *mockProgramRuleRepository) GetByRuleSetID(ctx context.Context, ruleSetID uuid.UUID) ([]*domain.ProgramRule, error) {
+	args := m.Called(ctx, ruleSetID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.ProgramRule), args.Error(1)
+}
+
+func (m *mockProgramRuleRepository) Update(ctx context.Context, rule *domain.ProgramRule) error {
+	args := m.Called(ctx, rule)
+	return args.Error(0)
+}
+
+func (m *mockProgramRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockProgramRuleRepository) GetActiveRules(ctx context.Context, programID uuid.UUID, timestamp time.Time) ([]*domain.ProgramRule, error) {
+	args := m.Called(ctx, programID, timestamp)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.ProgramRule), args.Error(1)
+}
+
+func (m *mockProgramRuleRepository) CreateAwards(ctx context.Context, awards []*domain.ProgramRuleAward) error {
+	args := m.Called(ctx, awards)
+	return args.Error(0)
+}
+
+func (m *mockProgramRuleRepository) SumAwardedPoints(ctx context.Context, ruleID, customerID uuid.UUID, from, to time.Time) (int, error) {
+	args := m.Called(ctx, ruleID, customerID, from, to)
+	return args.Int(0), args.Error(1)
+}
+
+type mockCustomerContextProvider struct {
+	mock.Mock
+}
+
+func (m *mockCustomerContextProvider) GetCustomerContext(ctx context.Context, customerID, programID uuid.UUID) (*domain.CustomerContext, error) {
+	args := m.Called(ctx, customerID, programID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.CustomerContext), args.Error(1)
+}
+
+func (m *mockCustomerContextProvider) InvalidateCustomerContext(ctx context.Context, customerID, programID uuid.UUID) error {
+	args := m.Called(ctx, customerID, programID)
+	return args.Error(0)
+}
+
+// passThroughTxManager runs units of work without a database transaction
+type passThroughTxManager struct{}
+
+func (passThroughTxManager) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return nil, nil
+}
+
+func (passThroughTxManager) Commit(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
+
+func (passThroughTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (passThroughTxManager) AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	fn(ctx)
+}
+
+// inUnitOfWork marks the ctx of a unit of work run by markingTxManager
+type inUnitOfWork struct{}
+
+// markingTxManager runs units of work without a database transaction, marking
+// their ctx so tests can tell what ran inside one
+type markingTxManager struct {
+	passThroughTxManager
+}
+
+func (markingTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(context.WithValue(ctx, inUnitOfWork{}, true))
+}
+
+// TransactionServiceTestSuite defines the test suite
+type TransactionServiceTestSuite struct {
+	suite.Suite
+	transactionRepo *mockTransactionRepository
+	pointsService   *mockPointsService
+	eventLogger     *mockEventLoggerService
+	customerRepo    *mockMerchantCustomersRepository
+	programRuleRepo *mockProgramRuleRepository
+	programRepo     *mockProgramRepository
+	customerContext *mockCustomerContextProvider
+	service         *TransactionService
+	merchantID      uuid.UUID
+	customerID      uuid.UUID
+	programID       uuid.UUID
+	transactionDate time.Time
+}
+
+// SetupTest is called before each test
+func (s *TransactionServiceTestSuite) SetupTest() {
+	s.transactionRepo = new(mockTransactionRepository)
+	s.pointsService = new(mockPointsService)
+	s.eventLogger = new(mockEventLoggerService)
+	s.customerRepo = new(mockMerchantCustomersRepository)
+	s.programRuleRepo = new(mockProgramRuleRepository)
+	s.programRepo = new(mockProgramRepository)
+	s.customerContext = new(mockCustomerContextProvider)
+	s.service = NewTransactionService(
+		s.transactionRepo,
+		s.pointsService,
+		s.eventLogger,
+		s.customerRepo,
+		s.programRuleRepo,
+		s.programRepo,
+		s.customerContext,
+		passThroughTxManager{},
+	)
+
+	s.merchantID = uuid.New()
+	s.customerID = uuid.New()
+	s.programID = uuid.New()
+	s.transactionDate = time.Now().Add(-time.Hour)
+
+	s.customerRepo.On("GetByID", mock.Anything, s.customerID).Return(&domain.MerchantCustomer{
+		ID:         s.customerID,
+		MerchantID: s.merchantID,
+	}, nil)
+	s.transactionRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.Transaction")).Return(
+		func(tx *domain.Transaction) *domain.Transaction { return tx },
+		nil,
+	)
+	s.eventLogger.On("SaveTransactionEvents", mock.Anything, domain.TransactionCreated, mock.Anything, mock.Anything).Return(nil).Maybe()
+	s.programRuleRepo.On("CreateAwards", mock.Anything, mock.Anything).Return(nil).Maybe()
+}
+
+func (s *TransactionServiceTestSuite) withCustomerContext(transactionCount int, memberSince time.Time) {
+	s.customerContext.On("GetCustomerContext", mock.Anything, s.customerID, s.programID).Return(&domain.CustomerContext{
+		MerchantCustomersID: s.customerID,
+		ProgramID:           s.programID,
+		TransactionCount:    transactionCount,
+		MemberSince:         memberSince,
+	}, nil)
+}
+
+// TestTransactionServiceTestSuite runs the test suite
+func TestTransactionServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(TransactionServiceTestSuite))
+}
+
+func (s *TransactionServiceTestSuite) newRequest(txType string, amount float64) *domain.CreateTransactionRequest {
+	return &domain.CreateTransactionRequest{
+		MerchantCustomersID: s.customerID,
+		ProgramID:           s.programID,
+		TransactionType:     txType,
+		TransactionAmount:   amount,
+		TransactionDate:     s.transactionDate,
+		Category:            "dining",
+		Status:              "completed",
+	}
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_EarnsPointsFromProgramRules() {
+	ctx := context.Background()
+	ruleSetID := uuid.New()
+	rules := []*domain.ProgramRule{
+		{
+			RuleSetID:      ruleSetID,
+			RuleName:       "1 point per unit above 10",
+			ConditionType:  "program_rule_transaction_amount",
+			ConditionValue: "10",
+			Multiplier:     1.0,
+			EffectiveFrom:  s.transactionDate.AddDate(0, 0, -1),
+		},
+		{
+			RuleSetID:      ruleSetID,
+			RuleName:       "Dining bonus",
+			ConditionType:  "program_rule_transaction_category",
+			ConditionValue: "dining",
+			Multiplier:     2.0,
+			PointsAwarded:  25,
+			EffectiveFrom:  s.transactionDate.AddDate(0, 0, -1),
+		},
+	}
+	s.programRuleRepo.On("GetActiveRules", ctx, s.programID, s.transactionDate).Return(rules, nil)
+	s.withCustomerContext(0, s.transactionDate)
+	s.pointsService.On("EarnPoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 150 &&
+			req.CustomerID == s.customerID.String() &&
+			req.ProgramID == s.programID.String() &&
+			req.RuleSetID == ruleSetID.String()
+	})).Return(&domain.PointsTransaction{Points: 150, Type: "earn"}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRequest("purchase", 100))
+
+	s.NoError(err)
+	s.NotNil(tx)
+	s.Equal(s.merchantID, tx.MerchantID)
+	s.Equal("dining", tx.Category)
+	s.Equal("completed", tx.Status)
+	s.pointsService.AssertExpectations(s.T())
+	s.pointsService.AssertNotCalled(s.T(), "RedeemPoints", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_BackdatedPurchaseEarnsAsOfItsDate() {
+	ctx := context.Background()
+	s.transactionDate = time.Date(2023, time.November, 20, 15, 0, 0, 0, time.UTC)
+	rules := []*domain.ProgramRule{
+		{
+			RuleSetID:      uuid.New(),
+			RuleName:       "1 point per unit above 10",
+			ConditionType:  "program_rule_transaction_amount",
+			ConditionValue: "10",
+			Multiplier:     1.0,
+			EffectiveFrom:  s.transactionDate.AddDate(0, 0, -1),
+		},
+	}
+	s.programRuleRepo.On("GetActiveRules", ctx, s.programID, s.transactionDate).Return(rules, nil)
+	s.withCustomerContext(0, s.transactionDate)
+	s.pointsService.On("EarnPoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 100 && req.EarnedAt.Equal(s.transactionDate)
+	})).Return(&domain.PointsTransaction{Points: 100, Type: "earn"}, nil)
+
+	_, err := s.service.Create(ctx, s.newRequest("purchase", 100))
+
+	s.NoError(err)
+	s.pointsService.AssertExpectations(s.T())
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_NoMatchingRulesEarnsNothing() {
+	ctx := context.Background()
+	s.programRuleRepo.On("GetActiveRules", ctx, s.programID, s.transactionDate).Return([]*domain.ProgramRule{
+		{
+			RuleName:       "Travel bonus",
+			ConditionType:  "program_rule_transaction_category",
+			ConditionValue: "travel",
+			Multiplier:     1.0,
+			PointsAwarded:  50,
+			EffectiveFrom:  s.transactionDate.AddDate(0, 0, -1),
+		},
+	}, nil)
+	s.withCustomerContext(0, s.transactionDate)
+
+	tx, err := s.service.Create(ctx, s.newRequest("purchase", 100))
+
+	s.NoError(err)
+	s.NotNil(tx)
+	s.pointsService.AssertNotCalled(s.T(), "EarnPoints", mock.Anything, mock.Anything)
+	s.pointsService.AssertNotCalled(s.T(), "RedeemPoints", mock.Anything, mock.Anything)
+}
+
+// withPurchase makes a purchase of amount that earned points refundable, with
+// refunded of it already refunded.
+func (s *TransactionServiceTestSuite) withPurchase(amount float64, earned int, refunded float64, refundPolicy string) uuid.UUID {
+	purchaseID := uuid.New()
+	s.programRepo.On("GetByID", mock.Anything, s.programID).Return(&domain.Program{
+		ID:           s.programID,
+		RefundPolicy: refundPolicy,
+	}, nil)
+	s.transactionRepo.On("LockByID", mock.Anything, purchaseID).Return(&domain.Transaction{
+		TransactionID:       purchaseID,
+		MerchantCustomersID: s.customerID,
+		ProgramID:           s.programID,
+		TransactionType:     "purchase",
+		TransactionAmount:   amount,
+		Status:              "completed",
+	}, nil)
+	s.transactionRepo.On("SumRefunds", mock.Anything, purchaseID).Return(refunded, nil)
+	s.pointsService.On("GetTransactionPoints", mock.Anything, purchaseID).Return(earned, 0, nil)
+	return purchaseID
+}
+
+func (s *TransactionServiceTestSuite) newRefund(amount float64, purchaseID uuid.UUID) *domain.CreateTransactionRequest {
+	req := s.newRequest("refund", amount)
+	req.OriginalTransactionID = &purchaseID
+	return req
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_RefundReversesPointsProRata() {
+	ctx := context.Background()
+	purchaseID := s.withPurchase(100, 150, 0, domain.RefundPolicyBlock)
+	s.pointsService.On("ReversePoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 60 && req.CustomerID == s.customerID.String()
+	}), domain.RefundPolicyBlock).Return(&domain.PointsTransaction{Points: 60, Type: "reverse"}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRefund(40, purchaseID))
+
+	s.NoError(err)
+	s.NotNil(tx)
+	s.Equal(purchaseID, *tx.OriginalTransactionID)
+	s.programRuleRepo.AssertNotCalled(s.T(), "GetActiveRules", mock.Anything, mock.Anything, mock.Anything)
+	s.pointsService.AssertNotCalled(s.T(), "RedeemPoints", mock.Anything, mock.Anything)
+	s.eventLogger.AssertCalled(s.T(), "SaveTransactionEvents", ctx, domain.TransactionCreated, tx, -60)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_LastPartialRefundTakesBackTheRest() {
+	ctx := context.Background()
+	// Two thirds were refunded earlier and took back 67 of the 101 points
+	purchaseID := s.withPurchase(100, 101, 66.67, domain.RefundPolicyBlock)
+	s.pointsService.On("ReversePoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 34
+	}), domain.RefundPolicyBlock).Return(&domain.PointsTransaction{Points: 34, Type: "reverse"}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRefund(33.33, purchaseID))
+
+	s.NoError(err)
+	s.NotNil(tx)
+	s.pointsService.AssertExpectations(s.T())
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_RefundReportsPointsActuallyClawedBack() {
+	ctx := context.Background()
+	purchaseID := s.withPurchase(100, 150, 0, domain.RefundPolicyClawBack)
+	s.pointsService.On("ReversePoints", ctx, mock.Anything, domain.RefundPolicyClawBack).
+		Return(&domain.PointsTransaction{Points: 10, Type: "reverse"}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRefund(100, purchaseID))
+
+	s.NoError(err)
+	s.eventLogger.AssertCalled(s.T(), "SaveTransactionEvents", ctx, domain.TransactionCreated, tx, -10)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_RefundExceedingOriginalIsRejected() {
+	ctx := context.Background()
+	purchaseID := s.withPurchase(100, 150, 80, domain.RefundPolicyBlock)
+
+	tx, err := s.service.Create(ctx, s.newRefund(20.01, purchaseID))
+
+	s.Nil(tx)
+	s.True(domain.IsBusinessLogicError(err))
+	s.Equal("REFUND_EXCEEDS_ORIGINAL", err.(domain.BusinessLogicError).Code)
+	s.transactionRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+	s.pointsService.AssertNotCalled(s.T(), "ReversePoints", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_RefundRequiresOriginalTransaction() {
+	ctx := context.Background()
+
+	tx, err := s.service.Create(ctx, s.newRequest("refund", 40))
+
+	s.Nil(tx)
+	s.True(domain.IsValidationError(err))
+	s.transactionRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_RefundOfAnotherCustomersPurchase() {
+	ctx := context.Background()
+	purchaseID := uuid.New()
+	s.programRepo.On("GetByID", ctx, s.programID).Return(&domain.Program{ID: s.programID}, nil)
+	s.transactionRepo.On("LockByID", ctx, purchaseID).Return(&domain.Transaction{
+		TransactionID:       purchaseID,
+		MerchantCustomersID: uuid.New(),
+		ProgramID:           s.programID,
+		TransactionType:     "purchase",
+		TransactionAmount:   100,
+		Status:              "completed",
+	}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRefund(40, purchaseID))
+
+	s.Nil(tx)
+	s.True(domain.IsValidationError(err))
+	s.transactionRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_RefundOfRedemptionGivesPointsBack() {
+	ctx := context.Background()
+	redemptionID := uuid.New()
+	s.programRepo.On("GetByID", ctx, s.programID).Return(&domain.Program{ID: s.programID}, nil)
+	s.transactionRepo.On("LockByID", ctx, redemptionID).Return(&domain.Transaction{
+		TransactionID:       redemptionID,
+		MerchantCustomersID: s.customerID,
+		ProgramID:           s.programID,
+		TransactionType:     "redemption",
+		TransactionAmount:   250,
+		Status:              "completed",
+	}, nil)
+	s.transactionRepo.On("SumRefunds", ctx, redemptionID).Return(0.0, nil)
+	s.pointsService.On("EarnPoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 250 && req.CustomerID == s.customerID.String()
+	})).Return(&domain.PointsTransaction{Points: 250}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRefund(250, redemptionID))
+
+	s.NoError(err)
+	s.NotNil(tx)
+	s.pointsService.AssertNotCalled(s.T(), "ReversePoints", mock.Anything, mock.Anything, mock.Anything)
+	s.eventLogger.AssertCalled(s.T(), "SaveTransactionEvents", ctx, domain.TransactionCreated, tx, 250)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_SecondRefundOfRedemptionIsRejected() {
+	ctx := context.Background()
+	redemptionID := uuid.New()
+	s.programRepo.On("GetByID", ctx, s.programID).Return(&domain.Program{ID: s.programID}, nil)
+	s.transactionRepo.On("LockByID", ctx, redemptionID).Return(&domain.Transaction{
+		TransactionID:       redemptionID,
+		MerchantCustomersID: s.customerID,
+		ProgramID:           s.programID,
+		TransactionType:     "redemption",
+		TransactionAmount:   250,
+		Status:              "completed",
+	}, nil)
+	s.transactionRepo.On("SumRefunds", ctx, redemptionID).Return(250.0, nil)
+
+	tx, err := s.service.Create(ctx, s.newRefund(250, redemptionID))
+
+	s.Nil(tx)
+	s.Equal("REFUND_EXCEEDS_ORIGINAL", err.(domain.BusinessLogicError).Code)
+	s.pointsService.AssertNotCalled(s.T(), "EarnPoints", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_RefundOfPendingPurchase() {
+	ctx := context.Background()
+	purchaseID := uuid.New()
+	s.programRepo.On("GetByID", ctx, s.programID).Return(&domain.Program{ID: s.programID}, nil)
+	s.transactionRepo.On("LockByID", ctx, purchaseID).Return(&domain.Transaction{
+		TransactionID:       purchaseID,
+		MerchantCustomersID: s.customerID,
+		ProgramID:           s.programID,
+		TransactionType:     "purchase",
+		TransactionAmount:   100,
+		Status:              "pending",
+	}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRefund(40, purchaseID))
+
+	s.Nil(tx)
+	s.True(domain.IsBusinessLogicError(err))
+	s.Equal("TRANSACTION_NOT_COMPLETED", err.(domain.BusinessLogicError).Code)
+	s.transactionRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) withEarningRule(ruleSetID uuid.UUID) {
+	s.programRuleRepo.On("GetActiveRules", mock.Anything, s.programID, s.transactionDate).Return([]*domain.ProgramRule{
+		{
+			ID:             uuid.New(),
+			RuleSetID:      ruleSetID,
+			RuleName:       "1 point per unit",
+			ConditionType:  "program_rule_transaction_amount",
+			ConditionValue: "0",
+			Multiplier:     1.0,
+			EffectiveFrom:  s.transactionDate.AddDate(0, 0, -1),
+		},
+	}, nil)
+	s.withCustomerContext(0, s.transactionDate)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_PendingPurchaseHoldsPoints() {
+	ctx := context.Background()
+	ruleSetID := uuid.New()
+	s.withEarningRule(ruleSetID)
+	s.pointsService.On("HoldPoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 100 && req.RuleSetID == ruleSetID.String()
+	})).Return(&domain.PointsHold{Points: 100, Status: domain.PointsHoldHeld}, nil)
+
+	req := s.newRequest("purchase", 100)
+	req.Status = "pending"
+	tx, err := s.service.Create(ctx, req)
+
+	s.NoError(err)
+	s.Equal("pending", tx.Status)
+	s.pointsService.AssertExpectations(s.T())
+	s.pointsService.AssertNotCalled(s.T(), "EarnPoints", mock.Anything, mock.Anything)
+	// The awards count towards caps while the order settles
+	s.programRuleRepo.AssertCalled(s.T(), "CreateAwards", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_FailedPurchaseMovesNoPoints() {
+	ctx := context.Background()
+	s.withEarningRule(uuid.New())
+
+	req := s.newRequest("purchase", 100)
+	req.Status = "failed"
+	tx, err := s.service.Create(ctx, req)
+
+	s.NoError(err)
+	s.Equal("failed", tx.Status)
+	s.pointsService.AssertNotCalled(s.T(), "EarnPoints", mock.Anything, mock.Anything)
+	s.pointsService.AssertNotCalled(s.T(), "HoldPoints", mock.Anything, mock.Anything)
+	s.programRuleRepo.AssertNotCalled(s.T(), "CreateAwards", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_PointsFailureFailsTheTransaction() {
+	ctx := context.Background()
+	purchaseID := s.withPurchase(100, 150, 0, domain.RefundPolicyBlock)
+	s.pointsService.On("ReversePoints", ctx, mock.Anything, domain.RefundPolicyBlock).
+		Return(nil, domain.NewBusinessLogicError("INSUFFICIENT_POINTS", "insufficient points"))
+
+	tx, err := s.service.Create(ctx, s.newRefund(40, purchaseID))
+
+	s.Error(err)
+	s.Nil(tx)
+	s.True(domain.IsBusinessLogicError(err))
+	s.eventLogger.AssertNotCalled(s.T(), "SaveTransactionEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_EventFailureFailsTheTransaction() {
+	ctx := context.Background()
+	eventLogger := new(mockEventLoggerService)
+	eventLogger.On("SaveTransactionEvents", ctx, domain.TransactionCreated, mock.Anything, -60).Return(errors.New("db down"))
+	s.service.eventLoggerService = eventLogger
+	purchaseID := s.withPurchase(100, 150, 0, domain.RefundPolicyBlock)
+	s.pointsService.On("ReversePoints", ctx, mock.Anything, domain.RefundPolicyBlock).Return(&domain.PointsTransaction{Points: 60, Type: "reverse"}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRefund(40, purchaseID))
+
+	s.Error(err)
+	s.Nil(tx)
+	s.True(domain.IsSystemError(err))
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_RuleLookupFailure() {
+	ctx := context.Background()
+	s.programRuleRepo.On("GetActiveRules", ctx, s.programID, s.transactionDate).Return(nil, errors.New("db down"))
+
+	tx, err := s.service.Create(ctx, s.newRequest("purchase", 100))
+
+	s.Error(err)
+	s.Nil(tx)
+	s.True(domain.IsSystemError(err))
+	s.transactionRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_CountAndTenureRulesUseCustomerContext() {
+	ctx := context.Background()
+	s.programRuleRepo.On("GetActiveRules", ctx, s.programID, s.transactionDate).Return([]*domain.ProgramRule{
+		{
+			RuleName:       "Fifth visit bonus",
+			ConditionType:  "program_rule_transaction_count",
+			ConditionValue: "4",
+			Multiplier:     1.0,
+			PointsAwarded:  20,
+			EffectiveFrom:  s.transactionDate.AddDate(0, 0, -1),
+		},
+		{
+			RuleName:       "Loyal member bonus",
+			ConditionType:  "program_rule_tenure",
+			ConditionValue: "365",
+			Multiplier:     1.0,
+			PointsAwarded:  30,
+			EffectiveFrom:  s.transactionDate.AddDate(0, 0, -1),
+		},
+	}, nil)
+	// Four earlier completed transactions, so this one is the fifth
+	s.withCustomerContext(4, s.transactionDate.AddDate(-2, 0, 0))
+	s.pointsService.On("EarnPoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 50
+	})).Return(&domain.PointsTransaction{Points: 50, Type: "earn"}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRequest("purchase", 100))
+
+	s.NoError(err)
+	s.NotNil(tx)
+	s.pointsService.AssertExpectations(s.T())
+	s.eventLogger.AssertCalled(s.T(), "SaveTransactionEvents", ctx, domain.TransactionCreated, tx, 50)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_CustomerContextFailure() {
+	ctx := context.Background()
+	s.programRuleRepo.On("GetActiveRules", ctx, s.programID, s.transactionDate).Return([]*domain.ProgramRule{}, nil)
+	s.customerContext.On("GetCustomerContext", ctx, s.customerID, s.programID).Return(nil, errors.New("redis down"))
+
+	tx, err := s.service.Create(ctx, s.newRequest("purchase", 100))
+
+	s.Error(err)
+	s.Nil(tx)
+	s.True(domain.IsSystemError(err))
+	s.transactionRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestUpdateStatus_PublishesStatusEvent() {
+	ctx := context.Background()
+	txID := uuid.New()
+	s.transactionRepo.On("LockByID", ctx, txID).Return(&domain.Transaction{
+		TransactionID:       txID,
+		MerchantCustomersID: s.customerID,
+		ProgramID:           s.programID,
+		Status:              "pending",
+	}, nil)
+	s.pointsService.On("ReleaseHold", ctx, txID).Return(nil, nil)
+	s.transactionRepo.On("UpdateStatus", ctx, txID, "completed").Return(nil)
+	s.eventLogger.On("SaveTransactionStatusEvents", ctx, mock.MatchedBy(func(tx *domain.Transaction) bool {
+		return tx.TransactionID == txID && tx.Status == "completed"
+	}), "pending").Return(nil)
+
+	err := s.service.UpdateStatus(ctx, txID.String(), "completed")
+
+	s.NoError(err)
+	s.eventLogger.AssertExpectations(s.T())
+}
+
+func (s *TransactionServiceTestSuite) TestUpdateStatus_CompletingReleasesTheHold() {
+	ctx := context.Background()
+	txID := uuid.New()
+	s.transactionRepo.On("LockByID", ctx, txID).Return(&domain.Transaction{
+		TransactionID:   txID,
+		TransactionType: "purchase",
+		Status:          "pending",
+	}, nil)
+	s.pointsService.On("ReleaseHold", ctx, txID).Return(&domain.PointsHold{
+		TransactionID: txID,
+		Points:        150,
+		Status:        domain.PointsHoldReleased,
+	}, nil)
+	s.transactionRepo.On("UpdateStatus", ctx, txID, "completed").Return(nil)
+	s.eventLogger.On("SaveTransactionStatusEvents", ctx, mock.Anything, "pending").Return(nil)
+
+	err := s.service.UpdateStatus(ctx, txID.String(), "completed")
+
+	s.NoError(err)
+	s.pointsService.AssertExpectations(s.T())
+	s.pointsService.AssertNotCalled(s.T(), "VoidHold", mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestUpdateStatus_FailingVoidsTheHold() {
+	ctx := context.Background()
+	txID := uuid.New()
+	s.transactionRepo.On("LockByID", ctx, txID).Return(&domain.Transaction{
+		TransactionID:   txID,
+		TransactionType: "purchase",
+		Status:          "pending",
+	}, nil)
+	s.pointsService.On("VoidHold", ctx, txID).Return(&domain.PointsHold{
+		TransactionID: txID,
+		Points:        150,
+		Status:        domain.PointsHoldVoided,
+	}, nil)
+	// Held points were never earned, there is nothing to reverse
+	s.pointsService.On("GetTransactionPoints", ctx, txID).Return(0, 0, nil)
+	s.transactionRepo.On("UpdateStatus", ctx, txID, "failed").Return(nil)
+	s.eventLogger.On("SaveTransactionStatusEvents", ctx, mock.Anything, "pending").Return(nil)
+
+	err := s.service.UpdateStatus(ctx, txID.String(), "failed")
+
+	s.NoError(err)
+	s.pointsService.AssertExpectations(s.T())
+	s.pointsService.AssertNotCalled(s.T(), "ReleaseHold", mock.Anything, mock.Anything)
+	s.pointsService.AssertNotCalled(s.T(), "ReversePoints", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestUpdateStatus_CancelReversesPointsNotYetRefunded() {
+	ctx := context.Background()
+	purchaseID := s.withPurchase(100, 150, 40, domain.RefundPolicyAllowNegative)
+	s.pointsService.On("VoidHold", ctx, purchaseID).Return(nil, nil)
+	s.pointsService.On("ReversePoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 90 && req.TransactionID == purchaseID.String()
+	}), domain.RefundPolicyAllowNegative).Return(&domain.PointsTransaction{Points: 90, Type: "reverse"}, nil)
+	s.transactionRepo.On("UpdateStatus", ctx, purchaseID, "cancelled").Return(nil)
+	s.eventLogger.On("SaveTransactionStatusEvents", ctx, mock.Anything, "completed").Return(nil)
+
+	err := s.service.UpdateStatus(ctx, purchaseID.String(), "cancelled")
+
+	s.NoError(err)
+	s.pointsService.AssertExpectations(s.T())
+	s.transactionRepo.AssertCalled(s.T(), "UpdateStatus", ctx, purchaseID, "cancelled")
+}
+
+func (s *TransactionServiceTestSuite) TestUpdateStatus_CancelRefundGivesPointsBack() {
+	ctx := context.Background()
+	refundID := uuid.New()
+	s.transactionRepo.On("LockByID", ctx, refundID).Return(&domain.Transaction{
+		TransactionID:       refundID,
+		MerchantCustomersID: s.customerID,
+		ProgramID:           s.programID,
+		TransactionType:     "refund",
+		TransactionAmount:   40,
+		Status:              "completed",
+	}, nil)
+	s.pointsService.On("VoidHold", ctx, refundID).Return(nil, nil)
+	s.pointsService.On("GetTransactionPoints", ctx, refundID).Return(0, 60, nil)
+	s.pointsService.On("EarnPoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 60 && req.TransactionID == refundID.String()
+	})).Return(&domain.PointsTransaction{Points: 60, Type: "earn"}, nil)
+	s.transactionRepo.On("UpdateStatus", ctx, refundID, "cancelled").Return(nil)
+	s.eventLogger.On("SaveTransactionStatusEvents", ctx, mock.Anything, "completed").Return(nil)
+
+	err := s.service.UpdateStatus(ctx, refundID.String(), "cancelled")
+
+	s.NoError(err)
+	s.pointsService.AssertExpectations(s.T())
+	s.pointsService.AssertNotCalled(s.T(), "ReversePoints", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestUpdateStatus_InvalidTransitions() {
+	for _, tc := range []struct{ from, to string }{
+		{"cancelled", "completed"},
+		{"failed", "pending"},
+		{"completed", "pending"},
+		{"completed", "failed"},
+		{"pending", "pending"},
+	} {
+		s.Run(tc.from+" to "+tc.to, func() {
+			s.SetupTest()
+			ctx := context.Background()
+			txID := uuid.New()
+			s.transactionRepo.On("LockByID", ctx, txID).Return(&domain.Transaction{
+				TransactionID: txID,
+				Status:        tc.from,
+			}, nil)
+
+			err := s.service.UpdateStatus(ctx, txID.String(), tc.to)
+
+			s.True(domain.IsBusinessLogicError(err))
+			s.Equal("INVALID_STATUS_TRANSITION", err.(domain.BusinessLogicError).Code)
+			s.transactionRepo.AssertNotCalled(s.T(), "UpdateStatus", mock.Anything, mock.Anything, mock.Anything)
+			s.pointsService.AssertNotCalled(s.T(), "ReleaseHold", mock.Anything, mock.Anything)
+			s.pointsService.AssertNotCalled(s.T(), "VoidHold", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func (s *TransactionServiceTestSuite) TestUpdateStatus_TransactionNotFound() {
+	ctx := context.Background()
+	txID := uuid.New()
+	s.transactionRepo.On("LockByID", ctx, txID).Return(nil, nil)
+
+	err := s.service.UpdateStatus(ctx, txID.String(), "cancelled")
+
+	s.True(domain.IsResourceNotFoundError(err))
+	s.transactionRepo.AssertNotCalled(s.T(), "UpdateStatus", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_CustomerCapLimitsAndRecordsAwards() {
+	ctx := context.Background()
+	capped := 100
+	rule := &domain.ProgramRule{
+		ID:                            uuid.New(),
+		RuleName:                      "3x, at most 100 a week",
+		ConditionType:                 "program_rule_transaction_amount",
+		ConditionValue:                "0",
+		Multiplier:                    3.0,
+		MaxPointsPerCustomerPerPeriod: &capped,
+		CapPeriod:                     domain.CapPeriodWeek,
+		EffectiveFrom:                 s.transactionDate.AddDate(0, 0, -1),
+	}
+	from, to := capPeriodBounds(domain.CapPeriodWeek, s.transactionDate, time.UTC)
+	s.programRuleRepo.On("GetActiveRules", ctx, s.programID, s.transactionDate).Return([]*domain.ProgramRule{rule}, nil)
+	s.programRuleRepo.On("SumAwardedPoints", ctx, rule.ID, s.customerID, from, to).Return(80, nil)
+	s.withCustomerContext(0, s.transactionDate)
+	s.pointsService.On("EarnPoints", ctx, mock.MatchedBy(func(req *domain.PointsTransaction) bool {
+		return req.Points == 20
+	})).Return(&domain.PointsTransaction{Points: 20, Type: "earn"}, nil)
+
+	tx, err := s.service.Create(ctx, s.newRequest("purchase", 100))
+
+	s.NoError(err)
+	s.NotNil(tx)
+	s.pointsService.AssertExpectations(s.T())
+	s.programRuleRepo.AssertCalled(s.T(), "CreateAwards", ctx, mock.MatchedBy(func(awards []*domain.ProgramRuleAward) bool {
+		return len(awards) == 1 &&
+			awards[0].RuleID == rule.ID &&
+			awards[0].Points == 20 &&
+			awards[0].TransactionID == tx.TransactionID
+	}))
+}
+
+func (s *TransactionServiceTestSuite) TestCreate_CapIsCheckedInTheUnitOfWork() {
+	ctx := context.Background()
+	s.service.txManager = markingTxManager{}
+	capped := 100
+	rule := &domain.ProgramRule{
+		ID:                            uuid.New(),
+		RuleName:                      "3x, at most 100 a week",
+		ConditionType:                 "program_rule_transaction_amount",
+		ConditionValue:                "0",
+		Multiplier:                    3.0,
+		MaxPointsPerCustomerPerPeriod: &capped,
+		CapPeriod:                     domain.CapPeriodWeek,
+		EffectiveFrom:                 s.transactionDate.AddDate(0, 0, -1),
+	}
+	inUnitOfWork := mock.MatchedBy(func(ctx context.Context) bool { return ctx.Value(inUnitOfWork{}) != nil })
+	s.programRuleRepo.On("GetActiveRules", mock.Anything, s.programID, s.transactionDate).Return([]*domain.ProgramRule{rule}, nil)
+	s.customerContext.On("GetCustomerContext", mock.Anything, s.customerID, s.programID).Return(&domain.CustomerContext{
+		MerchantCustomersID: s.customerID,
+		ProgramID:           s.programID,
+		MemberSince:         s.transactionDate,
+	}, nil)
+	// The sum and the awards it caps are in the same unit of work
+	s.programRuleRepo.On("SumAwardedPoints", inUnitOfWork, rule.ID, s.customerID, mock.Anything, mock.Anything).Return(80, nil)
+	s.pointsService.On("EarnPoints", mock.Anything, mock.Anything).Return(&domain.PointsTransaction{Points: 20, Type: "earn"}, nil)
+
+	_, err := s.service.Create(ctx, s.newRequest("purchase", 100))
+
+	s.NoError(err)
+	s.programRuleRepo.AssertCalled(s.T(), "SumAwardedPoints", inUnitOfWork, rule.ID, s.customerID, mock.Anything, mock.Anything)
+	s.programRuleRepo.AssertCalled(s.T(), "CreateAwards", inUnitOfWork, mock.Anything)
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// voucherCodeAlphabet leaves out 0, O, 1 and I, which are easily mistaken
+// when a code is read out or typed in at the till
+const voucherCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const (
+	voucherCodeLength   = 12 // 60 random bits, shown as XXXX-XXXX-XXXX
+	voucherCodeAttempts = 5
+)
+
+// VoucherService hands out the vouchers customers get for their redemptions
+// and verifies them when a branch scans them.
+type VoucherService struct {
+	voucherRepo        domain.VoucherRepository
+	redemptionRepo     domain.RedemptionRepository
+	rewardsRepo        domain.RewardsRepository
+	eventLoggerService domain.EventLoggerService
+	txManager          domain.TxManager
+	logger             zerolog.Logger
+}
+
+func NewVoucherService(
+	voucherRepo domain.VoucherRepository,
+	redemptionRepo domain.RedemptionRepository,
+	rewardsRepo domain.RewardsRepository,
+	eventLoggerService domain.EventLoggerService,
+	txManager domain.TxManager,
+) *VoucherService {
+	return &VoucherService{
+		voucherRepo:        voucherRepo,
+		redemptionRepo:     redemptionRepo,
+		rewardsRepo:        rewardsRepo,
+		eventLoggerService: eventLoggerService,
+		txManager:          txManager,
+		logger:             logging.GetLogger(),
+	}
+}
+
+// Issue gives a redemption its voucher, with a code generated for it or taken
+// from the reward's pool.
+func (s *VoucherService) Issue(ctx context.Context, redemption *domain.Redemption, reward *domain.Reward) (*domain.Voucher, error) {
+	voucher := &domain.Voucher{
+		RedemptionID: redemption.ID,
+		RewardID:     reward.ID,
+		Source:       domain.VoucherSourceGenerated,
+		Status:       domain.VoucherIssued,
+	}
+	if reward.VoucherValidityDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *reward.VoucherValidityDays)
+		voucher.ExpiresAt = &expiresAt
+	}
+
+	if reward.VoucherSource == domain.VoucherSourcePool {
+		code, err := s.voucherRepo.ClaimCode(ctx, reward.ID, redemption.ID)
+		if err != nil {
+			return nil, err
+		}
+		if code == nil {
+			s.logger.Warn().
+				Str("reward_id", reward.ID.String()).
+				Msg("Reward has no voucher codes left")
+			return nil, domain.NewBusinessLogicError("REWARD_OUT_OF_STOCK", "no voucher codes left for this reward")
+		}
+		voucher.Source = domain.VoucherSourcePool
+		voucher.Code = code.Code
+		if code.ExpiresAt != nil {
+			voucher.ExpiresAt = code.ExpiresAt
+		}
+
+		created, err := s.voucherRepo.Create(ctx, voucher)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			return nil, domain.NewResourceConflictError("voucher", "voucher code is already in use")
+		}
+		return voucher, nil
+	}
+
+	for range voucherCodeAttempts {
+		code, err := generateVoucherCode()
+		if err != nil {
+			return nil, domain.NewSystemError("VoucherService.Issue", err, "failed to generate voucher code")
+		}
+		voucher.Code = code
+
+		created, err := s.voucherRepo.Create(ctx, voucher)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			return voucher, nil
+		}
+	}
+	return nil, domain.NewSystemError("VoucherService.Issue", errors.New("every generated code was taken"), "failed to generate voucher code")
+}
+
+// Void makes an unused voucher of a redemption invalid. Pool codes are not
+// handed out again, the customer has already seen them.
+func (s *VoucherService) Void(ctx context.Context, redemptionID uuid.UUID) error {
+	return s.voucherRepo.Void(ctx, redemptionID)
+}
+
+func (s *VoucherService) GetByRedemptionID(ctx context.Context, redemptionID uuid.UUID) (*domain.Voucher, error) {
+	return s.voucherRepo.GetByRedemptionID(ctx, redemptionID)
+}
+
+// Verify uses a voucher a branch scanned and fulfills its pending or approved
+// redemption. A voucher is used once, a second scan is rejected.
+func (s *VoucherService) Verify(ctx context.Context, req *domain.VerifyVoucherRequest) (*domain.Redemption, error) {
+	code := strings.TrimSpace(req.Code)
+
+	var redemption *domain.Redemption
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Locking the voucher makes a second scan wait for this one
+		voucher, err := s.voucherRepo.LockByCode(ctx, req.MerchantID, code)
+		if err != nil {
+			return err
+		}
+		if voucher == nil {
+			return domain.NewResourceNotFoundError("voucher", code, "voucher not found")
+		}
+
+		switch {
+		case voucher.Status == domain.VoucherUsed:
+			s.logger.Warn().
+				Str("voucher_id", voucher.ID.String()).
+				Msg("Voucher has already been used")
+			return domain.NewBusinessLogicError("VOUCHER_ALREADY_USED", "voucher has already been used")
+		case voucher.Status == domain.VoucherVoid:
+			return domain.NewBusinessLogicError("VOUCHER_VOID", "voucher is no longer valid")
+		case voucher.ExpiresAt != nil && !time.Now().Before(*voucher.ExpiresAt):
+			return domain.NewBusinessLogicError("VOUCHER_EXPIRED", "voucher has expired")
+		}
+
+		redemption, err = s.redemptionRepo.LockByID(ctx, voucher.RedemptionID)
+		if err != nil {
+			return err
+		}
+		if redemption == nil {
+			return domain.NewResourceNotFoundError("redemption", voucher.RedemptionID.String(), "redemption not found")
+		}
+		switch {
+		case redemption.Status == domain.RedemptionStatusFulfilled:
+			return domain.NewBusinessLogicError("VOUCHER_ALREADY_USED", "reward has already been handed out")
+		case !domain.CanTransitionRedemption(redemption.Status, domain.RedemptionStatusFulfilled):
+			return domain.NewBusinessLogicError("VOUCHER_VOID", "voucher is no longer valid")
+		}
+
+		voucher.UsedBranchID = req.BranchID
+		if err := s.voucherRepo.MarkUsed(ctx, voucher); err != nil {
+			return err
+		}
+		redemption.Voucher = voucher
+
+		reward, err := s.rewardsRepo.GetByID(ctx, redemption.RewardID)
+		if err != nil {
+			return err
+		}
+		oldStatus := redemption.Status
+		redemption.Status = domain.RedemptionStatusFulfilled
+		if err := s.redemptionRepo.Update(ctx, redemption); err != nil {
+			return err
+		}
+		if err := s.redemptionRepo.RecordStatusChange(ctx, &domain.RedemptionStatusChange{
+			RedemptionID: redemption.ID,
+			FromStatus:   &oldStatus,
+			ToStatus:     redemption.Status,
+			Reason:       "voucher verified",
+			ChangedBy:    req.ChangedBy,
+		}); err != nil {
+			return err
+		}
+		return s.eventLoggerService.SaveRedemptionStatusEvents(ctx, redemption, reward, oldStatus)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("redemption_id", redemption.ID.String()).
+		Str("voucher_id", redemption.Voucher.ID.String()).
+		Msg("Voucher verified")
+	return redemption, nil
+}
+
+// AddCodes uploads codes to the pool of a reward that hands out pool codes.
+func (s *VoucherService) AddCodes(ctx context.Context, rewardID string, req *domain.AddRewardCodesRequest) (*domain.AddRewardCodesResponse, error) {
+	id, err := uuid.Parse(rewardID)
+	if err != nil {
+		return nil, domain.NewValidationError("id", "invalid reward ID format")
+	}
+	reward, err := s.rewardsRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if reward.VoucherSource != domain.VoucherSourcePool {
+		return nil, domain.NewBusinessLogicError("REWARD_NOT_POOLED", "reward does not hand out pool codes")
+	}
+
+	seen := make(map[string]bool, len(req.Codes))
+	codes := make([]string, 0, len(req.Codes))
+	for _, code := range req.Codes {
+		code = strings.TrimSpace(code)
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		codes = append(codes, code)
+	}
+
+	added, err := s.voucherRepo.AddCodes(ctx, id, codes, req.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	available, err := s.voucherRepo.CountAvailableCodes(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("reward_id", rewardID).
+		Int("added", added).
+		Msg("Reward codes added")
+	return &domain.AddRewardCodesResponse{
+		Added:      added,
+		Duplicates: len(req.Codes) - added,
+		Available:  available,
+	}, nil
+}
+
+func generateVoucherCode() (string, error) {
+	var code strings.Builder
+	for i := range voucherCodeLength {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(voucherCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(voucherCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+	"go-playground/server/mocks/repository/postgres"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type mockVoucherRepository struct {
+	mock.Mock
+}
+
+func (m *mockVoucherRepository) Create(ctx context.Context, voucher *domain.Voucher) (bool, error) {
+	args := m.Called(ctx, voucher)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockVoucherRepository) GetByRedemptionID(ctx context.Context, redemptionID uuid.UUID) (*domain.Voucher, error) {
+	args := m.Called(ctx, redemptionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Voucher), args.Error(1)
+}
+
+func (m *mockVoucherRepository) LockByCode(ctx context.Context, merchantID uuid.UUID, code string) (*domain.Voucher, error) {
+	args := m.Called(ctx, merchantID, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Voucher), args.Error(1)
+}
+
+func (m *mockVoucherRepository) MarkUsed(ctx context.Context, voucher *domain.Voucher) error {
+	args := m.Called(ctx, voucher)
+	return args.Error(0)
+}
+
+func (m *mockVoucherRepository) Void(ctx context.Context, redemptionID uuid.UUID) error {
+	args := m.Called(ctx, redemptionID)
+	return args.Error(0)
+}
+
+func (m *mockVoucherRepository) ClaimCode(ctx context.Context, rewardID, redemptionID uuid.UUID) (*domain.RewardCode, error) {
+	args := m.Called(ctx, rewardID, redemptionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RewardCode), args.Error(1)
+}
+
+func (m *mockVoucherRepository) AddCodes(ctx context.Context, rewardID uuid.UUID, codes []string, expiresAt *time.Time) (int, error) {
+	args := m.Called(ctx, rewardID, codes, expiresAt)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockVoucherRepository) CountAvailableCodes(ctx context.Context, rewardID uuid.UUID) (int, error) {
+	args := m.Called(ctx, rewardID)
+	return args.Int(0), args.Error(1)
+}
+
+type VoucherServiceTestSuite struct {
+	suite.Suite
+	voucherRepo    *mockVoucherRepository
+	redemptionRepo *postgres.MockRedemptionRepository
+	rewardsRepo    *postgres.MockRewardsRepository
+	eventLogger    *mockEventLoggerService
+	service        *VoucherService
+	merchantID     uuid.UUID
+	reward         *domain.Reward
+	redemption     *domain.Redemption
+}
+
+func (s *VoucherServiceTestSuite) SetupTest() {
+	s.voucherRepo = new(mockVoucherRepository)
+	s.redemptionRepo = new(postgres.MockRedemptionRepository)
+	s.rewardsRepo = new(postgres.MockRewardsRepository)
+	s.eventLogger = new(mockEventLoggerService)
+	s.service = NewVoucherService(
+		s.voucherRepo,
+		s.redemptionRepo,
+		s.rewardsRepo,
+		s.eventLogger,
+		passThroughTxManager{},
+	)
+
+	s.merchantID = uuid.New()
+	s.reward = &domain.Reward{
+		ID:            uuid.New(),
+		ProgramID:     uuid.New(),
+		Name:          "Free coffee",
+		VoucherSource: domain.VoucherSourceGenerated,
+		IsActive:      true,
+	}
+	s.redemption = &domain.Redemption{
+		ID:                  uuid.New(),
+		MerchantCustomersID: uuid.New(),
+		RewardID:            s.reward.ID,
+		Status:              domain.RedemptionStatusPending,
+	}
+	s.rewardsRepo.On("GetByID", mock.Anything, s.reward.ID).Return(s.reward, nil)
+	s.redemptionRepo.On("LockByID", mock.Anything, s.redemption.ID).Return(s.redemption, nil)
+}
+
+func TestVoucherServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(VoucherServiceTestSuite))
+}
+
+// scanned stores an issued voucher of the suite's redemption under code.
+func (s *VoucherServiceTestSuite) scanned(code string) *domain.Voucher {
+	voucher := &domain.Voucher{
+		ID:           uuid.New(),
+		RedemptionID: s.redemption.ID,
+		RewardID:     s.reward.ID,
+		MerchantID:   s.merchantID,
+		Code:         code,
+		Status:       domain.VoucherIssued,
+	}
+	s.voucherRepo.On("LockByCode", mock.Anything, s.merchantID, code).Return(voucher, nil)
+	return voucher
+}
+
+func (s *VoucherServiceTestSuite) TestIssue_GeneratesCode() {
+	s.reward.VoucherValidityDays = intPtr(30)
+	s.voucherRepo.On("Create", mock.Anything, mock.Anything).Return(true, nil)
+
+	voucher, err := s.service.Issue(context.Background(), s.redemption, s.reward)
+
+	s.Require().NoError(err)
+	s.Regexp(regexp.MustCompile(`^[A-HJ-NP-Z2-9]{4}-[A-HJ-NP-Z2-9]{4}-[A-HJ-NP-Z2-9]{4}$`), voucher.Code)
+	s.Equal(domain.VoucherSourceGenerated, voucher.Source)
+	s.Require().NotNil(voucher.ExpiresAt)
+	s.WithinDuration(time.Now().AddDate(0, 0, 30), *voucher.ExpiresAt, time.Minute)
+}
+
+func (s *VoucherServiceTestSuite) TestIssue_RetriesTakenCode() {
+	s.voucherRepo.On("Create", mock.Anything, mock.Anything).Return(false, nil).Once()
+	s.voucherRepo.On("Create", mock.Anything, mock.Anything).Return(true, nil).Once()
+
+	voucher, err := s.service.Issue(context.Background(), s.redemption, s.reward)
+
+	s.Require().NoError(err)
+	s.NotEmpty(voucher.Code)
+	s.voucherRepo.AssertNumberOfCalls(s.T(), "Create", 2)
+}
+
+func (s *VoucherServiceTestSuite) TestIssue_TakesPoolCode() {
+	s.reward.VoucherSource = domain.VoucherSourcePool
+	s.reward.VoucherValidityDays = intPtr(30)
+	expiresAt := time.Now().AddDate(0, 0, 7)
+	s.voucherRepo.On("ClaimCode", mock.Anything, s.reward.ID, s.redemption.ID).
+		Return(&domain.RewardCode{Code: "PARTNER-123", ExpiresAt: &expiresAt}, nil)
+	s.voucherRepo.On("Create", mock.Anything, mock.Anything).Return(true, nil)
+
+	voucher, err := s.service.Issue(context.Background(), s.redemption, s.reward)
+
+	s.Require().NoError(err)
+	s.Equal("PARTNER-123", voucher.Code)
+	s.Equal(domain.VoucherSourcePool, voucher.Source)
+	s.Equal(&expiresAt, voucher.ExpiresAt)
+}
+
+func (s *VoucherServiceTestSuite) TestIssue_EmptyPool() {
+	s.reward.VoucherSource = domain.VoucherSourcePool
+	s.voucherRepo.On("ClaimCode", mock.Anything, s.reward.ID, s.redemption.ID).Return(nil, nil)
+
+	_, err := s.service.Issue(context.Background(), s.redemption, s.reward)
+
+	s.Require().Error(err)
+	s.Equal("REWARD_OUT_OF_STOCK", err.(domain.BusinessLogicError).Code)
+	s.voucherRepo.AssertNotCalled(s.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (s *VoucherServiceTestSuite) TestVerify_FulfillsPendingRedemption() {
+	branchID := uuid.New()
+	s.scanned("ABCD-EFGH-JKLM")
+	s.voucherRepo.On("MarkUsed", mock.Anything, mock.MatchedBy(func(voucher *domain.Voucher) bool {
+		return voucher.UsedBranchID != nil && *voucher.UsedBranchID == branchID
+	})).Return(nil)
+	s.redemptionRepo.On("Update", mock.Anything, s.redemption).Return(nil)
+	s.redemptionRepo.On("RecordStatusChange", mock.Anything, mock.Anything).Return(nil)
+	s.eventLogger.On("SaveRedemptionStatusEvents", mock.Anything, s.redemption, s.reward, domain.RedemptionStatusPending).Return(nil)
+
+	redemption, err := s.service.Verify(context.Background(), &domain.VerifyVoucherRequest{
+		MerchantID: s.merchantID,
+		Code:       " ABCD-EFGH-JKLM ",
+		BranchID:   &branchID,
+		ChangedBy:  "cashier-1",
+	})
+
+	s.Require().NoError(err)
+	s.Equal(domain.RedemptionStatusFulfilled, redemption.Status)
+	s.NotNil(redemption.Voucher)
+	s.eventLogger.AssertExpectations(s.T())
+	s.redemptionRepo.AssertCalled(s.T(), "RecordStatusChange", mock.Anything, mock.MatchedBy(func(change *domain.RedemptionStatusChange) bool {
+		return *change.FromStatus == domain.RedemptionStatusPending && change.ToStatus == domain.RedemptionStatusFulfilled &&
+			change.ChangedBy == "cashier-1"
+	}))
+}
+
+func (s *VoucherServiceTestSuite) TestVerify_FulfillsApprovedRedemption() {
+	s.redemption.Status = domain.RedemptionStatusApproved
+	s.scanned("ABCD-EFGH-JKLM")
+	s.voucherRepo.On("MarkUsed", mock.Anything, mock.Anything).Return(nil)
+	s.redemptionRepo.On("Update", mock.Anything, s.redemption).Return(nil)
+	s.redemptionRepo.On("RecordStatusChange", mock.Anything, mock.Anything).Return(nil)
+	s.eventLogger.On("SaveRedemptionStatusEvents", mock.Anything, s.redemption, s.reward, domain.RedemptionStatusApproved).Return(nil)
+
+	redemption, err := s.service.Verify(context.Background(), &domain.VerifyVoucherRequest{
+		MerchantID: s.merchantID,
+		Code:       "ABCD-EFGH-JKLM",
+	})
+
+	s.Require().NoError(err)
+	s.Equal(domain.RedemptionStatusFulfilled, redemption.Status)
+}
+
+func (s *VoucherServiceTestSuite) TestVerify_RejectsFulfilledRedemption() {
+	s.redemption.Status = domain.RedemptionStatusFulfilled
+	s.scanned("ABCD-EFGH-JKLM")
+
+	_, err := s.service.Verify(context.Background(), &domain.VerifyVoucherRequest{
+		MerchantID: s.merchantID,
+		Code:       "ABCD-EFGH-JKLM",
+	})
+
+	s.Require().Error(err)
+	s.Equal("VOUCHER_ALREADY_USED", err.(domain.BusinessLogicError).Code)
+	s.voucherRepo.AssertNotCalled(s.T(), "MarkUsed", mock.Anything, mock.Anything)
+}
+
+func (s *VoucherServiceTestSuite) TestVerify_RejectsSecondScan() {
+	voucher := s.scanned("ABCD-EFGH-JKLM")
+	voucher.Status = domain.VoucherUsed
+
+	_, err := s.service.Verify(context.Background(), &domain.VerifyVoucherRequest{
+		MerchantID: s.merchantID,
+		Code:       "ABCD-EFGH-JKLM",
+	})
+
+	s.Require().Error(err)
+	s.Equal("VOUCHER_ALREADY_USED", err.(domain.BusinessLogicError).Code)
+	s.voucherRepo.AssertNotCalled(s.T(), "MarkUsed", mock.Anything, mock.Anything)
+}
+
+func (s *VoucherServiceTestSuite) TestVerify_RejectsExpiredVoucher() {
+	voucher := s.scanned("ABCD-EFGH-JKLM")
+	expiresAt := time.Now().Add(-time.Hour)
+	voucher.ExpiresAt = &expiresAt
+
+	_, err := s.service.Verify(context.Background(), &domain.VerifyVoucherRequest{
+		MerchantID: s.merchantID,
+		Code:       "ABCD-EFGH-JKLM",
+	})
+
+	s.Require().Error(err)
+	s.Equal("VOUCHER_EXPIRED", err.(domain.BusinessLogicError).Code)
+}
+
+func (s *VoucherServiceTestSuite) TestVerify_RejectsCancelledRedemption() {
+	s.redemption.Status = domain.RedemptionStatusCancelled
+	s.scanned("ABCD-EFGH-JKLM")
+
+	_, err := s.service.Verify(context.Background(), &domain.VerifyVoucherRequest{
+		MerchantID: s.merchantID,
+		Code:       "ABCD-EFGH-JKLM",
+	})
+
+	s.Require().Error(err)
+	s.Equal("VOUCHER_VOID", err.(domain.BusinessLogicError).Code)
+	s.voucherRepo.AssertNotCalled(s.T(), "MarkUsed", mock.Anything, mock.Anything)
+}
+
+func (s *VoucherServiceTestSuite) TestVerify_UnknownCode() {
+	s.voucherRepo.On("LockByCode", mock.Anything, s.merchantID, "NOPE").Return(nil, nil)
+
+	_, err := s.service.Verify(context.Background(), &domain.VerifyVoucherRequest{
+		MerchantID: s.merchantID,
+		Code:       "NOPE",
+	})
+
+	s.Require().Error(err)
+	s.IsType(domain.ResourceNotFoundError{}, err)
+}
+
+func (s *VoucherServiceTestSuite) TestAddCodes_SkipsDuplicates() {
+	s.reward.VoucherSource = domain.VoucherSourcePool
+	s.voucherRepo.On("AddCodes", mock.Anything, s.reward.ID, []string{"A1", "B2"}, (*time.Time)(nil)).Return(1, nil)
+	s.voucherRepo.On("CountAvailableCodes", mock.Anything, s.reward.ID).Return(4, nil)
+
+	result, err := s.service.AddCodes(context.Background(), s.reward.ID.String(), &domain.AddRewardCodesRequest{
+		Codes: []string{"A1", " A1 ", "B2"},
+	})
+
+	s.Require().NoError(err)
+	s.Equal(1, result.Added)
+	s.Equal(2, result.Duplicates)
+	s.Equal(4, result.Available)
+}
+
+func (s *VoucherServiceTestSuite) TestAddCodes_RejectsGeneratedReward() {
+	_, err := s.service.AddCodes(context.Background(), s.reward.ID.String(), &domain.AddRewardCodesRequest{
+		Codes: []string{"A1"},
+	})
+
+	s.Require().Error(err)
+	s.Equal("REWARD_NOT_POOLED", err.(domain.BusinessLogicError).Code)
+	s.voucherRepo.AssertNotCalled(s.T(), "AddCodes", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
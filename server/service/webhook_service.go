@@ -0,0 +1,448 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go-playground/pkg/logging"
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// maxWebhookAttempts is how many times a delivery is tried before it is dead
+	maxWebhookAttempts = 8
+	// The wait after a failed attempt doubles from minWebhookBackoff, a
+	// delivery is dead roughly an hour after its first attempt
+	minWebhookBackoff = 30 * time.Second
+	maxWebhookBackoff = time.Hour
+	// webhookBatchSize is how many deliveries are claimed and sent at once
+	webhookBatchSize = 50
+	// webhookLease keeps a claimed delivery from being claimed again while it
+	// is being sent, it must outlast WebhookTimeout
+	webhookLease = 2 * time.Minute
+	// WebhookTimeout bounds a single delivery attempt
+	WebhookTimeout = 10 * time.Second
+)
+
+// WebhookService manages merchants' webhook subscriptions and delivers the
+// domain events they subscribed to.
+//
+// Deliveries are queued in the unit of work that writes the event and sent by
+// DeliverDue, so an event committed is never lost and a merchant endpoint that
+// is down never holds up the request that caused the event.
+type WebhookService struct {
+	webhookRepo          domain.WebhookRepository
+	merchantRepo         domain.MerchantRepository
+	merchantCustomerRepo domain.MerchantCustomersRepository
+	client               *http.Client
+	logger               zerolog.Logger
+}
+
+func NewWebhookService(
+	webhookRepo domain.WebhookRepository,
+	merchantRepo domain.MerchantRepository,
+	merchantCustomerRepo domain.MerchantCustomersRepository,
+	client *http.Client,
+) *WebhookService {
+	return &WebhookService{
+		webhookRepo:          webhookRepo,
+		merchantRepo:         merchantRepo,
+		merchantCustomerRepo: merchantCustomerRepo,
+		client:               client,
+		logger:               logging.GetLogger(),
+	}
+}
+
+func (s *WebhookService) CreateSubscription(ctx context.Context, req *domain.CreateWebhookSubscriptionRequest) (*domain.WebhookSubscription, error) {
+	endpoint, err := url.Parse(req.URL)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Hostname() == "" {
+		s.logger.Error().
+			Str("url", req.URL).
+			Msg("Invalid webhook URL")
+		return nil, domain.NewValidationError("url", "url must be an absolute https URL")
+	}
+	if !isPublicWebhookHost(endpoint.Hostname()) {
+		s.logger.Error().
+			Str("url", req.URL).
+			Msg("Webhook URL points to a private address")
+		return nil, domain.NewValidationError("url", "url must not point to a private or loopback address")
+	}
+	for _, eventType := range req.EventTypes {
+		if !slices.Contains(domain.WebhookEventTypes, eventType) {
+			s.logger.Error().
+				Str("event_type", eventType).
+				Msg("Unknown webhook event type")
+			return nil, domain.NewValidationError("event_types", fmt.Sprintf("event_types must be among %v", domain.WebhookEventTypes))
+		}
+	}
+
+	if _, err := s.merchantRepo.GetByID(ctx, req.MerchantID); err != nil {
+		s.logger.Error().
+			Err(err).
+			Msg("Error getting merchant")
+		return nil, err // Repository layer will return appropriate error types
+	}
+
+	subscription := &domain.WebhookSubscription{
+		MerchantID: req.MerchantID,
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     req.Secret,
+		IsActive:   true,
+	}
+	if err := s.webhookRepo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("subscription_id", subscription.ID.String()).
+		Str("merchant_id", subscription.MerchantID.String()).
+		Strs("event_types", subscription.EventTypes).
+		Msg("Webhook subscription created")
+	return subscription, nil
+}
+
+func (s *WebhookService) GetSubscriptionsByMerchantID(ctx context.Context, merchantID string) ([]*domain.WebhookSubscription, error) {
+	id, err := uuid.Parse(merchantID)
+	if err != nil {
+		return nil, domain.NewValidationError("merchant_id", "invalid merchant ID format")
+	}
+	return s.webhookRepo.GetSubscriptionsByMerchantID(ctx, id)
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, subscriptionID string) error {
+	id, err := uuid.Parse(subscriptionID)
+	if err != nil {
+		return domain.NewValidationError("id", "invalid webhook subscription ID format")
+	}
+	return s.webhookRepo.DeleteSubscription(ctx, id)
+}
+
+// GetDeliveries returns a page of a subscription's delivery log. The dead
+// letter list is the deliveries with status dead.
+func (s *WebhookService) GetDeliveries(ctx context.Context, subscriptionID, status string, page, limit int) ([]*domain.WebhookDelivery, int64, error) {
+	id, err := uuid.Parse(subscriptionID)
+	if err != nil {
+		return nil, 0, domain.NewValidationError("id", "invalid webhook subscription ID format")
+	}
+	switch status {
+	case "", domain.WebhookDeliveryPending, domain.WebhookDeliveryDelivered, domain.WebhookDeliveryDead:
+	default:
+		return nil, 0, domain.NewValidationError("status", "status must be one of pending, delivered, dead")
+	}
+
+	subscription, err := s.webhookRepo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if subscription == nil {
+		return nil, 0, domain.NewResourceNotFoundError("webhook subscription", subscriptionID, "webhook subscription not found")
+	}
+
+	return s.webhookRepo.GetDeliveries(ctx, id, status, (page-1)*limit, limit)
+}
+
+// ReplayDelivery queues a past delivery to be sent again, with a fresh set of
+// attempts. The original delivery is left as it was in the log.
+func (s *WebhookService) ReplayDelivery(ctx context.Context, deliveryID string) (*domain.WebhookDelivery, error) {
+	id, err := uuid.Parse(deliveryID)
+	if err != nil {
+		return nil, domain.NewValidationError("id", "invalid webhook delivery ID format")
+	}
+
+	original, err := s.webhookRepo.GetDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return nil, domain.NewResourceNotFoundError("webhook delivery", deliveryID, "webhook delivery not found")
+	}
+
+	replay := &domain.WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         domain.WebhookDeliveryPending,
+		ReplayOf:       &original.ID,
+	}
+	if _, err := s.webhookRepo.CreateDelivery(ctx, replay); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("delivery_id", replay.ID.String()).
+		Str("replay_of", original.ID.String()).
+		Msg("Webhook delivery replay queued")
+	return replay, nil
+}
+
+// Enqueue queues a delivery of the event for each of the merchant's active
+// subscriptions to its type, in the unit of work running in ctx. Events no
+// webhook can subscribe to are skipped. An event queued before is not queued
+// again.
+func (s *WebhookService) Enqueue(ctx context.Context, eventType string, event domain.DomainEvent) error {
+	if !slices.Contains(domain.WebhookEventTypes, eventType) {
+		return nil
+	}
+
+	customer, err := s.merchantCustomerRepo.GetByID(ctx, event.CustomerID)
+	if err != nil {
+		return domain.NewSystemError("WebhookService.Enqueue", err, "failed to get merchant customer")
+	}
+	if customer == nil {
+		s.logger.Warn().
+			Str("customer_id", event.CustomerID.String()).
+			Msg("Skipping webhooks of an unknown customer")
+		return nil
+	}
+
+	subscriptions, err := s.webhookRepo.GetActiveSubscriptions(ctx, customer.MerchantID, eventType)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(&domain.WebhookEvent{
+		EventID:    event.EventID,
+		EventType:  eventType,
+		MerchantID: customer.MerchantID,
+		CustomerID: event.CustomerID,
+		ProgramID:  event.ProgramID,
+		OccurredAt: event.OccurredAt,
+		Data:       event.Data,
+	})
+	if err != nil {
+		return domain.NewSystemError("WebhookService.Enqueue", err, "failed to marshal webhook event")
+	}
+
+	for _, subscription := range subscriptions {
+		_, err := s.webhookRepo.CreateDelivery(ctx, &domain.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.EventID,
+			EventType:      eventType,
+			Payload:        payload,
+			Status:         domain.WebhookDeliveryPending,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeliverDue sends the deliveries that are due, in batches, until none are
+// left. The deliveries of a batch are sent concurrently.
+//
+// Delivery is at least once: an endpoint that received a delivery but did not
+// answer in time gets it again, receivers dedupe on the event ID.
+func (s *WebhookService) DeliverDue(ctx context.Context) (*domain.WebhookDeliveryRun, error) {
+	run := &domain.WebhookDeliveryRun{}
+	for {
+		dispatches, err := s.webhookRepo.ClaimDueDeliveries(ctx, webhookBatchSize, webhookLease)
+		if err != nil {
+			return run, err
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, dispatch := range dispatches {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				status := s.attempt(ctx, dispatch)
+
+				mu.Lock()
+				defer mu.Unlock()
+				switch status {
+				case domain.WebhookDeliveryDelivered:
+					run.Delivered++
+				case domain.WebhookDeliveryDead:
+					run.Dead++
+				default:
+					run.Retrying++
+				}
+			}()
+		}
+		wg.Wait()
+
+		if len(dispatches) < webhookBatchSize {
+			return run, nil
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome. It returns the
+// delivery's new status.
+func (s *WebhookService) attempt(ctx context.Context, dispatch *domain.WebhookDispatch) string {
+	delivery := dispatch.Delivery
+	statusCode, err := s.send(ctx, dispatch)
+
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	switch {
+	case err == nil:
+		delivery.Status = domain.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = nil
+	case delivery.Attempts >= maxWebhookAttempts:
+		reason := err.Error()
+		delivery.Status = domain.WebhookDeliveryDead
+		delivery.LastError = &reason
+	default:
+		reason := err.Error()
+		delivery.LastError = &reason
+		delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+	}
+
+	if err != nil {
+		s.logger.Warn().
+			Err(err).
+			Str("delivery_id", delivery.ID.String()).
+			Str("status", delivery.Status).
+			Int("attempts", delivery.Attempts).
+			Msg("Webhook delivery failed")
+	}
+
+	// A lost update leaves the delivery pending, it is sent again once its
+	// lease runs out
+	if err := s.webhookRepo.UpdateDelivery(ctx, delivery); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("delivery_id", delivery.ID.String()).
+			Msg("Failed to record webhook delivery attempt")
+	}
+	return delivery.Status
+}
+
+// send posts a delivery to its endpoint. Any 2xx response is a success.
+func (s *WebhookService) send(ctx context.Context, dispatch *domain.WebhookDispatch) (*int, error) {
+	delivery := dispatch.Delivery
+	ctx, cancel := context.WithTimeout(ctx, WebhookTimeout)
+	defer cancel()
+
+	endpoint, err := url.Parse(dispatch.URL)
+	if err != nil {
+		return nil, err
+	}
+	// Subscriptions made before https was required are not sent to
+	if endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("endpoint %s is not https", endpoint.Redacted())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(domain.WebhookEventHeader, delivery.EventType)
+	req.Header.Set(domain.WebhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(domain.WebhookTimestampHeader, timestamp)
+	req.Header.Set(domain.WebhookSignatureHeader, SignWebhook(dispatch.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	statusCode := resp.StatusCode
+	if statusCode < 200 || statusCode > 299 {
+		return &statusCode, fmt.Errorf("endpoint responded with status %d", statusCode)
+	}
+	return &statusCode, nil
+}
+
+// NewWebhookClient returns the HTTP client webhooks are sent with. It only
+// connects to public addresses, the check is made on the address dialed so a
+// host name that resolves to a private address is refused too.
+func NewWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: WebhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("webhook endpoint address %s is not public", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the dialed address the proxy's
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport, Timeout: WebhookTimeout}
+}
+
+// isPublicWebhookHost reports whether a subscription URL's host can be
+// accepted. Host names are resolved when a delivery is sent, see
+// NewWebhookClient.
+func isPublicWebhookHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return isPublicIP(ip)
+	}
+	return true
+}
+
+// isPublicIP reports whether an address is reachable on the internet, rather
+// than one of our own hosts or networks.
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// SignWebhook returns the signature header value of a webhook body, the hex
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the subscription's secret.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff is the wait before the next attempt, after the given number
+// of failed attempts.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := minWebhookBackoff
+	for i := 1; i < attempts && backoff < maxWebhookBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxWebhookBackoff)
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-playground/server/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *mockWebhookRepository) CreateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+func (m *mockWebhookRepository) GetSubscription(ctx context.Context, id uuid.UUID) (*domain.WebhookSubscription, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.WebhookSubscription), args.Error(1)
+}
+
+func (m *mockWebhookRepository) GetSubscriptionsByMerchantID(ctx context.Context, merchantID uuid.UUID) ([]*domain.WebhookSubscription, error) {
+	args := m.Called(ctx, merchantID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.WebhookSubscription), args.Error(1)
+}
+
+func (m *mockWebhookRepository) GetActiveSubscriptions(ctx context.Context, merchantID uuid.UUID, eventType string) ([]*domain.WebhookSubscription, error) {
+	args := m.Called(ctx, merchantID, eventType)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.WebhookSubscription), args.Error(1)
+}
+
+func (m *mockWebhookRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockWebhookRepository) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (bool, error) {
+	args := m.Called(ctx, delivery)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockWebhookRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.WebhookDelivery), args.Error(1)
+}
+
+func (m *mockWebhookRepository) GetDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, offset, limit int) ([]*domain.WebhookDelivery, int64, error) {
+	args := m.Called(ctx, subscriptionID, status, offset, limit)
+	return args.Get(0).([]*domain.WebhookDelivery), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockWebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDispatch, error) {
+	args := m.Called(ctx, limit, lease)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.WebhookDispatch), args.Error(1)
+}
+
+func (m *mockWebhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func webhookDispatch(url string, attempts int) *domain.WebhookDispatch {
+	return &domain.WebhookDispatch{
+		Delivery: &domain.WebhookDelivery{
+			ID:             uuid.New(),
+			SubscriptionID: uuid.New(),
+			EventID:        uuid.New(),
+			EventType:      "points.earned",
+			Payload:        json.RawMessage(`{"event_type":"points.earned"}`),
+			Status:         domain.WebhookDeliveryPending,
+			Attempts:       attempts,
+		},
+		URL:    url,
+		Secret: "merchant-secret-0123",
+	}
+}
+
+func TestWebhookService_DeliverDue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("signs and delivers", func(t *testing.T) {
+		dispatch := webhookDispatch("", 0)
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			timestamp := r.Header.Get(domain.WebhookTimestampHeader)
+			assert.Equal(t, SignWebhook(dispatch.Secret, timestamp, body), r.Header.Get(domain.WebhookSignatureHeader))
+			assert.Equal(t, "points.earned", r.Header.Get(domain.WebhookEventHeader))
+			assert.Equal(t, dispatch.Delivery.ID.String(), r.Header.Get(domain.WebhookDeliveryHeader))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		dispatch.URL = server.URL
+
+		repo := new(mockWebhookRepository)
+		svc := NewWebhookService(repo, nil, nil, server.Client())
+		repo.On("ClaimDueDeliveries", ctx, webhookBatchSize, webhookLease).Return([]*domain.WebhookDispatch{dispatch}, nil)
+		repo.On("UpdateDelivery", ctx, mock.MatchedBy(func(d *domain.WebhookDelivery) bool {
+			return d.Status == domain.WebhookDeliveryDelivered &&
+				d.Attempts == 1 &&
+				*d.LastStatusCode == http.StatusNoContent &&
+				d.DeliveredAt != nil
+		})).Return(nil)
+
+		run, err := svc.DeliverDue(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &domain.WebhookDeliveryRun{Delivered: 1}, run)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("failures back off, then go to the dead letters", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		retrying := webhookDispatch(server.URL, 2)
+		dying := webhookDispatch(server.URL, maxWebhookAttempts-1)
+
+		repo := new(mockWebhookRepository)
+		svc := NewWebhookService(repo, nil, nil, server.Client())
+		repo.On("ClaimDueDeliveries", ctx, webhookBatchSize, webhookLease).Return([]*domain.WebhookDispatch{retrying, dying}, nil)
+		repo.On("UpdateDelivery", ctx, mock.Anything).Return(nil)
+
+		before := time.Now()
+		run, err := svc.DeliverDue(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &domain.WebhookDeliveryRun{Retrying: 1, Dead: 1}, run)
+
+		assert.Equal(t, domain.WebhookDeliveryPending, retrying.Delivery.Status)
+		assert.Equal(t, 3, retrying.Delivery.Attempts)
+		assert.WithinDuration(t, before.Add(4*minWebhookBackoff), retrying.Delivery.NextAttemptAt, time.Second)
+		assert.Equal(t, "endpoint responded with status 503", *retrying.Delivery.LastError)
+
+		assert.Equal(t, domain.WebhookDeliveryDead, dying.Delivery.Status)
+		assert.Equal(t, maxWebhookAttempts, dying.Delivery.Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, *dying.Delivery.LastStatusCode)
+	})
+
+	t.Run("unreachable endpoint is retried", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		dispatch := webhookDispatch(server.URL, 0)
+		server.Close()
+
+		repo := new(mockWebhookRepository)
+		svc := NewWebhookService(repo, nil, nil, http.DefaultClient)
+		repo.On("ClaimDueDeliveries", ctx, webhookBatchSize, webhookLease).Return([]*domain.WebhookDispatch{dispatch}, nil)
+		repo.On("UpdateDelivery", ctx, mock.Anything).Return(nil)
+
+		run, err := svc.DeliverDue(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &domain.WebhookDeliveryRun{Retrying: 1}, run)
+		assert.Nil(t, dispatch.Delivery.LastStatusCode)
+		assert.NotNil(t, dispatch.Delivery.LastError)
+	})
+
+	t.Run("plain http endpoint is not sent to", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("http endpoint was sent a delivery")
+		}))
+		defer server.Close()
+		dispatch := webhookDispatch(server.URL, 0)
+
+		repo := new(mockWebhookRepository)
+		svc := NewWebhookService(repo, nil, nil, server.Client())
+		repo.On("ClaimDueDeliveries", ctx, webhookBatchSize, webhookLease).Return([]*domain.WebhookDispatch{dispatch}, nil)
+		repo.On("UpdateDelivery", ctx, mock.Anything).Return(nil)
+
+		run, err := svc.DeliverDue(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &domain.WebhookDeliveryRun{Retrying: 1}, run)
+		assert.Contains(t, *dispatch.Delivery.LastError, "is not https")
+	})
+
+	t.Run("webhook client refuses private addresses", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("loopback endpoint was sent a delivery")
+		}))
+		defer server.Close()
+		dispatch := webhookDispatch(server.URL, 0)
+
+		repo := new(mockWebhookRepository)
+		svc := NewWebhookService(repo, nil, nil, NewWebhookClient())
+		repo.On("ClaimDueDeliveries", ctx, webhookBatchSize, webhookLease).Return([]*domain.WebhookDispatch{dispatch}, nil)
+		repo.On("UpdateDelivery", ctx, mock.Anything).Return(nil)
+
+		run, err := svc.DeliverDue(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, &domain.WebhookDeliveryRun{Retrying: 1}, run)
+		assert.Contains(t, *dispatch.Delivery.LastError, "is not public")
+	})
+}
+
+func TestWebhookService_Enqueue(t *testing.T) {
+	ctx := context.Background()
+	merchantID := uuid.New()
+	customerID := uuid.New()
+	event := domain.DomainEvent{
+		EventID:    uuid.New(),
+		EventType:  domain.PointsEarned,
+		CustomerID: customerID,
+		ProgramID:  uuid.New(),
+		OccurredAt: time.Now().UTC(),
+		Data:       map[string]interface{}{"points_earned": 150},
+	}
+
+	repo := new(mockWebhookRepository)
+	customerRepo := new(mockMerchantCustomersRepository)
+	svc := NewWebhookService(repo, nil, customerRepo, http.DefaultClient)
+	customerRepo.On("GetByID", ctx, customerID).Return(&domain.MerchantCustomer{ID: customerID, MerchantID: merchantID}, nil)
+	subscriptions := []*domain.WebhookSubscription{{ID: uuid.New()}, {ID: uuid.New()}}
+	repo.On("GetActiveSubscriptions", ctx, merchantID, "points.earned").Return(subscriptions, nil)
+	repo.On("CreateDelivery", ctx, mock.Anything).Return(true, nil)
+
+	err := svc.Enqueue(ctx, "points.earned", event)
+
+	require.NoError(t, err)
+	repo.AssertNumberOfCalls(t, "CreateDelivery", 2)
+	delivery := repo.Calls[1].Arguments.Get(1).(*domain.WebhookDelivery)
+	assert.Equal(t, subscriptions[0].ID, delivery.SubscriptionID)
+	assert.Equal(t, event.EventID, delivery.EventID)
+	assert.Equal(t, domain.WebhookDeliveryPending, delivery.Status)
+
+	var body domain.WebhookEvent
+	require.NoError(t, json.Unmarshal(delivery.Payload, &body))
+	assert.Equal(t, "points.earned", body.EventType)
+	assert.Equal(t, merchantID, body.MerchantID)
+	assert.EqualValues(t, 150, body.Data["points_earned"])
+}
+
+func TestWebhookService_Enqueue_SkipsOtherEvents(t *testing.T) {
+	svc := NewWebhookService(new(mockWebhookRepository), nil, new(mockMerchantCustomersRepository), http.DefaultClient)
+
+	err := svc.Enqueue(context.Background(), "transaction.created", domain.DomainEvent{EventID: uuid.New(), CustomerID: uuid.New()})
+
+	assert.NoError(t, err)
+}
+
+func TestWebhookService_ReplayDelivery(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("queues a copy of the delivery", func(t *testing.T) {
+		repo := new(mockWebhookRepository)
+		svc := NewWebhookService(repo, nil, nil, http.DefaultClient)
+		original := webhookDispatch("", maxWebhookAttempts).Delivery
+		original.Status = domain.WebhookDeliveryDead
+		repo.On("GetDelivery", ctx, original.ID).Return(original, nil)
+		repo.On("CreateDelivery", ctx, mock.Anything).Return(true, nil)
+
+		replay, err := svc.ReplayDelivery(ctx, original.ID.String())
+
+		require.NoError(t, err)
+		assert.Equal(t, original.ID, *replay.ReplayOf)
+		assert.Equal(t, original.EventID, replay.EventID)
+		assert.Equal(t, original.Payload, replay.Payload)
+		assert.Equal(t, domain.WebhookDeliveryPending, replay.Status)
+		assert.Zero(t, replay.Attempts)
+	})
+
+	t.Run("unknown delivery", func(t *testing.T) {
+		repo := new(mockWebhookRepository)
+		svc := NewWebhookService(repo, nil, nil, http.DefaultClient)
+		id := uuid.New()
+		repo.On("GetDelivery", ctx, id).Return(nil, nil)
+
+		replay, err := svc.ReplayDelivery(ctx, id.String())
+
+		assert.Nil(t, replay)
+		assert.True(t, domain.IsResourceNotFoundError(err))
+	})
+}
+
+func TestWebhookService_CreateSubscription_Validation(t *testing.T) {
+	svc := NewWebhookService(new(mockWebhookRepository), nil, nil, http.DefaultClient)
+
+	tests := []struct {
+		name  string
+		req   domain.CreateWebhookSubscriptionRequest
+		field string
+	}{
+		{"non http url", domain.CreateWebhookSubscriptionRequest{URL: "ftp://example.com/hook", EventTypes: []string{"points.earned"}}, "url"},
+		{"plain http url", domain.CreateWebhookSubscriptionRequest{URL: "http://example.com/hook", EventTypes: []string{"points.earned"}}, "url"},
+		{"localhost", domain.CreateWebhookSubscriptionRequest{URL: "https://localhost:8080/hook", EventTypes: []string{"points.earned"}}, "url"},
+		{"loopback address", domain.CreateWebhookSubscriptionRequest{URL: "https://127.0.0.1/hook", EventTypes: []string{"points.earned"}}, "url"},
+		{"private address", domain.CreateWebhookSubscriptionRequest{URL: "https://10.0.0.12/hook", EventTypes: []string{"points.earned"}}, "url"},
+		{"link local address", domain.CreateWebhookSubscriptionRequest{URL: "https://169.254.169.254/latest/meta-data", EventTypes: []string{"points.earned"}}, "url"},
+		{"ipv6 loopback", domain.CreateWebhookSubscriptionRequest{URL: "https://[::1]/hook", EventTypes: []string{"points.earned"}}, "url"},
+		{"unknown event type", domain.CreateWebhookSubscriptionRequest{URL: "https://example.com/hook", EventTypes: []string{"user.created"}}, "event_types"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			subscription, err := svc.CreateSubscription(context.Background(), &tc.req)
+
+			assert.Nil(t, subscription)
+			assert.True(t, domain.IsValidationError(err))
+			assert.Equal(t, tc.field, err.(domain.ValidationError).Field)
+		})
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, minWebhookBackoff, webhookBackoff(1))
+	assert.Equal(t, 2*minWebhookBackoff, webhookBackoff(2))
+	assert.Equal(t, maxWebhookBackoff, webhookBackoff(20))
+}